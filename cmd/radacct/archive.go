@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/kal997/radius-accounting-server/internal/archive"
+	"github.com/kal997/radius-accounting-server/internal/config"
+	"github.com/kal997/radius-accounting-server/internal/notifier"
+	"github.com/kal997/radius-accounting-server/internal/storage"
+)
+
+const archiveArgs = "-dir directory [-interval duration] [-window duration]"
+
+// runArchive saves every record to hourly archive files before it expires
+// from Redis, until interrupted. Records are archived as they are stored,
+// following keyspace notifications, and a periodic sweep archives the
+// records close to expiry that were missed, e.g. while the archiver was down.
+func runArchive(ctx context.Context, app *app, args []string) error {
+	fs := flag.NewFlagSet("radacct archive", flag.ExitOnError)
+	dir := fs.String("dir", "", "archive directory")
+	interval := fs.Duration("interval", 5*time.Minute, "time between sweeps for records close to expiry")
+	window := fs.Duration("window", 30*time.Minute, "sweep records that expire within this duration; must exceed -interval")
+	_ = fs.Parse(args)
+
+	if fs.NArg() != 0 || *dir == "" {
+		return fmt.Errorf("usage: radacct archive %s", archiveArgs)
+	}
+	if *interval <= 0 || *window <= *interval {
+		return fmt.Errorf("window (%s) must exceed a positive interval (%s)", *window, *interval)
+	}
+	if !app.cfg.GetStorage().Uses(config.StorageBackendRedis) {
+		return fmt.Errorf("archive follows Redis notifications, but %s storage does not use Redis", app.cfg.GetStorage().GetBackend())
+	}
+
+	querier, err := app.querier()
+	if err != nil {
+		return err
+	}
+	tracker, err := app.archiveTracker()
+	if err != nil {
+		return err
+	}
+	archiver, err := archive.New(tracker, *dir)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := archiver.Close(context.Background()); err != nil {
+			fmt.Fprintf(os.Stderr, "radacct: failed to seal archive: %v\n", err)
+		}
+	}()
+
+	// Default notifier settings: keyspace channels, no CONFIG SET
+	events, err := notifier.NewRedisNotifierFromConfig(app.cfg.GetRedis(), &config.NotifierConfig{})
+	if err != nil {
+		return fmt.Errorf("failed to initialize notifier: %w", err)
+	}
+	defer events.Close()
+
+	if err := events.EnsureNotifications(ctx); err != nil {
+		if errors.Is(err, notifier.ErrNotificationsDisabled) {
+			return fmt.Errorf("%w (start Redis with --notify-keyspace-events KEA)", err)
+		}
+		fmt.Fprintf(os.Stderr, "radacct: could not verify keyspace notifications: %v\n", err)
+	}
+
+	updates, err := events.Subscribe(ctx, []string{"radius:acct:*"})
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to notifications: %w", err)
+	}
+
+	sweep := func() error {
+		n, err := archiver.Sweep(ctx, *window)
+		if n > 0 {
+			fmt.Fprintf(os.Stderr, "radacct: archived %d records close to expiry\n", n)
+		}
+		return err
+	}
+	if err := sweep(); err != nil {
+		return err
+	}
+
+	sweeps := time.NewTicker(*interval)
+	defer sweeps.Stop()
+	rotations := time.NewTicker(time.Minute)
+	defer rotations.Stop()
+
+	fmt.Fprintf(os.Stderr, "radacct: archiving records to %s\n", *dir)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-sweeps.C:
+			if err := sweep(); err != nil {
+				return err
+			}
+		case <-rotations.C:
+			manifest, err := archiver.Rotate(ctx)
+			if err != nil {
+				return err
+			}
+			if manifest != nil {
+				fmt.Fprintf(os.Stderr, "radacct: sealed %s (%d records)\n", manifest.File, manifest.Records)
+			}
+		case event, ok := <-updates:
+			if !ok {
+				return nil
+			}
+			if err := archiveEvent(ctx, archiver, querier, event); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// archiveEvent archives a stored record, and reports records that expired
+// without being archived
+func archiveEvent(ctx context.Context, archiver *archive.Archiver, querier storage.Querier, event notifier.StorageEvent) error {
+	switch event.Operation {
+	case notifier.OperationGap:
+		fmt.Fprintln(os.Stderr, "radacct: reconnected to Redis, missed records are archived by the sweep")
+	case "set":
+		record, err := querier.Record(ctx, event.Key)
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return archiver.Add(ctx, event.Key, record)
+	case "expired":
+		lost, err := archiver.Lost(ctx, event.Key)
+		if err != nil {
+			return err
+		}
+		if lost {
+			fmt.Fprintf(os.Stderr, "radacct: record %s expired before it was archived\n", event.Key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/kal997/radius-accounting-server/internal/export"
+	"github.com/kal997/radius-accounting-server/internal/storage"
+)
+
+const exportArgs = "(-from time [-to time] | -period day|month) [-format jsonl|csv|parquet] [-gzip] [-user name] [-ip address] [-mac address] [-nas address] [-session id] [-o file | -dir directory]"
+
+// runExport writes every record of a time range matching the filters to a
+// file, oldest first. With -period and -dir it is meant to run as a
+// scheduled job that exports the previous day or month.
+func runExport(ctx context.Context, app *app, args []string) error {
+	fs := flag.NewFlagSet("radacct export", flag.ExitOnError)
+	from := fs.String("from", "", "earliest event time, RFC 3339 or \"2006-01-02 15:04:05\" in UTC")
+	to := fs.String("to", "", "event time to stop before (default now)")
+	period := fs.String("period", "", "export the previous complete UTC day or month instead of -from/-to")
+	format := fs.String("format", string(export.FormatJSONL), "output format: jsonl, csv or parquet")
+	gzip := fs.Bool("gzip", false, "gzip the output; Parquet compresses its columns instead")
+	user := fs.String("user", "", "User-Name")
+	ip := fs.String("ip", "", "Framed-IP-Address; matches Start records only")
+	mac := fs.String("mac", "", "Calling-Station-Id, a MAC address in any notation")
+	nas := fs.String("nas", "", "NAS-IP-Address")
+	session := fs.String("session", "", "Acct-Session-Id")
+	output := fs.String("o", "", "output file (default standard output)")
+	dir := fs.String("dir", "", "output directory; the file is named after the time range")
+	_ = fs.Parse(args)
+
+	if fs.NArg() != 0 || (*from == "") == (*period == "") || (*period != "" && *to != "") || (*output != "" && *dir != "") {
+		return fmt.Errorf("usage: radacct export %s", exportArgs)
+	}
+
+	opts := export.Options{Gzip: *gzip}
+	var err error
+	if opts.Format, err = export.ParseFormat(*format); err != nil {
+		return err
+	}
+
+	q := storage.Query{
+		Username:         *user,
+		AcctSessionID:    *session,
+		NASIPAddress:     *nas,
+		FramedIPAddress:  *ip,
+		CallingStationID: *mac,
+	}
+	if *period != "" {
+		q.From, q.To, err = export.Period(*period, time.Now())
+	} else {
+		q.From, q.To, err = parseRange(*from, *to)
+	}
+	if err != nil {
+		return err
+	}
+	if q.To.IsZero() {
+		q.To = time.Now()
+	}
+
+	querier, err := app.querier()
+	if err != nil {
+		return err
+	}
+
+	path := *output
+	if *dir != "" {
+		path = filepath.Join(*dir, export.FileName(q.From, q.To, opts))
+	}
+	if path == "" {
+		_, err = exportTo(ctx, querier, q, opts, os.Stdout)
+		return err
+	}
+
+	// Write to a temporary file first so that a failed or interrupted run
+	// never leaves a truncated export under the final name
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to create export file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	n, err := exportTo(ctx, querier, q, opts, tmp)
+	if closeErr := tmp.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("failed to write export file: %w", closeErr)
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write export file: %w", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "Exported %d records to %s\n", n, path)
+	return nil
+}
+
+// exportTo streams the records matching q to out and returns their number
+func exportTo(ctx context.Context, querier storage.Querier, q storage.Query, opts export.Options, out io.Writer) (int, error) {
+	buf := bufio.NewWriter(out)
+	w, err := export.NewWriter(buf, opts)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := export.Run(ctx, querier, q, w)
+	if err == nil {
+		err = w.Close()
+	}
+	if err == nil {
+		err = buf.Flush()
+	}
+	return n, err
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/kal997/radius-accounting-server/internal/detail"
+	"github.com/kal997/radius-accounting-server/internal/storage"
+)
+
+const importArgs = "[-dry-run] detail-file..."
+
+// runImport stores the records of FreeRADIUS detail files, e.g. to migrate
+// accounting history from FreeRADIUS. Records that fail validation, like
+// those the server would reject, are reported and skipped.
+func runImport(ctx context.Context, app *app, args []string) error {
+	fs := flag.NewFlagSet("radacct import", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "read and validate the files without storing the records")
+	_ = fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		return fmt.Errorf("usage: radacct import %s", importArgs)
+	}
+
+	var store storage.Storage
+	if !*dryRun {
+		var err error
+		if store, err = app.storage(); err != nil {
+			return err
+		}
+	}
+
+	var imported, invalid, skipped int
+	for _, path := range fs.Args() {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+
+		reader := detail.NewReader(file)
+		for {
+			record, err := reader.Next()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				_ = file.Close()
+				return fmt.Errorf("%s: %w", path, err)
+			}
+			if err := record.Validate(); err != nil {
+				fmt.Fprintf(os.Stderr, "radacct: %s: skipping %s: %v\n", path, record.GenerateRedisKey(), err)
+				invalid++
+				continue
+			}
+			if store != nil {
+				if err := store.Store(ctx, record); err != nil {
+					_ = file.Close()
+					return fmt.Errorf("failed to store %s: %w", record.GenerateRedisKey(), err)
+				}
+			}
+			imported++
+		}
+		skipped += reader.Skipped
+		_ = file.Close()
+	}
+
+	verb := "Imported"
+	if *dryRun {
+		verb = "Would import"
+	}
+	fmt.Fprintf(os.Stderr, "%s %d records from %d files (%d invalid, %d other entries skipped)\n", verb, imported, fs.NArg(), invalid, skipped)
+	return nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/kal997/radius-accounting-server/internal/storage"
+)
+
+const ipArgs = "[-at time] [-json] <address|prefix>"
+
+// runIP answers "who had this address at that time" from the IP assignment
+// timeline
+func runIP(ctx context.Context, app *app, args []string) error {
+	fs := flag.NewFlagSet("radacct ip", flag.ExitOnError)
+	at := fs.String("at", "", "point in time, RFC 3339 or \"2006-01-02 15:04:05\" in UTC (default now)")
+	asJSON := fs.Bool("json", false, "print the assignments as JSON")
+	_ = fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: radacct ip %s", ipArgs)
+	}
+
+	prefix, err := storage.ParseIPPrefix(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	when := time.Now()
+	if *at != "" {
+		if when, err = parseTime(*at); err != nil {
+			return err
+		}
+	}
+
+	store, err := app.storage()
+	if err != nil {
+		return err
+	}
+	attributor, ok := store.(storage.IPAttributor)
+	if !ok {
+		return fmt.Errorf("%s storage does not keep an IP assignment timeline", app.cfg.GetStorage().GetBackend())
+	}
+
+	assignments, err := attributor.LookupIP(ctx, prefix, when)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if assignments == nil {
+			assignments = []storage.IPAssignment{}
+		}
+		return enc.Encode(assignments)
+	}
+
+	if len(assignments) == 0 {
+		fmt.Printf("No session held %s at %s\n", prefix, when.UTC().Format(time.RFC3339))
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "IP\tUSERNAME\tSESSION\tNAS\tSTART\tSTOP")
+	for _, a := range assignments {
+		stop := "open"
+		if a.Stop != nil {
+			stop = a.Stop.UTC().Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			a.IP, a.Username, a.AcctSessionID, a.NASIPAddress, a.Start.UTC().Format(time.RFC3339), stop)
+	}
+	return w.Flush()
+}
+
+// parseTime accepts RFC 3339 times and "2006-01-02 15:04:05" in UTC
+func parseTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.DateTime, value); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q, expected RFC 3339 or \"2006-01-02 15:04:05\"", value)
+}
@@ -0,0 +1,205 @@
+// radacct inspects the accounting data stored by radius-controlplane. It
+// reads the same configuration file and environment as the services.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+
+	"github.com/joho/godotenv"
+	"github.com/kal997/radius-accounting-server/internal/config"
+	"github.com/kal997/radius-accounting-server/internal/storage"
+)
+
+// command is a radacct subcommand
+type command struct {
+	args    string // Argument synopsis for the usage message
+	summary string
+	run     func(ctx context.Context, app *app, args []string) error
+}
+
+var commands = map[string]command{
+	"archive": {
+		args:    archiveArgs,
+		summary: "Save records to hourly archive files before they expire (Redis only)",
+		run:     runArchive,
+	},
+	"export": {
+		args:    exportArgs,
+		summary: "Write the records of a time range to a JSON lines, CSV or Parquet file",
+		run:     runExport,
+	},
+	"import": {
+		args:    importArgs,
+		summary: "Store the records of FreeRADIUS detail files",
+		run:     runImport,
+	},
+	"ip": {
+		args:    ipArgs,
+		summary: "Show which sessions held an IPv4 or IPv6 address or prefix at a point in time",
+		run:     runIP,
+	},
+	"replay": {
+		args:    replayArgs,
+		summary: "Store lost records again from archives, exports, detail files or packet captures",
+		run:     runReplay,
+	},
+	"restore": {
+		args:    restoreArgs,
+		summary: "Verify archive files and store their records again",
+		run:     runRestore,
+	},
+	"search": {
+		args:    searchArgs,
+		summary: "Find records by user, IP, MAC address, NAS, session or time",
+		run:     runSearch,
+	},
+	"session": {
+		args:    sessionArgs,
+		summary: "Show a session and the timeline of its records",
+		run:     runSession,
+	},
+	"sessions": {
+		args:    sessionsArgs,
+		summary: "List active sessions, or every session of a user or NAS",
+		run:     runSessions,
+	},
+	"stats": {
+		args:    statsArgs,
+		summary: "Show per-NAS counters and server statistics",
+		run:     runStats,
+	},
+	"tail": {
+		args:    tailArgs,
+		summary: "Print new records as they are stored (Redis only)",
+		run:     runTail,
+	},
+}
+
+// app is shared by the subcommands
+type app struct {
+	cfg   *config.ControlplaneConfig
+	store storage.Storage
+}
+
+// storage opens the configured storage on first use
+func (a *app) storage() (storage.Storage, error) {
+	if a.store != nil {
+		return a.store, nil
+	}
+
+	store, err := storage.New(a.cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize storage: %w", err)
+	}
+	a.store = store
+	return store, nil
+}
+
+// querier returns the storage if it can read records back
+func (a *app) querier() (storage.Querier, error) {
+	store, err := a.storage()
+	if err != nil {
+		return nil, err
+	}
+	querier, ok := store.(storage.Querier)
+	if !ok {
+		return nil, fmt.Errorf("%s storage does not support queries", a.cfg.GetStorage().GetBackend())
+	}
+	return querier, nil
+}
+
+// sessionTracker returns the storage if it aggregates sessions
+func (a *app) sessionTracker() (storage.SessionTracker, error) {
+	store, err := a.storage()
+	if err != nil {
+		return nil, err
+	}
+	tracker, ok := store.(storage.SessionTracker)
+	if !ok {
+		return nil, fmt.Errorf("%s storage does not track sessions", a.cfg.GetStorage().GetBackend())
+	}
+	return tracker, nil
+}
+
+// archiveTracker returns the storage if it tracks archived records
+func (a *app) archiveTracker() (storage.ArchiveTracker, error) {
+	store, err := a.storage()
+	if err != nil {
+		return nil, err
+	}
+	tracker, ok := store.(storage.ArchiveTracker)
+	if !ok {
+		return nil, fmt.Errorf("%s storage does not track archived records", a.cfg.GetStorage().GetBackend())
+	}
+	return tracker, nil
+}
+
+func main() {
+	configFlags := config.RegisterRadacctFlags(flag.CommandLine)
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[flag.Arg(0)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "radacct: unknown command %q\n\n", flag.Arg(0))
+		usage()
+		os.Exit(2)
+	}
+
+	// Pick up .env when run from a checkout; set variables take precedence
+	_ = godotenv.Load()
+
+	// Load configuration: defaults < config file < environment < flags
+	cfg, err := config.LoadControlplane(configFlags.ConfigFile(), configFlags)
+	if err != nil {
+		fatalf("failed to load configuration: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		fatalf("invalid configuration: %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	a := &app{cfg: cfg}
+
+	err = cmd.run(ctx, a, flag.Args()[1:])
+
+	stop()
+	if a.store != nil {
+		_ = a.store.Close()
+	}
+	if err != nil {
+		fatalf("%v", err)
+	}
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: radacct [flags] <command> [arguments]\n\nCommands:\n")
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(out, "  %s %s\n        %s\n", name, commands[name].args, commands[name].summary)
+	}
+
+	fmt.Fprintf(out, "\nFlags:\n")
+	flag.PrintDefaults()
+}
+
+func fatalf(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, "radacct: "+format+"\n", args...)
+	os.Exit(1)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/kal997/radius-accounting-server/internal/models"
+	"github.com/kal997/radius-accounting-server/internal/storage"
+)
+
+// recordHeader names the columns written by writeRecordRow
+const recordHeader = "TIME\tTYPE\tUSERNAME\tSESSION\tNAS\tDETAILS"
+
+// recordWriter prints records as a table or as JSON lines
+type recordWriter struct {
+	asJSON bool
+	enc    *json.Encoder
+	table  *tabwriter.Writer
+	rows   int
+}
+
+func newRecordWriter(w io.Writer, asJSON bool) *recordWriter {
+	return &recordWriter{
+		asJSON: asJSON,
+		enc:    json.NewEncoder(w),
+		table:  tabwriter.NewWriter(w, 0, 0, 2, ' ', 0),
+	}
+}
+
+// write prints one record; table rows are buffered until flush
+func (rw *recordWriter) write(event models.AccountingEvent) error {
+	rw.rows++
+	if rw.asJSON {
+		return rw.enc.Encode(storage.NewKeyedRecord(event))
+	}
+	if rw.rows == 1 {
+		fmt.Fprintln(rw.table, recordHeader)
+	}
+	fmt.Fprintln(rw.table, recordRow(event))
+	return nil
+}
+
+// flush writes the buffered table rows
+func (rw *recordWriter) flush() error {
+	return rw.table.Flush()
+}
+
+// recordRow returns the tab-separated columns of recordHeader
+func recordRow(event models.AccountingEvent) string {
+	var details []string
+	switch r := event.(type) {
+	case *models.StartRecord:
+		details = append(details, "ip="+valueOrDash(r.FramedIPAddress))
+	case *models.InterimRecord:
+		details = append(details, usageDetails(r.SessionTime, r.InputOctets, r.OutputOctets)...)
+	case *models.StopRecord:
+		details = append(details, usageDetails(r.SessionTime, r.InputOctets, r.OutputOctets)...)
+		details = append(details, "cause="+valueOrDash(r.TerminateCause))
+	}
+
+	base := event.Base()
+	if base.CallingStationID != "" {
+		details = append(details, "station="+base.CallingStationID)
+	}
+	return strings.Join([]string{
+		base.Timestamp,
+		storage.RecordType(event),
+		base.Username,
+		base.AcctSessionID,
+		base.NASIPAddress,
+		strings.Join(details, " "),
+	}, "\t")
+}
+
+func usageDetails(sessionTime int, inputOctets, outputOctets uint64) []string {
+	return []string{
+		fmt.Sprintf("time=%ds", sessionTime),
+		fmt.Sprintf("in=%d", inputOctets),
+		fmt.Sprintf("out=%d", outputOctets),
+	}
+}
+
+func valueOrDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+// queryAll calls fn for every record matching q, following the pagination
+// cursors, and stops after max records when max is positive
+func queryAll(ctx context.Context, querier storage.Querier, q storage.Query, max int, fn func(models.AccountingEvent) error) error {
+	seen := 0
+	for {
+		q.Limit = storage.MaxQueryLimit
+		if max > 0 {
+			q.Limit = min(max-seen, storage.MaxQueryLimit)
+		}
+
+		result, err := querier.Query(ctx, q)
+		if err != nil {
+			return err
+		}
+		for _, event := range result.Records {
+			if err := fn(event); err != nil {
+				return err
+			}
+		}
+		seen += len(result.Records)
+
+		if result.NextCursor == "" || (max > 0 && seen >= max) {
+			return nil
+		}
+		q.Cursor = result.NextCursor
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/kal997/radius-accounting-server/internal/archive"
+	"github.com/kal997/radius-accounting-server/internal/models"
+	"github.com/kal997/radius-accounting-server/internal/pcap"
+	"github.com/kal997/radius-accounting-server/internal/replay"
+)
+
+const replayArgs = "[-format auto|jsonl|detail|pcap] [-from time] [-to time] [-rate n] [-port n] [-dry-run] file..."
+
+// runReplay stores records lost to an outage or a bug again, from archive
+// files, JSON lines exports, FreeRADIUS detail files or captures of the
+// RADIUS traffic. Records are validated like received packets and skipped
+// when already stored.
+func runReplay(ctx context.Context, app *app, args []string) error {
+	fs := flag.NewFlagSet("radacct replay", flag.ExitOnError)
+	formatName := fs.String("format", "auto", "format of the files: auto, jsonl, detail or pcap")
+	from := fs.String("from", "", "earliest event time, RFC 3339 or \"2006-01-02 15:04:05\" in UTC")
+	to := fs.String("to", "", "event time to stop before, in the same formats")
+	rate := fs.Float64("rate", 0, "maximum records stored per second, 0 for no limit")
+	port := fs.Int("port", app.cfg.GetRADIUSPort(), "accounting port of the captured requests")
+	dryRun := fs.Bool("dry-run", false, "read, validate and deduplicate the records without storing them")
+	_ = fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		return fmt.Errorf("usage: radacct replay %s", replayArgs)
+	}
+	format, err := replay.ParseFormat(*formatName)
+	if err != nil {
+		return err
+	}
+	fromTime, toTime, err := parseRange(*from, *to)
+	if err != nil {
+		return err
+	}
+
+	// Archive files are verified against their manifests before anything
+	// is stored
+	for _, path := range fs.Args() {
+		manifest, err := archive.ReadManifest(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := archive.Verify(path, manifest); err != nil {
+			return err
+		}
+	}
+
+	// The storage is opened for dry runs too, to find duplicates
+	store, err := app.storage()
+	if err != nil {
+		return err
+	}
+
+	replayer := replay.New(store, replay.Options{
+		DryRun: *dryRun,
+		Rate:   *rate,
+		From:   fromTime,
+		To:     toTime,
+		Invalid: func(record models.AccountingEvent, err error) {
+			fmt.Fprintf(os.Stderr, "radacct: skipping %s: %v\n", record.GenerateRedisKey(), err)
+		},
+	})
+	packets := replay.PacketOptions{
+		Port:   *port,
+		Secret: app.cfg.SecretFor,
+		Rejected: func(datagram pcap.Datagram, err error) {
+			fmt.Fprintf(os.Stderr, "radacct: rejecting packet from %s: %v\n", datagram.Src, err)
+		},
+	}
+
+	skipped := 0
+	for _, path := range fs.Args() {
+		file, err := replay.Open(path, format, packets)
+		if err != nil {
+			return err
+		}
+		err = replayer.Replay(ctx, file)
+		skipped += file.Skipped()
+		_ = file.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	result := replayer.Result()
+	verb := "Replayed"
+	if *dryRun {
+		verb = "Would replay"
+	}
+	fmt.Fprintf(os.Stderr, "%s %d records from %d files (%d duplicates, %d invalid, %d outside the time range, %d other entries skipped)\n",
+		verb, result.Stored, fs.NArg(), result.Duplicates, result.Invalid, result.Outside, skipped)
+	return nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/kal997/radius-accounting-server/internal/archive"
+	"github.com/kal997/radius-accounting-server/internal/models"
+	"github.com/kal997/radius-accounting-server/internal/storage"
+)
+
+const restoreArgs = "[-from time] [-to time] [-dry-run] file|directory..."
+
+// runRestore stores the records of archive files again. Every file is
+// verified against its manifest first. Restored records are marked archived
+// before they are stored, so that a running archiver does not archive them
+// a second time.
+func runRestore(ctx context.Context, app *app, args []string) error {
+	fs := flag.NewFlagSet("radacct restore", flag.ExitOnError)
+	from := fs.String("from", "", "earliest event time, RFC 3339 or \"2006-01-02 15:04:05\" in UTC")
+	to := fs.String("to", "", "event time to stop before, in the same formats")
+	dryRun := fs.Bool("dry-run", false, "verify the files and count the records without storing them")
+	_ = fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		return fmt.Errorf("usage: radacct restore %s", restoreArgs)
+	}
+	fromTime, toTime, err := parseRange(*from, *to)
+	if err != nil {
+		return err
+	}
+
+	files, err := archiveFiles(fs.Args(), fromTime, toTime)
+	if err != nil {
+		return err
+	}
+
+	// Check every file before storing anything
+	for _, path := range files {
+		manifest, err := archive.ReadManifest(path)
+		if err != nil {
+			return err
+		}
+		if err := archive.Verify(path, manifest); err != nil {
+			return err
+		}
+	}
+
+	var store storage.Storage
+	var tracker storage.ArchiveTracker
+	if !*dryRun {
+		if store, err = app.storage(); err != nil {
+			return err
+		}
+		tracker, _ = store.(storage.ArchiveTracker)
+	}
+
+	restored := 0
+	for _, path := range files {
+		err := archive.Read(path, func(key string, record models.AccountingEvent) error {
+			t := storage.RecordTime(record, time.Time{})
+			if (!fromTime.IsZero() && t.Before(fromTime)) || (!toTime.IsZero() && !t.Before(toTime)) {
+				return nil
+			}
+			restored++
+			if *dryRun {
+				return nil
+			}
+			if tracker != nil {
+				err := tracker.MarkArchived(ctx, []string{key})
+				if err != nil && !errors.Is(err, storage.ErrArchiveNotSupported) {
+					return err
+				}
+			}
+			if err := store.Store(ctx, record); err != nil {
+				return fmt.Errorf("failed to restore %s: %w", key, err)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	verb := "Restored"
+	if *dryRun {
+		verb = "Would restore"
+	}
+	fmt.Fprintf(os.Stderr, "%s %d records from %d files\n", verb, restored, len(files))
+	return nil
+}
+
+// archiveFiles expands the arguments to archive file paths. Directories
+// contribute their files that may hold records in [from, to), in the order
+// they were sealed.
+func archiveFiles(args []string, from, to time.Time) ([]string, error) {
+	var files []string
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, arg)
+			continue
+		}
+
+		manifests, err := archive.List(arg)
+		if err != nil {
+			return nil, err
+		}
+		for _, manifest := range manifests {
+			if manifest.Covers(from, to) {
+				files = append(files, filepath.Join(arg, manifest.File))
+			}
+		}
+	}
+	return files, nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/kal997/radius-accounting-server/internal/models"
+	"github.com/kal997/radius-accounting-server/internal/storage"
+)
+
+const searchArgs = "[-user name] [-ip address] [-mac address] [-nas address] [-session id] [-from time] [-to time] [-limit n] [-json]"
+
+// runSearch prints the records matching every given filter, oldest first
+func runSearch(ctx context.Context, app *app, args []string) error {
+	fs := flag.NewFlagSet("radacct search", flag.ExitOnError)
+	user := fs.String("user", "", "User-Name")
+	ip := fs.String("ip", "", "Framed-IP-Address; matches Start records only")
+	mac := fs.String("mac", "", "Calling-Station-Id, a MAC address in any notation")
+	nas := fs.String("nas", "", "NAS-IP-Address")
+	session := fs.String("session", "", "Acct-Session-Id")
+	from := fs.String("from", "", "earliest event time, RFC 3339 or \"2006-01-02 15:04:05\" in UTC")
+	to := fs.String("to", "", "event time to stop before, in the same formats")
+	limit := fs.Int("limit", storage.DefaultQueryLimit, "maximum number of records, 0 for all")
+	asJSON := fs.Bool("json", false, "print records as JSON lines")
+	_ = fs.Parse(args)
+
+	if fs.NArg() != 0 {
+		return fmt.Errorf("usage: radacct search %s", searchArgs)
+	}
+	if *limit < 0 {
+		return fmt.Errorf("limit cannot be negative")
+	}
+
+	q := storage.Query{
+		Username:         *user,
+		AcctSessionID:    *session,
+		NASIPAddress:     *nas,
+		FramedIPAddress:  *ip,
+		CallingStationID: *mac,
+	}
+	var err error
+	if q.From, q.To, err = parseRange(*from, *to); err != nil {
+		return err
+	}
+
+	querier, err := app.querier()
+	if err != nil {
+		return err
+	}
+
+	out := newRecordWriter(os.Stdout, *asJSON)
+	err = queryAll(ctx, querier, q, *limit, func(event models.AccountingEvent) error {
+		return out.write(event)
+	})
+	if err != nil {
+		return err
+	}
+	if out.rows == 0 && !*asJSON {
+		fmt.Println("No matching records")
+		return nil
+	}
+	return out.flush()
+}
+
+// parseRange parses optional -from and -to times
+func parseRange(from, to string) (time.Time, time.Time, error) {
+	var start, end time.Time
+	var err error
+	if from != "" {
+		if start, err = parseTime(from); err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+	}
+	if to != "" {
+		if end, err = parseTime(to); err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+	}
+	return start, end, nil
+}
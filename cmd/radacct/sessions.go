@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/kal997/radius-accounting-server/internal/models"
+	"github.com/kal997/radius-accounting-server/internal/storage"
+)
+
+const (
+	sessionsArgs = "[-user name] [-nas address] [-all] [-limit n] [-json]"
+	sessionArgs  = "[-json] <nas-address> <acct-session-id>"
+)
+
+// runSessions lists sessions, least recently updated first. Only active
+// sessions are listed unless -all is given with a user or NAS.
+func runSessions(ctx context.Context, app *app, args []string) error {
+	fs := flag.NewFlagSet("radacct sessions", flag.ExitOnError)
+	user := fs.String("user", "", "only sessions of this User-Name")
+	nas := fs.String("nas", "", "only sessions of this NAS-IP-Address")
+	all := fs.Bool("all", false, "include stopped sessions; requires -user or -nas")
+	limit := fs.Int("limit", storage.DefaultQueryLimit, "maximum number of sessions, 0 for all")
+	asJSON := fs.Bool("json", false, "print sessions as JSON")
+	_ = fs.Parse(args)
+
+	if fs.NArg() != 0 {
+		return fmt.Errorf("usage: radacct sessions %s", sessionsArgs)
+	}
+	if *all && *user == "" && *nas == "" {
+		return fmt.Errorf("-all requires -user or -nas")
+	}
+	if *limit < 0 {
+		return fmt.Errorf("limit cannot be negative")
+	}
+
+	tracker, err := app.sessionTracker()
+	if err != nil {
+		return err
+	}
+
+	q := storage.SessionQuery{Username: *user, NASIPAddress: *nas, ActiveOnly: !*all}
+	sessions := []storage.Session{}
+	for *limit == 0 || len(sessions) < *limit {
+		q.Limit = storage.MaxQueryLimit
+		if *limit > 0 {
+			q.Limit = min(*limit-len(sessions), storage.MaxQueryLimit)
+		}
+		result, err := tracker.Sessions(ctx, q)
+		if err != nil {
+			return err
+		}
+		sessions = append(sessions, result.Sessions...)
+		if result.NextCursor == "" {
+			break
+		}
+		q.Cursor = result.NextCursor
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(sessions)
+	}
+
+	if len(sessions) == 0 {
+		fmt.Println("No matching sessions")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "USERNAME\tSESSION\tNAS\tIP\tSTART\tSTOP\tLAST UPDATE\tTIME\tIN\tOUT")
+	for _, s := range sessions {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%ds\t%d\t%d\n",
+			s.Username, s.AcctSessionID, s.NASIPAddress, valueOrDash(s.FramedIPAddress),
+			formatOptionalTime(s.Start, "-"), formatOptionalTime(s.Stop, "active"),
+			s.LastUpdate.UTC().Format(time.RFC3339), s.SessionTime, s.InputOctets, s.OutputOctets)
+	}
+	return w.Flush()
+}
+
+// runSession prints a session followed by every record of it, oldest first
+func runSession(ctx context.Context, app *app, args []string) error {
+	fs := flag.NewFlagSet("radacct session", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "print the session and its records as JSON")
+	_ = fs.Parse(args)
+
+	if fs.NArg() != 2 {
+		return fmt.Errorf("usage: radacct session %s", sessionArgs)
+	}
+	nas, id := fs.Arg(0), fs.Arg(1)
+
+	querier, err := app.querier()
+	if err != nil {
+		return err
+	}
+
+	// The session summary is optional; backends without it still have the records
+	var session *storage.Session
+	if tracker, ok := app.store.(storage.SessionTracker); ok {
+		if session, err = tracker.Session(ctx, nas, id); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return err
+		}
+	}
+
+	var records []models.AccountingEvent
+	err = queryAll(ctx, querier, storage.Query{AcctSessionID: id, NASIPAddress: nas}, 0, func(event models.AccountingEvent) error {
+		records = append(records, event)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if session == nil && len(records) == 0 {
+		return fmt.Errorf("session %s on %s not found", id, nas)
+	}
+
+	if *asJSON {
+		timeline := make([]storage.KeyedRecord, len(records))
+		for i, event := range records {
+			timeline[i] = storage.NewKeyedRecord(event)
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(struct {
+			Session *storage.Session      `json:"session,omitempty"`
+			Records []storage.KeyedRecord `json:"records"`
+		}{session, timeline})
+	}
+
+	if session != nil {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(w, "Username:\t%s\n", session.Username)
+		fmt.Fprintf(w, "Session:\t%s on %s\n", session.AcctSessionID, session.NASIPAddress)
+		fmt.Fprintf(w, "Framed IP:\t%s\n", valueOrDash(session.FramedIPAddress))
+		fmt.Fprintf(w, "Start:\t%s\n", formatOptionalTime(session.Start, "not received"))
+		fmt.Fprintf(w, "Stop:\t%s\n", formatOptionalTime(session.Stop, "active"))
+		fmt.Fprintf(w, "Last update:\t%s\n", session.LastUpdate.UTC().Format(time.RFC3339))
+		fmt.Fprintf(w, "Usage:\t%ds, %d octets in, %d octets out\n", session.SessionTime, session.InputOctets, session.OutputOctets)
+		if session.TerminateCause != "" {
+			fmt.Fprintf(w, "Terminate cause:\t%s\n", session.TerminateCause)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		fmt.Println()
+	}
+
+	if len(records) == 0 {
+		fmt.Println("No records left; they have expired")
+		return nil
+	}
+	out := newRecordWriter(os.Stdout, false)
+	for _, event := range records {
+		if err := out.write(event); err != nil {
+			return err
+		}
+	}
+	return out.flush()
+}
+
+func formatOptionalTime(t *time.Time, missing string) string {
+	if t == nil {
+		return missing
+	}
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/kal997/radius-accounting-server/internal/storage"
+)
+
+const statsArgs = "[-json]"
+
+// serverStats is the part of the admin API /stats response shown by stats
+type serverStats struct {
+	StartedAt     time.Time `json:"started_at"`
+	UptimeSeconds int64     `json:"uptime_seconds"`
+	Requests      struct {
+		Received uint64 `json:"received"`
+		Stored   uint64 `json:"stored"`
+		Invalid  uint64 `json:"invalid"`
+		Failed   uint64 `json:"failed"`
+	} `json:"requests"`
+}
+
+// runStats prints the per-NAS counters kept by the storage and, when the
+// admin API is enabled, the request counters of the running server
+func runStats(ctx context.Context, app *app, args []string) error {
+	fs := flag.NewFlagSet("radacct stats", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "print statistics as JSON")
+	_ = fs.Parse(args)
+
+	if fs.NArg() != 0 {
+		return fmt.Errorf("usage: radacct stats %s", statsArgs)
+	}
+
+	tracker, err := app.sessionTracker()
+	if err != nil {
+		return err
+	}
+	summaries, err := tracker.NASSummaries(ctx)
+	if err != nil {
+		return err
+	}
+
+	var server *serverStats
+	var serverErr error
+	if app.cfg.GetAPI().Enabled() {
+		server, serverErr = fetchServerStats(ctx, app.cfg.GetAPI().GetAddress(), app.cfg.GetAPI().GetToken())
+	}
+
+	if *asJSON {
+		if summaries == nil {
+			summaries = []storage.NASSummary{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(struct {
+			NAS    []storage.NASSummary `json:"nas"`
+			Server *serverStats         `json:"server,omitempty"`
+		}{summaries, server})
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	switch {
+	case server != nil:
+		fmt.Fprintf(w, "Server started:\t%s (up %s)\n", server.StartedAt.UTC().Format(time.RFC3339), time.Duration(server.UptimeSeconds)*time.Second)
+		fmt.Fprintf(w, "Requests:\t%d received, %d stored, %d invalid, %d failed\n",
+			server.Requests.Received, server.Requests.Stored, server.Requests.Invalid, server.Requests.Failed)
+	case serverErr != nil:
+		fmt.Fprintf(w, "Server:\tunavailable: %v\n", serverErr)
+	default:
+		fmt.Fprintf(w, "Server:\tenable the admin API for request counters\n")
+	}
+	fmt.Fprintln(w)
+
+	var active int
+	var starts, interims, stops uint64
+	fmt.Fprintln(w, "NAS\tACTIVE\tSTARTS\tINTERIMS\tSTOPS\tLAST SEEN")
+	for _, s := range summaries {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%s\n",
+			s.NASIPAddress, s.ActiveSessions, s.Starts, s.InterimUpdates, s.Stops, s.LastSeen.UTC().Format(time.RFC3339))
+		active += s.ActiveSessions
+		starts += s.Starts
+		interims += s.InterimUpdates
+		stops += s.Stops
+	}
+	fmt.Fprintf(w, "TOTAL\t%d\t%d\t%d\t%d\t\n", active, starts, interims, stops)
+	return w.Flush()
+}
+
+// fetchServerStats reads /api/v1/stats from the admin API of the running
+// server, connecting to localhost when it listens on every interface
+func fetchServerStats(ctx context.Context, address, token string) (*serverStats, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "127.0.0.1"
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	url := "http://" + net.JoinHostPort(host, port) + "/api/v1/stats"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	var stats serverStats
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		return nil, fmt.Errorf("failed to decode server statistics: %w", err)
+	}
+	return &stats, nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/kal997/radius-accounting-server/internal/config"
+	"github.com/kal997/radius-accounting-server/internal/notifier"
+	"github.com/kal997/radius-accounting-server/internal/storage"
+)
+
+const tailArgs = "[-user name] [-json]"
+
+// runTail prints records as they are stored, following Redis keyspace
+// notifications like the logger service, until interrupted
+func runTail(ctx context.Context, app *app, args []string) error {
+	fs := flag.NewFlagSet("radacct tail", flag.ExitOnError)
+	user := fs.String("user", "", "only records of this User-Name")
+	asJSON := fs.Bool("json", false, "print records as JSON lines")
+	_ = fs.Parse(args)
+
+	if fs.NArg() != 0 {
+		return fmt.Errorf("usage: radacct tail %s", tailArgs)
+	}
+	if !app.cfg.GetStorage().Uses(config.StorageBackendRedis) {
+		return fmt.Errorf("tail follows Redis notifications, but %s storage does not use Redis", app.cfg.GetStorage().GetBackend())
+	}
+
+	querier, err := app.querier()
+	if err != nil {
+		return err
+	}
+
+	// Default notifier settings: keyspace channels, no CONFIG SET
+	events, err := notifier.NewRedisNotifierFromConfig(app.cfg.GetRedis(), &config.NotifierConfig{})
+	if err != nil {
+		return fmt.Errorf("failed to initialize notifier: %w", err)
+	}
+	defer events.Close()
+
+	if err := events.EnsureNotifications(ctx); err != nil {
+		if errors.Is(err, notifier.ErrNotificationsDisabled) {
+			return fmt.Errorf("%w (start Redis with --notify-keyspace-events KEA)", err)
+		}
+		fmt.Fprintf(os.Stderr, "radacct: could not verify keyspace notifications: %v\n", err)
+	}
+
+	// User names may contain ':' and glob characters, so records are filtered
+	// by User-Name once read rather than by the key pattern
+	updates, err := events.Subscribe(ctx, []string{"radius:acct:*"})
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to notifications: %w", err)
+	}
+
+	out := newRecordWriter(os.Stdout, *asJSON)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-updates:
+			if !ok {
+				return nil
+			}
+			if event.Operation == notifier.OperationGap {
+				fmt.Fprintln(os.Stderr, "radacct: reconnected to Redis, records may have been missed")
+				continue
+			}
+			if event.Operation != "set" {
+				continue
+			}
+
+			record, err := querier.Record(ctx, event.Key)
+			if errors.Is(err, storage.ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if *user != "" && record.Base().Username != *user {
+				continue
+			}
+			if err := out.write(record); err != nil {
+				return err
+			}
+			if err := out.flush(); err != nil {
+				return err
+			}
+		}
+	}
+}
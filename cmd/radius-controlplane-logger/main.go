@@ -2,7 +2,8 @@ package main
 
 import (
 	"context"
-	"fmt"
+	"errors"
+	"flag"
 	"log"
 	"os"
 	"os/signal"
@@ -16,6 +17,9 @@ import (
 
 func main() {
 
+	configFlags := config.RegisterLoggerFlags(flag.CommandLine)
+	flag.Parse()
+
 	if value, ok := os.LookupEnv("ENV"); ok && value == "prod" {
 		// In Docker/Compose, rely only on provided env vars
 	} else {
@@ -24,8 +28,8 @@ func main() {
 			log.Fatalf("Could not load .env: %v", err)
 		}
 	}
-	// Load configuration into config
-	cfg, err := config.LoadFromEnv()
+	// Load configuration: defaults < config file < environment < flags
+	cfg, err := config.LoadLogger(configFlags.ConfigFile(), configFlags)
 	if err != nil {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
@@ -34,8 +38,13 @@ func main() {
 		log.Fatalf("Invalid configuration: %v", err)
 	}
 
+	// Reloadable settings are re-read on SIGHUP
+	reloader := config.NewReloader(cfg, func() (*config.LoggerConfig, error) {
+		return config.LoadLogger(configFlags.ConfigFile(), configFlags)
+	})
+
 	// Initialize notifier, worst case 5s before timeout
-	redis, err := notifier.NewRedisNotifier(cfg.GetRedisAddr())
+	redis, err := notifier.NewRedisNotifierFromConfig(cfg.GetRedis(), cfg.GetNotifier())
 	if err != nil {
 		log.Fatalf("Failed to initialize notifier: %v", err)
 	}
@@ -50,6 +59,14 @@ func main() {
 		log.Fatalf("Notifier health check failed: %v", err)
 	}
 
+	// Without notify-keyspace-events the subscription would silently receive nothing
+	if err := redis.EnsureNotifications(context.Background()); err != nil {
+		if errors.Is(err, notifier.ErrNotificationsDisabled) {
+			log.Fatalf("%v (start Redis with --notify-keyspace-events KEA or set notifier.configure_events)", err)
+		}
+		log.Printf("Warning: could not verify keyspace notifications: %v", err)
+	}
+
 	// Initialize file logger
 	fileLogger, err := logger.NewFileLogger(cfg.GetLogFile())
 	if err != nil {
@@ -63,7 +80,7 @@ func main() {
 	}()
 
 	log.Printf("Starting radius-controlplane-logger")
-	log.Printf("Connected to Redis at %s", cfg.GetRedisAddr())
+	log.Printf("Connected to Redis at %s", cfg.GetRedis().Describe())
 	log.Printf("Logging to file: %s", cfg.GetLogFile())
 
 	// Create context for graceful shutdown
@@ -80,6 +97,29 @@ func main() {
 		cancel()
 	}()
 
+	// Switch to the new log file when logging.file changes
+	reloader.OnReload(func(old, new *config.LoggerConfig) {
+		if old.GetLogFile() == new.GetLogFile() {
+			return
+		}
+		if err := fileLogger.Reopen(new.GetLogFile()); err != nil {
+			log.Printf("Failed to switch log file to %s: %v", new.GetLogFile(), err)
+			return
+		}
+		log.Printf("Logging to file: %s", new.GetLogFile())
+	})
+
+	// Detect Redis restarts that lose notify-keyspace-events
+	if interval := cfg.GetNotifier().GetCheckInterval(); interval > 0 {
+		go redis.WatchNotifications(ctx, interval, func(err error) {
+			log.Printf("Keyspace notification check failed: %v", err)
+		})
+	}
+
+	hupChan := make(chan os.Signal, 1)
+	signal.Notify(hupChan, syscall.SIGHUP)
+	go reloader.Watch(ctx, hupChan)
+
 	// Subscribe to Redis keyspace notifications
 	events, err := redis.Subscribe(ctx, []string{"radius:acct:*"})
 	if err != nil {
@@ -88,26 +128,13 @@ func main() {
 
 	log.Println("Listening for Redis keyspace notifications...")
 
-	// Process events
-	for {
-		select {
-		case <-ctx.Done():
-			log.Println("Shutting down...")
-			return
-		case event, ok := <-events:
-			if !ok {
-				log.Println("Event channel closed")
-				return
-			}
-
-			// Log all operations
-			message := fmt.Sprintf("Received update for key: %s, Operation: %s", event.Key, event.Operation)
-			if err := fileLogger.Log(ctx, message); err != nil {
-				log.Printf("Failed to log event: %v", err)
-			} else if cfg.IsDebugEnabled() {
-				log.Printf("Logged: %s", message)
-			}
-
+	// Process events until shutdown
+	logger.Forward(ctx, events, fileLogger, func(ctx context.Context) {
+		if err := redis.EnsureNotifications(ctx); err != nil {
+			log.Printf("Keyspace notification check failed: %v", err)
 		}
+	}, func() bool { return reloader.Current().IsDebugEnabled() })
+	if ctx.Err() != nil {
+		log.Println("Shutting down...")
 	}
 }
@@ -2,22 +2,33 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"log"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/joho/godotenv"
+	"github.com/kal997/radius-accounting-server/internal/accounting"
+	"github.com/kal997/radius-accounting-server/internal/api"
+	"github.com/kal997/radius-accounting-server/internal/capture"
 	"github.com/kal997/radius-accounting-server/internal/config"
-	"github.com/kal997/radius-accounting-server/internal/models"
+	"github.com/kal997/radius-accounting-server/internal/radsec"
 	"github.com/kal997/radius-accounting-server/internal/storage"
+	"github.com/kal997/radius-accounting-server/internal/stream"
 
 	"layeh.com/radius"
 )
 
 func main() {
 
+	configFlags := config.RegisterControlplaneFlags(flag.CommandLine)
+	flag.Parse()
+
 	if value, ok := os.LookupEnv("ENV"); ok && value == "prod" {
 		// In Docker/Compose, rely only on provided env vars
 	} else {
@@ -27,8 +38,8 @@ func main() {
 		}
 	}
 
-	// Load configuration into config
-	cfg, err := config.LoadFromEnv()
+	// Load configuration: defaults < config file < environment < flags
+	cfg, err := config.LoadControlplane(configFlags.ConfigFile(), configFlags)
 	if err != nil {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
@@ -37,8 +48,13 @@ func main() {
 		log.Fatalf("Invalid configuration: %v", err)
 	}
 
+	// Reloadable settings are re-read on SIGHUP
+	reloader := config.NewReloader(cfg, func() (*config.ControlplaneConfig, error) {
+		return config.LoadControlplane(configFlags.ConfigFile(), configFlags)
+	})
+
 	// Initialize storage
-	store, err := storage.NewRedisStorage(cfg)
+	store, err := storage.New(cfg)
 	if err != nil {
 		log.Fatalf("Failed to initialize storage: %v", err)
 	}
@@ -55,7 +71,35 @@ func main() {
 	}
 
 	log.Printf("Starting RADIUS accounting server on %s", cfg.GetRADIUSAddr())
-	log.Printf("Connected to Redis at %s", cfg.GetRedisAddr())
+	switch cfg.GetStorage().GetBackend() {
+	case config.StorageBackendSQLite:
+		log.Printf("Storing records in SQLite database %s", cfg.GetStorage().GetSQLite().GetPath())
+	case config.StorageBackendPostgres:
+		log.Printf("Storing records in PostgreSQL (%s partitions)", cfg.GetStorage().GetPostgres().GetPartitionInterval())
+	case config.StorageBackendMemory:
+		log.Printf("Storing records in memory; they are lost on restart")
+	case config.StorageBackendMulti:
+		log.Printf("Storing records in %v (quorum %d)", cfg.GetStorage().GetMulti().GetTargets(), cfg.GetStorage().GetMulti().GetQuorum())
+	default:
+		log.Printf("Connected to Redis at %s", cfg.GetRedis().Describe())
+	}
+
+	// Packets can be captured at runtime whenever a capture directory is set
+	var capturer *capture.Capturer
+	if captureCfg := cfg.GetCapture(); captureCfg.Configured() {
+		capturer, err = capture.New(captureCfg)
+		if err != nil {
+			log.Fatalf("Failed to initialize packet capture: %v", err)
+		}
+		defer func() {
+			if err := capturer.Close(); err != nil {
+				log.Printf("failed to close packet capture: %v", err)
+			}
+		}()
+		if captureCfg.Enabled() {
+			log.Printf("Capturing %s packets to %s", captureCfg.GetFormat(), captureCfg.GetDirectory())
+		}
+	}
 
 	// Create context for graceful shutdown
 	ctx, cancel := context.WithCancel(context.Background())
@@ -71,75 +115,179 @@ func main() {
 		cancel()
 	}()
 
+	// Apply new TTLs and retention to records stored after a reload, and
+	// capture settings changed in the configuration file
+	reloader.OnReload(func(old, new *config.ControlplaneConfig) {
+		applyStorageReload(store, new)
+		if capturer != nil {
+			applyCaptureReload(capturer, old.GetCapture(), new.GetCapture())
+		}
+	})
+
+	hupChan := make(chan os.Signal, 1)
+	signal.Notify(hupChan, syscall.SIGHUP)
+	go reloader.Watch(ctx, hupChan)
+
+	stats := accounting.NewRequestStats()
+
+	// Start the admin API; the token is read per request so that it can be
+	// rotated by a reload
+	apiErr := make(chan error, 1)
+	if cfg.GetAPI().Enabled() {
+		apiServer := &http.Server{
+			Addr: cfg.GetAPI().GetAddress(),
+			Handler: api.NewServer(store, string(cfg.GetStorage().GetBackend()), stats, capturer, func() string {
+				return reloader.Current().GetAPI().GetToken()
+			}),
+			ReadHeaderTimeout: 5 * time.Second,
+		}
+		go func() {
+			log.Printf("Serving admin API on %s", apiServer.Addr)
+			if err := apiServer.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				apiErr <- err
+			}
+		}()
+		defer func() {
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := apiServer.Shutdown(shutdownCtx); err != nil {
+				log.Printf("failed to stop admin API: %v", err)
+			}
+		}()
+	}
+
 	// Start RADIUS server
+	handler := accounting.NewHandler(store, stats)
 	server := radius.PacketServer{
-		Handler:      radius.HandlerFunc(handleAccounting(store)),
-		SecretSource: radius.StaticSecretSource([]byte(cfg.GetSharedSecret())),
+		Handler:      handler,
+		SecretSource: accounting.SecretSource(reloader.Current),
 		Addr:         cfg.GetRADIUSAddr(),
 		Network:      "udp",
 	}
 
+	conn, err := net.ListenPacket(server.Network, server.Addr)
+	if err != nil {
+		log.Fatalf("RADIUS server failed: %v", err)
+	}
+	if capturer != nil {
+		conn = capturer.Wrap(conn)
+	}
+
 	// Start server in goroutine
 	serverErr := make(chan error, 1)
 	go func() {
-		serverErr <- server.ListenAndServe()
+		serverErr <- server.Serve(conn)
 	}()
 
-	// Wait for shutdown signal or server error
-	select {
-	case <-ctx.Done():
-		log.Println("Shutting down...")
-	case err := <-serverErr:
+	// Start the TCP listener; its requests reach the same handler, with the
+	// secrets of the UDP clients
+	tcpErr := make(chan error, 1)
+	if tcpCfg := cfg.GetTCP(); tcpCfg.Enabled() {
+		listener, err := net.Listen("tcp", tcpCfg.GetAddress())
 		if err != nil {
-			log.Fatalf("RADIUS server failed: %v", err)
+			log.Fatalf("TCP listener failed: %v", err)
 		}
-	}
-}
-
-func handleAccounting(store storage.Storage) func(w radius.ResponseWriter, r *radius.Request) {
-	return func(w radius.ResponseWriter, r *radius.Request) {
-		var resp *radius.Packet
-
-		// Default response code
-		respCode := radius.CodeAccountingResponse
-
+		tcpServer := &stream.Server{
+			Handler:        handler,
+			SecretSource:   accounting.SecretSource(reloader.Current),
+			IdleTimeout:    tcpCfg.GetIdleTimeout(),
+			MaxConnections: tcpCfg.GetMaxConnections(),
+		}
+		go func() {
+			log.Printf("Serving RADIUS over TCP on %s", listener.Addr())
+			if err := tcpServer.Serve(listener); !errors.Is(err, stream.ErrServerClosed) {
+				tcpErr <- err
+			}
+		}()
 		defer func() {
-			// Always send response back, even in error cases
-			resp = r.Response(respCode)
-			if err := w.Write(resp); err != nil {
-				log.Printf("Failed to send accounting response: %v", err)
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := tcpServer.Shutdown(shutdownCtx); err != nil {
+				log.Printf("failed to stop TCP listener: %v", err)
 			}
 		}()
+	}
 
-		if r.Code != radius.CodeAccountingRequest {
-			log.Printf("Received non-accounting request: %d", r.Code)
-			return
+	// Start the RadSec listener; its requests reach the same handler
+	radsecErr := make(chan error, 1)
+	if radsecCfg := cfg.GetRadSec(); radsecCfg.Enabled() {
+		listener, err := radsec.Listen(radsecCfg)
+		if err != nil {
+			log.Fatalf("RadSec listener failed: %v", err)
 		}
+		radsecServer := radsec.NewServer(handler, reloader.Current)
+		go func() {
+			log.Printf("Serving RadSec on %s", listener.Addr())
+			if err := radsecServer.Serve(listener); !errors.Is(err, stream.ErrServerClosed) {
+				radsecErr <- err
+			}
+		}()
+		defer func() {
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := radsecServer.Shutdown(shutdownCtx); err != nil {
+				log.Printf("failed to stop RadSec listener: %v", err)
+			}
+		}()
+	}
 
-		clientIP := getClientIP(r)
-		event, err := models.ParseRADIUSPacket(r.Packet, clientIP)
+	// Wait for shutdown signal or server error
+	select {
+	case <-ctx.Done():
+		log.Println("Shutting down...")
+	case err := <-serverErr:
 		if err != nil {
-			log.Printf("Failed to parse accounting packet: %v", err)
-			return
+			log.Fatalf("RADIUS server failed: %v", err)
 		}
+	case err := <-apiErr:
+		log.Fatalf("Admin API failed: %v", err)
+	case err := <-tcpErr:
+		log.Fatalf("TCP listener failed: %v", err)
+	case err := <-radsecErr:
+		log.Fatalf("RadSec listener failed: %v", err)
+	}
+}
 
-		if err := event.Validate(); err != nil {
-			log.Printf("Invalid accounting record: %v", err)
-			return
+// applyStorageReload applies the reloadable storage settings to store and,
+// for a multi storage, to each of its backends
+func applyStorageReload(store storage.Storage, cfg *config.ControlplaneConfig) {
+	switch s := store.(type) {
+	case *storage.RedisStorage:
+		s.SetTTL(cfg.GetRecordTTL())
+	case *storage.SQLiteStorage:
+		s.SetRetention(cfg.GetStorage().GetSQLite().GetRetention())
+	case *storage.InMemoryStorage:
+		s.SetTTL(cfg.GetStorage().GetMemory().GetTTL())
+	case *storage.MultiStorage:
+		for _, backend := range s.Backends() {
+			applyStorageReload(backend, cfg)
 		}
+	}
+}
 
-		if err := store.Store(context.Background(), event); err != nil {
-			log.Printf("Failed to store accounting record: %v", err)
-			return
+// applyCaptureReload starts, stops or filters the packet capture when the
+// reloaded configuration changes it, leaving changes made through the admin
+// API otherwise
+func applyCaptureReload(capturer *capture.Capturer, old, new *config.CaptureConfig) {
+	if old.Enabled() != new.Enabled() {
+		if err := capturer.SetEnabled(new.Enabled()); err != nil {
+			log.Printf("Failed to stop packet capture: %v", err)
 		}
-
-		log.Printf("Stored %v record: %s", event.GetType(), event.GenerateRedisKey())
+	}
+	if !sameNetworks(old.GetClients(), new.GetClients()) {
+		capturer.SetClients(new.GetClients())
 	}
 }
 
-func getClientIP(r *radius.Request) string {
-	if addr, ok := r.RemoteAddr.(*net.UDPAddr); ok {
-		return addr.IP.String()
+// sameNetworks reports whether two network lists are equal
+func sameNetworks(a, b []*net.IPNet) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].String() != b[i].String() {
+			return false
+		}
 	}
-	return r.RemoteAddr.String()
+	return true
 }
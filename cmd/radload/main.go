@@ -0,0 +1,249 @@
+// radload simulates NAS sessions against a RADIUS accounting server: each
+// session sends a Start, Interim-Updates at an interval and a Stop with
+// growing counters. It measures response latency and loss and, through the
+// admin API, verifies that the stored records match what was sent.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"math/rand"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"layeh.com/radius"
+	"layeh.com/radius/rfc2866"
+
+	"github.com/kal997/radius-accounting-server/internal/models"
+	"github.com/kal997/radius-accounting-server/internal/nas"
+)
+
+// options are the command-line settings of a run
+type options struct {
+	server      string
+	secret      string
+	sessions    int
+	concurrency int
+	rate        float64
+	interims    int
+	interval    time.Duration
+	nasCount    int
+	timeout     time.Duration
+	retries     int
+	seed        int64
+	prefix      string
+	verify      bool
+	api         string
+	apiToken    string
+}
+
+func main() {
+	var opts options
+	flag.StringVar(&opts.server, "server", envOr("RADIUS_SERVER", "127.0.0.1"), "accounting server `host[:port]`, port 1813 by default")
+	flag.StringVar(&opts.secret, "secret", os.Getenv("RADIUS_SHARED_SECRET"), "shared secret")
+	flag.IntVar(&opts.sessions, "sessions", 1000, "sessions to simulate")
+	flag.IntVar(&opts.concurrency, "concurrency", 100, "sessions active at the same time, each with its own socket")
+	flag.Float64Var(&opts.rate, "rate", 0, "maximum requests per second, 0 for no limit")
+	flag.IntVar(&opts.interims, "interims", 2, "Interim-Updates per session")
+	flag.DurationVar(&opts.interval, "interval", time.Second, "time between the requests of a session")
+	flag.IntVar(&opts.nasCount, "nas", 10, "NAS the sessions are spread over")
+	flag.DurationVar(&opts.timeout, "timeout", 2*time.Second, "wait for a response before retransmitting")
+	flag.IntVar(&opts.retries, "retries", 2, "retransmissions of an unanswered request")
+	flag.Int64Var(&opts.seed, "seed", time.Now().UnixNano(), "seed of the simulated traffic")
+	flag.StringVar(&opts.prefix, "prefix", "", "prefix of the session IDs, unique per run by default")
+	flag.BoolVar(&opts.verify, "verify", false, "check the stored records through the admin API after the run")
+	flag.StringVar(&opts.api, "api", envOr("API_ADDRESS", "127.0.0.1:8080"), "admin API `host:port` or URL")
+	flag.StringVar(&opts.apiToken, "api-token", os.Getenv("API_TOKEN"), "admin API bearer token")
+	flag.Parse()
+
+	if err := opts.check(); err != nil {
+		fatalf("%v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	ok, err := run(ctx, opts)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	if !ok {
+		os.Exit(1)
+	}
+}
+
+// check validates the options and fills in the defaults that depend on them
+func (o *options) check() error {
+	if o.secret == "" {
+		return errors.New("a shared secret is required (-secret or RADIUS_SHARED_SECRET)")
+	}
+	if o.sessions < 1 || o.concurrency < 1 || o.nasCount < 1 {
+		return errors.New("-sessions, -concurrency and -nas must be at least 1")
+	}
+	if o.interims < 0 || o.retries < 0 || o.rate < 0 {
+		return errors.New("-interims, -retries and -rate cannot be negative")
+	}
+	if o.verify && o.apiToken == "" {
+		return errors.New("-verify requires the admin API token (-api-token or API_TOKEN)")
+	}
+	if _, _, err := net.SplitHostPort(o.server); err != nil {
+		o.server = net.JoinHostPort(o.server, "1813")
+	}
+	if o.prefix == "" {
+		o.prefix = "load-" + strconv.FormatInt(time.Now().Unix(), 36)
+	}
+	return nil
+}
+
+// run simulates the sessions and reports the results. It returns false when
+// the verification found missing or different records.
+func run(ctx context.Context, opts options) (bool, error) {
+	fmt.Fprintf(os.Stderr, "radload: simulating %d sessions on %d NAS against %s (session IDs %s-*)\n",
+		opts.sessions, opts.nasCount, opts.server, opts.prefix)
+
+	jobs := make(chan int)
+	go func() {
+		defer close(jobs)
+		for n := 0; n < opts.sessions; n++ {
+			select {
+			case jobs <- n:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	stats := newStats()
+	limiter := newLimiter(opts.rate)
+	sent := make([]*sentSession, opts.sessions)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, opts.concurrency)
+	started := time.Now()
+	for w := 0; w < opts.concurrency; w++ {
+		client, err := nas.Dial(opts.server, []byte(opts.secret), opts.timeout, opts.retries)
+		if err != nil {
+			return false, err
+		}
+		rng := rand.New(rand.NewSource(opts.seed + int64(w)))
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer client.Close()
+			for n := range jobs {
+				session := nas.NewSession(rng, opts.prefix, n, opts.nasCount)
+				s, err := simulate(ctx, client, session, opts, limiter, stats)
+				sent[n] = s
+				if err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	elapsed := time.Since(started)
+
+	stats.print(os.Stdout, elapsed)
+	if err := <-errs; err != nil && !errors.Is(err, context.Canceled) {
+		return false, err
+	}
+	if ctx.Err() != nil || !opts.verify {
+		return true, nil
+	}
+
+	report, err := verify(ctx, opts, sent)
+	if err != nil {
+		return false, err
+	}
+	report.print(os.Stdout)
+	return report.ok(), nil
+}
+
+// sentSession records the requests of a session acknowledged by the server,
+// as the server is expected to store them
+type sentSession struct {
+	session  *nas.Session
+	records  []models.AccountingEvent
+	complete bool // Every request was acknowledged
+	retried  bool // Some request was retransmitted and may be stored twice
+}
+
+// simulate runs one session: a Start, the Interim-Updates and a Stop, each
+// after the interval
+func simulate(ctx context.Context, client *nas.Client, session *nas.Session, opts options, limiter *limiter, stats *stats) (*sentSession, error) {
+	secret := []byte(opts.secret)
+	s := &sentSession{session: session, complete: true}
+
+	for i := 0; i <= opts.interims+1; i++ {
+		if i > 0 {
+			select {
+			case <-time.After(opts.interval):
+			case <-ctx.Done():
+				return s, ctx.Err()
+			}
+		}
+
+		now := time.Now()
+		var packet *radius.Packet
+		switch {
+		case i == 0:
+			packet = session.Start(now, secret)
+		case i <= opts.interims:
+			packet = session.Interim(now, secret)
+		default:
+			packet = session.Stop(now, rfc2866.AcctTerminateCause_Value_UserRequest, secret)
+		}
+		statusType := rfc2866.AcctStatusType_Get(packet)
+
+		if err := limiter.wait(ctx); err != nil {
+			return s, err
+		}
+		exchange, err := client.Send(ctx, packet)
+		switch {
+		case errors.Is(err, nas.ErrTimeout):
+			stats.lost(statusType, exchange.Attempts)
+			s.complete = false
+			continue
+		case err != nil:
+			return s, err
+		case exchange.Response.Code != radius.CodeAccountingResponse:
+			stats.lost(statusType, exchange.Attempts)
+			s.complete = false
+			continue
+		}
+		stats.answered(statusType, exchange)
+		s.retried = s.retried || exchange.Attempts > 1
+
+		record, err := models.ParseRADIUSPacket(packet, "")
+		if err != nil {
+			return s, err
+		}
+		clearReceived(record)
+		s.records = append(s.records, record)
+	}
+	return s, nil
+}
+
+// envOr returns the value of an environment variable, or fallback when it
+// is not set
+func envOr(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func fatalf(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, "radload: "+format+"\n", args...)
+	os.Exit(1)
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"layeh.com/radius/rfc2866"
+
+	"github.com/kal997/radius-accounting-server/internal/nas"
+)
+
+// counts are the outcomes of the requests of one type
+type counts struct {
+	requests        int
+	answered        int
+	lost            int // Unanswered after every retransmission
+	retransmissions int
+}
+
+// stats collects the outcome and latency of every request. It is safe for
+// concurrent use.
+type stats struct {
+	mu        sync.Mutex
+	types     map[rfc2866.AcctStatusType]*counts
+	latencies []time.Duration
+}
+
+func newStats() *stats {
+	return &stats{types: map[rfc2866.AcctStatusType]*counts{
+		rfc2866.AcctStatusType_Value_Start:         {},
+		rfc2866.AcctStatusType_Value_InterimUpdate: {},
+		rfc2866.AcctStatusType_Value_Stop:          {},
+	}}
+}
+
+func (s *stats) answered(statusType rfc2866.AcctStatusType, exchange nas.Exchange) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := s.types[statusType]
+	c.requests++
+	c.answered++
+	c.retransmissions += exchange.Attempts - 1
+	s.latencies = append(s.latencies, exchange.Latency)
+}
+
+func (s *stats) lost(statusType rfc2866.AcctStatusType, attempts int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := s.types[statusType]
+	c.requests++
+	c.lost++
+	c.retransmissions += max(attempts-1, 0)
+}
+
+// print writes the request counts, the loss and the latency percentiles of
+// a run that took elapsed
+func (s *stats) print(out io.Writer, elapsed time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var total counts
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "TYPE\tREQUESTS\tANSWERED\tLOST\tRETRANSMISSIONS\t")
+	for _, statusType := range []rfc2866.AcctStatusType{
+		rfc2866.AcctStatusType_Value_Start,
+		rfc2866.AcctStatusType_Value_InterimUpdate,
+		rfc2866.AcctStatusType_Value_Stop,
+	} {
+		c := s.types[statusType]
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t\n", statusType, c.requests, c.answered, c.lost, c.retransmissions)
+		total.requests += c.requests
+		total.answered += c.answered
+		total.lost += c.lost
+		total.retransmissions += c.retransmissions
+	}
+	fmt.Fprintf(w, "Total\t%d\t%d\t%d\t%d\t\n", total.requests, total.answered, total.lost, total.retransmissions)
+	_ = w.Flush()
+
+	fmt.Fprintln(out)
+	fmt.Fprintf(out, "Duration:    %s (%.1f requests/s)\n", elapsed.Round(time.Millisecond), float64(total.requests)/elapsed.Seconds())
+	if total.requests > 0 {
+		attempts := total.requests + total.retransmissions
+		fmt.Fprintf(out, "Loss:        %.2f%% of requests, %.2f%% of transmissions\n",
+			100*float64(total.lost)/float64(total.requests),
+			100*float64(attempts-total.answered)/float64(attempts))
+	}
+	if len(s.latencies) > 0 {
+		sort.Slice(s.latencies, func(i, j int) bool { return s.latencies[i] < s.latencies[j] })
+		fmt.Fprintf(out, "Latency:     p50 %s, p90 %s, p99 %s, max %s\n",
+			percentile(s.latencies, 50), percentile(s.latencies, 90), percentile(s.latencies, 99), s.latencies[len(s.latencies)-1])
+	}
+}
+
+// percentile returns the p-th percentile of sorted latencies
+func percentile(sorted []time.Duration, p int) time.Duration {
+	i := (len(sorted)*p + 99) / 100
+	return sorted[max(i-1, 0)].Round(time.Microsecond)
+}
+
+// limiter spaces requests to a maximum rate. It is safe for concurrent use.
+type limiter struct {
+	interval time.Duration // Zero for no limit
+
+	mu   sync.Mutex
+	next time.Time // Earliest time of the next request
+}
+
+func newLimiter(rate float64) *limiter {
+	l := &limiter{}
+	if rate > 0 {
+		l.interval = time.Duration(float64(time.Second) / rate)
+	}
+	return l
+}
+
+// wait blocks until the next request may be sent
+func (l *limiter) wait(ctx context.Context) error {
+	if l.interval == 0 {
+		return ctx.Err()
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	at := l.next
+	if at.Before(now) {
+		at = now
+	}
+	l.next = at.Add(l.interval)
+	l.mu.Unlock()
+
+	timer := time.NewTimer(time.Until(at))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
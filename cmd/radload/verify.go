@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kal997/radius-accounting-server/internal/models"
+	"github.com/kal997/radius-accounting-server/internal/storage"
+)
+
+// verifyWorkers is the number of concurrent admin API requests
+const verifyWorkers = 8
+
+// maxProblems is the number of differences printed
+const maxProblems = 10
+
+// report is the outcome of the verification of the stored records
+type report struct {
+	mu         sync.Mutex
+	verified   int // Sessions whose records all match
+	skipped    int // Sessions with a lost request, whose records are unknown
+	failed     int // Sessions with missing, unexpected or different records
+	duplicates int // Retransmissions stored as a second record
+	problems   []string
+}
+
+func (r *report) ok() bool {
+	return r.failed == 0
+}
+
+func (r *report) problem(format string, args ...any) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.failed++
+	if len(r.problems) < maxProblems {
+		r.problems = append(r.problems, fmt.Sprintf(format, args...))
+	}
+}
+
+func (r *report) print(out io.Writer) {
+	fmt.Fprintf(out, "Verified:    %d sessions match, %d differ, %d skipped after a lost request, %d duplicate records\n",
+		r.verified, r.failed, r.skipped, r.duplicates)
+	for _, problem := range r.problems {
+		fmt.Fprintf(out, "  %s\n", problem)
+	}
+	if r.failed > len(r.problems) {
+		fmt.Fprintf(out, "  ... and %d more\n", r.failed-len(r.problems))
+	}
+}
+
+// verify reads back the records of every session through the admin API and
+// compares them with the acknowledged requests. Sessions with a lost request
+// are skipped, as the server may have stored it before the response was lost.
+func verify(ctx context.Context, opts options, sent []*sentSession) (*report, error) {
+	base, err := apiURL(opts.api)
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	r := &report{}
+	sessions := make(chan *sentSession)
+	errs := make(chan error, verifyWorkers)
+	var wg sync.WaitGroup
+	for w := 0; w < verifyWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for s := range sessions {
+				stored, err := fetchRecords(ctx, client, base, opts.apiToken, s)
+				if err != nil {
+					errs <- err
+					return
+				}
+				r.compare(s, stored)
+			}
+		}()
+	}
+
+	for _, s := range sent {
+		if s == nil || !s.complete {
+			r.skipped++
+			continue
+		}
+		select {
+		case sessions <- s:
+		case err := <-errs:
+			close(sessions)
+			wg.Wait()
+			return nil, err
+		}
+	}
+	close(sessions)
+	wg.Wait()
+	close(errs)
+	if err := <-errs; err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// compare checks the stored records of a session, oldest first, against the
+// acknowledged requests. A retransmitted request may be stored twice.
+func (r *report) compare(s *sentSession, stored []models.AccountingEvent) {
+	id := s.session.ID
+	duplicates := 0
+	i := 0
+	for _, record := range stored {
+		clearReceived(record)
+		if i > 0 && s.retried && reflect.DeepEqual(record, s.records[i-1]) {
+			duplicates++
+			continue
+		}
+		if i == len(s.records) {
+			r.problem("%s: unexpected %s record", id, storage.RecordType(record))
+			return
+		}
+		if !reflect.DeepEqual(record, s.records[i]) {
+			want, _ := json.Marshal(s.records[i])
+			got, _ := json.Marshal(record)
+			r.problem("%s: stored %s record differs:\n    sent   %s\n    stored %s", id, storage.RecordType(record), want, got)
+			return
+		}
+		i++
+	}
+	if i < len(s.records) {
+		r.problem("%s: %d of %d records missing, first %s", id, len(s.records)-i, len(s.records), storage.RecordType(s.records[i]))
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.verified++
+	r.duplicates += duplicates
+}
+
+// clearReceived clears the fields set by the server on receipt, which the
+// sent records cannot know
+func clearReceived(record models.AccountingEvent) {
+	base := record.Base()
+	base.ClientIP = ""
+	base.Timestamp = ""
+}
+
+// fetchRecords reads the stored records of a session, following every page
+func fetchRecords(ctx context.Context, client *http.Client, base, token string, s *sentSession) ([]models.AccountingEvent, error) {
+	query := url.Values{
+		"username": {s.session.Username},
+		"session":  {s.session.ID},
+		"nas":      {s.session.NASIPAddress.String()},
+	}
+
+	var records []models.AccountingEvent
+	for {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, base+"/api/v1/records?"+query.Encode(), nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		var page struct {
+			Items      []storage.KeyedRecord `json:"items"`
+			NextCursor string                `json:"next_cursor"`
+			Error      string                `json:"error"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("admin API returned %s: %s", resp.Status, page.Error)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode admin API response: %w", err)
+		}
+
+		for _, item := range page.Items {
+			records = append(records, item.Record)
+		}
+		if page.NextCursor == "" {
+			return records, nil
+		}
+		query.Set("cursor", page.NextCursor)
+	}
+}
+
+// apiURL returns the base URL of the admin API from a URL or a host:port,
+// connecting to localhost when it listens on every interface
+func apiURL(address string) (string, error) {
+	if strings.Contains(address, "://") {
+		return strings.TrimSuffix(address, "/"), nil
+	}
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return "", fmt.Errorf("invalid admin API address: %w", err)
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "127.0.0.1"
+	}
+	return "http://" + net.JoinHostPort(host, port), nil
+}
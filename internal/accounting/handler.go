@@ -0,0 +1,119 @@
+// Package accounting handles the RADIUS Accounting-Requests received by
+// radius-controlplane: each request is parsed, validated and stored before
+// it is acknowledged.
+package accounting
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+
+	"layeh.com/radius"
+
+	"github.com/kal997/radius-accounting-server/internal/config"
+	"github.com/kal997/radius-accounting-server/internal/models"
+	"github.com/kal997/radius-accounting-server/internal/storage"
+)
+
+// NewHandler returns the handler storing the records of accounting requests
+// in store and counting them in stats. A retransmitted request that was not
+// acknowledged stores the record parsed the first time, under the same key.
+func NewHandler(store storage.Storage, stats *RequestStats) radius.Handler {
+	pending := newUnacknowledged()
+	return radius.HandlerFunc(func(w radius.ResponseWriter, r *radius.Request) {
+		var resp *radius.Packet
+
+		// Default response code
+		respCode := radius.CodeAccountingResponse
+		respond := true
+
+		defer func() {
+			// Send a response back, even in error cases, unless the record
+			// must be retransmitted by the NAS
+			if !respond {
+				return
+			}
+			resp = r.Response(respCode)
+			if err := w.Write(resp); err != nil {
+				log.Printf("Failed to send accounting response: %v", err)
+			}
+		}()
+
+		if r.Code != radius.CodeAccountingRequest {
+			log.Printf("Received non-accounting request: %d", r.Code)
+			return
+		}
+
+		stats.Received()
+
+		clientIP := getClientIP(r)
+		event, err := models.ParseRADIUSPacket(r.Packet, clientIP)
+		if err != nil {
+			log.Printf("Failed to parse accounting packet: %v", err)
+			stats.Invalid()
+			return
+		}
+
+		if err := event.Validate(); err != nil {
+			log.Printf("Invalid accounting record: %v", err)
+			stats.Invalid()
+			return
+		}
+
+		key := requestKey(clientIP, r.Packet)
+		if first, ok := pending.lookup(key); ok {
+			event = first
+		}
+
+		if err := store.Store(context.Background(), event); err != nil {
+			log.Printf("Failed to store accounting record: %v", err)
+			stats.Failed()
+			if errors.Is(err, storage.ErrQuorumNotMet) {
+				log.Printf("Not acknowledging %v record so the NAS retransmits it", event.GetType())
+				pending.remember(key, event)
+				respond = false
+			}
+			return
+		}
+		pending.forget(key)
+
+		stats.Stored()
+		log.Printf("Stored %v record: %s", event.GetType(), event.GenerateRedisKey())
+	})
+}
+
+// SecretSource resolves the secret for each packet, or TCP connection, from
+// the client table of the configuration returned by current, falling back to
+// the shared secret for unlisted clients. current is called for every packet
+// and connection so that reloaded secrets apply immediately.
+func SecretSource(current func() *config.ControlplaneConfig) radius.SecretSource {
+	return secretSourceFunc(func(remoteAddr net.Addr) []byte {
+		return []byte(current().SecretFor(remoteIP(remoteAddr)))
+	})
+}
+
+type secretSourceFunc func(remoteAddr net.Addr) []byte
+
+func (f secretSourceFunc) RADIUSSecret(ctx context.Context, remoteAddr net.Addr) ([]byte, error) {
+	return f(remoteAddr), nil
+}
+
+func getClientIP(r *radius.Request) string {
+	if ip := remoteIP(r.RemoteAddr); ip != nil {
+		return ip.String()
+	}
+	return r.RemoteAddr.String()
+}
+
+// remoteIP returns the IP address of a UDP or TCP peer, nil for other
+// addresses
+func remoteIP(addr net.Addr) net.IP {
+	switch addr := addr.(type) {
+	case *net.UDPAddr:
+		return addr.IP
+	case *net.TCPAddr:
+		return addr.IP
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package accounting
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"layeh.com/radius"
+	"layeh.com/radius/rfc2865"
+	"layeh.com/radius/rfc2866"
+
+	"github.com/kal997/radius-accounting-server/internal/models"
+	"github.com/kal997/radius-accounting-server/internal/storage"
+)
+
+// quorumStorage fails the first Store calls with storage.ErrQuorumNotMet and
+// records the key of every call
+type quorumStorage struct {
+	failures int
+	keys     []string
+}
+
+func (q *quorumStorage) Store(ctx context.Context, record models.AccountingEvent) error {
+	q.keys = append(q.keys, record.GenerateRedisKey())
+	if q.failures > 0 {
+		q.failures--
+		return fmt.Errorf("%w: postgres: connection refused", storage.ErrQuorumNotMet)
+	}
+	return nil
+}
+
+func (q *quorumStorage) HealthCheck(ctx context.Context) error { return nil }
+
+func (q *quorumStorage) Close() error { return nil }
+
+// responses collects the responses written by the handler
+type responses []*radius.Packet
+
+func (r *responses) Write(packet *radius.Packet) error {
+	*r = append(*r, packet)
+	return nil
+}
+
+func TestHandler_Retransmission(t *testing.T) {
+	store := &quorumStorage{failures: 1}
+	handler := NewHandler(store, NewRequestStats())
+
+	packet := radius.New(radius.CodeAccountingRequest, []byte("testing123"))
+	require.NoError(t, rfc2865.UserName_SetString(packet, "alice"))
+	require.NoError(t, rfc2865.NASIPAddress_Set(packet, net.IPv4(10, 0, 0, 1)))
+	require.NoError(t, rfc2866.AcctSessionID_SetString(packet, "session-1"))
+	require.NoError(t, rfc2866.AcctStatusType_Set(packet, rfc2866.AcctStatusType_Value_Start))
+	request := &radius.Request{
+		RemoteAddr: &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 1813},
+		Packet:     packet,
+	}
+
+	// The quorum is not met and the request is not acknowledged
+	var w responses
+	handler.ServeRADIUS(&w, request)
+	assert.Empty(t, w)
+
+	// The retransmission stores the same record under the same key
+	handler.ServeRADIUS(&w, request)
+	require.Len(t, w, 1)
+	assert.Equal(t, radius.CodeAccountingResponse, w[0].Code)
+	require.Len(t, store.keys, 2)
+	assert.Equal(t, store.keys[0], store.keys[1])
+
+	// Once acknowledged, the request is forgotten
+	handler.ServeRADIUS(&w, request)
+	require.Len(t, store.keys, 3)
+	assert.NotEqual(t, store.keys[0], store.keys[2])
+}
@@ -0,0 +1,80 @@
+package accounting
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"layeh.com/radius"
+
+	"github.com/kal997/radius-accounting-server/internal/models"
+)
+
+// Unacknowledged records are remembered for unacknowledgedTTL, up to
+// maxUnacknowledged of them, which covers the retransmissions of a NAS
+const (
+	unacknowledgedTTL = 10 * time.Minute
+	maxUnacknowledged = 10000
+)
+
+// unacknowledged remembers the records of the requests that were not
+// acknowledged. A NAS retransmits a request unchanged, and the record parsed
+// the first time is stored again instead of a new one, so that its receipt
+// time and therefore its key do not change.
+type unacknowledged struct {
+	mu      sync.Mutex
+	entries map[string]unacknowledgedEntry
+}
+
+type unacknowledgedEntry struct {
+	event     models.AccountingEvent
+	expiresAt time.Time
+}
+
+func newUnacknowledged() *unacknowledged {
+	return &unacknowledged{entries: make(map[string]unacknowledgedEntry)}
+}
+
+// requestKey identifies a request by its client, identifier and
+// authenticator, which a retransmission keeps
+func requestKey(clientIP string, packet *radius.Packet) string {
+	return fmt.Sprintf("%s/%d/%x", clientIP, packet.Identifier, packet.Authenticator)
+}
+
+// lookup returns the record of an unacknowledged request
+func (u *unacknowledged) lookup(key string) (models.AccountingEvent, bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	entry, ok := u.entries[key]
+	if !ok || !time.Now().Before(entry.expiresAt) {
+		return nil, false
+	}
+	return entry.event, true
+}
+
+// remember keeps the record of a request that was not acknowledged
+func (u *unacknowledged) remember(key string, event models.AccountingEvent) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	now := time.Now()
+	if _, ok := u.entries[key]; !ok && len(u.entries) >= maxUnacknowledged {
+		for k, entry := range u.entries {
+			if !now.Before(entry.expiresAt) {
+				delete(u.entries, k)
+			}
+		}
+		if len(u.entries) >= maxUnacknowledged {
+			return
+		}
+	}
+	u.entries[key] = unacknowledgedEntry{event: event, expiresAt: now.Add(unacknowledgedTTL)}
+}
+
+// forget drops a request once it is acknowledged
+func (u *unacknowledged) forget(key string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	delete(u.entries, key)
+}
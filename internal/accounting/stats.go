@@ -0,0 +1,54 @@
+package accounting
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// RequestStats counts the accounting requests handled by the RADIUS server.
+// It is safe for concurrent use.
+type RequestStats struct {
+	started  time.Time
+	received atomic.Uint64
+	stored   atomic.Uint64
+	invalid  atomic.Uint64
+	failed   atomic.Uint64
+}
+
+// NewRequestStats creates zeroed counters, counting uptime from now
+func NewRequestStats() *RequestStats {
+	return &RequestStats{started: time.Now()}
+}
+
+// Started returns when the counters were created
+func (s *RequestStats) Started() time.Time { return s.started }
+
+// Received counts an accounting request
+func (s *RequestStats) Received() { s.received.Add(1) }
+
+// Stored counts a record stored successfully
+func (s *RequestStats) Stored() { s.stored.Add(1) }
+
+// Invalid counts a request that could not be parsed or validated
+func (s *RequestStats) Invalid() { s.invalid.Add(1) }
+
+// Failed counts a record that could not be stored
+func (s *RequestStats) Failed() { s.failed.Add(1) }
+
+// RequestCounts is a snapshot of the counters
+type RequestCounts struct {
+	Received uint64 `json:"received"`
+	Stored   uint64 `json:"stored"`
+	Invalid  uint64 `json:"invalid"`
+	Failed   uint64 `json:"failed"`
+}
+
+// Counts returns the current counters
+func (s *RequestStats) Counts() RequestCounts {
+	return RequestCounts{
+		Received: s.received.Load(),
+		Stored:   s.stored.Load(),
+		Invalid:  s.invalid.Load(),
+		Failed:   s.failed.Load(),
+	}
+}
@@ -0,0 +1,434 @@
+// Package api serves the admin REST API of radius-controlplane: active
+// sessions, session history, accounting records, per-NAS summaries and
+// server statistics, read from the storage layer, and control of the packet
+// capture.
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kal997/radius-accounting-server/internal/accounting"
+	"github.com/kal997/radius-accounting-server/internal/capture"
+	"github.com/kal997/radius-accounting-server/internal/config"
+	"github.com/kal997/radius-accounting-server/internal/storage"
+)
+
+//go:embed openapi.yaml
+var openAPISpec []byte
+
+// healthTimeout bounds the storage health check of /healthz and /stats
+const healthTimeout = 2 * time.Second
+
+// Server handles the API requests. Every route but /healthz and the OpenAPI
+// document requires the bearer token.
+type Server struct {
+	store   storage.Storage
+	backend string
+	stats   *accounting.RequestStats
+	capture *capture.Capturer // Nil when packet capture is not configured
+	token   func() string
+	mux     *http.ServeMux
+}
+
+// NewServer creates an API server reading from store, the configured
+// backend. capturer may be nil when packet capture is not configured. token
+// is called for every request so that a token rotated by a configuration
+// reload applies immediately.
+func NewServer(store storage.Storage, backend string, stats *accounting.RequestStats, capturer *capture.Capturer, token func() string) *Server {
+	s := &Server{
+		store:   store,
+		backend: backend,
+		stats:   stats,
+		capture: capturer,
+		token:   token,
+		mux:     http.NewServeMux(),
+	}
+
+	s.mux.HandleFunc("GET /healthz", s.handleHealth)
+	s.mux.HandleFunc("GET /api/v1/openapi.yaml", s.handleOpenAPI)
+	s.mux.Handle("GET /api/v1/sessions", s.authenticated(s.handleSessions))
+	s.mux.Handle("GET /api/v1/sessions/{nas}/{session}", s.authenticated(s.handleSession))
+	s.mux.Handle("GET /api/v1/users/{username}/sessions", s.authenticated(s.handleUserSessions))
+	s.mux.Handle("GET /api/v1/records", s.authenticated(s.handleRecords))
+	s.mux.Handle("GET /api/v1/records/{key...}", s.authenticated(s.handleRecord))
+	s.mux.Handle("GET /api/v1/nas", s.authenticated(s.handleNAS))
+	s.mux.Handle("GET /api/v1/ip/{prefix...}", s.authenticated(s.handleIP))
+	s.mux.Handle("GET /api/v1/stats", s.authenticated(s.handleStats))
+	s.mux.Handle("GET /api/v1/capture", s.authenticated(s.handleCapture))
+	s.mux.Handle("PUT /api/v1/capture", s.authenticated(s.handleUpdateCapture))
+	s.mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, "not found")
+	})
+
+	return s
+}
+
+// ServeHTTP implements http.Handler
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// authenticated rejects requests without the bearer token. Tokens are
+// compared in constant time.
+func (s *Server) authenticated(next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		want := s.token()
+		if !ok || want == "" || subtle.ConstantTimeCompare([]byte(token), []byte(want)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="radius-accounting"`)
+			writeError(w, http.StatusUnauthorized, "missing or invalid bearer token")
+			return
+		}
+		next(w, r)
+	})
+}
+
+// page is the body of every paginated response
+type page[T any] struct {
+	Items      []T    `json:"items"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), healthTimeout)
+	defer cancel()
+
+	if err := s.store.HealthCheck(ctx); err != nil {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"status": "unhealthy", "error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func (s *Server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/yaml")
+	_, _ = w.Write(openAPISpec)
+}
+
+func (s *Server) handleSessions(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	s.listSessions(w, r, storage.SessionQuery{
+		Username:     query.Get("username"),
+		NASIPAddress: query.Get("nas"),
+	})
+}
+
+func (s *Server) handleUserSessions(w http.ResponseWriter, r *http.Request) {
+	s.listSessions(w, r, storage.SessionQuery{
+		Username:     r.PathValue("username"),
+		NASIPAddress: r.URL.Query().Get("nas"),
+	})
+}
+
+// listSessions completes q with the active and pagination parameters and
+// writes one page of sessions
+func (s *Server) listSessions(w http.ResponseWriter, r *http.Request, q storage.SessionQuery) {
+	tracker, ok := s.store.(storage.SessionTracker)
+	if !ok {
+		writeError(w, http.StatusNotImplemented, storage.ErrSessionsNotSupported.Error())
+		return
+	}
+
+	query := r.URL.Query()
+	var err error
+	if q.ActiveOnly, err = parseBool(query.Get("active")); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid active: "+err.Error())
+		return
+	}
+	if q.Limit, err = parseLimit(query.Get("limit")); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	q.Cursor = query.Get("cursor")
+
+	result, err := tracker.Sessions(r.Context(), q)
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, page[storage.Session]{
+		Items:      nonNil(result.Sessions),
+		NextCursor: result.NextCursor,
+	})
+}
+
+func (s *Server) handleSession(w http.ResponseWriter, r *http.Request) {
+	tracker, ok := s.store.(storage.SessionTracker)
+	if !ok {
+		writeError(w, http.StatusNotImplemented, storage.ErrSessionsNotSupported.Error())
+		return
+	}
+
+	session, err := tracker.Session(r.Context(), r.PathValue("nas"), r.PathValue("session"))
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, session)
+}
+
+func (s *Server) handleRecords(w http.ResponseWriter, r *http.Request) {
+	querier, ok := s.store.(storage.Querier)
+	if !ok {
+		writeError(w, http.StatusNotImplemented, storage.ErrQueryNotSupported.Error())
+		return
+	}
+
+	query := r.URL.Query()
+	q := storage.Query{
+		Username:         query.Get("username"),
+		AcctSessionID:    query.Get("session"),
+		NASIPAddress:     query.Get("nas"),
+		FramedIPAddress:  query.Get("framed_ip"),
+		CallingStationID: query.Get("calling_station"),
+		Cursor:           query.Get("cursor"),
+	}
+
+	var err error
+	if q.From, err = parseTime(query.Get("from")); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid from: "+err.Error())
+		return
+	}
+	if q.To, err = parseTime(query.Get("to")); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid to: "+err.Error())
+		return
+	}
+	if q.Limit, err = parseLimit(query.Get("limit")); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	result, err := querier.Query(r.Context(), q)
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+
+	records := make([]storage.KeyedRecord, len(result.Records))
+	for i, event := range result.Records {
+		records[i] = storage.NewKeyedRecord(event)
+	}
+	writeJSON(w, http.StatusOK, page[storage.KeyedRecord]{Items: records, NextCursor: result.NextCursor})
+}
+
+func (s *Server) handleRecord(w http.ResponseWriter, r *http.Request) {
+	querier, ok := s.store.(storage.Querier)
+	if !ok {
+		writeError(w, http.StatusNotImplemented, storage.ErrQueryNotSupported.Error())
+		return
+	}
+
+	event, err := querier.Record(r.Context(), r.PathValue("key"))
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, storage.NewKeyedRecord(event))
+}
+
+func (s *Server) handleNAS(w http.ResponseWriter, r *http.Request) {
+	tracker, ok := s.store.(storage.SessionTracker)
+	if !ok {
+		writeError(w, http.StatusNotImplemented, storage.ErrSessionsNotSupported.Error())
+		return
+	}
+
+	summaries, err := tracker.NASSummaries(r.Context())
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, page[storage.NASSummary]{Items: nonNil(summaries)})
+}
+
+func (s *Server) handleIP(w http.ResponseWriter, r *http.Request) {
+	attributor, ok := s.store.(storage.IPAttributor)
+	if !ok {
+		writeError(w, http.StatusNotImplemented, storage.ErrIPLookupNotSupported.Error())
+		return
+	}
+
+	prefix, err := storage.ParseIPPrefix(r.PathValue("prefix"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	at := time.Now()
+	if value := r.URL.Query().Get("at"); value != "" {
+		if at, err = parseTime(value); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid at: "+err.Error())
+			return
+		}
+	}
+
+	assignments, err := attributor.LookupIP(r.Context(), prefix, at)
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, page[storage.IPAssignment]{Items: nonNil(assignments)})
+}
+
+// storageStatus reports the configured backend and whether it is healthy
+type storageStatus struct {
+	Backend string `json:"backend"`
+	Healthy bool   `json:"healthy"`
+	Error   string `json:"error,omitempty"`
+}
+
+// serverStats is the body of /stats
+type serverStats struct {
+	StartedAt     time.Time                `json:"started_at"`
+	UptimeSeconds int64                    `json:"uptime_seconds"`
+	Requests      accounting.RequestCounts `json:"requests"`
+	Storage       storageStatus            `json:"storage"`
+}
+
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), healthTimeout)
+	defer cancel()
+
+	status := storageStatus{Backend: s.backend, Healthy: true}
+	if err := s.store.HealthCheck(ctx); err != nil {
+		status.Healthy = false
+		status.Error = err.Error()
+	}
+
+	writeJSON(w, http.StatusOK, serverStats{
+		StartedAt:     s.stats.Started().UTC(),
+		UptimeSeconds: int64(time.Since(s.stats.Started()).Seconds()),
+		Requests:      s.stats.Counts(),
+		Storage:       status,
+	})
+}
+
+// errCaptureNotConfigured answers capture requests without a capture
+// directory
+const errCaptureNotConfigured = "packet capture is not configured"
+
+func (s *Server) handleCapture(w http.ResponseWriter, r *http.Request) {
+	if s.capture == nil {
+		writeError(w, http.StatusNotImplemented, errCaptureNotConfigured)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.capture.Status())
+}
+
+// captureUpdate is the body of PUT /capture; omitted fields are unchanged
+type captureUpdate struct {
+	Enabled *bool     `json:"enabled"`
+	Clients *[]string `json:"clients"`
+}
+
+func (s *Server) handleUpdateCapture(w http.ResponseWriter, r *http.Request) {
+	if s.capture == nil {
+		writeError(w, http.StatusNotImplemented, errCaptureNotConfigured)
+		return
+	}
+
+	var update captureUpdate
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid body: "+err.Error())
+		return
+	}
+	var clients []*net.IPNet
+	if update.Clients != nil {
+		for _, value := range *update.Clients {
+			network, err := config.ParseClientAddress(value)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			clients = append(clients, network)
+		}
+	}
+
+	if update.Clients != nil {
+		s.capture.SetClients(clients)
+	}
+	if update.Enabled != nil {
+		if err := s.capture.SetEnabled(*update.Enabled); err != nil {
+			log.Printf("API capture error: %v", err)
+			writeError(w, http.StatusInternalServerError, "internal error")
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, s.capture.Status())
+}
+
+// parseLimit parses the page size; zero leaves the default to the storage
+func parseLimit(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 1 || limit > storage.MaxQueryLimit {
+		return 0, fmt.Errorf("limit must be between 1 and %d", storage.MaxQueryLimit)
+	}
+	return limit, nil
+}
+
+// parseTime parses an RFC 3339 time; empty means no bound
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339Nano, value)
+}
+
+func parseBool(value string) (bool, error) {
+	if value == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(value)
+}
+
+// nonNil makes empty lists encode as [] rather than null
+func nonNil[T any](items []T) []T {
+	if items == nil {
+		return []T{}
+	}
+	return items
+}
+
+// writeStorageError maps storage errors to HTTP statuses. Unexpected errors
+// are logged and reported without details.
+func writeStorageError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, storage.ErrInvalidQuery):
+		writeError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, storage.ErrNotFound):
+		writeError(w, http.StatusNotFound, "not found")
+	case errors.Is(err, storage.ErrQueryNotSupported),
+		errors.Is(err, storage.ErrSessionsNotSupported),
+		errors.Is(err, storage.ErrIPLookupNotSupported):
+		writeError(w, http.StatusNotImplemented, err.Error())
+	default:
+		log.Printf("API storage error: %v", err)
+		writeError(w, http.StatusInternalServerError, "internal error")
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Printf("Failed to write API response: %v", err)
+	}
+}
@@ -0,0 +1,327 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kal997/radius-accounting-server/internal/accounting"
+	"github.com/kal997/radius-accounting-server/internal/capture"
+	"github.com/kal997/radius-accounting-server/internal/config"
+	"github.com/kal997/radius-accounting-server/internal/models"
+	"github.com/kal997/radius-accounting-server/internal/storage"
+)
+
+const testToken = "0123456789abcdef"
+
+// newTestServer serves the API over an in-memory storage holding two
+// sessions of alice, one stopped and one active, and a session of bob
+func newTestServer(t *testing.T) (*httptest.Server, time.Time) {
+	t.Helper()
+
+	_ = os.Setenv("RADIUS_SHARED_SECRET", "testing123")
+	_ = os.Setenv("STORAGE_BACKEND", "memory")
+	t.Cleanup(func() {
+		_ = os.Unsetenv("RADIUS_SHARED_SECRET")
+		_ = os.Unsetenv("STORAGE_BACKEND")
+	})
+
+	cfg, err := config.LoadControlplane("", nil)
+	require.NoError(t, err)
+	store := storage.NewInMemoryStorage(cfg)
+	t.Cleanup(func() { _ = store.Close() })
+
+	start := time.Now().Add(-time.Hour).Truncate(time.Second).UTC()
+	base := func(user, session, nas string, minute int) models.BaseAccountingRecord {
+		return models.BaseAccountingRecord{
+			Username:      user,
+			AcctSessionID: session,
+			NASIPAddress:  nas,
+			Timestamp:     start.Add(time.Duration(minute) * time.Minute).Format(time.RFC3339),
+		}
+	}
+	records := []models.AccountingEvent{
+		&models.StartRecord{BaseAccountingRecord: base("alice", "a1", "192.168.1.1", 0), FramedIPAddress: "10.0.0.1"},
+		&models.StopRecord{BaseAccountingRecord: base("alice", "a1", "192.168.1.1", 1), SessionTime: 60, TerminateCause: "1"},
+		&models.StartRecord{BaseAccountingRecord: base("alice", "a2", "192.168.1.1", 2), FramedIPAddress: "10.0.0.1"},
+		&models.StartRecord{BaseAccountingRecord: base("bob", "b1", "192.168.1.2", 3), FramedIPAddress: "10.0.0.2"},
+	}
+	for _, record := range records {
+		require.NoError(t, store.Store(context.Background(), record))
+	}
+
+	stats := accounting.NewRequestStats()
+	stats.Received()
+	stats.Stored()
+
+	server := httptest.NewServer(NewServer(store, "memory", stats, nil, func() string { return testToken }))
+	t.Cleanup(server.Close)
+	return server, start
+}
+
+// get requests path with the test token and decodes the JSON response
+func get(t *testing.T, server *httptest.Server, path string, body any) int {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, server.URL+path, nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+testToken)
+
+	resp, err := server.Client().Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	if body != nil {
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(body))
+	}
+	return resp.StatusCode
+}
+
+type sessionPage struct {
+	Items      []storage.Session `json:"items"`
+	NextCursor string            `json:"next_cursor"`
+}
+
+func sessionIDs(page sessionPage) []string {
+	var ids []string
+	for _, session := range page.Items {
+		ids = append(ids, session.AcctSessionID)
+	}
+	return ids
+}
+
+func TestServer_Authentication(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	tests := []struct {
+		name   string
+		header string
+	}{
+		{name: "missing", header: ""},
+		{name: "wrong token", header: "Bearer wrong-token-0000000"},
+		{name: "wrong scheme", header: "Basic " + testToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, server.URL+"/api/v1/stats", nil)
+			require.NoError(t, err)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+
+			resp, err := server.Client().Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+			assert.Contains(t, resp.Header.Get("WWW-Authenticate"), "Bearer")
+		})
+	}
+
+	t.Run("public endpoints", func(t *testing.T) {
+		for _, path := range []string{"/healthz", "/api/v1/openapi.yaml"} {
+			resp, err := server.Client().Get(server.URL + path)
+			require.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, http.StatusOK, resp.StatusCode, path)
+		}
+	})
+}
+
+func TestServer_Sessions(t *testing.T) {
+	server, start := newTestServer(t)
+
+	var page sessionPage
+	require.Equal(t, http.StatusOK, get(t, server, "/api/v1/sessions?active=true", &page))
+	assert.Equal(t, []string{"a2", "b1"}, sessionIDs(page))
+
+	page = sessionPage{}
+	require.Equal(t, http.StatusOK, get(t, server, "/api/v1/users/alice/sessions?limit=1", &page))
+	assert.Equal(t, []string{"a1"}, sessionIDs(page))
+	require.NotEmpty(t, page.NextCursor)
+
+	cursor := page.NextCursor
+	page = sessionPage{}
+	require.Equal(t, http.StatusOK, get(t, server, "/api/v1/users/alice/sessions?limit=1&cursor="+cursor, &page))
+	assert.Equal(t, []string{"a2"}, sessionIDs(page))
+
+	page = sessionPage{}
+	require.Equal(t, http.StatusOK, get(t, server, "/api/v1/users/alice/sessions?active=1", &page))
+	assert.Equal(t, []string{"a2"}, sessionIDs(page))
+
+	var session storage.Session
+	require.Equal(t, http.StatusOK, get(t, server, "/api/v1/sessions/192.168.1.1/a1", &session))
+	assert.Equal(t, 60, session.SessionTime)
+	require.NotNil(t, session.Stop)
+	assert.True(t, start.Add(time.Minute).Equal(*session.Stop))
+
+	var apiErr map[string]string
+	assert.Equal(t, http.StatusNotFound, get(t, server, "/api/v1/sessions/192.168.1.2/a1", &apiErr))
+	assert.Equal(t, http.StatusBadRequest, get(t, server, "/api/v1/sessions", &apiErr))
+	assert.Contains(t, apiErr["error"], "filter is required")
+	assert.Equal(t, http.StatusBadRequest, get(t, server, "/api/v1/sessions?active=maybe", &apiErr))
+	assert.Equal(t, http.StatusBadRequest, get(t, server, "/api/v1/sessions?active=true&cursor=bogus", &apiErr))
+}
+
+func TestServer_Records(t *testing.T) {
+	server, start := newTestServer(t)
+
+	type recordPage struct {
+		Items []struct {
+			Key    string         `json:"key"`
+			Type   string         `json:"type"`
+			Record map[string]any `json:"record"`
+		} `json:"items"`
+		NextCursor string `json:"next_cursor"`
+	}
+
+	var page recordPage
+	require.Equal(t, http.StatusOK, get(t, server, "/api/v1/records?username=alice&session=a1", &page))
+	require.Len(t, page.Items, 2)
+	assert.Equal(t, "start", page.Items[0].Type)
+	assert.Equal(t, "stop", page.Items[1].Type)
+	assert.Equal(t, "10.0.0.1", page.Items[0].Record["framed_ip_address"])
+
+	query := url.Values{"from": {start.Add(2 * time.Minute).Format(time.RFC3339)}}
+	page = recordPage{}
+	require.Equal(t, http.StatusOK, get(t, server, "/api/v1/records?"+query.Encode(), &page))
+	assert.Len(t, page.Items, 2)
+
+	key := page.Items[0].Key
+	var record struct {
+		Key  string `json:"key"`
+		Type string `json:"type"`
+	}
+	require.Equal(t, http.StatusOK, get(t, server, "/api/v1/records/"+url.PathEscape(key), &record))
+	assert.Equal(t, key, record.Key)
+	assert.Equal(t, "start", record.Type)
+
+	var apiErr map[string]string
+	assert.Equal(t, http.StatusNotFound, get(t, server, "/api/v1/records/radius:acct:nobody", &apiErr))
+	assert.Equal(t, http.StatusBadRequest, get(t, server, "/api/v1/records?limit=0", &apiErr))
+	assert.Equal(t, http.StatusBadRequest, get(t, server, "/api/v1/records?from=yesterday", &apiErr))
+}
+
+func TestServer_NASAndIP(t *testing.T) {
+	server, start := newTestServer(t)
+
+	var nas struct {
+		Items []storage.NASSummary `json:"items"`
+	}
+	require.Equal(t, http.StatusOK, get(t, server, "/api/v1/nas", &nas))
+	require.Len(t, nas.Items, 2)
+	assert.Equal(t, "192.168.1.1", nas.Items[0].NASIPAddress)
+	assert.Equal(t, 1, nas.Items[0].ActiveSessions)
+	assert.Equal(t, uint64(2), nas.Items[0].Starts)
+	assert.Equal(t, uint64(1), nas.Items[0].Stops)
+
+	var ip struct {
+		Items []storage.IPAssignment `json:"items"`
+	}
+	require.Equal(t, http.StatusOK, get(t, server, "/api/v1/ip/10.0.0.0/24", &ip))
+	require.Len(t, ip.Items, 2)
+	assert.Equal(t, "a2", ip.Items[0].AcctSessionID)
+	assert.Equal(t, "b1", ip.Items[1].AcctSessionID)
+
+	at := url.QueryEscape(start.Add(30 * time.Second).Format(time.RFC3339))
+	require.Equal(t, http.StatusOK, get(t, server, "/api/v1/ip/10.0.0.1?at="+at, &ip))
+	require.Len(t, ip.Items, 1)
+	assert.Equal(t, "a1", ip.Items[0].AcctSessionID)
+
+	var apiErr map[string]string
+	assert.Equal(t, http.StatusBadRequest, get(t, server, "/api/v1/ip/not-an-ip", &apiErr))
+}
+
+func TestServer_Stats(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	var stats serverStats
+	require.Equal(t, http.StatusOK, get(t, server, "/api/v1/stats", &stats))
+
+	assert.Equal(t, uint64(1), stats.Requests.Received)
+	assert.Equal(t, uint64(1), stats.Requests.Stored)
+	assert.Equal(t, "memory", stats.Storage.Backend)
+	assert.True(t, stats.Storage.Healthy)
+	assert.WithinDuration(t, time.Now(), stats.StartedAt, time.Minute)
+
+	var apiErr map[string]string
+	assert.Equal(t, http.StatusNotFound, get(t, server, "/api/v1/unknown", &apiErr))
+}
+
+func TestServer_Capture(t *testing.T) {
+	t.Setenv("RADIUS_SHARED_SECRET", "testing123")
+	t.Setenv("STORAGE_BACKEND", "memory")
+	t.Setenv("CAPTURE_DIRECTORY", t.TempDir())
+	cfg, err := config.LoadControlplane("", nil)
+	require.NoError(t, err)
+	capturer, err := capture.New(cfg.GetCapture())
+	require.NoError(t, err)
+	defer capturer.Close()
+
+	server := httptest.NewServer(NewServer(storage.NewInMemoryStorage(cfg), "memory", accounting.NewRequestStats(), capturer, func() string { return testToken }))
+	defer server.Close()
+
+	put := func(body string, response any) int {
+		req, err := http.NewRequest(http.MethodPut, server.URL+"/api/v1/capture", strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		resp, err := server.Client().Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(response))
+		return resp.StatusCode
+	}
+
+	var status capture.Status
+	require.Equal(t, http.StatusOK, get(t, server, "/api/v1/capture", &status))
+	assert.False(t, status.Enabled)
+	assert.Equal(t, "pcapng", status.Format)
+	assert.Empty(t, status.Clients)
+
+	require.Equal(t, http.StatusOK, put(`{"enabled": true, "clients": ["192.168.1.1", "10.0.0.0/8"]}`, &status))
+	assert.True(t, status.Enabled)
+	assert.Equal(t, []string{"192.168.1.1/32", "10.0.0.0/8"}, status.Clients)
+
+	// Omitted fields are unchanged
+	require.Equal(t, http.StatusOK, put(`{"enabled": false}`, &status))
+	assert.False(t, status.Enabled)
+	assert.Len(t, status.Clients, 2)
+
+	var apiErr map[string]string
+	assert.Equal(t, http.StatusBadRequest, put(`{"clients": ["nas-1"]}`, &apiErr))
+	assert.Contains(t, apiErr["error"], "nas-1")
+	assert.Equal(t, http.StatusBadRequest, put(`{"clients": [""]}`, &apiErr))
+	assert.Equal(t, "client address cannot be empty", apiErr["error"])
+	assert.Equal(t, http.StatusBadRequest, put(`not json`, &apiErr))
+}
+
+func TestServer_NotSupported(t *testing.T) {
+	server := httptest.NewServer(NewServer(&statusOnlyStorage{}, "postgres", accounting.NewRequestStats(), nil, func() string { return testToken }))
+	defer server.Close()
+
+	var apiErr map[string]string
+	assert.Equal(t, http.StatusNotImplemented, get(t, server, "/api/v1/sessions?active=true", &apiErr))
+	assert.Equal(t, http.StatusNotImplemented, get(t, server, "/api/v1/records", &apiErr))
+	assert.Equal(t, http.StatusNotImplemented, get(t, server, "/api/v1/ip/10.0.0.1", &apiErr))
+	assert.Equal(t, http.StatusNotImplemented, get(t, server, "/api/v1/capture", &apiErr))
+}
+
+// statusOnlyStorage is a backend that supports none of the read interfaces
+type statusOnlyStorage struct{}
+
+func (s *statusOnlyStorage) Store(ctx context.Context, record models.AccountingEvent) error {
+	return nil
+}
+func (s *statusOnlyStorage) HealthCheck(ctx context.Context) error { return nil }
+func (s *statusOnlyStorage) Close() error                          { return nil }
@@ -0,0 +1,359 @@
+// Package archive saves accounting records to hourly gzip compressed JSON
+// lines files before they expire from storage, and reads them back.
+//
+// Records are appended to the segment of the current hour, a hidden .part
+// file. A segment is sealed at the end of its hour, or earlier when records
+// close to expiry were added to it: the file is synced and renamed, e.g. to
+// radius-accounting-20240115T10Z.jsonl.gz, and its manifest, with the record
+// count, event time range and SHA-256 checksum, is written next to it as
+// radius-accounting-20240115T10Z.jsonl.gz.manifest.json. Only then are the
+// records marked archived in storage, so a crash loses nothing that is not
+// archived again by the next sweep.
+package archive
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kal997/radius-accounting-server/internal/export"
+	"github.com/kal997/radius-accounting-server/internal/models"
+	"github.com/kal997/radius-accounting-server/internal/storage"
+)
+
+const (
+	filePrefix     = "radius-accounting-"
+	fileExtension  = ".jsonl.gz"
+	manifestSuffix = ".manifest.json"
+	partSuffix     = ".part"
+	hourLayout     = "20060102T15Z"
+)
+
+// Manifest describes a sealed archive file
+type Manifest struct {
+	File       string    `json:"file"` // Base name of the archive file
+	Records    int       `json:"records"`
+	Bytes      int64     `json:"bytes"`
+	SHA256     string    `json:"sha256"`      // Hex checksum of the archive file
+	FirstEvent time.Time `json:"first_event"` // Earliest event time of the records
+	LastEvent  time.Time `json:"last_event"`  // Latest event time of the records
+	Created    time.Time `json:"created"`     // When the first record was added
+	Sealed     time.Time `json:"sealed"`
+}
+
+// Covers reports whether the file may hold records with event times in
+// [from, to); a zero bound is open
+func (m *Manifest) Covers(from, to time.Time) bool {
+	if !from.IsZero() && m.LastEvent.Before(from) {
+		return false
+	}
+	return to.IsZero() || m.FirstEvent.Before(to)
+}
+
+// Archiver writes records to the archive directory and marks them archived
+// in storage once their segment is sealed. It is safe for concurrent use;
+// run a single archiver per directory.
+type Archiver struct {
+	tracker storage.ArchiveTracker
+	dir     string
+	now     func() time.Time
+
+	mu  sync.Mutex
+	seg *segment // The open segment, nil until a record is added
+}
+
+// New creates an archiver writing to dir. Segments left behind by a crashed
+// archiver are removed: their records were never marked archived, so they
+// are archived again before they expire.
+func New(tracker storage.ArchiveTracker, dir string) (*Archiver, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create archive directory: %w", err)
+	}
+
+	parts, err := filepath.Glob(filepath.Join(dir, "."+filePrefix+"*"+partSuffix))
+	if err != nil {
+		return nil, err
+	}
+	for _, part := range parts {
+		if err := os.Remove(part); err != nil {
+			return nil, fmt.Errorf("failed to remove stale segment: %w", err)
+		}
+	}
+
+	return &Archiver{tracker: tracker, dir: dir, now: time.Now}, nil
+}
+
+// Add archives a record that was just stored, unless it is already archived
+func (a *Archiver) Add(ctx context.Context, key string, record models.AccountingEvent) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.seg != nil && a.seg.has(key) {
+		return nil
+	}
+	archived, err := a.tracker.Archived(ctx, key)
+	if err != nil || archived {
+		return err
+	}
+	return a.add(ctx, key, record)
+}
+
+// Sweep archives the records that expire within the given duration and are
+// not archived yet, e.g. because notifications were missed, and seals the
+// segment right away when it found any. It returns the number of records
+// archived.
+func (a *Archiver) Sweep(ctx context.Context, within time.Duration) (int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	added := 0
+	err := a.tracker.Unarchived(ctx, a.now().Add(within), func(key string, record models.AccountingEvent) error {
+		if a.seg != nil && a.seg.has(key) {
+			return nil
+		}
+		added++
+		return a.add(ctx, key, record)
+	})
+	if err != nil {
+		return added, err
+	}
+	if added > 0 {
+		_, err = a.seal(ctx)
+	}
+	return added, err
+}
+
+// Rotate seals the open segment once its hour is over, and returns its
+// manifest, or nil when nothing was sealed
+func (a *Archiver) Rotate(ctx context.Context) (*Manifest, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.seg == nil || a.seg.hour.Equal(hourOf(a.now())) {
+		return nil, nil
+	}
+	return a.seal(ctx)
+}
+
+// Lost reports whether a record that expired from storage was never archived
+func (a *Archiver) Lost(ctx context.Context, key string) (bool, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.seg != nil && a.seg.has(key) {
+		return false, nil
+	}
+	archived, err := a.tracker.Archived(ctx, key)
+	return !archived, err
+}
+
+// Close seals the open segment
+func (a *Archiver) Close(ctx context.Context) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	_, err := a.seal(ctx)
+	return err
+}
+
+// add appends a record to the segment of the current hour
+func (a *Archiver) add(ctx context.Context, key string, record models.AccountingEvent) error {
+	now := a.now()
+	if a.seg != nil && !a.seg.hour.Equal(hourOf(now)) {
+		if _, err := a.seal(ctx); err != nil {
+			return err
+		}
+	}
+	if a.seg == nil {
+		seg, err := openSegment(a.dir, now)
+		if err != nil {
+			return err
+		}
+		a.seg = seg
+	}
+	return a.seg.add(key, record)
+}
+
+// seal closes the open segment, moves it to its final name, writes its
+// manifest and marks its records archived
+func (a *Archiver) seal(ctx context.Context) (*Manifest, error) {
+	seg := a.seg
+	if seg == nil {
+		return nil, nil
+	}
+
+	// A segment that failed to seal is dropped; its records are not marked
+	// archived, so the sweep picks them up again
+	a.seg = nil
+	manifest, err := seg.seal(a.now())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := a.tracker.MarkArchived(ctx, seg.keys); err != nil {
+		return manifest, fmt.Errorf("archived %s but %w", manifest.File, err)
+	}
+	return manifest, nil
+}
+
+// segment is an archive file being written
+type segment struct {
+	dir     string
+	hour    time.Time
+	file    *os.File
+	sum     hash.Hash
+	out     export.Writer
+	keys    []string
+	seen    map[string]struct{}
+	created time.Time
+	first   time.Time
+	last    time.Time
+}
+
+func openSegment(dir string, now time.Time) (*segment, error) {
+	hour := hourOf(now)
+	file, err := os.CreateTemp(dir, "."+filePrefix+hour.Format(hourLayout)+".*"+partSuffix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create archive segment: %w", err)
+	}
+
+	seg := &segment{
+		dir:     dir,
+		hour:    hour,
+		file:    file,
+		sum:     sha256.New(),
+		seen:    make(map[string]struct{}),
+		created: now.UTC(),
+	}
+	seg.out, err = export.NewWriter(io.MultiWriter(file, seg.sum), export.Options{Format: export.FormatJSONL, Gzip: true})
+	if err != nil {
+		_ = file.Close()
+		_ = os.Remove(file.Name())
+		return nil, err
+	}
+	return seg, nil
+}
+
+func (s *segment) has(key string) bool {
+	_, ok := s.seen[key]
+	return ok
+}
+
+func (s *segment) add(key string, record models.AccountingEvent) error {
+	if err := s.out.Write(record); err != nil {
+		return fmt.Errorf("failed to write archive segment: %w", err)
+	}
+	s.keys = append(s.keys, key)
+	s.seen[key] = struct{}{}
+
+	if t := storage.RecordTime(record, time.Time{}).UTC(); !t.IsZero() {
+		if s.first.IsZero() || t.Before(s.first) {
+			s.first = t
+		}
+		if t.After(s.last) {
+			s.last = t
+		}
+	}
+	return nil
+}
+
+// seal flushes and syncs the segment, then renames it to the first free
+// file name of its hour and writes the manifest
+func (s *segment) seal(now time.Time) (*Manifest, error) {
+	err := s.out.Close()
+	if err == nil {
+		err = s.file.Sync()
+	}
+	if closeErr := s.file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(s.file.Name())
+		return nil, fmt.Errorf("failed to write archive segment: %w", err)
+	}
+
+	info, err := os.Stat(s.file.Name())
+	if err != nil {
+		return nil, fmt.Errorf("failed to write archive segment: %w", err)
+	}
+
+	path, err := s.finalPath()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Rename(s.file.Name(), path); err != nil {
+		return nil, fmt.Errorf("failed to seal archive segment: %w", err)
+	}
+
+	manifest := &Manifest{
+		File:       filepath.Base(path),
+		Records:    len(s.keys),
+		Bytes:      info.Size(),
+		SHA256:     hex.EncodeToString(s.sum.Sum(nil)),
+		FirstEvent: s.first,
+		LastEvent:  s.last,
+		Created:    s.created,
+		Sealed:     now.UTC(),
+	}
+	if err := writeManifest(path+manifestSuffix, manifest); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// finalPath returns radius-accounting-<hour>.jsonl.gz, or the same name with
+// a -1, -2, ... suffix when the hour was sealed before
+func (s *segment) finalPath() (string, error) {
+	base := filepath.Join(s.dir, filePrefix+s.hour.Format(hourLayout))
+	for n := 0; ; n++ {
+		path := base + fileExtension
+		if n > 0 {
+			path = fmt.Sprintf("%s-%d%s", base, n, fileExtension)
+		}
+		_, err := os.Stat(path)
+		if os.IsNotExist(err) {
+			return path, nil
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to name archive file: %w", err)
+		}
+	}
+}
+
+// writeManifest writes the manifest through a temporary file, so that a
+// manifest is either complete or absent
+func writeManifest(path string, manifest *Manifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o600); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return nil
+}
+
+// hourOf truncates t to the start of its UTC hour
+func hourOf(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Hour)
+}
+
+// isArchiveFile reports whether name is a sealed archive file
+func isArchiveFile(name string) bool {
+	return strings.HasPrefix(name, filePrefix) && strings.HasSuffix(name, fileExtension)
+}
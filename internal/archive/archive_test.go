@@ -0,0 +1,165 @@
+package archive
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kal997/radius-accounting-server/internal/models"
+)
+
+// fakeTracker keeps archive marks in memory and returns expiring records
+// from a fixed list
+type fakeTracker struct {
+	marked   map[string]bool
+	expiring []models.AccountingEvent
+}
+
+func (f *fakeTracker) Unarchived(ctx context.Context, deadline time.Time, fn func(string, models.AccountingEvent) error) error {
+	for _, record := range f.expiring {
+		if key := record.GenerateRedisKey(); !f.marked[key] {
+			if err := fn(key, record); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (f *fakeTracker) Archived(ctx context.Context, key string) (bool, error) {
+	return f.marked[key], nil
+}
+
+func (f *fakeTracker) MarkArchived(ctx context.Context, keys []string) error {
+	for _, key := range keys {
+		f.marked[key] = true
+	}
+	return nil
+}
+
+func newRecord(session, timestamp string) models.AccountingEvent {
+	return &models.StartRecord{
+		BaseAccountingRecord: models.BaseAccountingRecord{
+			Username:      "alice",
+			NASIPAddress:  "192.168.1.1",
+			AcctSessionID: session,
+			Timestamp:     timestamp,
+		},
+		FramedIPAddress: "10.0.0.1",
+	}
+}
+
+func TestArchiver(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	tracker := &fakeTracker{marked: make(map[string]bool)}
+
+	// A segment left behind by a crash is removed
+	stale := filepath.Join(dir, ".radius-accounting-20240115T09Z.123.part")
+	require.NoError(t, os.WriteFile(stale, []byte("partial"), 0o600))
+
+	archiver, err := New(tracker, dir)
+	require.NoError(t, err)
+	assert.NoFileExists(t, stale)
+
+	now := time.Date(2024, 1, 15, 10, 5, 0, 0, time.UTC)
+	archiver.now = func() time.Time { return now }
+
+	a1 := newRecord("a1", "2024-01-15T10:04:00Z")
+	a2 := newRecord("a2", "2024-01-15T09:30:00Z")
+	require.NoError(t, archiver.Add(ctx, a1.GenerateRedisKey(), a1))
+	require.NoError(t, archiver.Add(ctx, a1.GenerateRedisKey(), a1))
+	require.NoError(t, archiver.Add(ctx, a2.GenerateRedisKey(), a2))
+
+	// Not sealed before the end of the hour, and not lost meanwhile
+	manifest, err := archiver.Rotate(ctx)
+	require.NoError(t, err)
+	assert.Nil(t, manifest)
+	assert.Empty(t, tracker.marked)
+	lost, err := archiver.Lost(ctx, a1.GenerateRedisKey())
+	require.NoError(t, err)
+	assert.False(t, lost)
+
+	now = now.Add(time.Hour)
+	manifest, err = archiver.Rotate(ctx)
+	require.NoError(t, err)
+	require.NotNil(t, manifest)
+	assert.Equal(t, "radius-accounting-20240115T10Z.jsonl.gz", manifest.File)
+	assert.Equal(t, 2, manifest.Records)
+	assert.Equal(t, time.Date(2024, 1, 15, 9, 30, 0, 0, time.UTC), manifest.FirstEvent)
+	assert.Equal(t, time.Date(2024, 1, 15, 10, 4, 0, 0, time.UTC), manifest.LastEvent)
+	assert.True(t, tracker.marked[a1.GenerateRedisKey()])
+	assert.True(t, tracker.marked[a2.GenerateRedisKey()])
+
+	// Archived records are skipped
+	require.NoError(t, archiver.Add(ctx, a1.GenerateRedisKey(), a1))
+
+	// The sweep seals right away
+	a3 := newRecord("a3", "2024-01-15T11:00:00Z")
+	tracker.expiring = []models.AccountingEvent{a1, a3}
+	n, err := archiver.Sweep(ctx, time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	// Later segments of the same hour get the next free name
+	now = now.Add(time.Minute)
+	a4 := newRecord("a4", "2024-01-15T11:05:00Z")
+	require.NoError(t, archiver.Add(ctx, a4.GenerateRedisKey(), a4))
+	require.NoError(t, archiver.Close(ctx))
+
+	manifests, err := List(dir)
+	require.NoError(t, err)
+	require.Len(t, manifests, 3)
+	assert.Equal(t, "radius-accounting-20240115T11Z.jsonl.gz", manifests[1].File)
+	assert.Equal(t, "radius-accounting-20240115T11Z-1.jsonl.gz", manifests[2].File)
+	assert.True(t, manifests[1].Covers(time.Date(2024, 1, 15, 11, 0, 0, 0, time.UTC), time.Time{}))
+	assert.False(t, manifests[0].Covers(time.Date(2024, 1, 15, 11, 0, 0, 0, time.UTC), time.Time{}))
+
+	path := filepath.Join(dir, manifests[0].File)
+	require.NoError(t, Verify(path, manifests[0]))
+
+	var sessions []string
+	err = Read(path, func(key string, record models.AccountingEvent) error {
+		assert.Equal(t, key, record.GenerateRedisKey())
+		sessions = append(sessions, record.(*models.StartRecord).AcctSessionID)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a1", "a2"}, sessions)
+
+	lost, err = archiver.Lost(ctx, newRecord("a5", "2024-01-15T10:00:00Z").GenerateRedisKey())
+	require.NoError(t, err)
+	assert.True(t, lost)
+}
+
+func TestVerify_Mismatch(t *testing.T) {
+	dir := t.TempDir()
+	tracker := &fakeTracker{marked: make(map[string]bool)}
+	archiver, err := New(tracker, dir)
+	require.NoError(t, err)
+
+	record := newRecord("a1", "2024-01-15T10:04:00Z")
+	require.NoError(t, archiver.Add(context.Background(), record.GenerateRedisKey(), record))
+	require.NoError(t, archiver.Close(context.Background()))
+
+	manifests, err := List(dir)
+	require.NoError(t, err)
+	require.Len(t, manifests, 1)
+
+	path := filepath.Join(dir, manifests[0].File)
+	manifest, err := ReadManifest(path)
+	require.NoError(t, err)
+	assert.Equal(t, manifests[0], manifest)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	data[len(data)/2] ^= 0xff
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+
+	assert.ErrorIs(t, Verify(path, manifest), ErrChecksumMismatch)
+}
@@ -0,0 +1,116 @@
+package archive
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/kal997/radius-accounting-server/internal/models"
+	"github.com/kal997/radius-accounting-server/internal/storage"
+)
+
+// ErrChecksumMismatch is returned when an archive file does not match the
+// checksum in its manifest
+var ErrChecksumMismatch = errors.New("archive checksum mismatch")
+
+// List returns the manifests of the sealed archive files in dir, in the
+// order they were sealed
+func List(dir string) ([]*Manifest, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, filePrefix+"*"+fileExtension+manifestSuffix))
+	if err != nil {
+		return nil, err
+	}
+
+	manifests := make([]*Manifest, 0, len(paths))
+	for _, path := range paths {
+		manifest, err := readManifest(path)
+		if err != nil {
+			return nil, err
+		}
+		manifests = append(manifests, manifest)
+	}
+	sort.Slice(manifests, func(i, j int) bool {
+		if !manifests[i].Sealed.Equal(manifests[j].Sealed) {
+			return manifests[i].Sealed.Before(manifests[j].Sealed)
+		}
+		return manifests[i].File < manifests[j].File
+	})
+	return manifests, nil
+}
+
+// ReadManifest reads the manifest of an archive file
+func ReadManifest(path string) (*Manifest, error) {
+	return readManifest(path + manifestSuffix)
+}
+
+func readManifest(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest %s: %w", path, err)
+	}
+	if !isArchiveFile(manifest.File) {
+		return nil, fmt.Errorf("invalid manifest %s: unexpected file name %q", path, manifest.File)
+	}
+	return &manifest, nil
+}
+
+// Verify checks the size and checksum of an archive file against its manifest
+func Verify(path string, manifest *Manifest) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open archive file: %w", err)
+	}
+	defer file.Close()
+
+	sum := sha256.New()
+	n, err := io.Copy(sum, file)
+	if err != nil {
+		return fmt.Errorf("failed to read archive file: %w", err)
+	}
+	if n != manifest.Bytes || hex.EncodeToString(sum.Sum(nil)) != manifest.SHA256 {
+		return fmt.Errorf("%w: %s", ErrChecksumMismatch, filepath.Base(path))
+	}
+	return nil
+}
+
+// Read calls fn for every record of an archive file, in the order they were
+// archived. The file is not verified; call Verify first.
+func Read(path string, fn func(key string, record models.AccountingEvent) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open archive file: %w", err)
+	}
+	defer file.Close()
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return fmt.Errorf("failed to read archive file %s: %w", filepath.Base(path), err)
+	}
+	defer gz.Close()
+
+	dec := json.NewDecoder(gz)
+	for {
+		var line storage.KeyedRecord
+		err := dec.Decode(&line)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read archive file %s: %w", filepath.Base(path), err)
+		}
+		if err := fn(line.Key, line.Record); err != nil {
+			return err
+		}
+	}
+}
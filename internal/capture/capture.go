@@ -0,0 +1,364 @@
+// Package capture records the RADIUS packets radius-controlplane receives and
+// sends, exactly as they crossed the socket, to debug NAS interoperability.
+//
+// Packets are written to rotating files in one of two formats:
+//
+//   - pcapng, with synthesised IP and UDP headers, for Wireshark and tcpdump
+//   - raw, the file magic "RADCAP01" followed by one record per packet: the
+//     big-endian uint32 length of the rest of the record, the int64 capture
+//     time in Unix nanoseconds, the direction (0 received, 1 sent), the
+//     16-byte client IP address (IPv4 addresses are IPv4-mapped), the uint16
+//     client port and the RADIUS packet
+package capture
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kal997/radius-accounting-server/internal/config"
+	"github.com/kal997/radius-accounting-server/internal/pcap"
+)
+
+// Direction tells whether a packet was received or sent by the server
+type Direction uint8
+
+const (
+	Received Direction = 0
+	Sent     Direction = 1
+)
+
+// RawMagic starts every capture file in the raw format
+const RawMagic = "RADCAP01"
+
+// filePrefix starts the name of every capture file
+const filePrefix = "radius-capture-"
+
+// Status describes the capture, in the format of the admin API
+type Status struct {
+	Enabled   bool     `json:"enabled"`
+	Format    string   `json:"format"`
+	Directory string   `json:"directory"`
+	Clients   []string `json:"clients"`        // Captured client networks, empty for all
+	File      string   `json:"file,omitempty"` // File being written, if any
+	Packets   uint64   `json:"packets"`        // Packets captured since startup
+	Bytes     uint64   `json:"bytes"`          // RADIUS bytes captured since startup
+}
+
+// Capturer writes captured packets to files. It is safe for concurrent use.
+type Capturer struct {
+	dir         string
+	format      config.CaptureFormat
+	maxFileSize int64
+	maxFiles    int
+
+	enabled atomic.Bool // Checked without the lock for every packet
+
+	mu      sync.Mutex
+	clients []*net.IPNet
+	file    *os.File
+	out     *countingWriter // Writes to file
+	pcap    *pcap.Writer    // Writer of the current pcapng file
+	packets uint64
+	bytes   uint64
+}
+
+// New creates a capturer writing to the configured directory, creating it if
+// needed. Capturing starts if the configuration enables it.
+func New(cfg *config.CaptureConfig) (*Capturer, error) {
+	if err := os.MkdirAll(cfg.GetDirectory(), 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create capture directory: %w", err)
+	}
+	c := &Capturer{
+		dir:         cfg.GetDirectory(),
+		format:      cfg.GetFormat(),
+		maxFileSize: cfg.GetMaxFileSize(),
+		maxFiles:    cfg.GetMaxFiles(),
+		clients:     cfg.GetClients(),
+	}
+	c.enabled.Store(cfg.Enabled())
+	return c, nil
+}
+
+// SetEnabled starts or stops capturing. Stopping closes the current file;
+// the next start writes a new one.
+func (c *Capturer) SetEnabled(enabled bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.enabled.Store(enabled)
+	if !enabled {
+		return c.closeFile()
+	}
+	return nil
+}
+
+// SetClients restricts the capture to clients in the given networks, or
+// captures every client when there are none
+func (c *Capturer) SetClients(clients []*net.IPNet) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.clients = clients
+}
+
+// Status returns the state of the capture
+func (c *Capturer) Status() Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	status := Status{
+		Enabled:   c.enabled.Load(),
+		Format:    string(c.format),
+		Directory: c.dir,
+		Clients:   []string{},
+		Packets:   c.packets,
+		Bytes:     c.bytes,
+	}
+	for _, network := range c.clients {
+		status.Clients = append(status.Clients, network.String())
+	}
+	if c.file != nil {
+		status.File = filepath.Base(c.file.Name())
+	}
+	return status
+}
+
+// Capture writes a packet exchanged with client. server is the local address
+// of the socket. Write errors stop the capture, so that a full disk does not
+// log every packet.
+func (c *Capturer) Capture(direction Direction, client, server net.Addr, packet []byte) {
+	if !c.enabled.Load() {
+		return
+	}
+	clientAddr, ok := client.(*net.UDPAddr)
+	if !ok {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.enabled.Load() || !c.captures(clientAddr.IP) {
+		return
+	}
+	if err := c.write(time.Now(), direction, clientAddr, serverAddr(server, clientAddr), packet); err != nil {
+		log.Printf("Packet capture stopped: %v", err)
+		c.enabled.Store(false)
+		_ = c.closeFile()
+	}
+}
+
+// Close stops capturing and closes the current file
+func (c *Capturer) Close() error {
+	return c.SetEnabled(false)
+}
+
+// captures reports whether packets of the client at ip are captured
+func (c *Capturer) captures(ip net.IP) bool {
+	if len(c.clients) == 0 {
+		return true
+	}
+	for _, network := range c.clients {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// serverAddr returns the local address to write in synthesised headers. A
+// wildcard listener is shown as the unspecified address of the client's
+// family.
+func serverAddr(local net.Addr, client *net.UDPAddr) *net.UDPAddr {
+	addr, ok := local.(*net.UDPAddr)
+	if !ok {
+		addr = &net.UDPAddr{}
+	}
+	if addr.IP == nil || addr.IP.IsUnspecified() {
+		ip := net.IPv6unspecified
+		if client.IP.To4() != nil {
+			ip = net.IPv4zero
+		}
+		return &net.UDPAddr{IP: ip, Port: addr.Port}
+	}
+	return addr
+}
+
+// write appends a packet to the current file, starting a new file when
+// there is none or the current one is full
+func (c *Capturer) write(t time.Time, direction Direction, client, server *net.UDPAddr, packet []byte) error {
+	if c.file == nil {
+		if err := c.openFile(t); err != nil {
+			return err
+		}
+	}
+
+	var err error
+	switch c.format {
+	case config.CaptureFormatRaw:
+		record := make([]byte, 4, 31+len(packet))
+		binary.BigEndian.PutUint32(record, uint32(27+len(packet)))
+		record = binary.BigEndian.AppendUint64(record, uint64(t.UnixNano()))
+		record = append(record, byte(direction))
+		record = append(record, client.IP.To16()...)
+		record = binary.BigEndian.AppendUint16(record, uint16(client.Port))
+		record = append(record, packet...)
+		_, err = c.out.Write(record)
+
+	default:
+		src, dst := client, server
+		if direction == Sent {
+			src, dst = server, client
+		}
+		err = c.pcap.WritePacket(t, pcap.EncodeUDP(src, dst, packet))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write capture file: %w", err)
+	}
+
+	c.packets++
+	c.bytes += uint64(len(packet))
+	if c.out.n >= c.maxFileSize {
+		return c.closeFile()
+	}
+	return nil
+}
+
+// openFile starts a capture file named after t and removes the oldest files
+// beyond the number kept
+func (c *Capturer) openFile(t time.Time) error {
+	extension := ".pcapng"
+	if c.format == config.CaptureFormatRaw {
+		extension = ".rcap"
+	}
+	name := filePrefix + t.UTC().Format("20060102T150405Z")
+
+	var file *os.File
+	var err error
+	for i := 0; ; i++ {
+		path := filepath.Join(c.dir, name+extension)
+		if i > 0 {
+			path = filepath.Join(c.dir, fmt.Sprintf("%s-%d%s", name, i, extension))
+		}
+		file, err = os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+		if !os.IsExist(err) {
+			break
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create capture file: %w", err)
+	}
+
+	out := &countingWriter{w: file}
+	if c.format == config.CaptureFormatRaw {
+		_, err = out.Write([]byte(RawMagic))
+	} else {
+		c.pcap, err = pcap.NewWriter(out)
+	}
+	if err != nil {
+		_ = file.Close()
+		return fmt.Errorf("failed to write capture file: %w", err)
+	}
+
+	c.file, c.out = file, out
+	c.prune()
+	return nil
+}
+
+// closeFile closes the current file, if any
+func (c *Capturer) closeFile() error {
+	if c.file == nil {
+		return nil
+	}
+	err := c.file.Close()
+	c.file, c.out, c.pcap = nil, nil, nil
+	if err != nil {
+		return fmt.Errorf("failed to close capture file: %w", err)
+	}
+	return nil
+}
+
+// prune removes the oldest capture files beyond maxFiles, counting the
+// current one
+func (c *Capturer) prune() {
+	if c.maxFiles == 0 {
+		return
+	}
+	paths, err := filepath.Glob(filepath.Join(c.dir, filePrefix+"*"))
+	if err != nil || len(paths) <= c.maxFiles {
+		return
+	}
+
+	type capture struct {
+		path     string
+		modified time.Time
+	}
+	var files []capture
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil {
+			files = append(files, capture{path, info.ModTime()})
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if !files[i].modified.Equal(files[j].modified) {
+			return files[i].modified.Before(files[j].modified)
+		}
+		return files[i].path < files[j].path
+	})
+
+	for _, file := range files[:max(len(files)-c.maxFiles, 0)] {
+		if file.path == c.file.Name() {
+			continue
+		}
+		if err := os.Remove(file.path); err != nil {
+			log.Printf("Failed to remove old capture file: %v", err)
+		}
+	}
+}
+
+// countingWriter counts the bytes written to a file, to rotate it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+// Wrap returns conn capturing the packets read from and written to it
+func (c *Capturer) Wrap(conn net.PacketConn) net.PacketConn {
+	return &packetConn{PacketConn: conn, capturer: c}
+}
+
+// packetConn captures the packets of a socket
+type packetConn struct {
+	net.PacketConn
+	capturer *Capturer
+}
+
+func (p *packetConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	n, addr, err := p.PacketConn.ReadFrom(b)
+	if err == nil {
+		p.capturer.Capture(Received, addr, p.LocalAddr(), b[:n])
+	}
+	return n, addr, err
+}
+
+func (p *packetConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	n, err := p.PacketConn.WriteTo(b, addr)
+	if err == nil {
+		p.capturer.Capture(Sent, addr, p.LocalAddr(), b)
+	}
+	return n, err
+}
@@ -0,0 +1,178 @@
+package capture
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kal997/radius-accounting-server/internal/config"
+	"github.com/kal997/radius-accounting-server/internal/pcap"
+)
+
+// newCapturer creates a capturer writing to a temporary directory, with the
+// given CAPTURE_* settings
+func newCapturer(t *testing.T, env map[string]string) *Capturer {
+	t.Helper()
+
+	env["RADIUS_SHARED_SECRET"] = "testing123"
+	env["STORAGE_BACKEND"] = "memory"
+	env["CAPTURE_DIRECTORY"] = t.TempDir()
+	for name, value := range env {
+		t.Setenv(name, value)
+	}
+
+	cfg, err := config.LoadControlplane("", nil)
+	require.NoError(t, err)
+	capturer, err := New(cfg.GetCapture())
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = capturer.Close() })
+	return capturer
+}
+
+// captureFiles lists the capture files, oldest first
+func captureFiles(t *testing.T, c *Capturer) []string {
+	t.Helper()
+	paths, err := filepath.Glob(filepath.Join(c.dir, filePrefix+"*"))
+	require.NoError(t, err)
+	return paths
+}
+
+var (
+	client = &net.UDPAddr{IP: net.ParseIP("192.168.1.1"), Port: 40000}
+	server = &net.UDPAddr{IP: net.IPv4zero, Port: 1813}
+)
+
+func TestCapturer_Pcapng(t *testing.T) {
+	c := newCapturer(t, map[string]string{"CAPTURE_ENABLED": "true"})
+
+	c.Capture(Received, client, server, []byte("request"))
+	c.Capture(Sent, client, server, []byte("response"))
+	require.NoError(t, c.Close())
+
+	paths := captureFiles(t, c)
+	require.Len(t, paths, 1)
+	assert.Equal(t, ".pcapng", filepath.Ext(paths[0]))
+
+	file, err := os.Open(paths[0])
+	require.NoError(t, err)
+	defer file.Close()
+	reader, err := pcap.NewReader(file)
+	require.NoError(t, err)
+
+	packet, err := reader.Next()
+	require.NoError(t, err)
+	datagram, ok := pcap.DecodeUDP(packet)
+	require.True(t, ok)
+	assert.Equal(t, "192.168.1.1:40000", datagram.Src.String())
+	assert.Equal(t, "0.0.0.0:1813", datagram.Dst.String())
+	assert.Equal(t, []byte("request"), datagram.Payload)
+
+	packet, err = reader.Next()
+	require.NoError(t, err)
+	datagram, ok = pcap.DecodeUDP(packet)
+	require.True(t, ok)
+	assert.Equal(t, "0.0.0.0:1813", datagram.Src.String())
+	assert.Equal(t, []byte("response"), datagram.Payload)
+
+	_, err = reader.Next()
+	assert.ErrorIs(t, err, io.EOF)
+
+	status := c.Status()
+	assert.Equal(t, uint64(2), status.Packets)
+	assert.Equal(t, uint64(15), status.Bytes)
+}
+
+func TestCapturer_Raw(t *testing.T) {
+	c := newCapturer(t, map[string]string{"CAPTURE_ENABLED": "true", "CAPTURE_FORMAT": "raw"})
+
+	before := time.Now()
+	c.Capture(Sent, client, server, []byte("response"))
+	require.NoError(t, c.Close())
+
+	paths := captureFiles(t, c)
+	require.Len(t, paths, 1)
+	data, err := os.ReadFile(paths[0])
+	require.NoError(t, err)
+
+	require.True(t, bytes.HasPrefix(data, []byte(RawMagic)))
+	record := data[len(RawMagic):]
+	require.Len(t, record, 4+27+len("response"))
+	assert.Equal(t, uint32(27+len("response")), binary.BigEndian.Uint32(record))
+	at := time.Unix(0, int64(binary.BigEndian.Uint64(record[4:])))
+	assert.WithinDuration(t, before, at, time.Second)
+	assert.Equal(t, byte(Sent), record[12])
+	assert.True(t, net.IP(record[13:29]).Equal(client.IP))
+	assert.Equal(t, uint16(40000), binary.BigEndian.Uint16(record[29:]))
+	assert.Equal(t, []byte("response"), record[31:])
+}
+
+func TestCapturer_EnabledAndClients(t *testing.T) {
+	c := newCapturer(t, map[string]string{"CAPTURE_CLIENTS": "10.0.0.0/8"})
+
+	// Disabled at startup
+	c.Capture(Received, client, server, []byte("ignored"))
+	assert.Empty(t, captureFiles(t, c))
+
+	require.NoError(t, c.SetEnabled(true))
+	c.Capture(Received, client, server, []byte("filtered"))
+	c.Capture(Received, &net.UDPAddr{IP: net.ParseIP("10.1.2.3"), Port: 1}, server, []byte("captured"))
+	status := c.Status()
+	assert.True(t, status.Enabled)
+	assert.Equal(t, []string{"10.0.0.0/8"}, status.Clients)
+	assert.Equal(t, uint64(1), status.Packets)
+	assert.NotEmpty(t, status.File)
+
+	c.SetClients(nil)
+	c.Capture(Received, client, server, []byte("captured"))
+	assert.Equal(t, uint64(2), c.Status().Packets)
+
+	require.NoError(t, c.SetEnabled(false))
+	assert.Empty(t, c.Status().File)
+}
+
+func TestCapturer_Rotation(t *testing.T) {
+	c := newCapturer(t, map[string]string{"CAPTURE_ENABLED": "true", "CAPTURE_FORMAT": "raw", "CAPTURE_MAX_FILES": "2"})
+	c.maxFileSize = int64(len(RawMagic) + 31 + 10) // One packet per file
+
+	for i := 0; i < 4; i++ {
+		c.Capture(Received, client, server, []byte("0123456789"))
+	}
+	assert.Len(t, captureFiles(t, c), 2)
+	assert.Empty(t, c.Status().File, "the full file is closed")
+	assert.Equal(t, uint64(4), c.Status().Packets)
+}
+
+func TestCapturer_Wrap(t *testing.T) {
+	c := newCapturer(t, map[string]string{"CAPTURE_ENABLED": "true"})
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	wrapped := c.Wrap(conn)
+	defer wrapped.Close()
+
+	peer, err := net.DialUDP("udp", nil, conn.LocalAddr().(*net.UDPAddr))
+	require.NoError(t, err)
+	defer peer.Close()
+
+	_, err = peer.Write([]byte("request"))
+	require.NoError(t, err)
+	buf := make([]byte, 64)
+	require.NoError(t, wrapped.SetReadDeadline(time.Now().Add(5*time.Second)))
+	n, addr, err := wrapped.ReadFrom(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "request", string(buf[:n]))
+	_, err = wrapped.WriteTo([]byte("response"), addr)
+	require.NoError(t, err)
+
+	status := c.Status()
+	assert.Equal(t, uint64(2), status.Packets)
+	assert.Equal(t, uint64(15), status.Bytes)
+}
@@ -0,0 +1,54 @@
+package config
+
+import "fmt"
+
+// minAPITokenLength keeps API tokens from being guessable
+const minAPITokenLength = 16
+
+// APIConfig holds the settings of the admin REST API served by
+// radius-controlplane: its listen address and bearer token
+type APIConfig struct {
+	address string // host:port to listen on, empty when the API is disabled
+	token   string
+}
+
+// Enabled returns true if the API should be served
+func (a *APIConfig) Enabled() bool {
+	return a.address != ""
+}
+
+// GetAddress returns the address the API listens on
+func (a *APIConfig) GetAddress() string {
+	return a.address
+}
+
+// GetToken returns the bearer token clients must present
+func (a *APIConfig) GetToken() string {
+	return a.token
+}
+
+// validate checks the API settings when the API is enabled
+func (a *APIConfig) validate() error {
+	if !a.Enabled() {
+		return nil
+	}
+
+	if err := validateListenAddress("api.address", a.address); err != nil {
+		return err
+	}
+
+	if len(a.token) < minAPITokenLength {
+		return &FieldError{Key: "api.token", Err: fmt.Errorf("token must be at least %d characters", minAPITokenLength)}
+	}
+
+	return nil
+}
+
+// diff lists the API settings that differ; the token can be rotated without
+// a restart
+func (a *APIConfig) diff(next *APIConfig) []Change {
+	var changes changeList
+	changes.add("api.address", a.address, next.address, false)
+	changes.addSecret("api.token", a.token, next.token)
+	return changes
+}
@@ -0,0 +1,120 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// CaptureFormat selects the file format of packet captures
+type CaptureFormat string
+
+const (
+	// CaptureFormatPcapng writes pcapng files with synthesised IP and UDP
+	// headers, for Wireshark and tcpdump
+	CaptureFormatPcapng CaptureFormat = "pcapng"
+
+	// CaptureFormatRaw writes the RADIUS packets length-prefixed, with their
+	// direction, time and client address
+	CaptureFormatRaw CaptureFormat = "raw"
+)
+
+// CaptureConfig holds the settings of the raw packet capture of
+// radius-controlplane: where and in which format packets are written, how
+// files rotate and which clients are recorded
+type CaptureConfig struct {
+	enabled     bool
+	directory   string // Empty when packets cannot be captured
+	format      CaptureFormat
+	maxFileSize int64 // Bytes written before a new file is started
+	maxFiles    int   // Files kept, 0 keeps every file
+	clients     []*net.IPNet
+}
+
+// Configured returns true if a capture directory is set, so that capturing
+// can be started at runtime
+func (c *CaptureConfig) Configured() bool {
+	return c.directory != ""
+}
+
+// Enabled returns true if packets are captured from startup
+func (c *CaptureConfig) Enabled() bool {
+	return c.enabled
+}
+
+// GetDirectory returns the directory capture files are written to
+func (c *CaptureConfig) GetDirectory() string {
+	return c.directory
+}
+
+// GetFormat returns the capture file format
+func (c *CaptureConfig) GetFormat() CaptureFormat {
+	return c.format
+}
+
+// GetMaxFileSize returns the size in bytes after which a new capture file is
+// started
+func (c *CaptureConfig) GetMaxFileSize() int64 {
+	return c.maxFileSize
+}
+
+// GetMaxFiles returns the number of capture files kept, zero for all
+func (c *CaptureConfig) GetMaxFiles() int {
+	return c.maxFiles
+}
+
+// GetClients returns the networks whose packets are captured, empty for all
+// clients
+func (c *CaptureConfig) GetClients() []*net.IPNet {
+	clients := make([]*net.IPNet, len(c.clients))
+	copy(clients, c.clients)
+	return clients
+}
+
+// validate checks the capture settings when a capture directory is set
+func (c *CaptureConfig) validate() error {
+	if c.enabled && c.directory == "" {
+		return &FieldError{Key: "capture.directory", Err: fmt.Errorf("directory is required to capture packets")}
+	}
+	if !c.Configured() {
+		return nil
+	}
+
+	switch c.format {
+	case CaptureFormatPcapng, CaptureFormatRaw:
+	default:
+		return &FieldError{Key: "capture.format", Err: fmt.Errorf("invalid format %q, expected pcapng or raw", c.format)}
+	}
+
+	if c.maxFileSize <= 0 {
+		return &FieldError{Key: "capture.max_file_size_mb", Err: fmt.Errorf("max file size must be greater than 0")}
+	}
+
+	if c.maxFiles < 0 {
+		return &FieldError{Key: "capture.max_files", Err: fmt.Errorf("max files cannot be negative")}
+	}
+
+	return nil
+}
+
+// diff lists the capture settings that differ; capturing can be started,
+// stopped and filtered without a restart
+func (c *CaptureConfig) diff(next *CaptureConfig) []Change {
+	var changes changeList
+	changes.add("capture.enabled", fmt.Sprint(c.enabled), fmt.Sprint(next.enabled), true)
+	changes.add("capture.directory", c.directory, next.directory, false)
+	changes.add("capture.format", string(c.format), string(next.format), false)
+	changes.add("capture.max_file_size_mb", fmt.Sprint(c.maxFileSize>>20), fmt.Sprint(next.maxFileSize>>20), false)
+	changes.add("capture.max_files", fmt.Sprint(c.maxFiles), fmt.Sprint(next.maxFiles), false)
+	changes.add("capture.clients", describeNetworks(c.clients), describeNetworks(next.clients), true)
+	return changes
+}
+
+// describeNetworks lists networks for change reports
+func describeNetworks(networks []*net.IPNet) string {
+	items := make([]string, len(networks))
+	for i, network := range networks {
+		items[i] = network.String()
+	}
+	return strings.Join(items, ",")
+}
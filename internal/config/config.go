@@ -2,9 +2,9 @@ package config
 
 import (
 	"fmt"
-	"os"
+	"net"
 	"strconv"
-	"time"
+	"strings"
 )
 
 // LogLevel represents the logging level
@@ -17,150 +17,255 @@ const (
 	LogLevelError LogLevel = "error"
 )
 
-// Config holds all application configuration
-// Fields are private to ensure immutability after creation
-type Config struct {
-	// RADIUS server configuration
-	radiusPort   int
-	sharedSecret string
+// FieldError reports an invalid configuration value together with the
+// dotted key path (as used in the YAML file) of the offending setting
+type FieldError struct {
+	Key string
+	Err error
+}
 
-	// Redis configuration
-	redisHost string
-	redisPort int
-	recordTTL time.Duration
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Key, e.Err)
+}
 
-	// Logging configuration
-	logLevel LogLevel
-	logFile  string
+func (e *FieldError) Unwrap() error {
+	return e.Err
 }
 
-// LoadFromEnv loads configuration from environment variables
-func LoadFromEnv() (*Config, error) {
-	config := &Config{
-		radiusPort: 1813, // Standard RADIUS accounting port
+// Client describes a RADIUS client (NAS) and the secret it signs packets with
+type Client struct {
+	Name    string
+	Network *net.IPNet
+	Secret  string
+}
 
-	}
+// RedisMode selects how the Redis deployment is reached
+type RedisMode string
 
-	// if port is not defined, fallback to standard port
-	redisAddr := os.Getenv("REDIS_PORT")
-	if redisAddr == "" {
-		config.redisPort = 6379 // Standard Redis port
-	} else {
-		port, err := strconv.Atoi(redisAddr)
-		if err != nil {
-			return nil, fmt.Errorf("invalid REDIS_ADDR: %w", err)
-		}
-		config.redisPort = port
-	}
+const (
+	RedisModeStandalone RedisMode = "standalone"
+	RedisModeSentinel   RedisMode = "sentinel"
+	RedisModeCluster    RedisMode = "cluster"
+)
 
-	// RADIUS configuration
-	secret := os.Getenv("RADIUS_SHARED_SECRET")
-	if secret == "" {
-		return nil, fmt.Errorf("RADIUS_SHARED_SECRET environment variable is required")
-	}
-	config.sharedSecret = secret
+// RedisConfig holds the Redis connection settings shared by all components:
+// the deployment mode, addresses, credentials and TLS
+type RedisConfig struct {
+	mode     RedisMode
+	host     string
+	port     int
+	username string
+	password string
+	db       int
+	tls      TLSConfig
 
-	// Redis configuration
-	host := os.Getenv("REDIS_HOST")
-	if host == "" {
-		return nil, fmt.Errorf("REDIS_HOST environment variable is required")
-	}
-	config.redisHost = host
+	// Sentinel mode
+	sentinelMasterName string
+	sentinelAddrs      []string
+	sentinelUsername   string
+	sentinelPassword   string
 
-	// TTL configuration
-	ttlStr := os.Getenv("RECORD_TTL_HOURS")
-	if ttlStr == "" {
-		return nil, fmt.Errorf("RECORD_TTL_HOURS environment variable is required")
-	}
-	hours, err := strconv.Atoi(ttlStr)
-	if err != nil {
-		return nil, fmt.Errorf("invalid RECORD_TTL_HOURS: %w", err)
-	}
-	config.recordTTL = time.Duration(hours) * time.Hour
+	// Cluster mode
+	clusterAddrs []string
+}
 
-	// Logging configuration
-	levelStr := os.Getenv("LOG_LEVEL")
-	if levelStr == "" {
-		return nil, fmt.Errorf("LOG_LEVEL environment variable is required")
+// GetMode returns whether a single server, a Sentinel-managed master or a
+// cluster is used
+func (r *RedisConfig) GetMode() RedisMode {
+	if r.mode == "" {
+		return RedisModeStandalone
 	}
-	logLevel := LogLevel(levelStr)
-	if !isValidLogLevel(logLevel) {
-		return nil, fmt.Errorf("invalid LOG_LEVEL: %s (valid: debug, info, warn, error)", levelStr)
-	}
-	config.logLevel = logLevel
+	return r.mode
+}
 
-	logFile := os.Getenv("LOG_FILE")
-	if logFile == "" {
-		return nil, fmt.Errorf("LOG_FILE environment variable is required")
-	}
-	config.logFile = logFile
+// GetSentinelMasterName returns the name of the master monitored by Sentinel
+func (r *RedisConfig) GetSentinelMasterName() string {
+	return r.sentinelMasterName
+}
 
-	return config, nil
+// GetSentinelAddrs returns the Sentinel addresses in host:port format
+func (r *RedisConfig) GetSentinelAddrs() []string {
+	return r.sentinelAddrs
 }
 
-// Validate checks if the configuration is valid
-func (c *Config) Validate() error {
+// GetSentinelUsername returns the username used to authenticate to Sentinel
+func (r *RedisConfig) GetSentinelUsername() string {
+	return r.sentinelUsername
+}
 
-	if c.sharedSecret == "" {
-		return fmt.Errorf("shared secret cannot be empty")
-	}
+// GetSentinelPassword returns the password used to authenticate to Sentinel
+func (r *RedisConfig) GetSentinelPassword() string {
+	return r.sentinelPassword
+}
 
-	if len(c.sharedSecret) < 8 {
-		return fmt.Errorf("shared secret must be at least 8 characters long")
-	}
+// GetClusterAddrs returns the cluster seed node addresses in host:port format
+func (r *RedisConfig) GetClusterAddrs() []string {
+	return r.clusterAddrs
+}
 
-	if c.redisHost == "" {
-		return fmt.Errorf("redis host cannot be empty")
+// Describe returns a human-readable description of the Redis endpoint
+func (r *RedisConfig) Describe() string {
+	switch r.GetMode() {
+	case RedisModeSentinel:
+		return fmt.Sprintf("master %q via sentinels %s", r.sentinelMasterName, strings.Join(r.sentinelAddrs, ","))
+	case RedisModeCluster:
+		return "cluster " + strings.Join(r.clusterAddrs, ",")
+	default:
+		return r.GetAddr()
 	}
+}
 
-	if c.recordTTL <= 0 {
-		return fmt.Errorf("record TTL must be greater than 0")
-	}
+// GetAddr returns the Redis address in host:port format
+func (r *RedisConfig) GetAddr() string {
+	return fmt.Sprintf("%s:%d", r.host, r.port)
+}
 
-	if !isValidLogLevel(c.logLevel) {
-		return fmt.Errorf("invalid log level: %s (valid: debug, info, warn, error)", c.logLevel)
-	}
+// GetUsername returns the Redis ACL username, empty for the default user
+func (r *RedisConfig) GetUsername() string {
+	return r.username
+}
 
-	if c.logFile == "" {
-		return fmt.Errorf("log file path cannot be empty")
-	}
+// GetPassword returns the Redis password, empty when AUTH is not used
+func (r *RedisConfig) GetPassword() string {
+	return r.password
+}
 
-	return nil
+// GetDB returns the Redis logical database index
+func (r *RedisConfig) GetDB() int {
+	return r.db
 }
 
-// GetRedisAddr returns the Redis address in host:port format
-func (c *Config) GetRedisAddr() string {
-	return fmt.Sprintf("%s:%d", c.redisHost, c.redisPort)
+// GetTLS returns the TLS settings for the Redis connection
+func (r *RedisConfig) GetTLS() *TLSConfig {
+	return &r.tls
 }
 
-// GetRADIUSAddr returns the RADIUS server address in :port format
-func (c *Config) GetRADIUSAddr() string {
-	return fmt.Sprintf(":%d", c.radiusPort)
+// validate checks the Redis connection settings
+func (r *RedisConfig) validate() error {
+	switch r.GetMode() {
+	case RedisModeStandalone:
+		if r.host == "" {
+			return &FieldError{Key: "redis.host", Err: fmt.Errorf("redis host cannot be empty")}
+		}
+
+		if err := validatePort(r.port); err != nil {
+			return &FieldError{Key: "redis.port", Err: err}
+		}
+
+	case RedisModeSentinel:
+		if r.sentinelMasterName == "" {
+			return &FieldError{Key: "redis.sentinel.master_name", Err: fmt.Errorf("master name cannot be empty")}
+		}
+		if err := validateAddrs("redis.sentinel.addresses", r.sentinelAddrs); err != nil {
+			return err
+		}
+		if r.sentinelUsername != "" && r.sentinelPassword == "" {
+			return &FieldError{Key: "redis.sentinel.password", Err: fmt.Errorf("password is required when username is set")}
+		}
+
+	case RedisModeCluster:
+		if err := validateAddrs("redis.cluster.addresses", r.clusterAddrs); err != nil {
+			return err
+		}
+		if r.db != 0 {
+			return &FieldError{Key: "redis.db", Err: fmt.Errorf("cluster mode only supports database 0")}
+		}
+
+	default:
+		return &FieldError{Key: "redis.mode", Err: fmt.Errorf("invalid mode: %s (valid: standalone, sentinel, cluster)", r.mode)}
+	}
+
+	if r.username != "" && r.password == "" {
+		return &FieldError{Key: "redis.password", Err: fmt.Errorf("password is required when username is set")}
+	}
+
+	if r.db < 0 {
+		return &FieldError{Key: "redis.db", Err: fmt.Errorf("database index cannot be negative")}
+	}
+
+	return r.tls.validate("redis.tls")
 }
 
-// GetSharedSecret returns the RADIUS shared secret
-func (c *Config) GetSharedSecret() string {
-	return c.sharedSecret
+// diff lists the Redis settings that differ; none of them are reloadable
+// because the connection is established once at startup
+func (r *RedisConfig) diff(next *RedisConfig) []Change {
+	var changes changeList
+	changes.add("redis.mode", string(r.mode), string(next.mode), false)
+	changes.add("redis.host", r.host, next.host, false)
+	changes.add("redis.port", fmt.Sprint(r.port), fmt.Sprint(next.port), false)
+	changes.add("redis.username", r.username, next.username, false)
+	if r.password != next.password {
+		changes = append(changes, Change{Key: "redis.password", Old: "<redacted>", New: "<redacted>", Reloadable: false})
+	}
+	changes.add("redis.db", fmt.Sprint(r.db), fmt.Sprint(next.db), false)
+	changes = append(changes, r.tls.diff("redis.tls", &next.tls)...)
+	changes.add("redis.sentinel.master_name", r.sentinelMasterName, next.sentinelMasterName, false)
+	changes.add("redis.sentinel.addresses", strings.Join(r.sentinelAddrs, ","), strings.Join(next.sentinelAddrs, ","), false)
+	changes.add("redis.sentinel.username", r.sentinelUsername, next.sentinelUsername, false)
+	if r.sentinelPassword != next.sentinelPassword {
+		changes = append(changes, Change{Key: "redis.sentinel.password", Old: "<redacted>", New: "<redacted>", Reloadable: false})
+	}
+	changes.add("redis.cluster.addresses", strings.Join(r.clusterAddrs, ","), strings.Join(next.clusterAddrs, ","), false)
+	return changes
 }
 
-// GetRecordTTL returns the record TTL duration
-func (c *Config) GetRecordTTL() time.Duration {
-	return c.recordTTL
+// Helper function to validate shared secrets
+func validateSecret(secret string) error {
+	if secret == "" {
+		return fmt.Errorf("shared secret cannot be empty")
+	}
+	if len(secret) < 8 {
+		return fmt.Errorf("shared secret must be at least 8 characters long")
+	}
+	return nil
 }
 
-// GetLogLevel returns the configured log level
-func (c *Config) GetLogLevel() LogLevel {
-	return c.logLevel
+// Helper function to validate TCP/UDP ports
+func validatePort(port int) error {
+	if port < 1 || port > 65535 {
+		return fmt.Errorf("port must be between 1 and 65535, got %d", port)
+	}
+	return nil
 }
 
-// GetLogFile returns the log file path
-func (c *Config) GetLogFile() string {
-	return c.logFile
+// Helper function to validate the host:port address a listener binds to;
+// the host may be empty to listen on every interface
+func validateListenAddress(key, addr string) error {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return &FieldError{Key: key, Err: fmt.Errorf("invalid address %q: %w", addr, err)}
+	}
+	n, err := strconv.Atoi(port)
+	if err != nil {
+		return &FieldError{Key: key, Err: fmt.Errorf("invalid port %q", port)}
+	}
+	if err := validatePort(n); err != nil {
+		return &FieldError{Key: key, Err: err}
+	}
+	return nil
 }
 
-// IsDebugEnabled returns true if debug logging is enabled
-func (c *Config) IsDebugEnabled() bool {
-	return c.logLevel == LogLevelDebug
+// Helper function to validate a non-empty list of host:port addresses
+func validateAddrs(key string, addrs []string) error {
+	if len(addrs) == 0 {
+		return &FieldError{Key: key, Err: fmt.Errorf("at least one address is required")}
+	}
+	for i, addr := range addrs {
+		host, port, err := net.SplitHostPort(addr)
+		if err == nil && host == "" {
+			err = fmt.Errorf("missing host")
+		}
+		if err == nil {
+			var n int
+			if n, err = strconv.Atoi(port); err == nil {
+				err = validatePort(n)
+			}
+		}
+		if err != nil {
+			return &FieldError{Key: fmt.Sprintf("%s[%d]", key, i), Err: fmt.Errorf("invalid address %q: %w", addr, err)}
+		}
+	}
+	return nil
 }
 
 // Helper function to validate log levels
@@ -172,3 +277,11 @@ func isValidLogLevel(level LogLevel) bool {
 		return false
 	}
 }
+
+// Helper function to validate the logging.level key
+func validateLogLevel(level LogLevel) error {
+	if !isValidLogLevel(level) {
+		return &FieldError{Key: "logging.level", Err: fmt.Errorf("invalid log level: %s (valid: debug, info, warn, error)", level)}
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"net"
 	"os"
 	"testing"
 	"time"
@@ -9,7 +10,7 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
-func TestLoadFromEnv_ValidConfig(t *testing.T) {
+func TestLoadControlplane_ValidConfig(t *testing.T) {
 	// Clean environment
 	clearEnv()
 	defer clearEnv()
@@ -19,20 +20,19 @@ func TestLoadFromEnv_ValidConfig(t *testing.T) {
 	_ = os.Setenv("REDIS_HOST", "localhost")
 	_ = os.Setenv("RECORD_TTL_HOURS", "24")
 	_ = os.Setenv("LOG_LEVEL", "info")
-	_ = os.Setenv("LOG_FILE", "/var/log/test.log")
 
-	cfg, err := LoadFromEnv()
+	cfg, err := LoadControlplane("", nil)
 
 	require.NoError(t, err)
 	assert.Equal(t, ":1813", cfg.GetRADIUSAddr())
+	assert.Equal(t, 1813, cfg.GetRADIUSPort())
 	assert.Equal(t, "secretkey123", cfg.GetSharedSecret())
 	assert.Equal(t, "localhost:6379", cfg.GetRedisAddr())
 	assert.Equal(t, 24*time.Hour, cfg.GetRecordTTL())
 	assert.Equal(t, LogLevelInfo, cfg.GetLogLevel())
-	assert.Equal(t, "/var/log/test.log", cfg.GetLogFile())
 }
 
-func TestLoadFromEnv_ValidConfig_test_setup(t *testing.T) {
+func TestLoadControlplane_ValidConfig_test_setup(t *testing.T) {
 	// Clean environment
 	clearEnv()
 	defer clearEnv()
@@ -43,9 +43,8 @@ func TestLoadFromEnv_ValidConfig_test_setup(t *testing.T) {
 	_ = os.Setenv("RECORD_TTL_HOURS", "24")
 	_ = os.Setenv("LOG_LEVEL", "info")
 	_ = os.Setenv("REDIS_PORT", "1111")
-	_ = os.Setenv("LOG_FILE", "/var/log/test.log")
 
-	cfg, err := LoadFromEnv()
+	cfg, err := LoadControlplane("", nil)
 
 	require.NoError(t, err)
 	assert.Equal(t, ":1813", cfg.GetRADIUSAddr())
@@ -53,9 +52,21 @@ func TestLoadFromEnv_ValidConfig_test_setup(t *testing.T) {
 	assert.Equal(t, "localhost:1111", cfg.GetRedisAddr())
 	assert.Equal(t, 24*time.Hour, cfg.GetRecordTTL())
 	assert.Equal(t, LogLevelInfo, cfg.GetLogLevel())
-	assert.Equal(t, "/var/log/test.log", cfg.GetLogFile())
 }
-func TestLoadFromEnv_MissingRequired(t *testing.T) {
+
+func TestLoadControlplane_DoesNotRequireLogFile(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	_ = os.Setenv("RADIUS_SHARED_SECRET", "secretkey123")
+	_ = os.Setenv("REDIS_HOST", "localhost")
+
+	_, err := LoadControlplane("", nil)
+
+	assert.NoError(t, err)
+}
+
+func TestLoadControlplane_MissingRequired(t *testing.T) {
 	tests := []struct {
 		name    string
 		envVars map[string]string
@@ -64,22 +75,14 @@ func TestLoadFromEnv_MissingRequired(t *testing.T) {
 		{
 			name:    "missing shared secret",
 			envVars: map[string]string{},
-			wantErr: "RADIUS_SHARED_SECRET environment variable is required",
+			wantErr: "radius.shared_secret: shared secret cannot be empty",
 		},
 		{
 			name: "missing redis host",
 			envVars: map[string]string{
 				"RADIUS_SHARED_SECRET": "secret123",
 			},
-			wantErr: "REDIS_HOST environment variable is required",
-		},
-		{
-			name: "missing TTL",
-			envVars: map[string]string{
-				"RADIUS_SHARED_SECRET": "secret123",
-				"REDIS_HOST":           "localhost",
-			},
-			wantErr: "RECORD_TTL_HOURS environment variable is required",
+			wantErr: "redis.host: redis host cannot be empty",
 		},
 		{
 			name: "invalid TTL",
@@ -88,16 +91,16 @@ func TestLoadFromEnv_MissingRequired(t *testing.T) {
 				"REDIS_HOST":           "localhost",
 				"RECORD_TTL_HOURS":     "invalid",
 			},
-			wantErr: "invalid RECORD_TTL_HOURS",
+			wantErr: `RECORD_TTL_HOURS: invalid int value "invalid"`,
 		},
 		{
-			name: "missing log level",
+			name: "zero TTL",
 			envVars: map[string]string{
 				"RADIUS_SHARED_SECRET": "secret123",
 				"REDIS_HOST":           "localhost",
-				"RECORD_TTL_HOURS":     "24",
+				"RECORD_TTL_HOURS":     "0",
 			},
-			wantErr: "LOG_LEVEL environment variable is required",
+			wantErr: "redis.record_ttl_hours: record TTL must be greater than 0",
 		},
 		{
 			name: "invalid log level",
@@ -107,29 +110,82 @@ func TestLoadFromEnv_MissingRequired(t *testing.T) {
 				"RECORD_TTL_HOURS":     "24",
 				"LOG_LEVEL":            "invalid",
 			},
-			wantErr: "invalid LOG_LEVEL: invalid (valid: debug, info, warn, error)",
+			wantErr: "logging.level: invalid log level: invalid (valid: debug, info, warn, error)",
 		},
 		{
-			name: "missing log file",
+			name: "invalid REDIS_PORT",
 			envVars: map[string]string{
 				"RADIUS_SHARED_SECRET": "secret123",
 				"REDIS_HOST":           "localhost",
 				"RECORD_TTL_HOURS":     "24",
 				"LOG_LEVEL":            "info",
+				"REDIS_PORT":           "invalid",
 			},
-			wantErr: "LOG_FILE environment variable is required",
+			wantErr: `REDIS_PORT: invalid int value "invalid"`,
 		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv()
+			defer clearEnv()
+
+			for k, v := range tt.envVars {
+				_ = os.Setenv(k, v)
+			}
+
+			cfg, err := LoadControlplane("", nil)
+
+			assert.Error(t, err)
+			assert.Nil(t, cfg)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestLoadLogger_ValidConfig(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	// No RADIUS settings are needed by the logger
+	_ = os.Setenv("REDIS_HOST", "localhost")
+	_ = os.Setenv("REDIS_PORT", "6380")
+	_ = os.Setenv("LOG_LEVEL", "debug")
+	_ = os.Setenv("LOG_FILE", "/var/log/test.log")
+
+	cfg, err := LoadLogger("", nil)
+
+	require.NoError(t, err)
+	assert.Equal(t, "localhost:6380", cfg.GetRedisAddr())
+	assert.Equal(t, LogLevelDebug, cfg.GetLogLevel())
+	assert.Equal(t, "/var/log/test.log", cfg.GetLogFile())
+	assert.True(t, cfg.IsDebugEnabled())
+}
+
+func TestLoadLogger_MissingRequired(t *testing.T) {
+	tests := []struct {
+		name    string
+		envVars map[string]string
+		wantErr string
+	}{
 		{
-			name: "invalid REDIS_PORT",
+			name:    "missing redis host",
+			envVars: map[string]string{"LOG_FILE": "/var/log/test.log"},
+			wantErr: "redis.host: redis host cannot be empty",
+		},
+		{
+			name:    "missing log file",
+			envVars: map[string]string{"REDIS_HOST": "localhost"},
+			wantErr: "logging.file: log file path cannot be empty",
+		},
+		{
+			name: "invalid log level",
 			envVars: map[string]string{
-				"RADIUS_SHARED_SECRET": "secret123",
-				"REDIS_HOST":           "localhost",
-				"RECORD_TTL_HOURS":     "24",
-				"LOG_LEVEL":            "info",
-				"LOG_FILE":             "/var/log/test.log",
-				"REDIS_PORT":           "invalid",
+				"REDIS_HOST": "localhost",
+				"LOG_FILE":   "/var/log/test.log",
+				"LOG_LEVEL":  "loud",
 			},
-			wantErr: "invalid REDIS_ADDR: strconv.Atoi: parsing \"invalid\": invalid syntax",
+			wantErr: "logging.level: invalid log level: loud",
 		},
 	}
 
@@ -142,7 +198,7 @@ func TestLoadFromEnv_MissingRequired(t *testing.T) {
 				_ = os.Setenv(k, v)
 			}
 
-			cfg, err := LoadFromEnv()
+			cfg, err := LoadLogger("", nil)
 
 			assert.Error(t, err)
 			assert.Nil(t, cfg)
@@ -151,113 +207,146 @@ func TestLoadFromEnv_MissingRequired(t *testing.T) {
 	}
 }
 
-func TestConfig_Validate(t *testing.T) {
+func TestControlplaneConfig_Validate(t *testing.T) {
 	tests := []struct {
 		name    string
-		config  *Config
+		config  *ControlplaneConfig
 		wantErr string
 	}{
 		{
 			name: "valid config",
-			config: &Config{
+			config: &ControlplaneConfig{
 				radiusPort:   1813,
 				sharedSecret: "verysecret123",
-				redisHost:    "localhost",
-				redisPort:    6379,
+				redis:        RedisConfig{host: "localhost", port: 6379},
 				recordTTL:    24 * time.Hour,
 				logLevel:     LogLevelInfo,
-				logFile:      "/var/log/test.log",
 			},
 			wantErr: "",
 		},
 		{
 			name: "empty shared secret",
-			config: &Config{
+			config: &ControlplaneConfig{
 				radiusPort:   1813,
 				sharedSecret: "",
-				redisHost:    "localhost",
-				redisPort:    6379,
+				redis:        RedisConfig{host: "localhost", port: 6379},
 				recordTTL:    24 * time.Hour,
 				logLevel:     LogLevelInfo,
-				logFile:      "/var/log/test.log",
 			},
 			wantErr: "shared secret cannot be empty",
 		},
 		{
 			name: "short shared secret",
-			config: &Config{
+			config: &ControlplaneConfig{
 				radiusPort:   1813,
 				sharedSecret: "short",
-				redisHost:    "localhost",
-				redisPort:    6379,
+				redis:        RedisConfig{host: "localhost", port: 6379},
 				recordTTL:    24 * time.Hour,
 				logLevel:     LogLevelInfo,
-				logFile:      "/var/log/test.log",
 			},
 			wantErr: "shared secret must be at least 8 characters long",
 		},
 		{
 			name: "empty redis host",
-			config: &Config{
+			config: &ControlplaneConfig{
 				radiusPort:   1813,
 				sharedSecret: "verysecret123",
-				redisHost:    "",
-				redisPort:    6379,
+				redis:        RedisConfig{host: "", port: 6379},
 				recordTTL:    24 * time.Hour,
 				logLevel:     LogLevelInfo,
-				logFile:      "/var/log/test.log",
 			},
 			wantErr: "redis host cannot be empty",
 		},
 		{
 			name: "zero TTL",
-			config: &Config{
+			config: &ControlplaneConfig{
 				radiusPort:   1813,
 				sharedSecret: "verysecret123",
-				redisHost:    "localhost",
-				redisPort:    6379,
+				redis:        RedisConfig{host: "localhost", port: 6379},
 				recordTTL:    0,
 				logLevel:     LogLevelInfo,
-				logFile:      "/var/log/test.log",
 			},
 			wantErr: "record TTL must be greater than 0",
 		},
 		{
 			name: "negative TTL",
-			config: &Config{
+			config: &ControlplaneConfig{
 				radiusPort:   1813,
 				sharedSecret: "verysecret123",
-				redisHost:    "localhost",
-				redisPort:    6379,
+				redis:        RedisConfig{host: "localhost", port: 6379},
 				recordTTL:    -1 * time.Hour,
 				logLevel:     LogLevelInfo,
-				logFile:      "/var/log/test.log",
 			},
 			wantErr: "record TTL must be greater than 0",
 		},
 		{
 			name: "invalid log level",
-			config: &Config{
+			config: &ControlplaneConfig{
 				radiusPort:   1813,
 				sharedSecret: "verysecret123",
-				redisHost:    "localhost",
-				redisPort:    6379,
+				redis:        RedisConfig{host: "localhost", port: 6379},
 				recordTTL:    24 * time.Hour,
 				logLevel:     LogLevel("invalid"),
-				logFile:      "/var/log/test.log",
 			},
 			wantErr: "invalid log level: invalid (valid: debug, info, warn, error)",
 		},
 		{
-			name: "empty log file",
-			config: &Config{
-				radiusPort:   1813,
+			name: "invalid radius port",
+			config: &ControlplaneConfig{
+				radiusPort:   0,
 				sharedSecret: "verysecret123",
-				redisHost:    "localhost",
-				redisPort:    6379,
+				redis:        RedisConfig{host: "localhost", port: 6379},
 				recordTTL:    24 * time.Hour,
 				logLevel:     LogLevelInfo,
-				logFile:      "",
+			},
+			wantErr: "radius.port: port must be between 1 and 65535, got 0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoggerConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *LoggerConfig
+		wantErr string
+	}{
+		{
+			name: "valid config",
+			config: &LoggerConfig{
+				redis:    RedisConfig{host: "localhost", port: 6379},
+				logLevel: LogLevelInfo,
+				logFile:  "/var/log/test.log",
+			},
+			wantErr: "",
+		},
+		{
+			name: "invalid redis port",
+			config: &LoggerConfig{
+				redis:    RedisConfig{host: "localhost", port: 70000},
+				logLevel: LogLevelInfo,
+				logFile:  "/var/log/test.log",
+			},
+			wantErr: "redis.port: port must be between 1 and 65535, got 70000",
+		},
+		{
+			name: "empty log file",
+			config: &LoggerConfig{
+				redis:    RedisConfig{host: "localhost", port: 6379},
+				logLevel: LogLevelInfo,
+				logFile:  "",
 			},
 			wantErr: "log file path cannot be empty",
 		},
@@ -277,6 +366,46 @@ func TestConfig_Validate(t *testing.T) {
 	}
 }
 
+func TestControlplaneConfig_SecretFor(t *testing.T) {
+	mustNetwork := func(address string) *net.IPNet {
+		network, err := ParseClientAddress(address)
+		require.NoError(t, err)
+		return network
+	}
+
+	cfg := &ControlplaneConfig{
+		sharedSecret: "defaultsecret",
+		clients: []Client{
+			{Name: "pop", Network: mustNetwork("10.0.0.0/8"), Secret: "popsecret1"},
+			{Name: "bras", Network: mustNetwork("10.1.2.3"), Secret: "brassecret"},
+			{Name: "v6", Network: mustNetwork("2001:db8::/32"), Secret: "v6secret12"},
+		},
+	}
+
+	tests := []struct {
+		ip   string
+		want string
+	}{
+		{ip: "10.9.9.9", want: "popsecret1"},
+		{ip: "10.1.2.3", want: "brassecret"}, // most specific prefix wins
+		{ip: "2001:db8::5", want: "v6secret12"},
+		{ip: "192.168.1.1", want: "defaultsecret"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			assert.Equal(t, tt.want, cfg.SecretFor(net.ParseIP(tt.ip)))
+		})
+	}
+
+	client, ok := cfg.LookupClient(net.ParseIP("10.1.2.3"))
+	assert.True(t, ok)
+	assert.Equal(t, "bras", client.Name)
+
+	_, ok = cfg.LookupClient(net.ParseIP("192.168.1.1"))
+	assert.False(t, ok)
+}
+
 func TestConfig_GetterMethods(t *testing.T) {
 	clearEnv()
 	defer clearEnv()
@@ -288,17 +417,24 @@ func TestConfig_GetterMethods(t *testing.T) {
 	_ = os.Setenv("LOG_LEVEL", "debug")
 	_ = os.Setenv("LOG_FILE", "/var/log/radius.log")
 
-	cfg, err := LoadFromEnv()
+	cfg, err := LoadControlplane("", nil)
 	require.NoError(t, err)
 
 	// Test all getters
 	assert.Equal(t, "redis-server:6379", cfg.GetRedisAddr())
+	assert.Equal(t, "redis-server:6379", cfg.GetRedis().GetAddr())
 	assert.Equal(t, ":1813", cfg.GetRADIUSAddr())
 	assert.Equal(t, "secretkey123", cfg.GetSharedSecret())
 	assert.Equal(t, 48*time.Hour, cfg.GetRecordTTL())
 	assert.Equal(t, LogLevelDebug, cfg.GetLogLevel())
-	assert.Equal(t, "/var/log/radius.log", cfg.GetLogFile())
 	assert.True(t, cfg.IsDebugEnabled())
+
+	loggerCfg, err := LoadLogger("", nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, "redis-server:6379", loggerCfg.GetRedis().GetAddr())
+	assert.Equal(t, LogLevelDebug, loggerCfg.GetLogLevel())
+	assert.Equal(t, "/var/log/radius.log", loggerCfg.GetLogFile())
 }
 
 func TestIsDebugEnabled(t *testing.T) {
@@ -331,10 +467,15 @@ func TestIsDebugEnabled(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			cfg := &Config{
+			cfg := &ControlplaneConfig{
 				logLevel: tt.logLevel,
 			}
 			assert.Equal(t, tt.want, cfg.IsDebugEnabled())
+
+			loggerCfg := &LoggerConfig{
+				logLevel: tt.logLevel,
+			}
+			assert.Equal(t, tt.want, loggerCfg.IsDebugEnabled())
 		})
 	}
 }
@@ -388,7 +529,23 @@ func TestIsValidLogLevel(t *testing.T) {
 func clearEnv() {
 	envVars := []string{
 		"RADIUS_SHARED_SECRET", "REDIS_HOST", "RECORD_TTL_HOURS",
-		"LOG_LEVEL", "LOG_FILE", "REDIS_PORT",
+		"LOG_LEVEL", "LOG_FILE", "REDIS_PORT", "RADIUS_PORT", "CONFIG_FILE",
+		"RADIUS_SHARED_SECRET_FILE", "REDIS_USERNAME", "REDIS_PASSWORD", "REDIS_PASSWORD_FILE",
+		"REDIS_DB", "REDIS_TLS", "REDIS_TLS_CA_FILE", "REDIS_TLS_CERT_FILE", "REDIS_TLS_KEY_FILE",
+		"REDIS_TLS_SERVER_NAME", "REDIS_TLS_INSECURE_SKIP_VERIFY", "NOTIFIER_KEY_EVENTS",
+		"NOTIFIER_CONFIGURE_EVENTS", "NOTIFIER_CHECK_INTERVAL_SECONDS",
+		"REDIS_MODE", "REDIS_SENTINEL_MASTER_NAME", "REDIS_SENTINEL_ADDRESSES", "REDIS_SENTINEL_USERNAME",
+		"REDIS_SENTINEL_PASSWORD", "REDIS_SENTINEL_PASSWORD_FILE", "REDIS_CLUSTER_ADDRESSES",
+		"STORAGE_BACKEND", "SQLITE_PATH", "SQLITE_RETENTION_DAYS", "SQLITE_PRUNE_INTERVAL_MINUTES",
+		"POSTGRES_DSN", "POSTGRES_DSN_FILE", "POSTGRES_BATCH_SIZE", "POSTGRES_PARTITION_INTERVAL",
+		"STORAGE_MULTI_BACKENDS", "STORAGE_MULTI_QUORUM", "MEMORY_TTL_SECONDS", "MEMORY_MAX_RECORDS",
+		"DETAIL_DIRECTORY",
+		"API_ADDRESS", "API_TOKEN", "API_TOKEN_FILE",
+		"CAPTURE_ENABLED", "CAPTURE_DIRECTORY", "CAPTURE_FORMAT", "CAPTURE_MAX_FILE_SIZE_MB",
+		"CAPTURE_MAX_FILES", "CAPTURE_CLIENTS",
+		"RADSEC_ADDRESS", "RADSEC_CERT_FILE", "RADSEC_KEY_FILE", "RADSEC_CA_FILE", "RADSEC_SECRET",
+		"RADSEC_SECRET_FILE", "TCP_ADDRESS", "TCP_IDLE_TIMEOUT_SECONDS", "TCP_MAX_CONNECTIONS",
+		"LOG", "REDIS_TLS_CA",
 	}
 	for _, env := range envVars {
 		_ = os.Unsetenv(env)
@@ -0,0 +1,273 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+// ControlplaneConfig holds the settings used by radius-controlplane
+// Fields are private to ensure immutability after creation
+type ControlplaneConfig struct {
+	// RADIUS server configuration
+	radiusPort   int
+	sharedSecret string
+	clients      []Client
+
+	// Storage configuration
+	storage   StorageConfig
+	redis     RedisConfig
+	recordTTL time.Duration
+
+	// Logging configuration
+	logLevel LogLevel
+
+	// Admin REST API configuration
+	api APIConfig
+
+	// Packet capture configuration
+	capture CaptureConfig
+
+	// RADIUS over TLS configuration
+	radsec RadSecConfig
+
+	// RADIUS over TCP configuration
+	tcp TCPConfig
+}
+
+// LoadControlplane loads the radius-controlplane configuration from every
+// source in precedence order: defaults < YAML file (when path is non-empty)
+// < environment < flags. flags may be nil. The result is validated.
+func LoadControlplane(path string, flags *Flags) (*ControlplaneConfig, error) {
+	fc, err := load(path, flags)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &ControlplaneConfig{
+		radiusPort:   fc.Radius.Port,
+		sharedSecret: fc.Radius.SharedSecret,
+		storage:      fc.storageConfig(),
+		redis:        fc.redisConfig(),
+		recordTTL:    time.Duration(fc.Redis.RecordTTLHours) * time.Hour,
+		logLevel:     LogLevel(fc.Logging.Level),
+		api:          fc.apiConfig(),
+		tcp:          fc.tcpConfig(),
+	}
+
+	if cfg.clients, err = fc.clients(); err != nil {
+		return nil, err
+	}
+	if cfg.capture, err = fc.captureConfig(); err != nil {
+		return nil, err
+	}
+	if cfg.radsec, err = fc.radsecConfig(); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// LoadFromFile loads the radius-controlplane configuration from a YAML file
+// overlaid by the environment, as LoadControlplane does without flags
+func LoadFromFile(path string) (*ControlplaneConfig, error) {
+	return LoadControlplane(path, nil)
+}
+
+// Validate checks if the configuration is valid
+// Errors are *FieldError values naming the offending key path
+func (c *ControlplaneConfig) Validate() error {
+
+	if err := validatePort(c.radiusPort); err != nil {
+		return &FieldError{Key: "radius.port", Err: err}
+	}
+
+	// A shared secret is only optional when every client has its own
+	if c.sharedSecret != "" || len(c.clients) == 0 {
+		if err := validateSecret(c.sharedSecret); err != nil {
+			return &FieldError{Key: "radius.shared_secret", Err: err}
+		}
+	}
+
+	for i, client := range c.clients {
+		if client.Network == nil {
+			return &FieldError{Key: fmt.Sprintf("radius.clients[%d].address", i), Err: fmt.Errorf("client address cannot be empty")}
+		}
+		if err := validateSecret(client.Secret); err != nil {
+			return &FieldError{Key: fmt.Sprintf("radius.clients[%d].secret", i), Err: err}
+		}
+	}
+
+	if err := c.storage.validate(); err != nil {
+		return err
+	}
+
+	// Redis settings are only needed when records are stored there
+	if c.storage.Uses(StorageBackendRedis) {
+		if err := c.redis.validate(); err != nil {
+			return err
+		}
+
+		if c.recordTTL <= 0 {
+			return &FieldError{Key: "redis.record_ttl_hours", Err: fmt.Errorf("record TTL must be greater than 0")}
+		}
+	}
+
+	if err := c.api.validate(); err != nil {
+		return err
+	}
+
+	if err := c.capture.validate(); err != nil {
+		return err
+	}
+
+	if err := c.radsec.validate(); err != nil {
+		return err
+	}
+
+	if err := c.tcp.validate(); err != nil {
+		return err
+	}
+
+	return validateLogLevel(c.logLevel)
+}
+
+// Diff lists the keys that differ between c and next.
+// Secrets are never included in the output, only the fact that they changed.
+func (c *ControlplaneConfig) Diff(next *ControlplaneConfig) []Change {
+	var changes changeList
+	changes.add("radius.port", fmt.Sprint(c.radiusPort), fmt.Sprint(next.radiusPort), false)
+	changes.addSecret("radius.shared_secret", c.sharedSecret, next.sharedSecret)
+	changes.add("radius.clients", describeClients(c.clients), describeClients(next.clients), true)
+	changes.addSecret("radius.clients[*].secret", clientSecrets(c.clients), clientSecrets(next.clients))
+	changes = append(changes, c.storage.diff(&next.storage)...)
+	changes = append(changes, c.redis.diff(&next.redis)...)
+	changes.add("redis.record_ttl_hours", c.recordTTL.String(), next.recordTTL.String(), true)
+	changes.add("logging.level", string(c.logLevel), string(next.logLevel), true)
+	changes = append(changes, c.api.diff(&next.api)...)
+	changes = append(changes, c.capture.diff(&next.capture)...)
+	changes = append(changes, c.radsec.diff(&next.radsec)...)
+	changes = append(changes, c.tcp.diff(&next.tcp)...)
+	return changes
+}
+
+// withReloadable returns a copy of c with the reloadable settings taken from
+// next; settings that need a restart keep their current values
+func (c *ControlplaneConfig) withReloadable(next *ControlplaneConfig) *ControlplaneConfig {
+	merged := *c
+	merged.sharedSecret = next.sharedSecret
+	merged.clients = next.GetClients()
+	merged.storage.sqlite.retention = next.storage.sqlite.retention
+	merged.storage.memory.ttl = next.storage.memory.ttl
+	merged.recordTTL = next.recordTTL
+	merged.logLevel = next.logLevel
+	merged.api.token = next.api.token
+	merged.capture.enabled = next.capture.enabled
+	merged.capture.clients = next.capture.clients
+	merged.radsec.secret = next.radsec.secret
+	merged.radsec.clients = next.radsec.GetClients()
+	return &merged
+}
+
+// GetRADIUSAddr returns the RADIUS server address in :port format
+func (c *ControlplaneConfig) GetRADIUSAddr() string {
+	return fmt.Sprintf(":%d", c.radiusPort)
+}
+
+// GetRADIUSPort returns the RADIUS accounting port
+func (c *ControlplaneConfig) GetRADIUSPort() int {
+	return c.radiusPort
+}
+
+// GetSharedSecret returns the RADIUS shared secret
+func (c *ControlplaneConfig) GetSharedSecret() string {
+	return c.sharedSecret
+}
+
+// GetClients returns a copy of the configured RADIUS client table
+func (c *ControlplaneConfig) GetClients() []Client {
+	clients := make([]Client, len(c.clients))
+	copy(clients, c.clients)
+	return clients
+}
+
+// LookupClient returns the most specific client whose network contains ip
+func (c *ControlplaneConfig) LookupClient(ip net.IP) (Client, bool) {
+	var (
+		best     Client
+		bestOnes = -1
+		found    bool
+	)
+	for _, client := range c.clients {
+		if !client.Network.Contains(ip) {
+			continue
+		}
+		if ones, _ := client.Network.Mask.Size(); ones > bestOnes {
+			best, bestOnes, found = client, ones, true
+		}
+	}
+	return best, found
+}
+
+// SecretFor returns the secret used to authenticate packets from ip,
+// falling back to the shared secret for hosts not in the client table
+func (c *ControlplaneConfig) SecretFor(ip net.IP) string {
+	if client, ok := c.LookupClient(ip); ok {
+		return client.Secret
+	}
+	return c.sharedSecret
+}
+
+// GetStorage returns the storage backend settings
+func (c *ControlplaneConfig) GetStorage() *StorageConfig {
+	return &c.storage
+}
+
+// GetRedis returns the Redis connection settings
+func (c *ControlplaneConfig) GetRedis() *RedisConfig {
+	return &c.redis
+}
+
+// GetRedisAddr returns the Redis address in host:port format
+func (c *ControlplaneConfig) GetRedisAddr() string {
+	return c.redis.GetAddr()
+}
+
+// GetRecordTTL returns the record TTL duration
+func (c *ControlplaneConfig) GetRecordTTL() time.Duration {
+	return c.recordTTL
+}
+
+// GetAPI returns the admin REST API settings
+func (c *ControlplaneConfig) GetAPI() *APIConfig {
+	return &c.api
+}
+
+// GetCapture returns the packet capture settings
+func (c *ControlplaneConfig) GetCapture() *CaptureConfig {
+	return &c.capture
+}
+
+// GetRadSec returns the RADIUS over TLS listener settings
+func (c *ControlplaneConfig) GetRadSec() *RadSecConfig {
+	return &c.radsec
+}
+
+// GetTCP returns the RADIUS over TCP listener settings
+func (c *ControlplaneConfig) GetTCP() *TCPConfig {
+	return &c.tcp
+}
+
+// GetLogLevel returns the configured log level
+func (c *ControlplaneConfig) GetLogLevel() LogLevel {
+	return c.logLevel
+}
+
+// IsDebugEnabled returns true if debug logging is enabled
+func (c *ControlplaneConfig) IsDebugEnabled() bool {
+	return c.logLevel == LogLevelDebug
+}
@@ -0,0 +1,550 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// fileConfig mirrors the layout of the YAML configuration file shared by all
+// components. It is the layer every source (defaults, file, env, flags)
+// writes into before being converted into a component configuration.
+type fileConfig struct {
+	Radius   radiusSection   `yaml:"radius"`
+	Redis    redisSection    `yaml:"redis"`
+	Storage  storageSection  `yaml:"storage"`
+	Notifier notifierSection `yaml:"notifier"`
+	Logging  loggingSection  `yaml:"logging"`
+	API      apiSection      `yaml:"api"`
+	Capture  captureSection  `yaml:"capture"`
+	RadSec   radsecSection   `yaml:"radsec"`
+	TCP      tcpSection      `yaml:"tcp"`
+}
+
+type radiusSection struct {
+	Port             int             `yaml:"port"`
+	SharedSecret     string          `yaml:"shared_secret"`
+	SharedSecretFile string          `yaml:"shared_secret_file"`
+	Clients          []clientSection `yaml:"clients"`
+}
+
+type clientSection struct {
+	Name       string `yaml:"name"`
+	Address    string `yaml:"address"` // IP address or CIDR prefix
+	Secret     string `yaml:"secret"`
+	SecretFile string `yaml:"secret_file"`
+}
+
+type redisSection struct {
+	Mode           string          `yaml:"mode"`
+	Host           string          `yaml:"host"`
+	Port           int             `yaml:"port"`
+	Username       string          `yaml:"username"`
+	Password       string          `yaml:"password"`
+	PasswordFile   string          `yaml:"password_file"`
+	DB             int             `yaml:"db"`
+	TLS            tlsSection      `yaml:"tls"`
+	Sentinel       sentinelSection `yaml:"sentinel"`
+	Cluster        clusterSection  `yaml:"cluster"`
+	RecordTTLHours int             `yaml:"record_ttl_hours"`
+}
+
+type sentinelSection struct {
+	MasterName   string   `yaml:"master_name"`
+	Addresses    []string `yaml:"addresses"`
+	Username     string   `yaml:"username"`
+	Password     string   `yaml:"password"`
+	PasswordFile string   `yaml:"password_file"`
+}
+
+type clusterSection struct {
+	Addresses []string `yaml:"addresses"`
+}
+
+type tlsSection struct {
+	Enabled            bool   `yaml:"enabled"`
+	CAFile             string `yaml:"ca_file"`
+	CertFile           string `yaml:"cert_file"`
+	KeyFile            string `yaml:"key_file"`
+	ServerName         string `yaml:"server_name"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+}
+
+type storageSection struct {
+	Backend  string          `yaml:"backend"`
+	SQLite   sqliteSection   `yaml:"sqlite"`
+	Postgres postgresSection `yaml:"postgres"`
+	Memory   memorySection   `yaml:"memory"`
+	Detail   detailSection   `yaml:"detail"`
+	Multi    multiSection    `yaml:"multi"`
+}
+
+type memorySection struct {
+	TTLSeconds int `yaml:"ttl_seconds"` // 0 keeps records until evicted
+	MaxRecords int `yaml:"max_records"` // 0 is unbounded
+}
+
+type detailSection struct {
+	Directory string `yaml:"directory"`
+}
+
+type multiSection struct {
+	Backends []storageTargetSection `yaml:"backends"`
+	Quorum   int                    `yaml:"quorum"`
+}
+
+type storageTargetSection struct {
+	Backend string `yaml:"backend"`
+	Policy  string `yaml:"policy"` // required (default) or best_effort
+}
+
+type sqliteSection struct {
+	Path                 string `yaml:"path"`
+	RetentionDays        int    `yaml:"retention_days"` // 0 keeps records forever
+	PruneIntervalMinutes int    `yaml:"prune_interval_minutes"`
+}
+
+type postgresSection struct {
+	DSN               string `yaml:"dsn"`
+	DSNFile           string `yaml:"dsn_file"`
+	BatchSize         int    `yaml:"batch_size"`
+	PartitionInterval string `yaml:"partition_interval"` // day or month
+}
+
+type notifierSection struct {
+	KeyEvents            []string `yaml:"key_events"` // __keyevent@N__ operations; empty means keyspace channels
+	ConfigureEvents      bool     `yaml:"configure_events"`
+	CheckIntervalSeconds int      `yaml:"check_interval_seconds"` // 0 checks only at startup
+}
+
+type apiSection struct {
+	Address   string `yaml:"address"` // host:port; empty disables the API
+	Token     string `yaml:"token"`
+	TokenFile string `yaml:"token_file"`
+}
+
+type captureSection struct {
+	Enabled       bool     `yaml:"enabled"`
+	Directory     string   `yaml:"directory"`
+	Format        string   `yaml:"format"` // pcapng or raw
+	MaxFileSizeMB int      `yaml:"max_file_size_mb"`
+	MaxFiles      int      `yaml:"max_files"` // 0 keeps every file
+	Clients       []string `yaml:"clients"`   // IP addresses or CIDR prefixes; empty for all
+}
+
+type radsecSection struct {
+	Address    string                `yaml:"address"` // host:port; empty disables RadSec
+	CertFile   string                `yaml:"cert_file"`
+	KeyFile    string                `yaml:"key_file"`
+	CAFile     string                `yaml:"ca_file"`
+	Secret     string                `yaml:"secret"`
+	SecretFile string                `yaml:"secret_file"`
+	Clients    []radsecClientSection `yaml:"clients"`
+}
+
+type radsecClientSection struct {
+	Name       string `yaml:"name"`
+	Subject    string `yaml:"subject"`     // certificate common name or subject alternative name
+	NASAddress string `yaml:"nas_address"` // IP address or CIDR prefix; empty for any
+}
+
+type tcpSection struct {
+	Address            string `yaml:"address"`              // host:port; empty disables TCP
+	IdleTimeoutSeconds int    `yaml:"idle_timeout_seconds"` // 0 keeps idle connections open
+	MaxConnections     int    `yaml:"max_connections"`      // 0 is unlimited
+}
+
+type loggingSection struct {
+	Level string `yaml:"level"`
+	File  string `yaml:"file"`
+}
+
+// defaultFileConfig returns the values used before any source is applied
+func defaultFileConfig() *fileConfig {
+	return &fileConfig{
+		Radius: radiusSection{
+			Port: 1813, // Standard RADIUS accounting port
+		},
+		Redis: redisSection{
+			Mode:           string(RedisModeStandalone),
+			Port:           6379, // Standard Redis port
+			RecordTTLHours: 24,
+		},
+		Storage: storageSection{
+			Backend: string(StorageBackendRedis),
+			SQLite: sqliteSection{
+				PruneIntervalMinutes: 60,
+			},
+			Postgres: postgresSection{
+				BatchSize:         500,
+				PartitionInterval: string(PartitionMonthly),
+			},
+			Memory: memorySection{
+				MaxRecords: 100000,
+			},
+			Multi: multiSection{
+				Quorum: 1,
+			},
+		},
+		Notifier: notifierSection{
+			CheckIntervalSeconds: 60,
+		},
+		Logging: loggingSection{
+			Level: string(LogLevelInfo),
+		},
+		Capture: captureSection{
+			Format:        string(CaptureFormatPcapng),
+			MaxFileSizeMB: 100,
+			MaxFiles:      10,
+		},
+		RadSec: radsecSection{
+			Secret: DefaultRadSecSecret,
+		},
+		TCP: tcpSection{
+			IdleTimeoutSeconds: 300,
+			MaxConnections:     1000,
+		},
+	}
+}
+
+// redisConfig converts the redis section into a RedisConfig
+func (fc *fileConfig) redisConfig() RedisConfig {
+	return RedisConfig{
+		mode:               RedisMode(fc.Redis.Mode),
+		host:               fc.Redis.Host,
+		port:               fc.Redis.Port,
+		username:           fc.Redis.Username,
+		password:           fc.Redis.Password,
+		db:                 fc.Redis.DB,
+		tls:                fc.Redis.TLS.tlsConfig(),
+		sentinelMasterName: fc.Redis.Sentinel.MasterName,
+		sentinelAddrs:      fc.Redis.Sentinel.Addresses,
+		sentinelUsername:   fc.Redis.Sentinel.Username,
+		sentinelPassword:   fc.Redis.Sentinel.Password,
+		clusterAddrs:       fc.Redis.Cluster.Addresses,
+	}
+}
+
+// storageConfig converts the storage section into a StorageConfig
+func (fc *fileConfig) storageConfig() StorageConfig {
+	return StorageConfig{
+		backend: StorageBackend(fc.Storage.Backend),
+		sqlite: SQLiteConfig{
+			path:          fc.Storage.SQLite.Path,
+			retention:     time.Duration(fc.Storage.SQLite.RetentionDays) * 24 * time.Hour,
+			pruneInterval: time.Duration(fc.Storage.SQLite.PruneIntervalMinutes) * time.Minute,
+		},
+		postgres: PostgresConfig{
+			dsn:       fc.Storage.Postgres.DSN,
+			batchSize: fc.Storage.Postgres.BatchSize,
+			partition: PartitionInterval(fc.Storage.Postgres.PartitionInterval),
+		},
+		memory: MemoryConfig{
+			ttl:        time.Duration(fc.Storage.Memory.TTLSeconds) * time.Second,
+			maxRecords: fc.Storage.Memory.MaxRecords,
+		},
+		detail: DetailConfig{
+			directory: fc.Storage.Detail.Directory,
+		},
+		multi: MultiConfig{
+			targets: fc.Storage.Multi.targets(),
+			quorum:  fc.Storage.Multi.Quorum,
+		},
+	}
+}
+
+// targets converts the storage.multi.backends section, defaulting the policy
+func (m multiSection) targets() []StorageTarget {
+	var targets []StorageTarget
+	for _, section := range m.Backends {
+		policy := StoragePolicy(section.Policy)
+		if policy == "" {
+			policy = StoragePolicyRequired
+		}
+		targets = append(targets, StorageTarget{Backend: StorageBackend(section.Backend), Policy: policy})
+	}
+	return targets
+}
+
+// apiConfig converts the api section into an APIConfig
+func (fc *fileConfig) apiConfig() APIConfig {
+	return APIConfig{
+		address: fc.API.Address,
+		token:   fc.API.Token,
+	}
+}
+
+// captureConfig converts the capture section into a CaptureConfig
+func (fc *fileConfig) captureConfig() (CaptureConfig, error) {
+	capture := CaptureConfig{
+		enabled:     fc.Capture.Enabled,
+		directory:   fc.Capture.Directory,
+		format:      CaptureFormat(fc.Capture.Format),
+		maxFileSize: int64(fc.Capture.MaxFileSizeMB) << 20,
+		maxFiles:    fc.Capture.MaxFiles,
+	}
+	for i, address := range fc.Capture.Clients {
+		network, err := ParseClientAddress(address)
+		if err != nil {
+			return CaptureConfig{}, &FieldError{Key: fmt.Sprintf("capture.clients[%d]", i), Err: err}
+		}
+		capture.clients = append(capture.clients, network)
+	}
+	return capture, nil
+}
+
+// radsecConfig converts the radsec section into a RadSecConfig
+func (fc *fileConfig) radsecConfig() (RadSecConfig, error) {
+	radsec := RadSecConfig{
+		address:  fc.RadSec.Address,
+		certFile: fc.RadSec.CertFile,
+		keyFile:  fc.RadSec.KeyFile,
+		caFile:   fc.RadSec.CAFile,
+		secret:   fc.RadSec.Secret,
+	}
+	for i, section := range fc.RadSec.Clients {
+		client := RadSecClient{Name: section.Name, Subject: section.Subject}
+		if client.Name == "" {
+			client.Name = section.Subject
+		}
+		if section.NASAddress != "" {
+			network, err := ParseClientAddress(section.NASAddress)
+			if err != nil {
+				return RadSecConfig{}, &FieldError{Key: fmt.Sprintf("radsec.clients[%d].nas_address", i), Err: err}
+			}
+			client.NASNetwork = network
+		}
+		radsec.clients = append(radsec.clients, client)
+	}
+	return radsec, nil
+}
+
+// tcpConfig converts the tcp section into a TCPConfig
+func (fc *fileConfig) tcpConfig() TCPConfig {
+	return TCPConfig{
+		address:        fc.TCP.Address,
+		idleTimeout:    time.Duration(fc.TCP.IdleTimeoutSeconds) * time.Second,
+		maxConnections: fc.TCP.MaxConnections,
+	}
+}
+
+// notifierConfig converts the notifier section into a NotifierConfig
+func (fc *fileConfig) notifierConfig() NotifierConfig {
+	return NotifierConfig{
+		keyEvents:       fc.Notifier.KeyEvents,
+		configureEvents: fc.Notifier.ConfigureEvents,
+		checkInterval:   time.Duration(fc.Notifier.CheckIntervalSeconds) * time.Second,
+	}
+}
+
+// tlsConfig converts a tls section into a TLSConfig
+func (s tlsSection) tlsConfig() TLSConfig {
+	return TLSConfig{
+		enabled:            s.Enabled,
+		caFile:             s.CAFile,
+		certFile:           s.CertFile,
+		keyFile:            s.KeyFile,
+		serverName:         s.ServerName,
+		insecureSkipVerify: s.InsecureSkipVerify,
+	}
+}
+
+// clients converts the radius.clients section into a client table
+func (fc *fileConfig) clients() ([]Client, error) {
+	var clients []Client
+	for i, section := range fc.Radius.Clients {
+		network, err := ParseClientAddress(section.Address)
+		if err != nil {
+			return nil, &FieldError{Key: fmt.Sprintf("radius.clients[%d].address", i), Err: err}
+		}
+		clients = append(clients, Client{
+			Name:    section.Name,
+			Network: network,
+			Secret:  section.Secret,
+		})
+	}
+	return clients, nil
+}
+
+// decodeFile reads a YAML file and overlays its values onto fc
+func (fc *fileConfig) decodeFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	if err := decodeNode(&root, reflect.ValueOf(fc).Elem(), ""); err != nil {
+		return err
+	}
+
+	return fc.resolveSecretFiles()
+}
+
+// resolveSecretFiles replaces every *_file key set in the YAML file with the
+// contents of the referenced file, so secrets can be mounted (Docker/K8s
+// secrets) instead of written into the configuration
+func (fc *fileConfig) resolveSecretFiles() error {
+	type secretRef struct {
+		key   string
+		value *string
+		file  *string
+	}
+
+	refs := []secretRef{
+		{"radius.shared_secret", &fc.Radius.SharedSecret, &fc.Radius.SharedSecretFile},
+		{"redis.password", &fc.Redis.Password, &fc.Redis.PasswordFile},
+		{"redis.sentinel.password", &fc.Redis.Sentinel.Password, &fc.Redis.Sentinel.PasswordFile},
+		{"storage.postgres.dsn", &fc.Storage.Postgres.DSN, &fc.Storage.Postgres.DSNFile},
+		{"api.token", &fc.API.Token, &fc.API.TokenFile},
+		{"radsec.secret", &fc.RadSec.Secret, &fc.RadSec.SecretFile},
+	}
+	for i := range fc.Radius.Clients {
+		client := &fc.Radius.Clients[i]
+		refs = append(refs, secretRef{fmt.Sprintf("radius.clients[%d].secret", i), &client.Secret, &client.SecretFile})
+	}
+
+	for _, ref := range refs {
+		if *ref.file == "" {
+			continue
+		}
+		if *ref.value != "" {
+			return &FieldError{Key: ref.key + "_file", Err: fmt.Errorf("cannot be combined with %s", ref.key)}
+		}
+		secret, err := readSecretFile(*ref.file)
+		if err != nil {
+			return &FieldError{Key: ref.key + "_file", Err: err}
+		}
+		*ref.value, *ref.file = secret, ""
+	}
+
+	return nil
+}
+
+// readSecretFile returns the contents of a secret file without the trailing newline
+func readSecretFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret file: %w", err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// decodeNode walks the YAML tree alongside the target struct so that unknown
+// keys and type mismatches can be reported with their full key path.
+// Values missing from the file leave the target untouched.
+func decodeNode(node *yaml.Node, out reflect.Value, path string) error {
+	if node.Kind == yaml.DocumentNode {
+		if len(node.Content) == 0 {
+			return nil
+		}
+		return decodeNode(node.Content[0], out, path)
+	}
+
+	// An explicit null (e.g. "radius:" with nothing below) keeps the default
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!null" {
+		return nil
+	}
+
+	switch out.Kind() {
+	case reflect.Struct:
+		if node.Kind != yaml.MappingNode {
+			return &FieldError{Key: keyOrRoot(path), Err: fmt.Errorf("expected a mapping (line %d)", node.Line)}
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			keyNode, valueNode := node.Content[i], node.Content[i+1]
+			key := joinKey(path, keyNode.Value)
+
+			field, ok := fieldByTag(out, keyNode.Value)
+			if !ok {
+				return &FieldError{Key: key, Err: fmt.Errorf("unknown key (line %d)", keyNode.Line)}
+			}
+			if err := decodeNode(valueNode, field, key); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case reflect.Slice:
+		if node.Kind != yaml.SequenceNode {
+			return &FieldError{Key: keyOrRoot(path), Err: fmt.Errorf("expected a list (line %d)", node.Line)}
+		}
+		items := reflect.MakeSlice(out.Type(), len(node.Content), len(node.Content))
+		for i, item := range node.Content {
+			if err := decodeNode(item, items.Index(i), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+		out.Set(items)
+		return nil
+
+	default:
+		if node.Kind != yaml.ScalarNode {
+			return &FieldError{Key: keyOrRoot(path), Err: fmt.Errorf("expected a single value (line %d)", node.Line)}
+		}
+		if err := node.Decode(out.Addr().Interface()); err != nil {
+			return &FieldError{Key: keyOrRoot(path), Err: fmt.Errorf("invalid %s value %q (line %d)", out.Kind(), node.Value, node.Line)}
+		}
+		return nil
+	}
+}
+
+// fieldByTag returns the struct field whose yaml tag matches name
+func fieldByTag(v reflect.Value, name string) (reflect.Value, bool) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		tag := strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0]
+		if tag == name {
+			return v.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+func joinKey(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func keyOrRoot(path string) string {
+	if path == "" {
+		return "(root)"
+	}
+	return path
+}
+
+// ParseClientAddress accepts either a single IP address or a CIDR prefix, as
+// the client and capture.clients settings do
+func ParseClientAddress(address string) (*net.IPNet, error) {
+	if address == "" {
+		return nil, fmt.Errorf("client address cannot be empty")
+	}
+
+	if strings.Contains(address, "/") {
+		_, network, err := net.ParseCIDR(address)
+		if err != nil {
+			return nil, fmt.Errorf("invalid client address %q: %w", address, err)
+		}
+		return network, nil
+	}
+
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid client address %q", address)
+	}
+	if v4 := ip.To4(); v4 != nil {
+		return &net.IPNet{IP: v4, Mask: net.CIDRMask(32, 32)}, nil
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+}
@@ -0,0 +1,1116 @@
+package config
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Helper function to write a YAML config file into a temp directory
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+	return path
+}
+
+func TestLoadFile_ValidConfig(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	path := writeConfigFile(t, `
+radius:
+  port: 11813
+  shared_secret: filesecret123
+  clients:
+    - name: bras-1
+      address: 10.1.0.0/16
+      secret: bras1secret
+    - name: bras-2
+      address: 10.1.2.3
+      secret: bras2secret
+redis:
+  host: redis.internal
+  port: 6380
+  record_ttl_hours: 48
+logging:
+  level: debug
+  file: /var/log/radius.log
+`)
+
+	cfg, err := LoadControlplane(path, nil)
+
+	require.NoError(t, err)
+	assert.Equal(t, ":11813", cfg.GetRADIUSAddr())
+	assert.Equal(t, "filesecret123", cfg.GetSharedSecret())
+	assert.Equal(t, "redis.internal:6380", cfg.GetRedisAddr())
+	assert.Equal(t, 48*time.Hour, cfg.GetRecordTTL())
+	assert.Equal(t, LogLevelDebug, cfg.GetLogLevel())
+
+	clients := cfg.GetClients()
+	require.Len(t, clients, 2)
+	assert.Equal(t, "bras-1", clients[0].Name)
+	assert.Equal(t, "10.1.0.0/16", clients[0].Network.String())
+	assert.Equal(t, "10.1.2.3/32", clients[1].Network.String())
+
+	// The logger reads the same file but only the sections it uses
+	loggerCfg, err := LoadLogger(path, nil)
+
+	require.NoError(t, err)
+	assert.Equal(t, "redis.internal:6380", loggerCfg.GetRedisAddr())
+	assert.Equal(t, "/var/log/radius.log", loggerCfg.GetLogFile())
+}
+
+func TestLoadFromFile(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	path := writeConfigFile(t, `
+radius:
+  shared_secret: filesecret123
+redis:
+  host: redis.internal
+`)
+	_ = os.Setenv("REDIS_PORT", "6380")
+
+	cfg, err := LoadFromFile(path)
+
+	require.NoError(t, err)
+	assert.Equal(t, "filesecret123", cfg.GetSharedSecret())
+	assert.Equal(t, "redis.internal:6380", cfg.GetRedisAddr())
+}
+
+func TestLoadFile_Defaults(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	path := writeConfigFile(t, `
+radius:
+  shared_secret: filesecret123
+redis:
+  host: localhost
+logging:
+  file: /tmp/radius.log
+`)
+
+	cfg, err := LoadControlplane(path, nil)
+
+	require.NoError(t, err)
+	assert.Equal(t, ":1813", cfg.GetRADIUSAddr())
+	assert.Equal(t, "localhost:6379", cfg.GetRedisAddr())
+	assert.Equal(t, 24*time.Hour, cfg.GetRecordTTL())
+	assert.Equal(t, LogLevelInfo, cfg.GetLogLevel())
+}
+
+func TestLoadFile_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantKey string
+		wantErr string
+	}{
+		{
+			name:    "unknown top-level key",
+			content: "radious:\n  port: 1813\n",
+			wantKey: "radious",
+			wantErr: "unknown key (line 1)",
+		},
+		{
+			name:    "unknown nested key",
+			content: "redis:\n  hostname: localhost\n",
+			wantKey: "redis.hostname",
+			wantErr: "unknown key (line 2)",
+		},
+		{
+			name:    "invalid integer",
+			content: "redis:\n  port: abc\n",
+			wantKey: "redis.port",
+			wantErr: `invalid int value "abc" (line 2)`,
+		},
+		{
+			name:    "section is not a mapping",
+			content: "logging: debug\n",
+			wantKey: "logging",
+			wantErr: "expected a mapping",
+		},
+		{
+			name:    "clients is not a list",
+			content: "radius:\n  clients: nas\n",
+			wantKey: "radius.clients",
+			wantErr: "expected a list",
+		},
+		{
+			name: "invalid client address",
+			content: `
+radius:
+  clients:
+    - address: 10.0.0.1
+      secret: goodsecret
+    - address: not-an-ip
+      secret: goodsecret
+`,
+			wantKey: "radius.clients[1].address",
+			wantErr: `invalid client address "not-an-ip"`,
+		},
+		{
+			name: "short client secret",
+			content: `
+radius:
+  clients:
+    - address: 10.0.0.0/8
+      secret: short
+redis:
+  host: localhost
+logging:
+  file: /tmp/radius.log
+`,
+			wantKey: "radius.clients[0].secret",
+			wantErr: "shared secret must be at least 8 characters long",
+		},
+		{
+			name:    "missing shared secret",
+			content: "redis:\n  host: localhost\n",
+			wantKey: "radius.shared_secret",
+			wantErr: "shared secret cannot be empty",
+		},
+		{
+			name: "invalid log level",
+			content: `
+radius:
+  shared_secret: filesecret123
+redis:
+  host: localhost
+logging:
+  level: verbose
+`,
+			wantKey: "logging.level",
+			wantErr: "invalid log level: verbose",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv()
+			defer clearEnv()
+
+			cfg, err := LoadControlplane(writeConfigFile(t, tt.content), nil)
+
+			require.Error(t, err)
+			assert.Nil(t, cfg)
+
+			var fieldErr *FieldError
+			require.True(t, errors.As(err, &fieldErr), "expected FieldError, got %T: %v", err, err)
+			assert.Equal(t, tt.wantKey, fieldErr.Key)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestLoadFile_MissingFile(t *testing.T) {
+	cfg, err := LoadControlplane(filepath.Join(t.TempDir(), "missing.yaml"), nil)
+
+	assert.Error(t, err)
+	assert.Nil(t, cfg)
+	assert.Contains(t, err.Error(), "failed to read config file")
+}
+
+func TestLoadFile_MalformedYAML(t *testing.T) {
+	cfg, err := LoadLogger(writeConfigFile(t, "radius: [unterminated\n"), nil)
+
+	assert.Error(t, err)
+	assert.Nil(t, cfg)
+	assert.Contains(t, err.Error(), "failed to parse config file")
+}
+
+func TestLoadFile_SecretFiles(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	dir := t.TempDir()
+	sharedSecretFile := filepath.Join(dir, "shared_secret")
+	clientSecretFile := filepath.Join(dir, "client_secret")
+	passwordFile := filepath.Join(dir, "redis_password")
+	require.NoError(t, os.WriteFile(sharedSecretFile, []byte("sharedfromfile\n"), 0600))
+	require.NoError(t, os.WriteFile(clientSecretFile, []byte("clientfromfile"), 0600))
+	require.NoError(t, os.WriteFile(passwordFile, []byte("redispassword\r\n"), 0600))
+
+	path := writeConfigFile(t, `
+radius:
+  shared_secret_file: `+sharedSecretFile+`
+  clients:
+    - address: 10.0.0.0/8
+      secret_file: `+clientSecretFile+`
+redis:
+  host: localhost
+  username: radius
+  password_file: `+passwordFile+`
+  db: 2
+`)
+
+	cfg, err := LoadControlplane(path, nil)
+
+	require.NoError(t, err)
+	assert.Equal(t, "sharedfromfile", cfg.GetSharedSecret())
+	assert.Equal(t, "clientfromfile", cfg.GetClients()[0].Secret)
+	assert.Equal(t, "radius", cfg.GetRedis().GetUsername())
+	assert.Equal(t, "redispassword", cfg.GetRedis().GetPassword())
+	assert.Equal(t, 2, cfg.GetRedis().GetDB())
+}
+
+func TestLoadFile_RedisErrors(t *testing.T) {
+	dir := t.TempDir()
+	bogusPEM := filepath.Join(dir, "bogus.pem")
+	require.NoError(t, os.WriteFile(bogusPEM, []byte("not a certificate"), 0600))
+
+	tests := []struct {
+		name    string
+		content string
+		wantKey string
+		wantErr string
+	}{
+		{
+			name:    "secret and secret file",
+			content: "radius:\n  shared_secret: inlinesecret\n  shared_secret_file: /run/secrets/radius\n",
+			wantKey: "radius.shared_secret_file",
+			wantErr: "cannot be combined with radius.shared_secret",
+		},
+		{
+			name:    "missing secret file",
+			content: "redis:\n  password_file: " + filepath.Join(dir, "missing") + "\n",
+			wantKey: "redis.password_file",
+			wantErr: "failed to read secret file",
+		},
+		{
+			name:    "username without password",
+			content: "redis:\n  host: localhost\n  username: radius\n",
+			wantKey: "redis.password",
+			wantErr: "password is required when username is set",
+		},
+		{
+			name:    "negative db",
+			content: "redis:\n  host: localhost\n  db: -1\n",
+			wantKey: "redis.db",
+			wantErr: "database index cannot be negative",
+		},
+		{
+			name:    "tls files without tls",
+			content: "redis:\n  host: localhost\n  tls:\n    ca_file: " + bogusPEM + "\n",
+			wantKey: "redis.tls.enabled",
+			wantErr: "must be true when TLS files are set",
+		},
+		{
+			name:    "cert without key",
+			content: "redis:\n  host: localhost\n  tls:\n    enabled: true\n    cert_file: " + bogusPEM + "\n",
+			wantKey: "redis.tls.key_file",
+			wantErr: "cert_file and key_file must be set together",
+		},
+		{
+			name:    "invalid CA file",
+			content: "redis:\n  host: localhost\n  tls:\n    enabled: true\n    ca_file: " + bogusPEM + "\n",
+			wantKey: "redis.tls",
+			wantErr: "no certificates found in CA file",
+		},
+		{
+			name:    "invalid tls flag",
+			content: "redis:\n  tls:\n    enabled: sometimes\n",
+			wantKey: "redis.tls.enabled",
+			wantErr: `invalid bool value "sometimes"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv()
+			defer clearEnv()
+
+			cfg, err := LoadLogger(writeConfigFile(t, "logging:\n  file: /tmp/test.log\n"+tt.content), nil)
+
+			require.Error(t, err)
+			assert.Nil(t, cfg)
+
+			var fieldErr *FieldError
+			require.True(t, errors.As(err, &fieldErr), "expected FieldError, got %T: %v", err, err)
+			assert.Equal(t, tt.wantKey, fieldErr.Key)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestLoadFile_RedisModes(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	dir := t.TempDir()
+	passwordFile := filepath.Join(dir, "sentinel_password")
+	require.NoError(t, os.WriteFile(passwordFile, []byte("sentinelpass\n"), 0600))
+
+	cfg, err := LoadLogger(writeConfigFile(t, `
+redis:
+  mode: sentinel
+  password: redispass
+  sentinel:
+    master_name: mymaster
+    addresses: [sentinel-1:26379, sentinel-2:26379]
+    password_file: `+passwordFile+`
+logging:
+  file: /tmp/test.log
+`), nil)
+
+	require.NoError(t, err)
+	redis := cfg.GetRedis()
+	assert.Equal(t, RedisModeSentinel, redis.GetMode())
+	assert.Equal(t, "mymaster", redis.GetSentinelMasterName())
+	assert.Equal(t, []string{"sentinel-1:26379", "sentinel-2:26379"}, redis.GetSentinelAddrs())
+	assert.Equal(t, "sentinelpass", redis.GetSentinelPassword())
+	assert.Equal(t, "redispass", redis.GetPassword())
+	assert.Equal(t, `master "mymaster" via sentinels sentinel-1:26379,sentinel-2:26379`, redis.Describe())
+
+	_ = os.Setenv("REDIS_MODE", "cluster")
+	_ = os.Setenv("REDIS_CLUSTER_ADDRESSES", "node-1:6379, node-2:6379")
+
+	cfg, err = LoadLogger(writeConfigFile(t, "logging:\n  file: /tmp/test.log\n"), nil)
+
+	require.NoError(t, err)
+	assert.Equal(t, RedisModeCluster, cfg.GetRedis().GetMode())
+	assert.Equal(t, []string{"node-1:6379", "node-2:6379"}, cfg.GetRedis().GetClusterAddrs())
+	assert.Equal(t, "cluster node-1:6379,node-2:6379", cfg.GetRedis().Describe())
+}
+
+func TestLoadFile_RedisModeErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantKey string
+		wantErr string
+	}{
+		{
+			name:    "unknown mode",
+			content: "redis:\n  mode: ring\n",
+			wantKey: "redis.mode",
+			wantErr: "invalid mode: ring",
+		},
+		{
+			name:    "sentinel without master name",
+			content: "redis:\n  mode: sentinel\n  sentinel:\n    addresses: [sentinel:26379]\n",
+			wantKey: "redis.sentinel.master_name",
+			wantErr: "master name cannot be empty",
+		},
+		{
+			name:    "sentinel without addresses",
+			content: "redis:\n  mode: sentinel\n  sentinel:\n    master_name: mymaster\n",
+			wantKey: "redis.sentinel.addresses",
+			wantErr: "at least one address is required",
+		},
+		{
+			name:    "sentinel address without port",
+			content: "redis:\n  mode: sentinel\n  sentinel:\n    master_name: mymaster\n    addresses: [sentinel]\n",
+			wantKey: "redis.sentinel.addresses[0]",
+			wantErr: `invalid address "sentinel"`,
+		},
+		{
+			name:    "cluster with invalid port",
+			content: "redis:\n  mode: cluster\n  cluster:\n    addresses: [node-1:6379, node-2:0]\n",
+			wantKey: "redis.cluster.addresses[1]",
+			wantErr: "port must be between 1 and 65535",
+		},
+		{
+			name:    "cluster with database index",
+			content: "redis:\n  mode: cluster\n  db: 1\n  cluster:\n    addresses: [node-1:6379]\n",
+			wantKey: "redis.db",
+			wantErr: "cluster mode only supports database 0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv()
+			defer clearEnv()
+
+			cfg, err := LoadLogger(writeConfigFile(t, "logging:\n  file: /tmp/test.log\n"+tt.content), nil)
+
+			require.Error(t, err)
+			assert.Nil(t, cfg)
+
+			var fieldErr *FieldError
+			require.True(t, errors.As(err, &fieldErr), "expected FieldError, got %T: %v", err, err)
+			assert.Equal(t, tt.wantKey, fieldErr.Key)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestLoadFile_NotifierKeyEvents(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	path := writeConfigFile(t, `
+redis:
+  host: localhost
+  db: 2
+notifier:
+  key_events: [set, expired]
+logging:
+  file: /tmp/test.log
+`)
+
+	cfg, err := LoadLogger(path, nil)
+
+	require.NoError(t, err)
+	assert.Equal(t, 2, cfg.GetRedis().GetDB())
+	assert.Equal(t, []string{"set", "expired"}, cfg.GetNotifier().GetKeyEvents())
+	assert.False(t, cfg.GetNotifier().ConfigureEvents())
+	assert.Equal(t, time.Minute, cfg.GetNotifier().GetCheckInterval())
+
+	// Environment overrides the file with a comma-separated list
+	_ = os.Setenv("NOTIFIER_KEY_EVENTS", "del, expired")
+
+	cfg, err = LoadLogger(path, nil)
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"del", "expired"}, cfg.GetNotifier().GetKeyEvents())
+
+	// Patterns are not operation names
+	_ = os.Setenv("NOTIFIER_KEY_EVENTS", "set,exp*")
+
+	cfg, err = LoadLogger(path, nil)
+
+	assert.Nil(t, cfg)
+	assert.EqualError(t, err, `notifier.key_events[1]: invalid event name "exp*"`)
+}
+
+func TestLoadFile_NotifierEventChecks(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	path := writeConfigFile(t, `
+redis:
+  host: localhost
+notifier:
+  configure_events: true
+  check_interval_seconds: 0
+logging:
+  file: /tmp/test.log
+`)
+
+	cfg, err := LoadLogger(path, nil)
+
+	require.NoError(t, err)
+	assert.True(t, cfg.GetNotifier().ConfigureEvents())
+	assert.Zero(t, cfg.GetNotifier().GetCheckInterval())
+
+	_ = os.Setenv("NOTIFIER_CHECK_INTERVAL_SECONDS", "-5")
+
+	cfg, err = LoadLogger(path, nil)
+
+	assert.Nil(t, cfg)
+	assert.EqualError(t, err, "notifier.check_interval_seconds: check interval cannot be negative")
+}
+
+func TestLoadFile_SQLiteStorage(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	// Redis settings are not required when records are stored in SQLite
+	path := writeConfigFile(t, `
+radius:
+  shared_secret: testsecret123
+storage:
+  backend: sqlite
+  sqlite:
+    path: /var/lib/radius/accounting.db
+    retention_days: 90
+`)
+
+	cfg, err := LoadControlplane(path, nil)
+
+	require.NoError(t, err)
+	assert.Equal(t, StorageBackendSQLite, cfg.GetStorage().GetBackend())
+	assert.Equal(t, "/var/lib/radius/accounting.db", cfg.GetStorage().GetSQLite().GetPath())
+	assert.Equal(t, 90*24*time.Hour, cfg.GetStorage().GetSQLite().GetRetention())
+	assert.Equal(t, time.Hour, cfg.GetStorage().GetSQLite().GetPruneInterval())
+
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr string
+	}{
+		{
+			name:    "invalid backend",
+			env:     map[string]string{"STORAGE_BACKEND": "mysql"},
+			wantErr: "storage.backend: invalid backend: mysql (valid: redis, sqlite, postgres, memory, detail, multi)",
+		},
+		{
+			name:    "redis backend requires redis host",
+			env:     map[string]string{"STORAGE_BACKEND": "redis"},
+			wantErr: "redis.host: redis host cannot be empty",
+		},
+		{
+			name:    "negative retention",
+			env:     map[string]string{"SQLITE_RETENTION_DAYS": "-1"},
+			wantErr: "storage.sqlite.retention_days: retention cannot be negative",
+		},
+		{
+			name:    "zero prune interval",
+			env:     map[string]string{"SQLITE_PRUNE_INTERVAL_MINUTES": "0"},
+			wantErr: "storage.sqlite.prune_interval_minutes: prune interval must be greater than 0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv()
+			for k, v := range tt.env {
+				_ = os.Setenv(k, v)
+			}
+
+			cfg, err := LoadControlplane(path, nil)
+
+			assert.Nil(t, cfg)
+			assert.EqualError(t, err, tt.wantErr)
+		})
+	}
+
+	// A SQLite backend without a path cannot be opened
+	_ = os.Setenv("STORAGE_BACKEND", "sqlite")
+	cfg, err = LoadControlplane(writeConfigFile(t, "radius:\n  shared_secret: testsecret123\n"), nil)
+
+	assert.Nil(t, cfg)
+	assert.EqualError(t, err, "storage.sqlite.path: database path cannot be empty")
+}
+
+func TestLoadFile_PostgresStorage(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	dir := t.TempDir()
+	dsnFile := filepath.Join(dir, "dsn")
+	require.NoError(t, os.WriteFile(dsnFile, []byte("postgres://radius:pw@db/radius\n"), 0o600))
+
+	path := writeConfigFile(t, `
+radius:
+  shared_secret: testsecret123
+storage:
+  backend: postgres
+  postgres:
+    dsn_file: `+dsnFile+`
+    partition_interval: day
+`)
+
+	cfg, err := LoadControlplane(path, nil)
+
+	require.NoError(t, err)
+	assert.Equal(t, StorageBackendPostgres, cfg.GetStorage().GetBackend())
+	assert.Equal(t, "postgres://radius:pw@db/radius", cfg.GetStorage().GetPostgres().GetDSN())
+	assert.Equal(t, 500, cfg.GetStorage().GetPostgres().GetBatchSize())
+	assert.Equal(t, PartitionDaily, cfg.GetStorage().GetPostgres().GetPartitionInterval())
+
+	_ = os.Setenv("POSTGRES_PARTITION_INTERVAL", "week")
+
+	cfg, err = LoadControlplane(path, nil)
+
+	assert.Nil(t, cfg)
+	assert.EqualError(t, err, "storage.postgres.partition_interval: invalid partition interval: week (valid: day, month)")
+
+	_ = os.Setenv("POSTGRES_PARTITION_INTERVAL", "month")
+	_ = os.Setenv("POSTGRES_BATCH_SIZE", "0")
+
+	cfg, err = LoadControlplane(path, nil)
+
+	assert.Nil(t, cfg)
+	assert.EqualError(t, err, "storage.postgres.batch_size: batch size must be greater than 0")
+}
+
+func TestLoadFile_MemoryStorage(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	path := writeConfigFile(t, `
+radius:
+  shared_secret: testsecret123
+storage:
+  backend: memory
+  memory:
+    ttl_seconds: 3600
+`)
+
+	cfg, err := LoadControlplane(path, nil)
+
+	require.NoError(t, err)
+	assert.Equal(t, StorageBackendMemory, cfg.GetStorage().GetBackend())
+	assert.Equal(t, time.Hour, cfg.GetStorage().GetMemory().GetTTL())
+	assert.Equal(t, 100000, cfg.GetStorage().GetMemory().GetMaxRecords())
+
+	_ = os.Setenv("MEMORY_MAX_RECORDS", "-1")
+
+	cfg, err = LoadControlplane(path, nil)
+
+	assert.Nil(t, cfg)
+	assert.EqualError(t, err, "storage.memory.max_records: max records cannot be negative")
+}
+
+func TestLoadFile_DetailStorage(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	path := writeConfigFile(t, `
+radius:
+  shared_secret: testsecret123
+storage:
+  backend: detail
+  detail:
+    directory: /var/log/radius/radacct
+`)
+
+	cfg, err := LoadControlplane(path, nil)
+
+	require.NoError(t, err)
+	assert.Equal(t, StorageBackendDetail, cfg.GetStorage().GetBackend())
+	assert.Equal(t, "/var/log/radius/radacct", cfg.GetStorage().GetDetail().GetDirectory())
+
+	_ = os.Setenv("DETAIL_DIRECTORY", "/srv/detail")
+
+	cfg, err = LoadControlplane(path, nil)
+
+	require.NoError(t, err)
+	assert.Equal(t, "/srv/detail", cfg.GetStorage().GetDetail().GetDirectory())
+
+	clearEnv()
+	path = writeConfigFile(t, `
+radius:
+  shared_secret: testsecret123
+storage:
+  backend: detail
+`)
+
+	cfg, err = LoadControlplane(path, nil)
+
+	assert.Nil(t, cfg)
+	assert.EqualError(t, err, "storage.detail.directory: directory cannot be empty")
+}
+
+func TestLoadFile_Capture(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	path := writeConfigFile(t, `
+radius:
+  shared_secret: testsecret123
+storage:
+  backend: memory
+capture:
+  directory: /var/lib/radius/capture
+  format: raw
+  clients: [10.1.0.0/16, 192.168.1.1]
+`)
+
+	cfg, err := LoadControlplane(path, nil)
+
+	require.NoError(t, err)
+	capture := cfg.GetCapture()
+	assert.True(t, capture.Configured())
+	assert.False(t, capture.Enabled())
+	assert.Equal(t, "/var/lib/radius/capture", capture.GetDirectory())
+	assert.Equal(t, CaptureFormatRaw, capture.GetFormat())
+	assert.Equal(t, int64(100<<20), capture.GetMaxFileSize())
+	assert.Equal(t, 10, capture.GetMaxFiles())
+	require.Len(t, capture.GetClients(), 2)
+	assert.Equal(t, "192.168.1.1/32", capture.GetClients()[1].String())
+
+	_ = os.Setenv("CAPTURE_ENABLED", "true")
+	_ = os.Setenv("CAPTURE_CLIENTS", "10.2.0.0/16")
+
+	cfg, err = LoadControlplane(path, nil)
+
+	require.NoError(t, err)
+	assert.True(t, cfg.GetCapture().Enabled())
+	require.Len(t, cfg.GetCapture().GetClients(), 1)
+	assert.Equal(t, "10.2.0.0/16", cfg.GetCapture().GetClients()[0].String())
+
+	_ = os.Setenv("CAPTURE_CLIENTS", "10.2.0.0/33")
+	_, err = LoadControlplane(path, nil)
+	assert.ErrorContains(t, err, "capture.clients[0]: ")
+
+	clearEnv()
+	_ = os.Setenv("RADIUS_SHARED_SECRET", "testsecret123")
+	_ = os.Setenv("STORAGE_BACKEND", "memory")
+	_ = os.Setenv("CAPTURE_ENABLED", "true")
+	_, err = LoadControlplane("", nil)
+	assert.EqualError(t, err, "capture.directory: directory is required to capture packets")
+
+	_ = os.Setenv("CAPTURE_DIRECTORY", "/tmp/capture")
+	_ = os.Setenv("CAPTURE_FORMAT", "pcap")
+	_, err = LoadControlplane("", nil)
+	assert.EqualError(t, err, `capture.format: invalid format "pcap", expected pcapng or raw`)
+}
+
+func TestLoadFile_MultiStorage(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	path := writeConfigFile(t, `
+radius:
+  shared_secret: testsecret123
+redis:
+  host: localhost
+storage:
+  backend: multi
+  sqlite:
+    path: /var/lib/radius/accounting.db
+  multi:
+    backends:
+      - backend: redis
+      - backend: sqlite
+        policy: best_effort
+`)
+
+	cfg, err := LoadControlplane(path, nil)
+
+	require.NoError(t, err)
+	assert.Equal(t, StorageBackendMulti, cfg.GetStorage().GetBackend())
+	assert.Equal(t, []StorageTarget{
+		{Backend: StorageBackendRedis, Policy: StoragePolicyRequired},
+		{Backend: StorageBackendSQLite, Policy: StoragePolicyBestEffort},
+	}, cfg.GetStorage().GetMulti().GetTargets())
+	assert.Equal(t, 1, cfg.GetStorage().GetMulti().GetQuorum())
+	assert.True(t, cfg.GetStorage().Uses(StorageBackendSQLite))
+	assert.False(t, cfg.GetStorage().Uses(StorageBackendPostgres))
+
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr string
+	}{
+		{
+			name:    "quorum above backend count",
+			env:     map[string]string{"STORAGE_MULTI_QUORUM": "3"},
+			wantErr: "storage.multi.quorum: quorum must be between 1 and 2, got 3",
+		},
+		{
+			name:    "backend settings are validated",
+			env:     map[string]string{"STORAGE_MULTI_BACKENDS": "redis,postgres"},
+			wantErr: "storage.postgres.dsn: connection string cannot be empty",
+		},
+		{
+			name:    "duplicate backend",
+			env:     map[string]string{"STORAGE_MULTI_BACKENDS": "redis,redis:best_effort"},
+			wantErr: "storage.multi.backends[1].backend: duplicate backend: redis",
+		},
+		{
+			name:    "nested multi",
+			env:     map[string]string{"STORAGE_MULTI_BACKENDS": "multi"},
+			wantErr: "storage.multi.backends[0].backend: multi storage cannot be nested",
+		},
+		{
+			name:    "invalid policy",
+			env:     map[string]string{"STORAGE_MULTI_BACKENDS": "redis:sometimes"},
+			wantErr: "storage.multi.backends[0].policy: invalid policy: sometimes (valid: required, best_effort)",
+		},
+		{
+			name:    "redis settings required when redis is a target",
+			env:     map[string]string{"STORAGE_MULTI_BACKENDS": "sqlite,redis", "REDIS_PORT": "0"},
+			wantErr: "redis.port: port must be between 1 and 65535, got 0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv()
+			for k, v := range tt.env {
+				_ = os.Setenv(k, v)
+			}
+
+			cfg, err := LoadControlplane(path, nil)
+
+			assert.Nil(t, cfg)
+			assert.EqualError(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestLoadFile_API(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	tokenFile := filepath.Join(t.TempDir(), "api_token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("0123456789abcdef\n"), 0o600))
+
+	path := writeConfigFile(t, `
+radius:
+  shared_secret: testsecret123
+redis:
+  host: localhost
+api:
+  address: 127.0.0.1:8080
+  token_file: `+tokenFile+`
+`)
+
+	cfg, err := LoadControlplane(path, nil)
+
+	require.NoError(t, err)
+	assert.True(t, cfg.GetAPI().Enabled())
+	assert.Equal(t, "127.0.0.1:8080", cfg.GetAPI().GetAddress())
+	assert.Equal(t, "0123456789abcdef", cfg.GetAPI().GetToken())
+
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr string
+	}{
+		{
+			name:    "short token",
+			env:     map[string]string{"API_TOKEN": "short"},
+			wantErr: "api.token: token must be at least 16 characters",
+		},
+		{
+			name:    "address without port",
+			env:     map[string]string{"API_ADDRESS": "localhost"},
+			wantErr: "api.address: invalid address \"localhost\": address localhost: missing port in address",
+		},
+		{
+			name:    "port out of range",
+			env:     map[string]string{"API_ADDRESS": ":70000"},
+			wantErr: "api.address: port must be between 1 and 65535, got 70000",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv()
+			for k, v := range tt.env {
+				_ = os.Setenv(k, v)
+			}
+
+			cfg, err := LoadControlplane(path, nil)
+
+			assert.Nil(t, cfg)
+			assert.EqualError(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestLoadFile_RadSec(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	path := writeConfigFile(t, `
+radius:
+  shared_secret: testsecret123
+storage:
+  backend: memory
+radsec:
+  clients:
+    - subject: nas-1.example.net
+      nas_address: 10.1.0.0/16
+`)
+
+	cfg, err := LoadControlplane(path, nil)
+
+	require.NoError(t, err)
+	radsec := cfg.GetRadSec()
+	assert.False(t, radsec.Enabled())
+	assert.Equal(t, DefaultRadSecSecret, radsec.GetSecret())
+	require.Len(t, radsec.GetClients(), 1)
+	assert.Equal(t, "nas-1.example.net", radsec.GetClients()[0].Name)
+	assert.Equal(t, "10.1.0.0/16", radsec.GetClients()[0].NASNetwork.String())
+
+	missing := filepath.Join(t.TempDir(), "missing.pem")
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr string
+	}{
+		{
+			name:    "port out of range",
+			env:     map[string]string{"RADSEC_ADDRESS": ":70000"},
+			wantErr: "radsec.address: port must be between 1 and 65535, got 70000",
+		},
+		{
+			name:    "no certificate",
+			env:     map[string]string{"RADSEC_ADDRESS": ":2083"},
+			wantErr: "radsec.cert_file: cert_file and key_file are required",
+		},
+		{
+			name:    "no CA",
+			env:     map[string]string{"RADSEC_ADDRESS": ":2083", "RADSEC_CERT_FILE": missing, "RADSEC_KEY_FILE": missing},
+			wantErr: "radsec.ca_file: CA file is required to verify NAS certificates",
+		},
+		{
+			name: "unreadable certificate",
+			env: map[string]string{"RADSEC_ADDRESS": ":2083", "RADSEC_CERT_FILE": missing, "RADSEC_KEY_FILE": missing,
+				"RADSEC_CA_FILE": missing},
+			wantErr: "radsec: failed to load certificate: open " + missing + ": no such file or directory",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv()
+			for k, v := range tt.env {
+				_ = os.Setenv(k, v)
+			}
+
+			cfg, err := LoadControlplane(path, nil)
+
+			assert.Nil(t, cfg)
+			assert.EqualError(t, err, tt.wantErr)
+		})
+	}
+
+	clearEnv()
+	_, err = LoadControlplane(writeConfigFile(t, `
+radius:
+  shared_secret: testsecret123
+storage:
+  backend: memory
+radsec:
+  address: :2083
+  cert_file: `+missing+`
+  key_file: `+missing+`
+  ca_file: `+missing+`
+  secret: ""
+`), nil)
+	assert.EqualError(t, err, "radsec.secret: secret cannot be empty")
+
+	path = writeConfigFile(t, `
+radius:
+  shared_secret: testsecret123
+storage:
+  backend: memory
+radsec:
+  clients:
+    - name: pop-1
+      subject: nas-1.example.net
+      nas_address: 10.1.0.0/33
+`)
+	_, err = LoadControlplane(path, nil)
+	assert.ErrorContains(t, err, "radsec.clients[0].nas_address: ")
+}
+
+func TestLoadFile_TCP(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	path := writeConfigFile(t, `
+radius:
+  shared_secret: testsecret123
+storage:
+  backend: memory
+tcp:
+  address: :1813
+  max_connections: 50
+`)
+
+	cfg, err := LoadControlplane(path, nil)
+
+	require.NoError(t, err)
+	tcp := cfg.GetTCP()
+	assert.True(t, tcp.Enabled())
+	assert.Equal(t, ":1813", tcp.GetAddress())
+	assert.Equal(t, 300*time.Second, tcp.GetIdleTimeout())
+	assert.Equal(t, 50, tcp.GetMaxConnections())
+
+	_ = os.Setenv("TCP_IDLE_TIMEOUT_SECONDS", "0")
+	_ = os.Setenv("TCP_MAX_CONNECTIONS", "0")
+	cfg, err = LoadControlplane(path, nil)
+	require.NoError(t, err)
+	assert.Zero(t, cfg.GetTCP().GetIdleTimeout())
+	assert.Zero(t, cfg.GetTCP().GetMaxConnections())
+
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr string
+	}{
+		{
+			name:    "address without port",
+			env:     map[string]string{"TCP_ADDRESS": "localhost"},
+			wantErr: "tcp.address: invalid address \"localhost\": address localhost: missing port in address",
+		},
+		{
+			name:    "negative idle timeout",
+			env:     map[string]string{"TCP_IDLE_TIMEOUT_SECONDS": "-1"},
+			wantErr: "tcp.idle_timeout_seconds: idle timeout cannot be negative",
+		},
+		{
+			name:    "negative max connections",
+			env:     map[string]string{"TCP_MAX_CONNECTIONS": "-1"},
+			wantErr: "tcp.max_connections: max connections cannot be negative",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv()
+			for k, v := range tt.env {
+				_ = os.Setenv(k, v)
+			}
+
+			cfg, err := LoadControlplane(path, nil)
+
+			assert.Nil(t, cfg)
+			assert.EqualError(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestRadSecConfig_LookupClient(t *testing.T) {
+	radsec := &RadSecConfig{clients: []RadSecClient{
+		{Name: "pop-1", Subject: "nas-1.example.net"},
+		{Name: "pop-2", Subject: "192.0.2.2"},
+	}}
+
+	tests := []struct {
+		name string
+		cert *x509.Certificate
+		want string
+	}{
+		{name: "common name", cert: &x509.Certificate{Subject: pkix.Name{CommonName: "NAS-1.example.net"}}, want: "pop-1"},
+		{name: "DNS name", cert: &x509.Certificate{DNSNames: []string{"other", "nas-1.example.net"}}, want: "pop-1"},
+		{name: "IP address", cert: &x509.Certificate{IPAddresses: []net.IP{net.IPv4(192, 0, 2, 2)}}, want: "pop-2"},
+		{name: "unmapped", cert: &x509.Certificate{Subject: pkix.Name{CommonName: "nas-3.example.net"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, ok := radsec.LookupClient(tt.cert)
+			assert.Equal(t, tt.want != "", ok)
+			assert.Equal(t, tt.want, client.Name)
+		})
+	}
+}
+
+func TestParseClientAddress(t *testing.T) {
+	tests := []struct {
+		address string
+		want    string
+		wantErr bool
+	}{
+		{address: "192.168.1.1", want: "192.168.1.1/32"},
+		{address: "192.168.0.0/16", want: "192.168.0.0/16"},
+		{address: "2001:db8::1", want: "2001:db8::1/128"},
+		{address: "2001:db8::/32", want: "2001:db8::/32"},
+		{address: "", wantErr: true},
+		{address: "10.0.0.0/99", wantErr: true},
+		{address: "nas.example.com", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.address, func(t *testing.T) {
+			network, err := ParseClientAddress(tt.address)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, network.String())
+		})
+	}
+}
@@ -0,0 +1,259 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// binding maps an environment variable or flag onto a file configuration key
+type binding struct {
+	name  string
+	usage string
+	apply func(fc *fileConfig, value string) error
+
+	// secretFile marks a NAME_FILE variable holding the path of the secret
+	// also settable as NAME; setting both is an error
+	secretFile bool
+}
+
+// envBindings lists every environment variable that can override a key
+var envBindings = []binding{
+	{name: "RADIUS_PORT", apply: intSetter(func(fc *fileConfig) *int { return &fc.Radius.Port })},
+	{name: "RADIUS_SHARED_SECRET", apply: stringSetter(func(fc *fileConfig) *string { return &fc.Radius.SharedSecret })},
+	{name: "RADIUS_SHARED_SECRET_FILE", secretFile: true, apply: secretFileSetter(func(fc *fileConfig) *string { return &fc.Radius.SharedSecret })},
+	{name: "REDIS_HOST", apply: stringSetter(func(fc *fileConfig) *string { return &fc.Redis.Host })},
+	{name: "REDIS_PORT", apply: intSetter(func(fc *fileConfig) *int { return &fc.Redis.Port })},
+	{name: "REDIS_USERNAME", apply: stringSetter(func(fc *fileConfig) *string { return &fc.Redis.Username })},
+	{name: "REDIS_PASSWORD", apply: stringSetter(func(fc *fileConfig) *string { return &fc.Redis.Password })},
+	{name: "REDIS_PASSWORD_FILE", secretFile: true, apply: secretFileSetter(func(fc *fileConfig) *string { return &fc.Redis.Password })},
+	{name: "REDIS_DB", apply: intSetter(func(fc *fileConfig) *int { return &fc.Redis.DB })},
+	{name: "REDIS_TLS", apply: boolSetter(func(fc *fileConfig) *bool { return &fc.Redis.TLS.Enabled })},
+	{name: "REDIS_TLS_CA_FILE", apply: stringSetter(func(fc *fileConfig) *string { return &fc.Redis.TLS.CAFile })},
+	{name: "REDIS_TLS_CERT_FILE", apply: stringSetter(func(fc *fileConfig) *string { return &fc.Redis.TLS.CertFile })},
+	{name: "REDIS_TLS_KEY_FILE", apply: stringSetter(func(fc *fileConfig) *string { return &fc.Redis.TLS.KeyFile })},
+	{name: "REDIS_TLS_SERVER_NAME", apply: stringSetter(func(fc *fileConfig) *string { return &fc.Redis.TLS.ServerName })},
+	{name: "REDIS_TLS_INSECURE_SKIP_VERIFY", apply: boolSetter(func(fc *fileConfig) *bool { return &fc.Redis.TLS.InsecureSkipVerify })},
+	{name: "REDIS_MODE", apply: stringSetter(func(fc *fileConfig) *string { return &fc.Redis.Mode })},
+	{name: "REDIS_SENTINEL_MASTER_NAME", apply: stringSetter(func(fc *fileConfig) *string { return &fc.Redis.Sentinel.MasterName })},
+	{name: "REDIS_SENTINEL_ADDRESSES", apply: listSetter(func(fc *fileConfig) *[]string { return &fc.Redis.Sentinel.Addresses })},
+	{name: "REDIS_SENTINEL_USERNAME", apply: stringSetter(func(fc *fileConfig) *string { return &fc.Redis.Sentinel.Username })},
+	{name: "REDIS_SENTINEL_PASSWORD", apply: stringSetter(func(fc *fileConfig) *string { return &fc.Redis.Sentinel.Password })},
+	{name: "REDIS_SENTINEL_PASSWORD_FILE", secretFile: true, apply: secretFileSetter(func(fc *fileConfig) *string { return &fc.Redis.Sentinel.Password })},
+	{name: "REDIS_CLUSTER_ADDRESSES", apply: listSetter(func(fc *fileConfig) *[]string { return &fc.Redis.Cluster.Addresses })},
+	{name: "RECORD_TTL_HOURS", apply: intSetter(func(fc *fileConfig) *int { return &fc.Redis.RecordTTLHours })},
+	{name: "STORAGE_BACKEND", apply: stringSetter(func(fc *fileConfig) *string { return &fc.Storage.Backend })},
+	{name: "SQLITE_PATH", apply: stringSetter(func(fc *fileConfig) *string { return &fc.Storage.SQLite.Path })},
+	{name: "SQLITE_RETENTION_DAYS", apply: intSetter(func(fc *fileConfig) *int { return &fc.Storage.SQLite.RetentionDays })},
+	{name: "SQLITE_PRUNE_INTERVAL_MINUTES", apply: intSetter(func(fc *fileConfig) *int { return &fc.Storage.SQLite.PruneIntervalMinutes })},
+	{name: "POSTGRES_DSN", apply: stringSetter(func(fc *fileConfig) *string { return &fc.Storage.Postgres.DSN })},
+	{name: "POSTGRES_DSN_FILE", secretFile: true, apply: secretFileSetter(func(fc *fileConfig) *string { return &fc.Storage.Postgres.DSN })},
+	{name: "POSTGRES_BATCH_SIZE", apply: intSetter(func(fc *fileConfig) *int { return &fc.Storage.Postgres.BatchSize })},
+	{name: "POSTGRES_PARTITION_INTERVAL", apply: stringSetter(func(fc *fileConfig) *string { return &fc.Storage.Postgres.PartitionInterval })},
+	{name: "MEMORY_TTL_SECONDS", apply: intSetter(func(fc *fileConfig) *int { return &fc.Storage.Memory.TTLSeconds })},
+	{name: "MEMORY_MAX_RECORDS", apply: intSetter(func(fc *fileConfig) *int { return &fc.Storage.Memory.MaxRecords })},
+	{name: "DETAIL_DIRECTORY", apply: stringSetter(func(fc *fileConfig) *string { return &fc.Storage.Detail.Directory })},
+	{name: "STORAGE_MULTI_BACKENDS", apply: storageTargetsSetter(func(fc *fileConfig) *[]storageTargetSection { return &fc.Storage.Multi.Backends })},
+	{name: "STORAGE_MULTI_QUORUM", apply: intSetter(func(fc *fileConfig) *int { return &fc.Storage.Multi.Quorum })},
+	{name: "NOTIFIER_KEY_EVENTS", apply: listSetter(func(fc *fileConfig) *[]string { return &fc.Notifier.KeyEvents })},
+	{name: "NOTIFIER_CONFIGURE_EVENTS", apply: boolSetter(func(fc *fileConfig) *bool { return &fc.Notifier.ConfigureEvents })},
+	{name: "NOTIFIER_CHECK_INTERVAL_SECONDS", apply: intSetter(func(fc *fileConfig) *int { return &fc.Notifier.CheckIntervalSeconds })},
+	{name: "LOG_LEVEL", apply: stringSetter(func(fc *fileConfig) *string { return &fc.Logging.Level })},
+	{name: "LOG_FILE", apply: stringSetter(func(fc *fileConfig) *string { return &fc.Logging.File })},
+	{name: "API_ADDRESS", apply: stringSetter(func(fc *fileConfig) *string { return &fc.API.Address })},
+	{name: "API_TOKEN", apply: stringSetter(func(fc *fileConfig) *string { return &fc.API.Token })},
+	{name: "API_TOKEN_FILE", secretFile: true, apply: secretFileSetter(func(fc *fileConfig) *string { return &fc.API.Token })},
+	{name: "CAPTURE_ENABLED", apply: boolSetter(func(fc *fileConfig) *bool { return &fc.Capture.Enabled })},
+	{name: "CAPTURE_DIRECTORY", apply: stringSetter(func(fc *fileConfig) *string { return &fc.Capture.Directory })},
+	{name: "CAPTURE_FORMAT", apply: stringSetter(func(fc *fileConfig) *string { return &fc.Capture.Format })},
+	{name: "CAPTURE_MAX_FILE_SIZE_MB", apply: intSetter(func(fc *fileConfig) *int { return &fc.Capture.MaxFileSizeMB })},
+	{name: "CAPTURE_MAX_FILES", apply: intSetter(func(fc *fileConfig) *int { return &fc.Capture.MaxFiles })},
+	{name: "CAPTURE_CLIENTS", apply: listSetter(func(fc *fileConfig) *[]string { return &fc.Capture.Clients })},
+	{name: "RADSEC_ADDRESS", apply: stringSetter(func(fc *fileConfig) *string { return &fc.RadSec.Address })},
+	{name: "RADSEC_CERT_FILE", apply: stringSetter(func(fc *fileConfig) *string { return &fc.RadSec.CertFile })},
+	{name: "RADSEC_KEY_FILE", apply: stringSetter(func(fc *fileConfig) *string { return &fc.RadSec.KeyFile })},
+	{name: "RADSEC_CA_FILE", apply: stringSetter(func(fc *fileConfig) *string { return &fc.RadSec.CAFile })},
+	{name: "RADSEC_SECRET", apply: stringSetter(func(fc *fileConfig) *string { return &fc.RadSec.Secret })},
+	{name: "RADSEC_SECRET_FILE", secretFile: true, apply: secretFileSetter(func(fc *fileConfig) *string { return &fc.RadSec.Secret })},
+	{name: "TCP_ADDRESS", apply: stringSetter(func(fc *fileConfig) *string { return &fc.TCP.Address })},
+	{name: "TCP_IDLE_TIMEOUT_SECONDS", apply: intSetter(func(fc *fileConfig) *int { return &fc.TCP.IdleTimeoutSeconds })},
+	{name: "TCP_MAX_CONNECTIONS", apply: intSetter(func(fc *fileConfig) *int { return &fc.TCP.MaxConnections })},
+}
+
+// Command-line flags, registered per component
+var (
+	radiusPortFlag = binding{name: "radius-port", usage: "RADIUS accounting port", apply: intSetter(func(fc *fileConfig) *int { return &fc.Radius.Port })}
+	redisHostFlag  = binding{name: "redis-host", usage: "Redis host", apply: stringSetter(func(fc *fileConfig) *string { return &fc.Redis.Host })}
+	redisPortFlag  = binding{name: "redis-port", usage: "Redis port", apply: intSetter(func(fc *fileConfig) *int { return &fc.Redis.Port })}
+	logLevelFlag   = binding{name: "log-level", usage: "log level (debug, info, warn, error)", apply: stringSetter(func(fc *fileConfig) *string { return &fc.Logging.Level })}
+	logFileFlag    = binding{name: "log-file", usage: "log file path", apply: stringSetter(func(fc *fileConfig) *string { return &fc.Logging.File })}
+)
+
+func stringSetter(field func(*fileConfig) *string) func(*fileConfig, string) error {
+	return func(fc *fileConfig, value string) error {
+		*field(fc) = value
+		return nil
+	}
+}
+
+func intSetter(field func(*fileConfig) *int) func(*fileConfig, string) error {
+	return func(fc *fileConfig, value string) error {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid int value %q", value)
+		}
+		*field(fc) = n
+		return nil
+	}
+}
+
+func boolSetter(field func(*fileConfig) *bool) func(*fileConfig, string) error {
+	return func(fc *fileConfig, value string) error {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid bool value %q", value)
+		}
+		*field(fc) = b
+		return nil
+	}
+}
+
+// listSetter splits a comma-separated value, ignoring blanks around items
+func listSetter(field func(*fileConfig) *[]string) func(*fileConfig, string) error {
+	return func(fc *fileConfig, value string) error {
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		*field(fc) = items
+		return nil
+	}
+}
+
+// storageTargetsSetter parses a comma-separated list of backend[:policy] items
+func storageTargetsSetter(field func(*fileConfig) *[]storageTargetSection) func(*fileConfig, string) error {
+	return func(fc *fileConfig, value string) error {
+		var targets []storageTargetSection
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
+			backend, policy, _ := strings.Cut(item, ":")
+			targets = append(targets, storageTargetSection{Backend: backend, Policy: policy})
+		}
+		*field(fc) = targets
+		return nil
+	}
+}
+
+// secretFileSetter reads the secret from the file named by the value
+func secretFileSetter(field func(*fileConfig) *string) func(*fileConfig, string) error {
+	return func(fc *fileConfig, value string) error {
+		secret, err := readSecretFile(value)
+		if err != nil {
+			return err
+		}
+		*field(fc) = secret
+		return nil
+	}
+}
+
+// Flags holds command-line overrides, the highest-precedence configuration source
+type Flags struct {
+	fs         *flag.FlagSet
+	configFile string
+	bindings   map[string]binding
+}
+
+// RegisterControlplaneFlags defines the radius-controlplane flags on fs
+func RegisterControlplaneFlags(fs *flag.FlagSet) *Flags {
+	return registerFlags(fs, radiusPortFlag, redisHostFlag, redisPortFlag, logLevelFlag)
+}
+
+// RegisterLoggerFlags defines the radius-controlplane-logger flags on fs
+func RegisterLoggerFlags(fs *flag.FlagSet) *Flags {
+	return registerFlags(fs, redisHostFlag, redisPortFlag, logLevelFlag, logFileFlag)
+}
+
+// RegisterRadacctFlags defines the radacct flags on fs
+func RegisterRadacctFlags(fs *flag.FlagSet) *Flags {
+	return registerFlags(fs, redisHostFlag, redisPortFlag)
+}
+
+// registerFlags defines -config plus the given override flags on fs.
+// Only flags explicitly set on the command line override other sources.
+func registerFlags(fs *flag.FlagSet, bindings ...binding) *Flags {
+	f := &Flags{fs: fs, bindings: make(map[string]binding)}
+	fs.StringVar(&f.configFile, "config", os.Getenv("CONFIG_FILE"), "path to YAML configuration file")
+	for _, b := range bindings {
+		fs.String(b.name, "", b.usage)
+		f.bindings[b.name] = b
+	}
+	return f
+}
+
+// ConfigFile returns the configuration file path given by -config or CONFIG_FILE
+func (f *Flags) ConfigFile() string {
+	return f.configFile
+}
+
+// apply overlays the flags that were set on the command line onto fc
+func (f *Flags) apply(fc *fileConfig) error {
+	var err error
+	f.fs.Visit(func(fl *flag.Flag) {
+		b, ok := f.bindings[fl.Name]
+		if !ok || err != nil {
+			return
+		}
+		if applyErr := b.apply(fc, fl.Value.String()); applyErr != nil {
+			err = fmt.Errorf("invalid -%s: %w", fl.Name, applyErr)
+		}
+	})
+	return err
+}
+
+// load layers the configuration sources in precedence order:
+// defaults < YAML file (when path is non-empty) < environment < flags
+func load(path string, flags *Flags) (*fileConfig, error) {
+	fc := defaultFileConfig()
+
+	if path != "" {
+		if err := fc.decodeFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := fc.applyEnv(); err != nil {
+		return nil, err
+	}
+
+	if flags != nil {
+		if err := flags.apply(fc); err != nil {
+			return nil, err
+		}
+	}
+
+	return fc, nil
+}
+
+// applyEnv overlays every environment variable that is set onto fc.
+// Malformed values are reported as *FieldError naming the variable.
+func (fc *fileConfig) applyEnv() error {
+	for _, b := range envBindings {
+		value, ok := os.LookupEnv(b.name)
+		if !ok || value == "" {
+			continue
+		}
+		if plain := strings.TrimSuffix(b.name, "_FILE"); b.secretFile && os.Getenv(plain) != "" {
+			return fmt.Errorf("%s and %s cannot both be set", plain, b.name)
+		}
+		if err := b.apply(fc, value); err != nil {
+			return &FieldError{Key: b.name, Err: err}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,210 @@
+package config
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoad_Precedence(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	path := writeConfigFile(t, `
+radius:
+  shared_secret: filesecret123
+redis:
+  host: file-redis
+  port: 6380
+  record_ttl_hours: 12
+logging:
+  level: warn
+  file: /var/log/file.log
+`)
+
+	// Environment overrides the file
+	_ = os.Setenv("REDIS_HOST", "env-redis")
+	_ = os.Setenv("LOG_LEVEL", "error")
+
+	// Flags override the environment
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags := RegisterControlplaneFlags(fs)
+	require.NoError(t, fs.Parse([]string{"-log-level", "debug"}))
+
+	cfg, err := LoadControlplane(path, flags)
+
+	require.NoError(t, err)
+	assert.Equal(t, "filesecret123", cfg.GetSharedSecret()) // file
+	assert.Equal(t, "env-redis:6380", cfg.GetRedisAddr())   // env host, file port
+	assert.Equal(t, 12*time.Hour, cfg.GetRecordTTL())       // file
+	assert.Equal(t, LogLevelDebug, cfg.GetLogLevel())       // flag
+	assert.Equal(t, ":1813", cfg.GetRADIUSAddr())           // default
+
+	fs = flag.NewFlagSet("test", flag.ContinueOnError)
+	loggerFlags := RegisterLoggerFlags(fs)
+	require.NoError(t, fs.Parse([]string{"-log-file", "/var/log/flag.log"}))
+
+	loggerCfg, err := LoadLogger(path, loggerFlags)
+
+	require.NoError(t, err)
+	assert.Equal(t, LogLevelError, loggerCfg.GetLogLevel())      // env
+	assert.Equal(t, "/var/log/flag.log", loggerCfg.GetLogFile()) // flag
+}
+
+func TestLoad_EnvOnly(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	_ = os.Setenv("RADIUS_SHARED_SECRET", "secretkey123")
+	_ = os.Setenv("REDIS_HOST", "localhost")
+
+	cfg, err := LoadControlplane("", nil)
+
+	require.NoError(t, err)
+	assert.Equal(t, "localhost:6379", cfg.GetRedisAddr())
+	assert.Equal(t, 24*time.Hour, cfg.GetRecordTTL())
+	assert.Equal(t, LogLevelInfo, cfg.GetLogLevel())
+}
+
+func TestLoad_UnsetFlagsDoNotOverride(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	_ = os.Setenv("RADIUS_SHARED_SECRET", "secretkey123")
+	_ = os.Setenv("REDIS_HOST", "env-redis")
+	_ = os.Setenv("LOG_FILE", "/var/log/test.log")
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags := RegisterControlplaneFlags(fs)
+	require.NoError(t, fs.Parse([]string{"-redis-port", "7000"}))
+
+	cfg, err := LoadControlplane("", flags)
+
+	require.NoError(t, err)
+	assert.Equal(t, "env-redis:7000", cfg.GetRedisAddr())
+}
+
+func TestLoad_InvalidFlag(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags := RegisterLoggerFlags(fs)
+	require.NoError(t, fs.Parse([]string{"-redis-port", "seven"}))
+
+	cfg, err := LoadLogger("", flags)
+
+	assert.Error(t, err)
+	assert.Nil(t, cfg)
+	assert.Contains(t, err.Error(), "invalid -redis-port")
+}
+
+func TestRegisterFlags_PerComponent(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	RegisterControlplaneFlags(fs)
+	assert.NotNil(t, fs.Lookup("radius-port"))
+	assert.Nil(t, fs.Lookup("log-file"))
+
+	fs = flag.NewFlagSet("test", flag.ContinueOnError)
+	RegisterLoggerFlags(fs)
+	assert.NotNil(t, fs.Lookup("log-file"))
+	assert.Nil(t, fs.Lookup("radius-port"))
+}
+
+func TestLoad_InvalidEnv(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	_ = os.Setenv("RECORD_TTL_HOURS", "soon")
+
+	cfg, err := LoadControlplane("", nil)
+
+	assert.Nil(t, cfg)
+	var fieldErr *FieldError
+	require.ErrorAs(t, err, &fieldErr)
+	assert.Equal(t, "RECORD_TTL_HOURS", fieldErr.Key)
+	assert.EqualError(t, err, `RECORD_TTL_HOURS: invalid int value "soon"`)
+}
+
+func TestLoad_SecretFileEnv(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	dir := t.TempDir()
+	secretFile := filepath.Join(dir, "radius_secret")
+	passwordFile := filepath.Join(dir, "redis_password")
+	require.NoError(t, os.WriteFile(secretFile, []byte("secretfromfile\n"), 0600))
+	require.NoError(t, os.WriteFile(passwordFile, []byte("passwordfromfile\n"), 0600))
+
+	_ = os.Setenv("RADIUS_SHARED_SECRET_FILE", secretFile)
+	_ = os.Setenv("REDIS_HOST", "localhost")
+	_ = os.Setenv("REDIS_PASSWORD_FILE", passwordFile)
+	_ = os.Setenv("REDIS_DB", "4")
+
+	cfg, err := LoadControlplane("", nil)
+
+	require.NoError(t, err)
+	assert.Equal(t, "secretfromfile", cfg.GetSharedSecret())
+	assert.Equal(t, "passwordfromfile", cfg.GetRedis().GetPassword())
+	assert.Equal(t, 4, cfg.GetRedis().GetDB())
+
+	// Setting both the value and the file is ambiguous
+	_ = os.Setenv("RADIUS_SHARED_SECRET", "inlinesecret")
+
+	cfg, err = LoadControlplane("", nil)
+
+	assert.Nil(t, cfg)
+	assert.EqualError(t, err, "RADIUS_SHARED_SECRET and RADIUS_SHARED_SECRET_FILE cannot both be set")
+}
+
+func TestLoad_FileEnvWithoutSecret(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	// Only *_FILE variables holding secrets conflict with their plain name
+	_ = os.Setenv("LOG", "1")
+	_ = os.Setenv("LOG_FILE", "/var/log/radius.log")
+	_ = os.Setenv("REDIS_TLS_CA", "unrelated")
+	_ = os.Setenv("REDIS_TLS_CA_FILE", "/etc/redis/ca.pem")
+
+	fc, err := load("", nil)
+
+	require.NoError(t, err)
+	assert.Equal(t, "/var/log/radius.log", fc.Logging.File)
+	assert.Equal(t, "/etc/redis/ca.pem", fc.Redis.TLS.CAFile)
+}
+
+func TestLoad_ValidationErrorHasKeyPath(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	_ = os.Setenv("RADIUS_SHARED_SECRET", "secretkey123")
+
+	cfg, err := LoadControlplane("", nil)
+
+	assert.Error(t, err)
+	assert.Nil(t, cfg)
+	assert.Equal(t, "redis.host: redis host cannot be empty", err.Error())
+}
+
+func TestFlags_ConfigFile(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	_ = os.Setenv("CONFIG_FILE", "/etc/radius/from-env.yaml")
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags := RegisterControlplaneFlags(fs)
+	require.NoError(t, fs.Parse(nil))
+	assert.Equal(t, "/etc/radius/from-env.yaml", flags.ConfigFile())
+
+	fs = flag.NewFlagSet("test", flag.ContinueOnError)
+	flags = RegisterLoggerFlags(fs)
+	require.NoError(t, fs.Parse([]string{"-config", "/etc/radius/from-flag.yaml"}))
+	assert.Equal(t, "/etc/radius/from-flag.yaml", flags.ConfigFile())
+}
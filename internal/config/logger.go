@@ -0,0 +1,110 @@
+package config
+
+import "fmt"
+
+// LoggerConfig holds the settings used by radius-controlplane-logger.
+// It deliberately has no RADIUS settings so the logger never needs secrets.
+type LoggerConfig struct {
+	// Notification source configuration
+	redis    RedisConfig
+	notifier NotifierConfig
+
+	// Logging configuration
+	logLevel LogLevel
+	logFile  string
+}
+
+// LoadLogger loads the radius-controlplane-logger configuration from every
+// source in precedence order: defaults < YAML file (when path is non-empty)
+// < environment < flags. flags may be nil. The result is validated.
+func LoadLogger(path string, flags *Flags) (*LoggerConfig, error) {
+	fc, err := load(path, flags)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &LoggerConfig{
+		redis:    fc.redisConfig(),
+		notifier: fc.notifierConfig(),
+		logLevel: LogLevel(fc.Logging.Level),
+		logFile:  fc.Logging.File,
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// Validate checks if the configuration is valid
+// Errors are *FieldError values naming the offending key path
+func (c *LoggerConfig) Validate() error {
+
+	if err := c.redis.validate(); err != nil {
+		return err
+	}
+
+	if err := c.notifier.validate(); err != nil {
+		return err
+	}
+
+	if err := validateLogLevel(c.logLevel); err != nil {
+		return err
+	}
+
+	if c.logFile == "" {
+		return &FieldError{Key: "logging.file", Err: fmt.Errorf("log file path cannot be empty")}
+	}
+
+	return nil
+}
+
+// Diff lists the keys that differ between c and next
+func (c *LoggerConfig) Diff(next *LoggerConfig) []Change {
+	var changes changeList
+	changes = append(changes, c.redis.diff(&next.redis)...)
+	changes = append(changes, c.notifier.diff(&next.notifier)...)
+	changes.add("logging.level", string(c.logLevel), string(next.logLevel), true)
+	changes.add("logging.file", c.logFile, next.logFile, true)
+	return changes
+}
+
+// withReloadable returns a copy of c with the reloadable settings taken from
+// next; settings that need a restart keep their current values
+func (c *LoggerConfig) withReloadable(next *LoggerConfig) *LoggerConfig {
+	merged := *c
+	merged.logLevel = next.logLevel
+	merged.logFile = next.logFile
+	return &merged
+}
+
+// GetRedis returns the Redis connection settings
+func (c *LoggerConfig) GetRedis() *RedisConfig {
+	return &c.redis
+}
+
+// GetNotifier returns the keyspace notification settings
+func (c *LoggerConfig) GetNotifier() *NotifierConfig {
+	return &c.notifier
+}
+
+// GetRedisAddr returns the Redis address in host:port format
+func (c *LoggerConfig) GetRedisAddr() string {
+	return c.redis.GetAddr()
+}
+
+// GetLogLevel returns the configured log level
+func (c *LoggerConfig) GetLogLevel() LogLevel {
+	return c.logLevel
+}
+
+// GetLogFile returns the log file path
+func (c *LoggerConfig) GetLogFile() string {
+	return c.logFile
+}
+
+// IsDebugEnabled returns true if debug logging is enabled
+func (c *LoggerConfig) IsDebugEnabled() bool {
+	return c.logLevel == LogLevelDebug
+}
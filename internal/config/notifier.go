@@ -0,0 +1,63 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// NotifierConfig holds the settings for consuming Redis keyspace
+// notifications: the subscribed events and how notify-keyspace-events is
+// checked
+type NotifierConfig struct {
+	keyEvents       []string
+	configureEvents bool
+	checkInterval   time.Duration
+}
+
+// GetKeyEvents returns the operations to subscribe to on __keyevent@N__
+// channels. Empty means all operations are received on __keyspace@N__ channels.
+func (n *NotifierConfig) GetKeyEvents() []string {
+	return n.keyEvents
+}
+
+// ConfigureEvents returns true if missing notify-keyspace-events flags
+// should be enabled with CONFIG SET instead of being reported as an error
+func (n *NotifierConfig) ConfigureEvents() bool {
+	return n.configureEvents
+}
+
+// GetCheckInterval returns how often notify-keyspace-events is re-checked,
+// zero when only checked at startup
+func (n *NotifierConfig) GetCheckInterval() time.Duration {
+	return n.checkInterval
+}
+
+// validate checks that every key event is a bare operation name
+func (n *NotifierConfig) validate() error {
+	for i, event := range n.keyEvents {
+		key := fmt.Sprintf("notifier.key_events[%d]", i)
+		if event == "" {
+			return &FieldError{Key: key, Err: fmt.Errorf("event name cannot be empty")}
+		}
+		if strings.ContainsAny(event, " \t:*?[]") {
+			return &FieldError{Key: key, Err: fmt.Errorf("invalid event name %q", event)}
+		}
+	}
+
+	if n.checkInterval < 0 {
+		return &FieldError{Key: "notifier.check_interval_seconds", Err: fmt.Errorf("check interval cannot be negative")}
+	}
+
+	return nil
+}
+
+// diff lists the notifier settings that differ; subscriptions are made once
+// at startup so none of them are reloadable
+func (n *NotifierConfig) diff(next *NotifierConfig) []Change {
+	var changes changeList
+	changes.add("notifier.key_events", strings.Join(n.keyEvents, ","), strings.Join(next.keyEvents, ","), false)
+	changes.add("notifier.configure_events", fmt.Sprint(n.configureEvents), fmt.Sprint(next.configureEvents), false)
+	changes.add("notifier.check_interval_seconds", fmt.Sprint(n.checkInterval.Seconds()), fmt.Sprint(next.checkInterval.Seconds()), false)
+	return changes
+}
@@ -0,0 +1,152 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// DefaultRadSecSecret is the shared secret RFC 6614 fixes for RADIUS over
+// TLS, where the TLS session authenticates the NAS
+const DefaultRadSecSecret = "radsec"
+
+// RadSecClient maps a client certificate to a NAS identity
+type RadSecClient struct {
+	Name       string     // NAS identity logged for the connection
+	Subject    string     // Certificate common name or DNS/IP subject alternative name
+	NASNetwork *net.IPNet // NAS-IP-Address values accepted from the NAS, nil for any
+}
+
+// RadSecConfig holds the settings of the RADIUS over TLS (RFC 6614) listener
+// of radius-controlplane: its address, server certificate, the CA verifying
+// NAS certificates and the mapping of certificates to NAS
+type RadSecConfig struct {
+	address  string // host:port to listen on, empty when RadSec is disabled
+	certFile string
+	keyFile  string
+	caFile   string // CA bundle verifying the NAS certificates
+	secret   string
+	clients  []RadSecClient
+}
+
+// Enabled returns true if the RadSec listener should be started
+func (r *RadSecConfig) Enabled() bool {
+	return r.address != ""
+}
+
+// GetAddress returns the address the RadSec listener binds to
+func (r *RadSecConfig) GetAddress() string {
+	return r.address
+}
+
+// GetSecret returns the shared secret of the RADIUS packets inside TLS
+func (r *RadSecConfig) GetSecret() string {
+	return r.secret
+}
+
+// GetClients returns a copy of the certificate to NAS mapping; when empty,
+// every certificate signed by the CA is accepted and named by its common
+// name
+func (r *RadSecConfig) GetClients() []RadSecClient {
+	clients := make([]RadSecClient, len(r.clients))
+	copy(clients, r.clients)
+	return clients
+}
+
+// ServerConfig builds the *tls.Config of the listener, which requires every
+// NAS to present a certificate signed by the CA
+func (r *RadSecConfig) ServerConfig() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load certificate: %w", err)
+	}
+	pool, err := loadCertPool(r.caFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+	}, nil
+}
+
+// LookupClient returns the client whose subject matches the common name or
+// a subject alternative name of cert
+func (r *RadSecConfig) LookupClient(cert *x509.Certificate) (RadSecClient, bool) {
+	names := append([]string{cert.Subject.CommonName}, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		names = append(names, ip.String())
+	}
+
+	for _, client := range r.clients {
+		for _, name := range names {
+			if name != "" && strings.EqualFold(name, client.Subject) {
+				return client, true
+			}
+		}
+	}
+	return RadSecClient{}, false
+}
+
+// validate checks the RadSec settings when the listener is enabled
+func (r *RadSecConfig) validate() error {
+	if !r.Enabled() {
+		return nil
+	}
+
+	if err := validateListenAddress("radsec.address", r.address); err != nil {
+		return err
+	}
+
+	if r.certFile == "" || r.keyFile == "" {
+		return &FieldError{Key: "radsec.cert_file", Err: fmt.Errorf("cert_file and key_file are required")}
+	}
+	if r.caFile == "" {
+		return &FieldError{Key: "radsec.ca_file", Err: fmt.Errorf("CA file is required to verify NAS certificates")}
+	}
+	if r.secret == "" {
+		return &FieldError{Key: "radsec.secret", Err: fmt.Errorf("secret cannot be empty")}
+	}
+
+	for i, client := range r.clients {
+		if client.Subject == "" {
+			return &FieldError{Key: fmt.Sprintf("radsec.clients[%d].subject", i), Err: fmt.Errorf("subject cannot be empty")}
+		}
+	}
+
+	if _, err := r.ServerConfig(); err != nil {
+		return &FieldError{Key: "radsec", Err: err}
+	}
+
+	return nil
+}
+
+// diff lists the RadSec settings that differ; the secret and the client
+// mapping apply without a restart, the mapping to new connections
+func (r *RadSecConfig) diff(next *RadSecConfig) []Change {
+	var changes changeList
+	changes.add("radsec.address", r.address, next.address, false)
+	changes.add("radsec.cert_file", r.certFile, next.certFile, false)
+	changes.add("radsec.key_file", r.keyFile, next.keyFile, false)
+	changes.add("radsec.ca_file", r.caFile, next.caFile, false)
+	changes.addSecret("radsec.secret", r.secret, next.secret)
+	changes.add("radsec.clients", describeRadSecClients(r.clients), describeRadSecClients(next.clients), true)
+	return changes
+}
+
+// describeRadSecClients lists the certificate mapping for change reports
+func describeRadSecClients(clients []RadSecClient) string {
+	parts := make([]string, len(clients))
+	for i, client := range clients {
+		parts[i] = fmt.Sprintf("%s=%s", client.Name, client.Subject)
+		if client.NASNetwork != nil {
+			parts[i] += "@" + client.NASNetwork.String()
+		}
+	}
+	return "[" + strings.Join(parts, " ") + "]"
+}
@@ -0,0 +1,154 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Change describes a single configuration key that differs between two configs
+type Change struct {
+	Key        string
+	Old        string
+	New        string
+	Reloadable bool // false when the change only takes effect after a restart
+}
+
+func (c Change) String() string {
+	s := fmt.Sprintf("%s: %s -> %s", c.Key, c.Old, c.New)
+	if !c.Reloadable {
+		s += " (requires restart, ignored)"
+	}
+	return s
+}
+
+// changeList accumulates the changes found while diffing two configs
+type changeList []Change
+
+func (l *changeList) add(key, oldValue, newValue string, reloadable bool) {
+	if oldValue != newValue {
+		*l = append(*l, Change{Key: key, Old: oldValue, New: newValue, Reloadable: reloadable})
+	}
+}
+
+// addSecret records that a secret changed without revealing either value
+func (l *changeList) addSecret(key, oldValue, newValue string) {
+	if oldValue != newValue {
+		*l = append(*l, Change{Key: key, Old: "<redacted>", New: "<redacted>", Reloadable: true})
+	}
+}
+
+func describeClients(clients []Client) string {
+	parts := make([]string, len(clients))
+	for i, client := range clients {
+		parts[i] = fmt.Sprintf("%s=%s", client.Name, client.Network)
+	}
+	return "[" + strings.Join(parts, " ") + "]"
+}
+
+func clientSecrets(clients []Client) string {
+	parts := make([]string, len(clients))
+	for i, client := range clients {
+		parts[i] = client.Secret
+	}
+	return strings.Join(parts, "\x00")
+}
+
+// reloadable is implemented by the component configurations
+type reloadable[T any] interface {
+	Validate() error
+	Diff(next T) []Change
+	withReloadable(next T) T
+}
+
+// Reloader holds the active configuration and swaps it atomically when the
+// configuration sources are re-read (typically on SIGHUP)
+type Reloader[T reloadable[T]] struct {
+	load func() (T, error)
+
+	mu      sync.RWMutex // Protects current
+	current T
+
+	reloadMu sync.Mutex // Serialises reloads and protects hooks
+	hooks    []func(old, new T)
+}
+
+// NewReloader creates a reloader starting from initial; load re-reads all sources
+func NewReloader[T reloadable[T]](initial T, load func() (T, error)) *Reloader[T] {
+	return &Reloader[T]{load: load, current: initial}
+}
+
+// Current returns the active configuration
+func (r *Reloader[T]) Current() T {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.current
+}
+
+// OnReload registers fn to be called after a successful reload
+func (r *Reloader[T]) OnReload(fn func(old, new T)) {
+	r.reloadMu.Lock()
+	defer r.reloadMu.Unlock()
+	r.hooks = append(r.hooks, fn)
+}
+
+// Reload re-reads and validates the configuration. Invalid configurations are
+// refused and the active one is kept. On success the reloadable settings are
+// swapped in, registered hooks are run and the list of changes is returned.
+func (r *Reloader[T]) Reload() ([]Change, error) {
+	r.reloadMu.Lock()
+	defer r.reloadMu.Unlock()
+
+	next, err := r.load()
+	if err != nil {
+		return nil, fmt.Errorf("reload refused: %w", err)
+	}
+
+	if err := next.Validate(); err != nil {
+		return nil, fmt.Errorf("reload refused: %w", err)
+	}
+
+	old := r.Current()
+	changes := old.Diff(next)
+	if len(changes) == 0 {
+		return nil, nil
+	}
+
+	merged := old.withReloadable(next)
+	r.mu.Lock()
+	r.current = merged
+	r.mu.Unlock()
+
+	for _, hook := range r.hooks {
+		hook(old, merged)
+	}
+
+	return changes, nil
+}
+
+// Watch reloads the configuration every time a signal (typically SIGHUP) is
+// received on signals, logging the outcome, until ctx is done
+func (r *Reloader[T]) Watch(ctx context.Context, signals <-chan os.Signal) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-signals:
+			log.Println("Received SIGHUP, reloading configuration...")
+			changes, err := r.Reload()
+			if err != nil {
+				log.Printf("Configuration reload failed, keeping current configuration: %v", err)
+				continue
+			}
+			if len(changes) == 0 {
+				log.Println("Configuration unchanged")
+			}
+			for _, change := range changes {
+				log.Printf("Configuration changed: %s", change)
+			}
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Helper function to build a valid config for reload tests
+func newReloadTestConfig() *ControlplaneConfig {
+	return &ControlplaneConfig{
+		radiusPort:   1813,
+		sharedSecret: "verysecret123",
+		redis:        RedisConfig{host: "localhost", port: 6379},
+		recordTTL:    24 * time.Hour,
+		logLevel:     LogLevelInfo,
+	}
+}
+
+func TestDiff(t *testing.T) {
+	old := newReloadTestConfig()
+	next := newReloadTestConfig()
+	next.sharedSecret = "othersecret123"
+	next.recordTTL = 48 * time.Hour
+	next.logLevel = LogLevelDebug
+	next.redis.host = "redis.internal"
+
+	changes := old.Diff(next)
+
+	require.Len(t, changes, 4)
+	assert.Equal(t, Change{Key: "radius.shared_secret", Old: "<redacted>", New: "<redacted>", Reloadable: true}, changes[0])
+	assert.Equal(t, Change{Key: "redis.host", Old: "localhost", New: "redis.internal", Reloadable: false}, changes[1])
+	assert.Equal(t, "redis.record_ttl_hours: 24h0m0s -> 48h0m0s", changes[2].String())
+	assert.Equal(t, "logging.level: info -> debug", changes[3].String())
+	assert.Equal(t, "redis.host: localhost -> redis.internal (requires restart, ignored)", changes[1].String())
+
+	for _, change := range changes {
+		assert.NotContains(t, change.String(), "secret123")
+	}
+}
+
+func TestDiff_API(t *testing.T) {
+	old := newReloadTestConfig()
+	old.api = APIConfig{address: ":8080", token: "0123456789abcdef"}
+	next := newReloadTestConfig()
+	next.api = APIConfig{address: ":9090", token: "fedcba9876543210"}
+
+	changes := old.Diff(next)
+
+	require.Len(t, changes, 2)
+	assert.Equal(t, "api.address: :8080 -> :9090 (requires restart, ignored)", changes[0].String())
+	assert.Equal(t, Change{Key: "api.token", Old: "<redacted>", New: "<redacted>", Reloadable: true}, changes[1])
+
+	reloaded := old.withReloadable(next)
+	assert.Equal(t, ":8080", reloaded.GetAPI().GetAddress())
+	assert.Equal(t, "fedcba9876543210", reloaded.GetAPI().GetToken())
+}
+
+func TestDiff_Capture(t *testing.T) {
+	_, network, err := net.ParseCIDR("10.0.0.0/8")
+	require.NoError(t, err)
+
+	old := newReloadTestConfig()
+	old.capture = CaptureConfig{directory: "/tmp/capture", format: CaptureFormatPcapng}
+	next := newReloadTestConfig()
+	next.capture = CaptureConfig{enabled: true, directory: "/srv/capture", format: CaptureFormatPcapng, clients: []*net.IPNet{network}}
+
+	changes := old.Diff(next)
+
+	require.Len(t, changes, 3)
+	assert.Equal(t, "capture.enabled: false -> true", changes[0].String())
+	assert.Equal(t, "capture.directory: /tmp/capture -> /srv/capture (requires restart, ignored)", changes[1].String())
+	assert.Equal(t, "capture.clients:  -> 10.0.0.0/8", changes[2].String())
+
+	reloaded := old.withReloadable(next)
+	assert.True(t, reloaded.GetCapture().Enabled())
+	assert.Equal(t, "/tmp/capture", reloaded.GetCapture().GetDirectory())
+	assert.Len(t, reloaded.GetCapture().GetClients(), 1)
+}
+
+func TestDiff_RadSec(t *testing.T) {
+	old := newReloadTestConfig()
+	old.radsec = RadSecConfig{address: ":2083", certFile: "/etc/radsec/cert.pem", secret: DefaultRadSecSecret}
+	next := newReloadTestConfig()
+	next.radsec = RadSecConfig{address: ":2083", certFile: "/etc/radsec/new.pem", secret: "othersecret",
+		clients: []RadSecClient{{Name: "pop-1", Subject: "nas-1.example.net"}}}
+
+	changes := old.Diff(next)
+
+	require.Len(t, changes, 3)
+	assert.Equal(t, "radsec.cert_file: /etc/radsec/cert.pem -> /etc/radsec/new.pem (requires restart, ignored)", changes[0].String())
+	assert.Equal(t, Change{Key: "radsec.secret", Old: "<redacted>", New: "<redacted>", Reloadable: true}, changes[1])
+	assert.Equal(t, "radsec.clients: [] -> [pop-1=nas-1.example.net]", changes[2].String())
+
+	reloaded := old.withReloadable(next)
+	assert.Equal(t, "othersecret", reloaded.GetRadSec().GetSecret())
+	assert.Len(t, reloaded.GetRadSec().GetClients(), 1)
+}
+
+func TestDiff_TCP(t *testing.T) {
+	old := newReloadTestConfig()
+	old.tcp = TCPConfig{address: ":1813", idleTimeout: 5 * time.Minute, maxConnections: 1000}
+	next := newReloadTestConfig()
+	next.tcp = TCPConfig{address: ":1813", idleTimeout: time.Minute, maxConnections: 1000}
+
+	changes := old.Diff(next)
+
+	require.Len(t, changes, 1)
+	assert.Equal(t, "tcp.idle_timeout_seconds: 300 -> 60 (requires restart, ignored)", changes[0].String())
+	assert.Equal(t, 5*time.Minute, old.withReloadable(next).GetTCP().GetIdleTimeout())
+}
+
+func TestDiff_Clients(t *testing.T) {
+	_, network, err := net.ParseCIDR("10.0.0.0/8")
+	require.NoError(t, err)
+
+	old := newReloadTestConfig()
+	old.clients = []Client{{Name: "pop", Network: network, Secret: "popsecret1"}}
+	next := newReloadTestConfig()
+	next.clients = []Client{{Name: "pop", Network: network, Secret: "popsecret2"}}
+
+	changes := old.Diff(next)
+
+	require.Len(t, changes, 1)
+	assert.Equal(t, "radius.clients[*].secret", changes[0].Key)
+	assert.NotContains(t, changes[0].String(), "popsecret")
+}
+
+func TestReloader_Reload(t *testing.T) {
+	initial := newReloadTestConfig()
+	next := newReloadTestConfig()
+	next.recordTTL = 2 * time.Hour
+	next.logLevel = LogLevelDebug
+	next.radiusPort = 1814 // not reloadable
+
+	reloader := NewReloader(initial, func() (*ControlplaneConfig, error) { return next, nil })
+
+	var hookOld, hookNew *ControlplaneConfig
+	reloader.OnReload(func(old, new *ControlplaneConfig) {
+		hookOld, hookNew = old, new
+	})
+
+	changes, err := reloader.Reload()
+
+	require.NoError(t, err)
+	assert.Len(t, changes, 3)
+
+	current := reloader.Current()
+	assert.Equal(t, 2*time.Hour, current.GetRecordTTL())
+	assert.Equal(t, LogLevelDebug, current.GetLogLevel())
+	assert.Equal(t, ":1813", current.GetRADIUSAddr(), "listener port must not change without restart")
+
+	assert.Same(t, initial, hookOld)
+	assert.Same(t, current, hookNew)
+}
+
+func TestReloader_LoggerConfig(t *testing.T) {
+	initial := &LoggerConfig{
+		redis:    RedisConfig{host: "localhost", port: 6379},
+		logLevel: LogLevelInfo,
+		logFile:  "/var/log/test.log",
+	}
+	next := *initial
+	next.logFile = "/var/log/rotated.log"
+	next.redis.port = 6380 // not reloadable
+
+	reloader := NewReloader(initial, func() (*LoggerConfig, error) { return &next, nil })
+
+	changes, err := reloader.Reload()
+
+	require.NoError(t, err)
+	require.Len(t, changes, 2)
+	assert.False(t, changes[0].Reloadable)
+	assert.Equal(t, "/var/log/rotated.log", reloader.Current().GetLogFile())
+	assert.Equal(t, "localhost:6379", reloader.Current().GetRedisAddr())
+}
+
+func TestReloader_Watch(t *testing.T) {
+	next := newReloadTestConfig()
+	next.logLevel = LogLevelDebug
+	reloader := NewReloader(newReloadTestConfig(), func() (*ControlplaneConfig, error) { return next, nil })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	go func() {
+		reloader.Watch(ctx, signals)
+		close(done)
+	}()
+
+	signals <- syscall.SIGHUP
+	require.Eventually(t, func() bool { return reloader.Current().IsDebugEnabled() }, time.Second, time.Millisecond)
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Watch did not return after cancel")
+	}
+}
+
+func TestReloader_RefusesInvalidConfig(t *testing.T) {
+	initial := newReloadTestConfig()
+
+	tests := []struct {
+		name    string
+		load    func() (*ControlplaneConfig, error)
+		wantErr string
+	}{
+		{
+			name:    "load error",
+			load:    func() (*ControlplaneConfig, error) { return nil, errors.New("redis.port: invalid int value") },
+			wantErr: "reload refused: redis.port: invalid int value",
+		},
+		{
+			name: "validation error",
+			load: func() (*ControlplaneConfig, error) {
+				cfg := newReloadTestConfig()
+				cfg.sharedSecret = "short"
+				return cfg, nil
+			},
+			wantErr: "reload refused: radius.shared_secret: shared secret must be at least 8 characters long",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reloader := NewReloader(initial, tt.load)
+			hookCalled := false
+			reloader.OnReload(func(old, new *ControlplaneConfig) { hookCalled = true })
+
+			changes, err := reloader.Reload()
+
+			assert.EqualError(t, err, tt.wantErr)
+			assert.Nil(t, changes)
+			assert.False(t, hookCalled)
+			assert.Same(t, initial, reloader.Current())
+		})
+	}
+}
+
+func TestReloader_NoChanges(t *testing.T) {
+	initial := newReloadTestConfig()
+	reloader := NewReloader(initial, func() (*ControlplaneConfig, error) { return newReloadTestConfig(), nil })
+
+	changes, err := reloader.Reload()
+
+	assert.NoError(t, err)
+	assert.Empty(t, changes)
+	assert.Same(t, initial, reloader.Current())
+}
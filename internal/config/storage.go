@@ -0,0 +1,314 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// StorageBackend selects where accounting records are persisted
+type StorageBackend string
+
+const (
+	StorageBackendRedis    StorageBackend = "redis"
+	StorageBackendSQLite   StorageBackend = "sqlite"
+	StorageBackendPostgres StorageBackend = "postgres"
+	StorageBackendMemory   StorageBackend = "memory"
+	StorageBackendDetail   StorageBackend = "detail"
+	StorageBackendMulti    StorageBackend = "multi"
+)
+
+// StoragePolicy decides whether a backend of a multi storage must succeed
+type StoragePolicy string
+
+const (
+	StoragePolicyRequired   StoragePolicy = "required"
+	StoragePolicyBestEffort StoragePolicy = "best_effort"
+)
+
+// StorageTarget is one backend written to by a multi storage
+type StorageTarget struct {
+	Backend StorageBackend
+	Policy  StoragePolicy
+}
+
+func (t StorageTarget) String() string {
+	return fmt.Sprintf("%s:%s", t.Backend, t.Policy)
+}
+
+// StorageConfig holds the settings for the accounting record store: the
+// selected backend and the settings of each backend
+type StorageConfig struct {
+	backend  StorageBackend
+	sqlite   SQLiteConfig
+	postgres PostgresConfig
+	memory   MemoryConfig
+	detail   DetailConfig
+	multi    MultiConfig
+}
+
+// SQLiteConfig holds the settings for the embedded SQLite backend
+type SQLiteConfig struct {
+	path          string
+	retention     time.Duration
+	pruneInterval time.Duration
+}
+
+// PostgresConfig holds the settings for the PostgreSQL backend
+type PostgresConfig struct {
+	dsn       string
+	batchSize int
+	partition PartitionInterval
+}
+
+// MemoryConfig holds the settings for the in-memory backend
+type MemoryConfig struct {
+	ttl        time.Duration
+	maxRecords int
+}
+
+// DetailConfig holds the settings for the FreeRADIUS detail file backend
+type DetailConfig struct {
+	directory string
+}
+
+// MultiConfig holds the settings for writing to several backends at once
+type MultiConfig struct {
+	targets []StorageTarget
+	quorum  int
+}
+
+// PartitionInterval selects the time range covered by each records partition
+type PartitionInterval string
+
+const (
+	PartitionDaily   PartitionInterval = "day"
+	PartitionMonthly PartitionInterval = "month"
+)
+
+// GetBackend returns the selected storage backend
+func (s *StorageConfig) GetBackend() StorageBackend {
+	if s.backend == "" {
+		return StorageBackendRedis
+	}
+	return s.backend
+}
+
+// GetSQLite returns the SQLite backend settings
+func (s *StorageConfig) GetSQLite() *SQLiteConfig {
+	return &s.sqlite
+}
+
+// GetPostgres returns the PostgreSQL backend settings
+func (s *StorageConfig) GetPostgres() *PostgresConfig {
+	return &s.postgres
+}
+
+// GetMemory returns the in-memory backend settings
+func (s *StorageConfig) GetMemory() *MemoryConfig {
+	return &s.memory
+}
+
+// GetDetail returns the detail file backend settings
+func (s *StorageConfig) GetDetail() *DetailConfig {
+	return &s.detail
+}
+
+// GetMulti returns the multi storage settings
+func (s *StorageConfig) GetMulti() *MultiConfig {
+	return &s.multi
+}
+
+// Uses returns true if records are written to backend, directly or as part
+// of a multi storage
+func (s *StorageConfig) Uses(backend StorageBackend) bool {
+	if s.GetBackend() != StorageBackendMulti {
+		return s.GetBackend() == backend
+	}
+	for _, target := range s.multi.targets {
+		if target.Backend == backend {
+			return true
+		}
+	}
+	return false
+}
+
+// GetPath returns the path of the SQLite database file
+func (s *SQLiteConfig) GetPath() string {
+	return s.path
+}
+
+// GetRetention returns how long records are kept, zero to keep them forever
+func (s *SQLiteConfig) GetRetention() time.Duration {
+	return s.retention
+}
+
+// GetPruneInterval returns how often records older than the retention are deleted
+func (s *SQLiteConfig) GetPruneInterval() time.Duration {
+	return s.pruneInterval
+}
+
+// GetDSN returns the PostgreSQL connection string (URL or key=value format)
+func (p *PostgresConfig) GetDSN() string {
+	return p.dsn
+}
+
+// GetBatchSize returns the maximum number of records written in one COPY
+func (p *PostgresConfig) GetBatchSize() int {
+	return p.batchSize
+}
+
+// GetPartitionInterval returns the time range covered by each partition
+func (p *PostgresConfig) GetPartitionInterval() PartitionInterval {
+	return p.partition
+}
+
+// GetTTL returns how long records are kept, zero when they never expire
+func (m *MemoryConfig) GetTTL() time.Duration {
+	return m.ttl
+}
+
+// GetMaxRecords returns how many records are kept before the oldest is
+// evicted, zero when unbounded
+func (m *MemoryConfig) GetMaxRecords() int {
+	return m.maxRecords
+}
+
+// GetDirectory returns the directory the detail files are written under
+func (d *DetailConfig) GetDirectory() string {
+	return d.directory
+}
+
+// GetTargets returns a copy of the backends written to, in order
+func (m *MultiConfig) GetTargets() []StorageTarget {
+	targets := make([]StorageTarget, len(m.targets))
+	copy(targets, m.targets)
+	return targets
+}
+
+// GetQuorum returns how many backends must store a record for it to be
+// acknowledged; required backends must succeed regardless
+func (m *MultiConfig) GetQuorum() int {
+	return m.quorum
+}
+
+// validate checks the storage settings
+func (s *StorageConfig) validate() error {
+	if s.GetBackend() != StorageBackendMulti {
+		return s.validateBackend("storage.backend", s.GetBackend())
+	}
+
+	if len(s.multi.targets) == 0 {
+		return &FieldError{Key: "storage.multi.backends", Err: fmt.Errorf("at least one backend is required")}
+	}
+
+	seen := make(map[StorageBackend]bool)
+	for i, target := range s.multi.targets {
+		key := fmt.Sprintf("storage.multi.backends[%d]", i)
+		if target.Backend == StorageBackendMulti {
+			return &FieldError{Key: key + ".backend", Err: fmt.Errorf("multi storage cannot be nested")}
+		}
+		if seen[target.Backend] {
+			return &FieldError{Key: key + ".backend", Err: fmt.Errorf("duplicate backend: %s", target.Backend)}
+		}
+		seen[target.Backend] = true
+
+		if err := s.validateBackend(key+".backend", target.Backend); err != nil {
+			return err
+		}
+
+		switch target.Policy {
+		case StoragePolicyRequired, StoragePolicyBestEffort:
+		default:
+			return &FieldError{Key: key + ".policy", Err: fmt.Errorf("invalid policy: %s (valid: required, best_effort)", target.Policy)}
+		}
+	}
+
+	if s.multi.quorum < 1 || s.multi.quorum > len(s.multi.targets) {
+		return &FieldError{Key: "storage.multi.quorum", Err: fmt.Errorf("quorum must be between 1 and %d, got %d", len(s.multi.targets), s.multi.quorum)}
+	}
+
+	return nil
+}
+
+// validateBackend checks the settings of a single backend; key names the
+// setting that selected it
+func (s *StorageConfig) validateBackend(key string, backend StorageBackend) error {
+	switch backend {
+	case StorageBackendRedis:
+		return nil
+
+	case StorageBackendSQLite:
+		if s.sqlite.path == "" {
+			return &FieldError{Key: "storage.sqlite.path", Err: fmt.Errorf("database path cannot be empty")}
+		}
+		if s.sqlite.retention < 0 {
+			return &FieldError{Key: "storage.sqlite.retention_days", Err: fmt.Errorf("retention cannot be negative")}
+		}
+		if s.sqlite.retention > 0 && s.sqlite.pruneInterval <= 0 {
+			return &FieldError{Key: "storage.sqlite.prune_interval_minutes", Err: fmt.Errorf("prune interval must be greater than 0")}
+		}
+		return nil
+
+	case StorageBackendPostgres:
+		if s.postgres.dsn == "" {
+			return &FieldError{Key: "storage.postgres.dsn", Err: fmt.Errorf("connection string cannot be empty")}
+		}
+		if s.postgres.batchSize < 1 {
+			return &FieldError{Key: "storage.postgres.batch_size", Err: fmt.Errorf("batch size must be greater than 0")}
+		}
+		switch s.postgres.partition {
+		case PartitionDaily, PartitionMonthly:
+		default:
+			return &FieldError{Key: "storage.postgres.partition_interval", Err: fmt.Errorf("invalid partition interval: %s (valid: day, month)", s.postgres.partition)}
+		}
+		return nil
+
+	case StorageBackendMemory:
+		if s.memory.ttl < 0 {
+			return &FieldError{Key: "storage.memory.ttl_seconds", Err: fmt.Errorf("TTL cannot be negative")}
+		}
+		if s.memory.maxRecords < 0 {
+			return &FieldError{Key: "storage.memory.max_records", Err: fmt.Errorf("max records cannot be negative")}
+		}
+		return nil
+
+	case StorageBackendDetail:
+		if s.detail.directory == "" {
+			return &FieldError{Key: "storage.detail.directory", Err: fmt.Errorf("directory cannot be empty")}
+		}
+		return nil
+
+	default:
+		return &FieldError{Key: key, Err: fmt.Errorf("invalid backend: %s (valid: redis, sqlite, postgres, memory, detail, multi)", backend)}
+	}
+}
+
+// diff lists the storage settings that differ; only the retention and the
+// in-memory TTL can be changed without reopening the store
+func (s *StorageConfig) diff(next *StorageConfig) []Change {
+	var changes changeList
+	changes.add("storage.backend", string(s.backend), string(next.backend), false)
+	changes.add("storage.sqlite.path", s.sqlite.path, next.sqlite.path, false)
+	changes.add("storage.sqlite.retention_days", s.sqlite.retention.String(), next.sqlite.retention.String(), true)
+	changes.add("storage.sqlite.prune_interval_minutes", s.sqlite.pruneInterval.String(), next.sqlite.pruneInterval.String(), false)
+	if s.postgres.dsn != next.postgres.dsn {
+		changes = append(changes, Change{Key: "storage.postgres.dsn", Old: "<redacted>", New: "<redacted>", Reloadable: false})
+	}
+	changes.add("storage.postgres.batch_size", fmt.Sprint(s.postgres.batchSize), fmt.Sprint(next.postgres.batchSize), false)
+	changes.add("storage.postgres.partition_interval", string(s.postgres.partition), string(next.postgres.partition), false)
+	changes.add("storage.memory.ttl_seconds", s.memory.ttl.String(), next.memory.ttl.String(), true)
+	changes.add("storage.memory.max_records", fmt.Sprint(s.memory.maxRecords), fmt.Sprint(next.memory.maxRecords), false)
+	changes.add("storage.detail.directory", s.detail.directory, next.detail.directory, false)
+	changes.add("storage.multi.backends", describeTargets(s.multi.targets), describeTargets(next.multi.targets), false)
+	changes.add("storage.multi.quorum", fmt.Sprint(s.multi.quorum), fmt.Sprint(next.multi.quorum), false)
+	return changes
+}
+
+func describeTargets(targets []StorageTarget) string {
+	parts := make([]string, len(targets))
+	for i, target := range targets {
+		parts[i] = target.String()
+	}
+	return "[" + strings.Join(parts, " ") + "]"
+}
@@ -0,0 +1,66 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// TCPConfig holds the settings of the RADIUS over TCP (RFC 6613) listener of
+// radius-controlplane: its address, idle timeout and connection limit
+type TCPConfig struct {
+	address        string // host:port to listen on, empty when TCP is disabled
+	idleTimeout    time.Duration
+	maxConnections int // 0 is unlimited
+}
+
+// Enabled returns true if the TCP listener should be started
+func (t *TCPConfig) Enabled() bool {
+	return t.address != ""
+}
+
+// GetAddress returns the address the TCP listener binds to
+func (t *TCPConfig) GetAddress() string {
+	return t.address
+}
+
+// GetIdleTimeout returns how long a connection may stay without a request
+// before it is closed, zero for no limit
+func (t *TCPConfig) GetIdleTimeout() time.Duration {
+	return t.idleTimeout
+}
+
+// GetMaxConnections returns the number of connections accepted at once,
+// zero for no limit
+func (t *TCPConfig) GetMaxConnections() int {
+	return t.maxConnections
+}
+
+// validate checks the TCP settings when the listener is enabled
+func (t *TCPConfig) validate() error {
+	if !t.Enabled() {
+		return nil
+	}
+
+	if err := validateListenAddress("tcp.address", t.address); err != nil {
+		return err
+	}
+
+	if t.idleTimeout < 0 {
+		return &FieldError{Key: "tcp.idle_timeout_seconds", Err: fmt.Errorf("idle timeout cannot be negative")}
+	}
+
+	if t.maxConnections < 0 {
+		return &FieldError{Key: "tcp.max_connections", Err: fmt.Errorf("max connections cannot be negative")}
+	}
+
+	return nil
+}
+
+// diff lists the TCP settings that differ; all of them need a restart
+func (t *TCPConfig) diff(next *TCPConfig) []Change {
+	var changes changeList
+	changes.add("tcp.address", t.address, next.address, false)
+	changes.add("tcp.idle_timeout_seconds", fmt.Sprint(t.idleTimeout.Seconds()), fmt.Sprint(next.idleTimeout.Seconds()), false)
+	changes.add("tcp.max_connections", fmt.Sprint(t.maxConnections), fmt.Sprint(next.maxConnections), false)
+	return changes
+}
@@ -0,0 +1,104 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// TLSConfig holds the certificate settings for a TLS connection and whether
+// the server certificate is verified
+type TLSConfig struct {
+	enabled            bool
+	caFile             string
+	certFile           string
+	keyFile            string
+	serverName         string
+	insecureSkipVerify bool
+}
+
+// Enabled returns true if TLS should be used
+func (t *TLSConfig) Enabled() bool {
+	return t.enabled
+}
+
+// ClientConfig builds a *tls.Config for dialing a server, or nil when TLS is
+// disabled. The CA file, when set, replaces the system roots; the certificate
+// and key, when set, are presented to the server.
+func (t *TLSConfig) ClientConfig() (*tls.Config, error) {
+	if !t.enabled {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         t.serverName,
+		InsecureSkipVerify: t.insecureSkipVerify, // explicit opt-in, meant for test environments
+	}
+
+	if t.caFile != "" {
+		pool, err := loadCertPool(t.caFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if t.certFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.certFile, t.keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// validate checks the TLS settings; prefix is the key path of the tls section
+func (t *TLSConfig) validate(prefix string) error {
+	if !t.enabled {
+		if t.caFile != "" || t.certFile != "" || t.keyFile != "" {
+			return &FieldError{Key: prefix + ".enabled", Err: fmt.Errorf("must be true when TLS files are set")}
+		}
+		return nil
+	}
+
+	if (t.certFile == "") != (t.keyFile == "") {
+		return &FieldError{Key: prefix + ".key_file", Err: fmt.Errorf("cert_file and key_file must be set together")}
+	}
+
+	if _, err := t.ClientConfig(); err != nil {
+		return &FieldError{Key: prefix, Err: err}
+	}
+
+	return nil
+}
+
+// diff lists the TLS settings that differ; prefix is the key path of the tls section
+func (t *TLSConfig) diff(prefix string, next *TLSConfig) []Change {
+	var changes changeList
+	changes.add(prefix+".enabled", fmt.Sprint(t.enabled), fmt.Sprint(next.enabled), false)
+	changes.add(prefix+".ca_file", t.caFile, next.caFile, false)
+	changes.add(prefix+".cert_file", t.certFile, next.certFile, false)
+	changes.add(prefix+".key_file", t.keyFile, next.keyFile, false)
+	changes.add(prefix+".server_name", t.serverName, next.serverName, false)
+	changes.add(prefix+".insecure_skip_verify", fmt.Sprint(t.insecureSkipVerify), fmt.Sprint(next.insecureSkipVerify), false)
+	return changes
+}
+
+// loadCertPool reads a PEM bundle of CA certificates
+func loadCertPool(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA file: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in CA file %s", path)
+	}
+
+	return pool, nil
+}
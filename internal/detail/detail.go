@@ -0,0 +1,179 @@
+// Package detail writes and reads accounting records in the FreeRADIUS
+// detail file format, for tools that consume detail files and for migrating
+// existing FreeRADIUS accounting data.
+//
+// An entry starts with the time it was written, in ctime format, followed by
+// one tab-indented "Attribute = value" line per attribute and an empty line:
+//
+//	Mon Jan 15 10:30:45 2024
+//		Acct-Status-Type = Start
+//		User-Name = "alice"
+//		NAS-IP-Address = 192.168.1.1
+//		...
+//		Timestamp = 1705314645
+package detail
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kal997/radius-accounting-server/internal/models"
+	"layeh.com/radius/rfc2866"
+)
+
+// headerLayout is the ctime format of the line that starts an entry
+const headerLayout = "Mon Jan _2 15:04:05 2006"
+
+// eventTimestampLayout is the format FreeRADIUS uses for Event-Timestamp
+const eventTimestampLayout = "Jan _2 2006 15:04:05 MST"
+
+// attribute is one line of an entry
+type attribute struct {
+	name  string
+	value string
+}
+
+// Encode writes a record as one detail entry. Times are written in UTC; the
+// entry time is the record's event time, or the current time when it has
+// none.
+func Encode(w io.Writer, record models.AccountingEvent) error {
+	attrs, eventTime, err := attributes(record)
+	if err != nil {
+		return err
+	}
+	if eventTime.IsZero() {
+		eventTime = time.Now()
+	}
+	eventTime = eventTime.UTC()
+
+	var b strings.Builder
+	b.WriteString(eventTime.Format(headerLayout))
+	b.WriteByte('\n')
+	for _, attr := range attrs {
+		fmt.Fprintf(&b, "\t%s = %s\n", attr.name, attr.value)
+	}
+	fmt.Fprintf(&b, "\tEvent-Timestamp = %s\n", quote(eventTime.Format(eventTimestampLayout)))
+	fmt.Fprintf(&b, "\tTimestamp = %d\n\n", eventTime.Unix())
+
+	_, err = io.WriteString(w, b.String())
+	return err
+}
+
+// attributes returns the attribute lines of a record in the order FreeRADIUS
+// writes them, and its event time. Empty strings are omitted, like
+// attributes missing from the request.
+func attributes(record models.AccountingEvent) ([]attribute, time.Time, error) {
+	var (
+		base   *models.BaseAccountingRecord
+		status rfc2866.AcctStatusType
+	)
+	switch r := record.(type) {
+	case *models.StartRecord:
+		base, status = &r.BaseAccountingRecord, rfc2866.AcctStatusType_Value_Start
+	case *models.InterimRecord:
+		base, status = &r.BaseAccountingRecord, rfc2866.AcctStatusType_Value_InterimUpdate
+	case *models.StopRecord:
+		base, status = &r.BaseAccountingRecord, rfc2866.AcctStatusType_Value_Stop
+	default:
+		return nil, time.Time{}, fmt.Errorf("unsupported record type %T", record)
+	}
+
+	var attrs []attribute
+	add := func(name, value string) {
+		if value != "" {
+			attrs = append(attrs, attribute{name, value})
+		}
+	}
+
+	add("Acct-Status-Type", status.String())
+	add("User-Name", quote(base.Username))
+	add("NAS-IP-Address", address(base.NASIPAddress))
+	add("NAS-Port", strconv.Itoa(base.NASPort))
+	add("Acct-Session-Id", quote(base.AcctSessionID))
+	add("Calling-Station-Id", quote(base.CallingStationID))
+	add("Called-Station-Id", quote(base.CalledStationID))
+
+	switch r := record.(type) {
+	case *models.StartRecord:
+		add("Framed-IP-Address", address(r.FramedIPAddress))
+	case *models.InterimRecord:
+		attrs = append(attrs, usage(r.SessionTime, r.InputOctets, r.OutputOctets)...)
+	case *models.StopRecord:
+		attrs = append(attrs, usage(r.SessionTime, r.InputOctets, r.OutputOctets)...)
+		add("Acct-Terminate-Cause", terminateCauseName(r.TerminateCause))
+	}
+
+	add("Packet-Src-IP-Address", address(base.ClientIP))
+
+	eventTime, _ := time.Parse(time.RFC3339Nano, base.Timestamp)
+	return attrs, eventTime, nil
+}
+
+// address returns s if it is an IP address. Attributes missing from the
+// request are stored as "<nil>" and are omitted.
+func address(s string) string {
+	if net.ParseIP(s) == nil {
+		return ""
+	}
+	return s
+}
+
+// usage returns the session time and the octet counters, split into the
+// 32-bit Octets and Gigawords attributes
+func usage(sessionTime int, inputOctets, outputOctets uint64) []attribute {
+	return []attribute{
+		{"Acct-Session-Time", strconv.Itoa(sessionTime)},
+		{"Acct-Input-Octets", strconv.FormatUint(inputOctets&0xffffffff, 10)},
+		{"Acct-Output-Octets", strconv.FormatUint(outputOctets&0xffffffff, 10)},
+		{"Acct-Input-Gigawords", strconv.FormatUint(inputOctets>>32, 10)},
+		{"Acct-Output-Gigawords", strconv.FormatUint(outputOctets>>32, 10)},
+	}
+}
+
+// terminateCauseName returns the dictionary name of a numeric terminate
+// cause, e.g. User-Request for 1; other values are written as they are
+func terminateCauseName(cause string) string {
+	n, err := strconv.ParseUint(cause, 10, 32)
+	if err != nil {
+		return cause
+	}
+	if name, ok := rfc2866.AcctTerminateCause_Strings[rfc2866.AcctTerminateCause(n)]; ok {
+		return name
+	}
+	return cause
+}
+
+// quote returns s as a double-quoted detail string, escaping quotes,
+// backslashes and control characters like FreeRADIUS; empty strings stay
+// empty so that the attribute is omitted
+func quote(s string) string {
+	if s == "" {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c == '\n':
+			b.WriteString(`\n`)
+		case c == '\r':
+			b.WriteString(`\r`)
+		case c == '\t':
+			b.WriteString(`\t`)
+		case c < 0x20 || c == 0x7f:
+			fmt.Fprintf(&b, `\%03o`, c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
@@ -0,0 +1,181 @@
+package detail
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kal997/radius-accounting-server/internal/models"
+)
+
+var testStop = &models.StopRecord{
+	BaseAccountingRecord: models.BaseAccountingRecord{
+		Username:         `al"ice`,
+		NASIPAddress:     "192.168.1.1",
+		NASPort:          7,
+		AcctSessionID:    "a1",
+		CallingStationID: "aa:bb:cc:dd:ee:01",
+		ClientIP:         "192.168.1.1",
+		Timestamp:        "2024-01-05T10:30:45Z",
+	},
+	SessionTime:    3600,
+	TerminateCause: "1",
+	InputOctets:    5<<32 | 1000,
+	OutputOctets:   2000,
+}
+
+const testStopEntry = `Fri Jan  5 10:30:45 2024
+	Acct-Status-Type = Stop
+	User-Name = "al\"ice"
+	NAS-IP-Address = 192.168.1.1
+	NAS-Port = 7
+	Acct-Session-Id = "a1"
+	Calling-Station-Id = "aa:bb:cc:dd:ee:01"
+	Acct-Session-Time = 3600
+	Acct-Input-Octets = 1000
+	Acct-Output-Octets = 2000
+	Acct-Input-Gigawords = 5
+	Acct-Output-Gigawords = 0
+	Acct-Terminate-Cause = User-Request
+	Packet-Src-IP-Address = 192.168.1.1
+	Event-Timestamp = "Jan  5 2024 10:30:45 UTC"
+	Timestamp = 1704450645
+
+`
+
+func TestEncode(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, Encode(&buf, testStop))
+	assert.Equal(t, testStopEntry, buf.String())
+}
+
+func TestReader(t *testing.T) {
+	// Entries as written by FreeRADIUS, with an Accounting-On to skip and
+	// no empty line at the end
+	input := testStopEntry + `Fri Jan  5 10:31:00 2024
+	Acct-Status-Type = Accounting-On
+	NAS-IP-Address = 192.168.1.2
+	Timestamp = 1704450660
+
+Fri Jan  5 10:32:00 2024
+	Acct-Status-Type = Start
+	User-Name = "bob"
+	NAS-IP-Address = 192.168.1.2
+	Acct-Session-Id = "b1"
+	Framed-IP-Address = 10.0.0.2
+	Client-IP-Address = 192.168.1.2
+	Event-Timestamp = "Jan  5 2024 10:32:00 UTC"
+Fri Jan  5 10:33:00 2024
+	Acct-Status-Type = Interim-Update
+	User-Name = "bob"
+	Acct-Session-Id = "b1"
+	Acct-Session-Time = 60
+	Acct-Output-Octets = 42
+	Event-Timestamp = 1704450780`
+
+	reader := NewReader(strings.NewReader(input))
+
+	record, err := reader.Next()
+	require.NoError(t, err)
+	assert.Equal(t, testStop, record)
+
+	record, err = reader.Next()
+	require.NoError(t, err)
+	start, ok := record.(*models.StartRecord)
+	require.True(t, ok)
+	assert.Equal(t, "10.0.0.2", start.FramedIPAddress)
+	assert.Equal(t, "192.168.1.2", start.ClientIP)
+	assert.Equal(t, "2024-01-05T10:32:00Z", start.Timestamp)
+
+	record, err = reader.Next()
+	require.NoError(t, err)
+	interim, ok := record.(*models.InterimRecord)
+	require.True(t, ok)
+	assert.Equal(t, uint64(42), interim.OutputOctets)
+	assert.Empty(t, interim.ClientIP)
+	assert.Equal(t, "2024-01-05T10:33:00Z", interim.Timestamp)
+
+	_, err = reader.Next()
+	assert.ErrorIs(t, err, io.EOF)
+	assert.Equal(t, 1, reader.Skipped)
+}
+
+func TestReader_Errors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		err   string
+	}{
+		{
+			name:  "invalid number",
+			input: "Fri Jan  5 10:30:45 2024\n\tAcct-Status-Type = Stop\n\tAcct-Session-Time = soon\n\tTimestamp = 1704450645\n",
+			err:   `line 1: invalid Acct-Session-Time "soon"`,
+		},
+		{
+			name:  "missing status",
+			input: "\nFri Jan  5 10:30:45 2024\n\tUser-Name = \"alice\"\n",
+			err:   "line 2: missing Acct-Status-Type",
+		},
+		{
+			name:  "missing time",
+			input: "Fri Jan  5 10:30:45 2024\n\tAcct-Status-Type = Start\n",
+			err:   "line 1: missing Timestamp and Event-Timestamp",
+		},
+		{
+			name:  "attribute outside of an entry",
+			input: "\tUser-Name = \"alice\"\n",
+			err:   "line 1: attribute outside of an entry",
+		},
+		{
+			name:  "malformed attribute",
+			input: "Fri Jan  5 10:30:45 2024\n\tAcct-Status-Type: Start\n",
+			err:   `line 2: expected "Attribute = value"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewReader(strings.NewReader(tt.input)).Next()
+			assert.EqualError(t, err, tt.err)
+		})
+	}
+}
+
+func TestWriter(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "radacct")
+	writer, err := NewWriter(dir)
+	require.NoError(t, err)
+
+	start := &models.StartRecord{BaseAccountingRecord: models.BaseAccountingRecord{
+		Username:      "bob",
+		NASIPAddress:  "<nil>",
+		ClientIP:      "192.168.1.2",
+		AcctSessionID: "b1",
+		Timestamp:     "2024-01-05T23:59:59.5Z",
+	}}
+	require.NoError(t, writer.Write(testStop))
+	require.NoError(t, writer.Write(testStop))
+	require.NoError(t, writer.Write(start))
+
+	data, err := os.ReadFile(filepath.Join(dir, "192.168.1.1", "detail-20240105"))
+	require.NoError(t, err)
+	assert.Equal(t, testStopEntry+testStopEntry, string(data))
+
+	// Filed under the client address when NAS-IP-Address is missing
+	path := filepath.Join(dir, "192.168.1.2", "detail-20240105")
+	assert.Equal(t, path, writer.Path(start))
+
+	data, err = os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "NAS-IP-Address")
+
+	record, err := NewReader(bytes.NewReader(data)).Next()
+	require.NoError(t, err)
+	assert.Equal(t, "2024-01-05T23:59:59Z", record.(*models.StartRecord).Timestamp)
+}
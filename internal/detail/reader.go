@@ -0,0 +1,259 @@
+package detail
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kal997/radius-accounting-server/internal/models"
+	"layeh.com/radius/rfc2866"
+)
+
+// maxLineLength bounds the lines of a detail file
+const maxLineLength = 64 * 1024
+
+// Reader reads records from a detail file, such as one written by
+// FreeRADIUS' detail module
+type Reader struct {
+	scanner *bufio.Scanner
+	line    int    // Number of the last line read
+	header  string // Entry header read ahead, if any
+
+	// Skipped counts the entries that are not Start, Interim-Update or Stop
+	// records, e.g. Accounting-On
+	Skipped int
+}
+
+// NewReader creates a reader of the detail entries in r
+func NewReader(r io.Reader) *Reader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 4096), maxLineLength)
+	return &Reader{scanner: scanner}
+}
+
+// Next returns the next record, or io.EOF after the last one. Errors name the
+// line of the entry that could not be read.
+func (r *Reader) Next() (models.AccountingEvent, error) {
+	for {
+		start, attrs, err := r.entry()
+		if err != nil {
+			return nil, err
+		}
+		record, err := newRecord(attrs)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", start, err)
+		}
+		if record == nil {
+			r.Skipped++
+			continue
+		}
+		return record, nil
+	}
+}
+
+// entry reads the next entry and returns the line it starts on and its
+// attributes. An entry ends at an empty line, the next header or the end of
+// the file.
+func (r *Reader) entry() (int, map[string]string, error) {
+	start := r.line
+	if r.header == "" {
+		for {
+			text, err := r.next()
+			if err != nil {
+				return 0, nil, err
+			}
+			if strings.TrimSpace(text) == "" {
+				continue
+			}
+			if isAttribute(text) {
+				return 0, nil, fmt.Errorf("line %d: attribute outside of an entry", r.line)
+			}
+			start = r.line
+			break
+		}
+	}
+	r.header = ""
+
+	attrs := make(map[string]string)
+	for {
+		text, err := r.next()
+		if errors.Is(err, io.EOF) {
+			return start, attrs, nil
+		}
+		if err != nil {
+			return 0, nil, err
+		}
+		if strings.TrimSpace(text) == "" {
+			return start, attrs, nil
+		}
+		if !isAttribute(text) {
+			r.header = text
+			return start, attrs, nil
+		}
+
+		name, value, ok := strings.Cut(strings.TrimSpace(text), " = ")
+		if !ok {
+			return 0, nil, fmt.Errorf("line %d: expected \"Attribute = value\"", r.line)
+		}
+		attrs[name] = unquote(value)
+	}
+}
+
+// next returns the next line
+func (r *Reader) next() (string, error) {
+	if !r.scanner.Scan() {
+		if err := r.scanner.Err(); err != nil {
+			return "", fmt.Errorf("line %d: %w", r.line+1, err)
+		}
+		return "", io.EOF
+	}
+	r.line++
+	return r.scanner.Text(), nil
+}
+
+// isAttribute reports whether a line is indented, as attribute lines are
+func isAttribute(line string) bool {
+	return strings.HasPrefix(line, "\t") || strings.HasPrefix(line, " ")
+}
+
+// unquote returns the contents of a double-quoted value, or the value as it
+// is when it is not quoted
+func unquote(value string) string {
+	if len(value) < 2 || value[0] != '"' || value[len(value)-1] != '"' {
+		return value
+	}
+	if s, err := strconv.Unquote(value); err == nil {
+		return s
+	}
+	return value[1 : len(value)-1]
+}
+
+// newRecord converts the attributes of an entry, or returns nil for entries
+// that are not Start, Interim-Update or Stop records
+func newRecord(attrs map[string]string) (models.AccountingEvent, error) {
+	status, err := statusType(attrs["Acct-Status-Type"])
+	if err != nil || status == 0 {
+		return nil, err
+	}
+
+	p := parser{attrs: attrs}
+	base := models.BaseAccountingRecord{
+		Username:         attrs["User-Name"],
+		NASIPAddress:     attrs["NAS-IP-Address"],
+		NASPort:          int(p.uint("NAS-Port", 32)),
+		AcctSessionID:    attrs["Acct-Session-Id"],
+		CallingStationID: attrs["Calling-Station-Id"],
+		CalledStationID:  attrs["Called-Station-Id"],
+		ClientIP:         attrs["Packet-Src-IP-Address"],
+		Timestamp:        p.eventTime().Format(time.RFC3339Nano),
+	}
+	if base.ClientIP == "" {
+		base.ClientIP = attrs["Client-IP-Address"] // FreeRADIUS 2
+	}
+	if base.ClientIP == "" {
+		// Entries written without a source address came from the NAS itself
+		// unless a proxy was involved, which the file cannot tell
+		base.ClientIP = base.NASIPAddress
+	}
+
+	var record models.AccountingEvent
+	switch status {
+	case rfc2866.AcctStatusType_Value_Start:
+		record = &models.StartRecord{
+			BaseAccountingRecord: base,
+			FramedIPAddress:      attrs["Framed-IP-Address"],
+		}
+	case rfc2866.AcctStatusType_Value_InterimUpdate:
+		record = &models.InterimRecord{
+			BaseAccountingRecord: base,
+			SessionTime:          int(p.uint("Acct-Session-Time", 32)),
+			InputOctets:          p.octets("Acct-Input-Octets", "Acct-Input-Gigawords"),
+			OutputOctets:         p.octets("Acct-Output-Octets", "Acct-Output-Gigawords"),
+		}
+	default:
+		record = &models.StopRecord{
+			BaseAccountingRecord: base,
+			SessionTime:          int(p.uint("Acct-Session-Time", 32)),
+			TerminateCause:       terminateCauseNumber(attrs["Acct-Terminate-Cause"]),
+			InputOctets:          p.octets("Acct-Input-Octets", "Acct-Input-Gigawords"),
+			OutputOctets:         p.octets("Acct-Output-Octets", "Acct-Output-Gigawords"),
+		}
+	}
+	return record, p.err
+}
+
+// statusType returns the status of an entry by name or number, or zero for
+// statuses other than Start, Interim-Update and Stop
+func statusType(value string) (rfc2866.AcctStatusType, error) {
+	switch value {
+	case "Start", "1":
+		return rfc2866.AcctStatusType_Value_Start, nil
+	case "Stop", "2":
+		return rfc2866.AcctStatusType_Value_Stop, nil
+	case "Interim-Update", "Alive", "3":
+		return rfc2866.AcctStatusType_Value_InterimUpdate, nil
+	case "":
+		return 0, fmt.Errorf("missing Acct-Status-Type")
+	default:
+		return 0, nil
+	}
+}
+
+// terminateCauseNumber converts a terminate cause name to the numeric form
+// stored by the server, e.g. 1 for User-Request
+func terminateCauseNumber(value string) string {
+	for cause, name := range rfc2866.AcctTerminateCause_Strings {
+		if name == value {
+			return strconv.FormatUint(uint64(cause), 10)
+		}
+	}
+	return value
+}
+
+// parser converts attribute values, keeping the first error
+type parser struct {
+	attrs map[string]string
+	err   error
+}
+
+// uint parses an unsigned attribute, zero when it is absent
+func (p *parser) uint(name string, bits int) uint64 {
+	value, ok := p.attrs[name]
+	if !ok {
+		return 0
+	}
+	n, err := strconv.ParseUint(value, 10, bits)
+	if err != nil && p.err == nil {
+		p.err = fmt.Errorf("invalid %s %q", name, value)
+	}
+	return n
+}
+
+// octets combines an Octets attribute with its Gigawords attribute
+func (p *parser) octets(octets, gigawords string) uint64 {
+	return p.uint(gigawords, 32)<<32 | p.uint(octets, 32)
+}
+
+// eventTime returns when the request was received: the Timestamp attribute
+// FreeRADIUS adds, else Event-Timestamp, in its string or numeric form
+func (p *parser) eventTime() time.Time {
+	if _, ok := p.attrs["Timestamp"]; ok {
+		return time.Unix(int64(p.uint("Timestamp", 63)), 0).UTC()
+	}
+
+	value, ok := p.attrs["Event-Timestamp"]
+	if !ok {
+		if p.err == nil {
+			p.err = fmt.Errorf("missing Timestamp and Event-Timestamp")
+		}
+		return time.Time{}
+	}
+	if t, err := time.Parse(eventTimestampLayout, value); err == nil {
+		return t.UTC()
+	}
+	return time.Unix(int64(p.uint("Event-Timestamp", 63)), 0).UTC()
+}
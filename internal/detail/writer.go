@@ -0,0 +1,84 @@
+package detail
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/kal997/radius-accounting-server/internal/models"
+)
+
+// Writer appends records to one detail file per NAS and UTC day, named like
+// the FreeRADIUS default: <dir>/<NAS-IP-Address>/detail-20240115. Each file
+// is opened for every entry, so files may be moved away at any time, e.g. by
+// a detail file consumer or logrotate.
+type Writer struct {
+	dir string
+	mu  sync.Mutex // Keeps entries of concurrent writes whole
+}
+
+// NewWriter creates a writer under dir, creating the directory if needed
+func NewWriter(dir string) (*Writer, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create detail directory: %w", err)
+	}
+	return &Writer{dir: dir}, nil
+}
+
+// Dir returns the directory the detail files are written under
+func (w *Writer) Dir() string {
+	return w.dir
+}
+
+// Path returns the file a record is written to. Records without a valid
+// NAS-IP-Address are filed under the address of the client that sent them.
+func (w *Writer) Path(record models.AccountingEvent) string {
+	nas := "unknown"
+	eventTime := time.Now()
+	base := record.Base()
+	if net.ParseIP(base.NASIPAddress) != nil {
+		nas = base.NASIPAddress
+	} else if net.ParseIP(base.ClientIP) != nil {
+		nas = base.ClientIP
+	}
+	if t, err := time.Parse(time.RFC3339Nano, base.Timestamp); err == nil {
+		eventTime = t
+	}
+	return filepath.Join(w.dir, nas, "detail-"+eventTime.UTC().Format("20060102"))
+}
+
+// Write appends a record to its detail file and syncs it to disk
+func (w *Writer) Write(record models.AccountingEvent) error {
+	var entry bytes.Buffer
+	if err := Encode(&entry, record); err != nil {
+		return err
+	}
+	path := w.Path(record)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return fmt.Errorf("failed to create detail directory: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return fmt.Errorf("failed to open detail file: %w", err)
+	}
+
+	_, err = file.Write(entry.Bytes())
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write detail file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package export
+
+import (
+	"encoding/csv"
+	"io"
+
+	"github.com/kal997/radius-accounting-server/internal/models"
+)
+
+// csvWriter writes a header line followed by one line per record
+type csvWriter struct {
+	w             *csv.Writer
+	headerWritten bool
+}
+
+func newCSVWriter(w io.Writer) *csvWriter {
+	return &csvWriter{w: csv.NewWriter(w)}
+}
+
+func (c *csvWriter) Write(record models.AccountingEvent) error {
+	if err := c.writeHeader(); err != nil {
+		return err
+	}
+	row := newRow(record)
+	return c.w.Write(row.strings())
+}
+
+// Close writes the header of an empty export and flushes
+func (c *csvWriter) Close() error {
+	if err := c.writeHeader(); err != nil {
+		return err
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func (c *csvWriter) writeHeader() error {
+	if c.headerWritten {
+		return nil
+	}
+	c.headerWritten = true
+	return c.w.Write(columns)
+}
@@ -0,0 +1,164 @@
+// Package export writes accounting records to CSV, Parquet or JSON lines
+// files with a stable schema, streaming them from storage page by page.
+package export
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/kal997/radius-accounting-server/internal/models"
+	"github.com/kal997/radius-accounting-server/internal/storage"
+)
+
+// Format is the file format of an export
+type Format string
+
+const (
+	FormatCSV     Format = "csv"
+	FormatParquet Format = "parquet"
+	FormatJSONL   Format = "jsonl"
+)
+
+// ParseFormat validates a format name
+func ParseFormat(name string) (Format, error) {
+	switch format := Format(name); format {
+	case FormatCSV, FormatParquet, FormatJSONL:
+		return format, nil
+	default:
+		return "", fmt.Errorf("unknown export format %q, expected csv, parquet or jsonl", name)
+	}
+}
+
+// Options selects how records are written
+type Options struct {
+	Format Format
+
+	// Gzip compresses CSV and JSON lines output as a whole. Parquet files
+	// compress their column chunks with gzip instead, so that they remain
+	// readable by Parquet tools.
+	Gzip bool
+}
+
+// Extension returns the file name extension of the options, e.g. ".csv.gz"
+func (o Options) Extension() string {
+	ext := "." + string(o.Format)
+	if o.Gzip && o.Format != FormatParquet {
+		ext += ".gz"
+	}
+	return ext
+}
+
+// Writer writes records to an export file
+type Writer interface {
+	// Write adds a record to the export
+	Write(record models.AccountingEvent) error
+
+	// Close flushes buffered rows and writes any trailer, e.g. the Parquet
+	// footer. It does not close the underlying io.Writer.
+	Close() error
+}
+
+// NewWriter creates a writer for the given options on w
+func NewWriter(w io.Writer, opts Options) (Writer, error) {
+	switch opts.Format {
+	case FormatParquet:
+		return newParquetWriter(w, opts.Gzip), nil
+	case FormatCSV, FormatJSONL:
+	default:
+		return nil, fmt.Errorf("unknown export format %q", opts.Format)
+	}
+
+	var gz *gzip.Writer
+	if opts.Gzip {
+		gz = gzip.NewWriter(w)
+		w = gz
+	}
+
+	var inner Writer
+	if opts.Format == FormatCSV {
+		inner = newCSVWriter(w)
+	} else {
+		inner = &jsonlWriter{enc: json.NewEncoder(w)}
+	}
+	if gz == nil {
+		return inner, nil
+	}
+	return &gzipWriter{Writer: inner, gz: gz}, nil
+}
+
+// gzipWriter closes the gzip stream after the wrapped writer
+type gzipWriter struct {
+	Writer
+	gz *gzip.Writer
+}
+
+func (w *gzipWriter) Close() error {
+	if err := w.Writer.Close(); err != nil {
+		return err
+	}
+	return w.gz.Close()
+}
+
+// jsonlWriter writes one JSON object per line, in the format of the admin API
+type jsonlWriter struct {
+	enc *json.Encoder
+}
+
+func (w *jsonlWriter) Write(record models.AccountingEvent) error {
+	return w.enc.Encode(storage.NewKeyedRecord(record))
+}
+
+func (w *jsonlWriter) Close() error {
+	return nil
+}
+
+// Run streams every record matching q to w, oldest first, and returns the
+// number of records written. q.Limit and q.Cursor are managed by Run.
+func Run(ctx context.Context, querier storage.Querier, q storage.Query, w Writer) (int, error) {
+	q.Limit = storage.MaxQueryLimit
+	q.Cursor = ""
+
+	written := 0
+	for {
+		result, err := querier.Query(ctx, q)
+		if err != nil {
+			return written, fmt.Errorf("failed to read records: %w", err)
+		}
+		for _, record := range result.Records {
+			if err := w.Write(record); err != nil {
+				return written, fmt.Errorf("failed to write record: %w", err)
+			}
+			written++
+		}
+		if result.NextCursor == "" {
+			return written, nil
+		}
+		q.Cursor = result.NextCursor
+	}
+}
+
+// Period returns the last complete day or month before now, in UTC
+func Period(name string, now time.Time) (time.Time, time.Time, error) {
+	now = now.UTC()
+	switch name {
+	case "day":
+		end := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+		return end.AddDate(0, 0, -1), end, nil
+	case "month":
+		end := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+		return end.AddDate(0, -1, 0), end, nil
+	default:
+		return time.Time{}, time.Time{}, fmt.Errorf("unknown period %q, expected day or month", name)
+	}
+}
+
+// FileName names the export of a time range, e.g.
+// radius-accounting-20240101T000000Z-20240201T000000Z.csv.gz
+func FileName(from, to time.Time, opts Options) string {
+	const layout = "20060102T150405Z"
+	return fmt.Sprintf("radius-accounting-%s-%s%s", from.UTC().Format(layout), to.UTC().Format(layout), opts.Extension())
+}
@@ -0,0 +1,194 @@
+package export
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kal997/radius-accounting-server/internal/config"
+	"github.com/kal997/radius-accounting-server/internal/models"
+	"github.com/kal997/radius-accounting-server/internal/storage"
+)
+
+var (
+	testStart = &models.StartRecord{
+		BaseAccountingRecord: models.BaseAccountingRecord{
+			Username:         "alice",
+			NASIPAddress:     "192.168.1.1",
+			NASPort:          7,
+			AcctSessionID:    "a1",
+			CallingStationID: "aa:bb:cc:dd:ee:01",
+			ClientIP:         "192.168.1.1",
+			Timestamp:        "2024-01-15T10:00:00Z",
+		},
+		FramedIPAddress: "10.0.0.1",
+	}
+	testStop = &models.StopRecord{
+		BaseAccountingRecord: models.BaseAccountingRecord{
+			Username:      "alice",
+			NASIPAddress:  "192.168.1.1",
+			AcctSessionID: "a1",
+			Timestamp:     "2024-01-15T11:00:00Z",
+		},
+		SessionTime:    3600,
+		InputOctets:    1000,
+		OutputOctets:   2000,
+		TerminateCause: "1",
+	}
+)
+
+// writeAll writes the test records with the given options
+func writeAll(t *testing.T, opts Options) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, opts)
+	require.NoError(t, err)
+	require.NoError(t, w.Write(testStart))
+	require.NoError(t, w.Write(testStop))
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func TestWriter_CSV(t *testing.T) {
+	data := writeAll(t, Options{Format: FormatCSV, Gzip: true})
+
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	require.NoError(t, err)
+	lines, err := csv.NewReader(gz).ReadAll()
+	require.NoError(t, err)
+
+	require.Len(t, lines, 3)
+	assert.Equal(t, columns, lines[0])
+	assert.Equal(t, []string{
+		"start", testStart.GenerateRedisKey(), "2024-01-15T10:00:00Z", "alice", "192.168.1.1", "7", "a1",
+		"aa:bb:cc:dd:ee:01", "", "192.168.1.1", "10.0.0.1", "", "", "", "",
+	}, lines[1])
+	assert.Equal(t, []string{
+		"stop", testStop.GenerateRedisKey(), "2024-01-15T11:00:00Z", "alice", "192.168.1.1", "0", "a1",
+		"", "", "", "", "3600", "1000", "2000", "1",
+	}, lines[2])
+}
+
+func TestWriter_CSVEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, Options{Format: FormatCSV})
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	lines, err := csv.NewReader(&buf).ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{columns}, lines)
+}
+
+func TestWriter_Parquet(t *testing.T) {
+	for _, gz := range []bool{false, true} {
+		data := writeAll(t, Options{Format: FormatParquet, Gzip: gz})
+
+		rows, err := parquet.Read[Row](bytes.NewReader(data), int64(len(data)))
+		require.NoError(t, err)
+		require.Len(t, rows, 2)
+
+		assert.Equal(t, "start", rows[0].RecordType)
+		assert.True(t, time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC).Equal(rows[0].EventTime))
+		require.NotNil(t, rows[0].FramedIPAddress)
+		assert.Equal(t, "10.0.0.1", *rows[0].FramedIPAddress)
+		assert.Nil(t, rows[0].SessionTime)
+
+		assert.Equal(t, "stop", rows[1].RecordType)
+		assert.Nil(t, rows[1].FramedIPAddress)
+		require.NotNil(t, rows[1].OutputOctets)
+		assert.Equal(t, int64(2000), *rows[1].OutputOctets)
+		assert.Equal(t, "1", *rows[1].TerminateCause)
+	}
+}
+
+func TestWriter_JSONL(t *testing.T) {
+	data := writeAll(t, Options{Format: FormatJSONL})
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	var types []string
+	for {
+		var line struct {
+			Type   string         `json:"type"`
+			Record map[string]any `json:"record"`
+		}
+		if err := dec.Decode(&line); err == io.EOF {
+			break
+		} else {
+			require.NoError(t, err)
+		}
+		types = append(types, line.Type)
+	}
+	assert.Equal(t, []string{"start", "stop"}, types)
+}
+
+func TestRun(t *testing.T) {
+	_ = os.Setenv("RADIUS_SHARED_SECRET", "testing123")
+	_ = os.Setenv("STORAGE_BACKEND", "memory")
+	defer func() {
+		_ = os.Unsetenv("RADIUS_SHARED_SECRET")
+		_ = os.Unsetenv("STORAGE_BACKEND")
+	}()
+
+	cfg, err := config.LoadControlplane("", nil)
+	require.NoError(t, err)
+	store := storage.NewInMemoryStorage(cfg)
+	defer store.Close()
+
+	ctx := context.Background()
+	require.NoError(t, store.Store(ctx, testStart))
+	require.NoError(t, store.Store(ctx, testStop))
+
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, Options{Format: FormatCSV})
+	require.NoError(t, err)
+
+	n, err := Run(ctx, store, storage.Query{
+		From: time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC),
+		To:   time.Date(2024, 1, 16, 0, 0, 0, 0, time.UTC),
+	}, w)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	assert.Equal(t, 1, n)
+	lines, err := csv.NewReader(&buf).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, lines, 2)
+	assert.Equal(t, "stop", lines[1][0])
+}
+
+func TestPeriod(t *testing.T) {
+	now := time.Date(2024, 3, 10, 15, 0, 0, 0, time.UTC)
+
+	from, to, err := Period("month", now)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), from)
+	assert.Equal(t, time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), to)
+
+	from, to, err = Period("day", now)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 3, 9, 0, 0, 0, 0, time.UTC), from)
+	assert.Equal(t, time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC), to)
+
+	_, _, err = Period("week", now)
+	assert.EqualError(t, err, `unknown period "week", expected day or month`)
+}
+
+func TestFileName(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, "radius-accounting-20240101T000000Z-20240201T000000Z.csv.gz", FileName(from, to, Options{Format: FormatCSV, Gzip: true}))
+	assert.Equal(t, "radius-accounting-20240101T000000Z-20240201T000000Z.parquet", FileName(from, to, Options{Format: FormatParquet, Gzip: true}))
+}
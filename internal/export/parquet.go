@@ -0,0 +1,46 @@
+package export
+
+import (
+	"io"
+
+	"github.com/parquet-go/parquet-go"
+
+	"github.com/kal997/radius-accounting-server/internal/models"
+)
+
+// parquetRowGroupSize bounds the rows buffered in memory before a row group
+// is written
+const parquetRowGroupSize = 64 * 1024
+
+// parquetWriter writes rows of the Row schema, compressed with Snappy or,
+// when gzip is requested, with gzip
+type parquetWriter struct {
+	w    *parquet.GenericWriter[Row]
+	rows int
+}
+
+func newParquetWriter(w io.Writer, gzip bool) *parquetWriter {
+	var codec parquet.WriterOption = parquet.Compression(&parquet.Snappy)
+	if gzip {
+		codec = parquet.Compression(&parquet.Gzip)
+	}
+	return &parquetWriter{
+		w: parquet.NewGenericWriter[Row](w, codec, parquet.CreatedBy("radius-accounting-server", "", "")),
+	}
+}
+
+func (p *parquetWriter) Write(record models.AccountingEvent) error {
+	if _, err := p.w.Write([]Row{newRow(record)}); err != nil {
+		return err
+	}
+	p.rows++
+	if p.rows%parquetRowGroupSize == 0 {
+		return p.w.Flush()
+	}
+	return nil
+}
+
+// Close writes the last row group and the footer
+func (p *parquetWriter) Close() error {
+	return p.w.Close()
+}
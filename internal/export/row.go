@@ -0,0 +1,130 @@
+package export
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/kal997/radius-accounting-server/internal/models"
+	"github.com/kal997/radius-accounting-server/internal/storage"
+)
+
+// Row is the export schema: one column per record attribute, in this order.
+// Columns that do not apply to a record type are null in Parquet and empty
+// in CSV. The schema is stable; new columns are only ever appended.
+type Row struct {
+	RecordType       string    `parquet:"record_type"`
+	Key              string    `parquet:"key"`
+	EventTime        time.Time `parquet:"event_time,timestamp(microsecond)"`
+	Username         string    `parquet:"username"`
+	NASIPAddress     string    `parquet:"nas_ip_address"`
+	NASPort          int64     `parquet:"nas_port"`
+	AcctSessionID    string    `parquet:"acct_session_id"`
+	CallingStationID string    `parquet:"calling_station_id"`
+	CalledStationID  string    `parquet:"called_station_id"`
+	ClientIP         string    `parquet:"client_ip"`
+	FramedIPAddress  *string   `parquet:"framed_ip_address,optional"` // Start only
+	SessionTime      *int64    `parquet:"session_time,optional"`      // Interim and Stop
+	InputOctets      *int64    `parquet:"input_octets,optional"`      // Interim and Stop
+	OutputOctets     *int64    `parquet:"output_octets,optional"`     // Interim and Stop
+	TerminateCause   *string   `parquet:"terminate_cause,optional"`   // Stop only
+}
+
+// columns are the CSV header, matching the Parquet column names
+var columns = []string{
+	"record_type",
+	"key",
+	"event_time",
+	"username",
+	"nas_ip_address",
+	"nas_port",
+	"acct_session_id",
+	"calling_station_id",
+	"called_station_id",
+	"client_ip",
+	"framed_ip_address",
+	"session_time",
+	"input_octets",
+	"output_octets",
+	"terminate_cause",
+}
+
+// newRow converts a record. The event time is the record timestamp in UTC,
+// or zero when it cannot be parsed.
+func newRow(record models.AccountingEvent) Row {
+	row := Row{
+		RecordType: storage.RecordType(record),
+		Key:        record.GenerateRedisKey(),
+	}
+
+	switch r := record.(type) {
+	case *models.StartRecord:
+		row.FramedIPAddress = &r.FramedIPAddress
+	case *models.InterimRecord:
+		row.setUsage(r.SessionTime, r.InputOctets, r.OutputOctets)
+	case *models.StopRecord:
+		row.setUsage(r.SessionTime, r.InputOctets, r.OutputOctets)
+		row.TerminateCause = &r.TerminateCause
+	}
+
+	base := record.Base()
+
+	if t, err := time.Parse(time.RFC3339Nano, base.Timestamp); err == nil {
+		row.EventTime = t.UTC()
+	}
+	row.Username = base.Username
+	row.NASIPAddress = base.NASIPAddress
+	row.NASPort = int64(base.NASPort)
+	row.AcctSessionID = base.AcctSessionID
+	row.CallingStationID = base.CallingStationID
+	row.CalledStationID = base.CalledStationID
+	row.ClientIP = base.ClientIP
+	return row
+}
+
+// setUsage sets the counters; octet counts beyond int64 are clamped, which
+// no NAS reports in practice
+func (r *Row) setUsage(sessionTime int, inputOctets, outputOctets uint64) {
+	st := int64(sessionTime)
+	in := int64(min(inputOctets, 1<<63-1))
+	out := int64(min(outputOctets, 1<<63-1))
+	r.SessionTime, r.InputOctets, r.OutputOctets = &st, &in, &out
+}
+
+// strings returns the CSV fields of the row, in the order of columns
+func (r *Row) strings() []string {
+	eventTime := ""
+	if !r.EventTime.IsZero() {
+		eventTime = r.EventTime.Format(time.RFC3339Nano)
+	}
+	return []string{
+		r.RecordType,
+		r.Key,
+		eventTime,
+		r.Username,
+		r.NASIPAddress,
+		strconv.FormatInt(r.NASPort, 10),
+		r.AcctSessionID,
+		r.CallingStationID,
+		r.CalledStationID,
+		r.ClientIP,
+		optionalString(r.FramedIPAddress),
+		optionalInt(r.SessionTime),
+		optionalInt(r.InputOctets),
+		optionalInt(r.OutputOctets),
+		optionalString(r.TerminateCause),
+	}
+}
+
+func optionalString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func optionalInt(n *int64) string {
+	if n == nil {
+		return ""
+	}
+	return strconv.FormatInt(*n, 10)
+}
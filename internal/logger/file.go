@@ -47,6 +47,27 @@ func (fl *FileLogger) Log(ctx context.Context, message string) error {
 	return fl.file.Sync()
 }
 
+// Reopen switches logging to logfile, closing the current file.
+// It is used on configuration reload and after external log rotation.
+func (fl *FileLogger) Reopen(logfile string) error {
+	file, err := os.OpenFile(logfile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+
+	fl.mutex.Lock()
+	defer fl.mutex.Unlock()
+
+	if fl.closed {
+		_ = file.Close()
+		return fmt.Errorf("logger is closed")
+	}
+
+	old := fl.file
+	fl.file = file
+	return old.Close()
+}
+
 // Close closes the log file
 func (fl *FileLogger) Close() error {
 	fl.mutex.Lock()
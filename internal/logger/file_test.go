@@ -312,6 +312,40 @@ func TestFileLogger_CloseMultipleTimes(t *testing.T) {
 	assert.True(t, logger.closed)
 }
 
+func TestFileLogger_Reopen(t *testing.T) {
+	dir := t.TempDir()
+	firstFile := dir + "/first.log"
+	secondFile := dir + "/second.log"
+
+	logger, err := NewFileLogger(firstFile)
+	require.NoError(t, err)
+	defer func() {
+		_ = logger.Close()
+	}()
+
+	require.NoError(t, logger.Log(context.Background(), "before reopen"))
+	require.NoError(t, logger.Reopen(secondFile))
+	require.NoError(t, logger.Log(context.Background(), "after reopen"))
+
+	first, err := os.ReadFile(firstFile)
+	require.NoError(t, err)
+	assert.Contains(t, string(first), "before reopen")
+	assert.NotContains(t, string(first), "after reopen")
+
+	second, err := os.ReadFile(secondFile)
+	require.NoError(t, err)
+	assert.Contains(t, string(second), "after reopen")
+
+	// Invalid path keeps the current file
+	err = logger.Reopen(dir + "/missing/dir/third.log")
+	assert.ErrorContains(t, err, "failed to open log file")
+	assert.NoError(t, logger.Log(context.Background(), "still writing"))
+
+	// Reopen after close fails
+	require.NoError(t, logger.Close())
+	assert.ErrorContains(t, logger.Reopen(secondFile), "logger is closed")
+}
+
 func TestFileLogger_WriteError(t *testing.T) {
 	// This test simulates a write error by closing the file descriptor
 	// before attempting to write
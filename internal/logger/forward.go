@@ -0,0 +1,47 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/kal997/radius-accounting-server/internal/notifier"
+)
+
+// Forward logs every storage event to l until ctx is done or events is
+// closed. onGap, if not nil, is called after a notification gap is logged,
+// e.g. to check that Redis still publishes notifications. debug reports
+// whether logged events are also printed.
+func Forward(ctx context.Context, events <-chan notifier.StorageEvent, l Logger, onGap func(ctx context.Context), debug func() bool) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-events:
+			if !ok {
+				log.Println("Event channel closed")
+				return
+			}
+
+			// The notifier reconnected; Redis may also have restarted without notifications
+			if event.Operation == notifier.OperationGap {
+				log.Println("Reconnected to Redis, notifications may have been missed")
+				if err := l.Log(ctx, "Notification gap: reconnected to Redis, updates may have been missed"); err != nil {
+					log.Printf("Failed to log event: %v", err)
+				}
+				if onGap != nil {
+					onGap(ctx)
+				}
+				continue
+			}
+
+			// Log all operations
+			message := fmt.Sprintf("Received update for key: %s, Operation: %s", event.Key, event.Operation)
+			if err := l.Log(ctx, message); err != nil {
+				log.Printf("Failed to log event: %v", err)
+			} else if debug != nil && debug() {
+				log.Printf("Logged: %s", message)
+			}
+		}
+	}
+}
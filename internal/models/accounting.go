@@ -24,6 +24,7 @@ type AccountingEvent interface {
 	Validate() error
 	GenerateRedisKey() string
 	GetType() AccRecordType
+	Base() *BaseAccountingRecord
 }
 
 // ======================= BASE STRUCT =====================
@@ -124,6 +125,10 @@ func (r *InterimRecord) Validate() error {
 	return nil
 }
 
+// ======================= BASE =============================
+// Base returns the attributes shared by every record type
+func (b *BaseAccountingRecord) Base() *BaseAccountingRecord { return b }
+
 // ======================= GET TYPE =========================
 func (r *StartRecord) GetType() AccRecordType   { return Start }
 func (r *StopRecord) GetType() AccRecordType    { return Stop }
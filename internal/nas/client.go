@@ -0,0 +1,150 @@
+package nas
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"layeh.com/radius"
+
+	"github.com/kal997/radius-accounting-server/internal/stream"
+)
+
+// ErrTimeout is returned when a request is not answered after every
+// retransmission
+var ErrTimeout = errors.New("no response from server")
+
+// Client sends RADIUS requests from one UDP socket, one at a time,
+// retransmitting unanswered requests unchanged as RFC 5080 recommends. Over
+// TCP, requests are never retransmitted, as RFC 6613 requires.
+type Client struct {
+	conn    net.Conn
+	stream  *bufio.Reader // Reads the responses of a TCP connection, nil over UDP
+	secret  []byte
+	timeout time.Duration // Wait for a response before retransmitting
+	retries int           // Retransmissions after the first attempt
+	id      uint8         // Identifier of the next request
+	buf     []byte
+}
+
+// Exchange describes an answered request
+type Exchange struct {
+	Response *radius.Packet
+	Attempts int           // Transmissions, 1 when the first one was answered
+	Latency  time.Duration // From the first transmission to the response
+}
+
+// Dial creates a client of the server at addr
+func Dial(addr string, secret []byte, timeout time.Duration, retries int) (*Client, error) {
+	raddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.DialUDP("udp", nil, raddr)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{
+		conn:    conn,
+		secret:  secret,
+		timeout: timeout,
+		retries: retries,
+		buf:     make([]byte, radius.MaxPacketLength),
+	}, nil
+}
+
+// DialTCP creates a client of the server at addr sending requests on one
+// TCP connection (RFC 6613)
+func DialTCP(addr string, secret []byte, timeout time.Duration) (*Client, error) {
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{
+		conn:    conn,
+		stream:  bufio.NewReader(conn),
+		secret:  secret,
+		timeout: timeout,
+	}, nil
+}
+
+// LocalAddr returns the address requests are sent from
+func (c *Client) LocalAddr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+// Close closes the socket
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Send sends packet with the next identifier and waits for its response.
+// Responses to other identifiers, late answers to earlier requests, and
+// responses with an invalid authenticator are ignored. The exchange is
+// returned with ErrTimeout when the request was lost, to count attempts.
+func (c *Client) Send(ctx context.Context, packet *radius.Packet) (Exchange, error) {
+	packet.Identifier = c.id
+	packet.Secret = c.secret
+	c.id++
+
+	request, err := packet.Encode()
+	if err != nil {
+		return Exchange{}, fmt.Errorf("failed to encode request: %w", err)
+	}
+
+	var exchange Exchange
+	first := time.Now()
+	for exchange.Attempts <= c.retries {
+		if err := ctx.Err(); err != nil {
+			return exchange, err
+		}
+		if _, err := c.conn.Write(request); err != nil {
+			return exchange, fmt.Errorf("failed to send request: %w", err)
+		}
+		exchange.Attempts++
+
+		deadline := time.Now().Add(c.timeout)
+		if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+			deadline = d
+		}
+		if err := c.conn.SetReadDeadline(deadline); err != nil {
+			return exchange, err
+		}
+		for {
+			response, err := c.read()
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				break
+			}
+			if err != nil {
+				return exchange, fmt.Errorf("failed to read response: %w", err)
+			}
+			if len(response) < 20 || response[1] != packet.Identifier || !radius.IsAuthenticResponse(response, request, c.secret) {
+				continue
+			}
+			exchange.Latency = time.Since(first)
+			exchange.Response, err = radius.Parse(append([]byte(nil), response...), c.secret)
+			if err != nil {
+				return exchange, fmt.Errorf("invalid response: %w", err)
+			}
+			return exchange, nil
+		}
+	}
+	return exchange, ErrTimeout
+}
+
+// read returns the next datagram, or the next packet of the TCP connection
+// framed by its Length field
+func (c *Client) read() ([]byte, error) {
+	if c.stream != nil {
+		return stream.ReadPacket(c.stream)
+	}
+	n, err := c.conn.Read(c.buf)
+	if err != nil {
+		return nil, err
+	}
+	return c.buf[:n], nil
+}
@@ -0,0 +1,159 @@
+package nas
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"layeh.com/radius"
+	"layeh.com/radius/rfc2866"
+	"layeh.com/radius/rfc2869"
+
+	"github.com/kal997/radius-accounting-server/internal/models"
+	"github.com/kal997/radius-accounting-server/internal/stream"
+)
+
+var secret = []byte("testing123")
+
+// serve answers accounting requests on a loopback socket, dropping the
+// first drop requests
+func serve(t *testing.T, drop int32) (addr string, received *atomic.Int32) {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	received = &atomic.Int32{}
+	server := &radius.PacketServer{
+		SecretSource: radius.StaticSecretSource(secret),
+		Handler: radius.HandlerFunc(func(w radius.ResponseWriter, r *radius.Request) {
+			if received.Add(1) <= drop {
+				return
+			}
+			_ = w.Write(r.Response(radius.CodeAccountingResponse))
+		}),
+	}
+	go func() { _ = server.Serve(conn) }()
+	t.Cleanup(func() { _ = server.Shutdown(context.Background()) })
+	return conn.LocalAddr().String(), received
+}
+
+func TestClient_Send(t *testing.T) {
+	addr, received := serve(t, 1)
+	client, err := Dial(addr, secret, 100*time.Millisecond, 2)
+	require.NoError(t, err)
+	defer client.Close()
+
+	session := NewSession(rand.New(rand.NewSource(1)), "test", 0, 1)
+
+	// The first transmission is dropped and answered when retransmitted
+	exchange, err := client.Send(context.Background(), session.Start(time.Now(), secret))
+	require.NoError(t, err)
+	assert.Equal(t, 2, exchange.Attempts)
+	assert.Equal(t, radius.CodeAccountingResponse, exchange.Response.Code)
+	assert.GreaterOrEqual(t, exchange.Latency, 100*time.Millisecond)
+
+	exchange, err = client.Send(context.Background(), session.Interim(time.Now(), secret))
+	require.NoError(t, err)
+	assert.Equal(t, 1, exchange.Attempts)
+	assert.Equal(t, int32(3), received.Load())
+}
+
+func TestClient_SendTimeout(t *testing.T) {
+	addr, received := serve(t, 100)
+	client, err := Dial(addr, secret, 20*time.Millisecond, 2)
+	require.NoError(t, err)
+	defer client.Close()
+
+	session := NewSession(rand.New(rand.NewSource(1)), "test", 0, 1)
+	exchange, err := client.Send(context.Background(), session.Start(time.Now(), secret))
+	assert.ErrorIs(t, err, ErrTimeout)
+	assert.Equal(t, 3, exchange.Attempts)
+	assert.Equal(t, int32(3), received.Load())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = client.Send(ctx, session.Start(time.Now(), secret))
+	assert.True(t, errors.Is(err, context.Canceled))
+}
+
+func TestClient_SendTCP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	received := &atomic.Int32{}
+	server := &stream.Server{
+		SecretSource: radius.StaticSecretSource(secret),
+		Handler: radius.HandlerFunc(func(w radius.ResponseWriter, r *radius.Request) {
+			// The second request is not answered
+			if received.Add(1) == 2 {
+				return
+			}
+			_ = w.Write(r.Response(radius.CodeAccountingResponse))
+		}),
+	}
+	go func() { _ = server.Serve(l) }()
+	defer server.Shutdown(context.Background())
+
+	client, err := DialTCP(l.Addr().String(), secret, 200*time.Millisecond)
+	require.NoError(t, err)
+	defer client.Close()
+
+	session := NewSession(rand.New(rand.NewSource(1)), "test", 0, 1)
+	exchange, err := client.Send(context.Background(), session.Start(time.Now(), secret))
+	require.NoError(t, err)
+	assert.Equal(t, radius.CodeAccountingResponse, exchange.Response.Code)
+
+	// Requests are not retransmitted over TCP
+	exchange, err = client.Send(context.Background(), session.Interim(time.Now(), secret))
+	assert.ErrorIs(t, err, ErrTimeout)
+	assert.Equal(t, 1, exchange.Attempts)
+
+	_, err = client.Send(context.Background(), session.Stop(time.Now(), rfc2866.AcctTerminateCause_Value_UserRequest, secret))
+	require.NoError(t, err)
+	assert.Equal(t, int32(3), received.Load())
+}
+
+func TestSession(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	session := NewSession(rng, "run1", 1001, 10)
+	assert.Equal(t, "load-user-1001", session.Username)
+	assert.Equal(t, "run1-1001", session.ID)
+	assert.Equal(t, "198.18.0.2", session.NASIPAddress.String())
+	assert.Equal(t, uint32(100), session.NASPort)
+	assert.Equal(t, "100.64.3.234", session.FramedIPAddress.String())
+	assert.Equal(t, "02-00-00-00-03-E9", session.CallingStationID)
+
+	start := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	event, err := models.ParseRADIUSPacket(session.Start(start, secret), "192.0.2.1")
+	require.NoError(t, err)
+	require.NoError(t, event.Validate())
+	assert.Equal(t, "100.64.3.234", event.(*models.StartRecord).FramedIPAddress)
+
+	// Counters only grow; the session time is at least a second
+	event, err = models.ParseRADIUSPacket(session.Interim(start.Add(100*time.Millisecond), secret), "192.0.2.1")
+	require.NoError(t, err)
+	require.NoError(t, event.Validate())
+	assert.Equal(t, 1, event.(*models.InterimRecord).SessionTime)
+
+	previous := session.OutputOctets
+	packet := session.Stop(start.Add(time.Hour), rfc2866.AcctTerminateCause_Value_UserRequest, secret)
+	assert.Greater(t, session.OutputOctets, previous)
+	assert.Greater(t, session.OutputOctets, session.InputOctets)
+
+	// With this seed, an hour of traffic overflows the 32-bit counter
+	require.Greater(t, session.OutputOctets, uint64(1)<<32)
+	assert.Equal(t, rfc2869.AcctOutputGigawords(session.OutputOctets>>32), rfc2869.AcctOutputGigawords_Get(packet))
+
+	event, err = models.ParseRADIUSPacket(packet, "192.0.2.1")
+	require.NoError(t, err)
+	require.NoError(t, event.Validate())
+	stop := event.(*models.StopRecord)
+	assert.Equal(t, 3600, stop.SessionTime)
+	assert.Equal(t, "1", stop.TerminateCause)
+	assert.Equal(t, uint64(uint32(session.InputOctets)), stop.InputOctets)
+}
@@ -0,0 +1,147 @@
+// Package nas simulates Network Access Servers: user sessions whose
+// accounting requests carry realistic, growing counters, and a client that
+// sends them with retransmissions the way a NAS does.
+package nas
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"net"
+	"time"
+
+	"layeh.com/radius"
+	"layeh.com/radius/rfc2865"
+	"layeh.com/radius/rfc2866"
+	"layeh.com/radius/rfc2869"
+)
+
+// Simulated addresses come from the benchmarking (RFC 2544) and shared
+// address space (RFC 6598) ranges, so that they never clash with real ones
+var (
+	nasNetwork    = net.IPv4(198, 18, 0, 0).To4()
+	framedNetwork = net.IPv4(100, 64, 0, 0).To4()
+)
+
+// averagePacketSize converts octet counters to packet counters
+const averagePacketSize = 900
+
+// Session is the accounting state of one simulated user session. It is not
+// safe for concurrent use.
+type Session struct {
+	Username         string
+	ID               string // Acct-Session-Id
+	NASIPAddress     net.IP
+	NASPort          uint32
+	CallingStationID string
+	CalledStationID  string
+	FramedIPAddress  net.IP
+
+	// Counters reported by the last request
+	SessionTime   uint32 // Seconds
+	InputOctets   uint64
+	OutputOctets  uint64
+	InputPackets  uint32
+	OutputPackets uint32
+
+	rng        *rand.Rand
+	started    time.Time
+	updated    time.Time
+	inputRate  float64 // Mean bytes per second uploaded by the user
+	outputRate float64 // Mean bytes per second downloaded by the user
+}
+
+// NewSession creates session n of a simulated population spread over nasCount
+// NAS. prefix makes the session IDs of a run unique. rng draws the traffic
+// rates and their jitter.
+func NewSession(rng *rand.Rand, prefix string, n, nasCount int) *Session {
+	nas := n % max(nasCount, 1)
+	mac := make([]byte, 6)
+	mac[0] = 0x02 // Locally administered
+	binary.BigEndian.PutUint32(mac[2:], uint32(n))
+
+	// Downloads between 10 kB/s and 2 MB/s, uploads a tenth to a half
+	output := 10e3 + rng.Float64()*2e6
+	return &Session{
+		Username:         fmt.Sprintf("load-user-%d", n),
+		ID:               fmt.Sprintf("%s-%d", prefix, n),
+		NASIPAddress:     addIP(nasNetwork, uint32(nas+1)),
+		NASPort:          uint32(n / max(nasCount, 1)),
+		CallingStationID: fmt.Sprintf("%02X-%02X-%02X-%02X-%02X-%02X", mac[0], mac[1], mac[2], mac[3], mac[4], mac[5]),
+		CalledStationID:  fmt.Sprintf("nas-%d", nas+1),
+		FramedIPAddress:  addIP(framedNetwork, uint32(n+1)),
+		rng:              rng,
+		inputRate:        output * (0.1 + rng.Float64()*0.4),
+		outputRate:       output,
+	}
+}
+
+// Start returns the Accounting-Request starting the session at now
+func (s *Session) Start(now time.Time, secret []byte) *radius.Packet {
+	s.started, s.updated = now, now
+	return s.request(rfc2866.AcctStatusType_Value_Start, secret)
+}
+
+// Interim returns the Interim-Update reporting the counters at now
+func (s *Session) Interim(now time.Time, secret []byte) *radius.Packet {
+	s.advance(now)
+	return s.request(rfc2866.AcctStatusType_Value_InterimUpdate, secret)
+}
+
+// Stop returns the Accounting-Request ending the session at now
+func (s *Session) Stop(now time.Time, cause rfc2866.AcctTerminateCause, secret []byte) *radius.Packet {
+	s.advance(now)
+	packet := s.request(rfc2866.AcctStatusType_Value_Stop, secret)
+	_ = rfc2866.AcctTerminateCause_Set(packet, cause)
+	return packet
+}
+
+// advance grows the counters by the traffic since the last request, with
+// jitter. The session time is at least one second, as servers reject updates
+// without one.
+func (s *Session) advance(now time.Time) {
+	elapsed := now.Sub(s.updated).Seconds()
+	if elapsed > 0 {
+		s.InputOctets += uint64(s.inputRate * elapsed * (0.5 + s.rng.Float64()))
+		s.OutputOctets += uint64(s.outputRate * elapsed * (0.5 + s.rng.Float64()))
+		s.InputPackets = uint32(s.InputOctets / averagePacketSize)
+		s.OutputPackets = uint32(s.OutputOctets / averagePacketSize)
+		s.updated = now
+	}
+	s.SessionTime = max(uint32(now.Sub(s.started).Round(time.Second)/time.Second), 1)
+}
+
+// request builds an Accounting-Request with the attributes of the session
+// and, after the start, its counters
+func (s *Session) request(status rfc2866.AcctStatusType, secret []byte) *radius.Packet {
+	packet := radius.New(radius.CodeAccountingRequest, secret)
+	_ = rfc2866.AcctStatusType_Set(packet, status)
+	_ = rfc2865.UserName_SetString(packet, s.Username)
+	_ = rfc2866.AcctSessionID_SetString(packet, s.ID)
+	_ = rfc2865.NASIPAddress_Set(packet, s.NASIPAddress)
+	_ = rfc2865.NASPort_Set(packet, rfc2865.NASPort(s.NASPort))
+	_ = rfc2865.NASPortType_Set(packet, rfc2865.NASPortType_Value_Virtual)
+	_ = rfc2865.CallingStationID_SetString(packet, s.CallingStationID)
+	_ = rfc2865.CalledStationID_SetString(packet, s.CalledStationID)
+	_ = rfc2865.FramedIPAddress_Set(packet, s.FramedIPAddress)
+	_ = rfc2866.AcctAuthentic_Set(packet, rfc2866.AcctAuthentic_Value_RADIUS)
+	_ = rfc2869.EventTimestamp_Set(packet, s.updated)
+
+	if status != rfc2866.AcctStatusType_Value_Start {
+		_ = rfc2866.AcctSessionTime_Set(packet, rfc2866.AcctSessionTime(s.SessionTime))
+		_ = rfc2866.AcctInputOctets_Set(packet, rfc2866.AcctInputOctets(uint32(s.InputOctets)))
+		_ = rfc2869.AcctInputGigawords_Set(packet, rfc2869.AcctInputGigawords(s.InputOctets>>32))
+		_ = rfc2866.AcctOutputOctets_Set(packet, rfc2866.AcctOutputOctets(uint32(s.OutputOctets)))
+		_ = rfc2869.AcctOutputGigawords_Set(packet, rfc2869.AcctOutputGigawords(s.OutputOctets>>32))
+		_ = rfc2866.AcctInputPackets_Set(packet, rfc2866.AcctInputPackets(s.InputPackets))
+		_ = rfc2866.AcctOutputPackets_Set(packet, rfc2866.AcctOutputPackets(s.OutputPackets))
+	}
+	return packet
+}
+
+// addIP returns the IPv4 address n addresses after base
+func addIP(base net.IP, n uint32) net.IP {
+	ip := make(net.IP, 4)
+	binary.BigEndian.PutUint32(ip, binary.BigEndian.Uint32(base)+n)
+	return ip
+}
@@ -0,0 +1,103 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestCluster returns a cluster client whose slots are split between two
+// miniredis primaries
+func newTestCluster(t *testing.T) (*redis.ClusterClient, *miniredis.Miniredis, *miniredis.Miniredis) {
+	t.Helper()
+	first, err := miniredis.Run()
+	require.NoError(t, err)
+	t.Cleanup(first.Close)
+	second, err := miniredis.Run()
+	require.NoError(t, err)
+	t.Cleanup(second.Close)
+
+	client := redis.NewClusterClient(&redis.ClusterOptions{
+		ClusterSlots: func(ctx context.Context) ([]redis.ClusterSlot, error) {
+			return []redis.ClusterSlot{
+				{Start: 0, End: 8191, Nodes: []redis.ClusterNode{{Addr: first.Addr()}}},
+				{Start: 8192, End: 16383, Nodes: []redis.ClusterNode{{Addr: second.Addr()}}},
+			}, nil
+		},
+	})
+
+	return client, first, second
+}
+
+func TestRedisNotifier_ClusterSubscribesEveryPrimary(t *testing.T) {
+	client, first, second := newTestCluster(t)
+
+	notifier, err := newRedisNotifier(client, nil)
+	require.NoError(t, err)
+	defer func() {
+		_ = notifier.Close()
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, err := notifier.Subscribe(ctx, []string{"radius:acct:*"})
+	require.NoError(t, err)
+	assert.Len(t, notifier.pubsubs, 2)
+
+	require.Eventually(t, func() bool {
+		return first.PubSubNumPat() == 1 && second.PubSubNumPat() == 1
+	}, time.Second, 10*time.Millisecond)
+
+	// Each primary only publishes notifications for its own keys
+	first.Publish("__keyspace@0__:radius:acct:first", "set")
+	second.Publish("__keyspace@0__:radius:acct:second", "expired")
+
+	received := map[string]string{}
+	for len(received) < 2 {
+		select {
+		case event := <-events:
+			received[event.Key] = event.Operation
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for events, got %v", received)
+		}
+	}
+	assert.Equal(t, map[string]string{"radius:acct:first": "set", "radius:acct:second": "expired"}, received)
+}
+
+func TestRedisNotifier_ClusterEnsureNotifications(t *testing.T) {
+	client, first, second := newTestCluster(t)
+
+	firstConfig := &fakeConfig{events: "KEA"}
+	firstConfig.register(t, first)
+	secondConfig := &fakeConfig{events: ""}
+	secondConfig.register(t, second)
+
+	notifier, err := newRedisNotifier(client, nil)
+	require.NoError(t, err)
+	defer func() {
+		_ = notifier.Close()
+	}()
+
+	err = notifier.EnsureNotifications(context.Background())
+
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrNotificationsDisabled))
+	assert.Contains(t, err.Error(), ":"+second.Port())
+
+	// With configure_events every primary is fixed
+	notifier.configureEvents = true
+	require.NoError(t, notifier.EnsureNotifications(context.Background()))
+
+	flags, sets := secondConfig.get()
+	assert.Equal(t, "Kg$x", flags)
+	assert.Equal(t, 1, sets)
+	_, sets = firstConfig.get()
+	assert.Zero(t, sets)
+}
@@ -0,0 +1,142 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrNotificationsDisabled is returned when Redis is not configured to publish
+// the keyspace notifications the notifier subscribes to
+var ErrNotificationsDisabled = errors.New("keyspace notifications are not enabled")
+
+const notifyKeyspaceEvents = "notify-keyspace-events"
+
+// allEventClasses is what the "A" flag of notify-keyspace-events stands for
+const allEventClasses = "g$lshzxetd"
+
+// eventClasses maps keyevent operations to the notify-keyspace-events class
+// that publishes them. Operations not listed require every class ("A").
+var eventClasses = map[string]byte{
+	"del": 'g', "expire": 'g', "rename_from": 'g', "rename_to": 'g', "persist": 'g',
+	"copy_to": 'g', "move_from": 'g', "move_to": 'g', "restore": 'g',
+	"set": '$', "setrange": '$', "incrby": '$', "incrbyfloat": '$', "append": '$',
+	"hset": 'h', "hdel": 'h', "hincrby": 'h', "hincrbyfloat": 'h',
+	"lpush": 'l', "rpush": 'l', "lpop": 'l', "rpop": 'l', "linsert": 'l', "lset": 'l', "lrem": 'l', "ltrim": 'l',
+	"sadd": 's', "srem": 's', "spop": 's',
+	"zadd": 'z', "zincr": 'z', "zrem": 'z', "zrembyscore": 'z', "zrembyrank": 'z',
+	"xadd": 't', "xdel": 't', "xtrim": 't',
+	"expired": 'x',
+	"evicted": 'e',
+	"new":     'n',
+}
+
+// requiredEventFlags returns the notify-keyspace-events flags needed for
+// the notifier's subscriptions: K (keyspace) with the classes covering
+// record writes and expiry, or E (keyevent) with the classes of the
+// configured operations
+func (rn *RedisNotifier) requiredEventFlags() string {
+	if len(rn.keyEvents) == 0 {
+		return "Kg$x"
+	}
+
+	flags := "E"
+	for _, event := range rn.keyEvents {
+		class, ok := eventClasses[event]
+		if !ok {
+			return "E" + allEventClasses
+		}
+		if !strings.ContainsRune(flags, rune(class)) {
+			flags += string(class)
+		}
+	}
+	return flags
+}
+
+// missingEventFlags returns the flags of required that current does not enable
+func missingEventFlags(current, required string) string {
+	if strings.Contains(current, "A") {
+		current += allEventClasses
+	}
+
+	var missing strings.Builder
+	for _, flag := range required {
+		if !strings.ContainsRune(current, flag) {
+			missing.WriteRune(flag)
+		}
+	}
+	return missing.String()
+}
+
+// EnsureNotifications checks with CONFIG GET that Redis publishes the
+// notifications the notifier relies on. Missing flags are added with
+// CONFIG SET when notifier.configure_events is enabled; otherwise an error
+// wrapping ErrNotificationsDisabled is returned. Other errors mean the
+// setting could not be read or changed (e.g. CONFIG is disabled).
+// In Cluster mode every primary is checked.
+func (rn *RedisNotifier) EnsureNotifications(ctx context.Context) error {
+	nodes, err := rn.nodes(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, node := range nodes {
+		if err := rn.ensureNodeNotifications(ctx, node); err != nil {
+			if c, ok := node.(*redis.Client); ok && len(nodes) > 1 {
+				return fmt.Errorf("%s: %w", c.Options().Addr, err)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// ensureNodeNotifications checks and optionally fixes the setting of one node
+func (rn *RedisNotifier) ensureNodeNotifications(ctx context.Context, node redis.UniversalClient) error {
+	values, err := node.ConfigGet(ctx, notifyKeyspaceEvents).Result()
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", notifyKeyspaceEvents, err)
+	}
+
+	current := values[notifyKeyspaceEvents]
+	missing := missingEventFlags(current, rn.requiredEventFlags())
+	if missing == "" {
+		return nil
+	}
+
+	if !rn.configureEvents {
+		return fmt.Errorf("%w: %s is %q, missing %q", ErrNotificationsDisabled, notifyKeyspaceEvents, current, missing)
+	}
+
+	if err := node.ConfigSet(ctx, notifyKeyspaceEvents, current+missing).Err(); err != nil {
+		return fmt.Errorf("failed to enable keyspace notifications: %w", err)
+	}
+
+	return nil
+}
+
+// WatchNotifications re-runs EnsureNotifications every interval until ctx is
+// done, so a Redis restart with the default configuration is detected.
+// Failed checks are passed to onError.
+func (rn *RedisNotifier) WatchNotifications(ctx context.Context, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			checkCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+			err := rn.EnsureNotifications(checkCtx)
+			cancel()
+			if err != nil && ctx.Err() == nil {
+				onError(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/alicebob/miniredis/v2/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeConfig adds CONFIG GET/SET for notify-keyspace-events to miniredis,
+// which does not implement the CONFIG command
+type fakeConfig struct {
+	mu      sync.Mutex
+	events  string
+	sets    int
+	denySet bool
+}
+
+func (f *fakeConfig) register(t *testing.T, mr *miniredis.Miniredis) {
+	t.Helper()
+	require.NoError(t, mr.Server().Register("CONFIG", func(c *server.Peer, cmd string, args []string) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+
+		switch {
+		case len(args) == 2 && strings.EqualFold(args[0], "GET"):
+			c.WriteMapLen(1)
+			c.WriteBulk(notifyKeyspaceEvents)
+			c.WriteBulk(f.events)
+		case len(args) == 3 && strings.EqualFold(args[0], "SET"):
+			if f.denySet {
+				c.WriteError("ERR CONFIG SET is disabled")
+				return
+			}
+			f.events = args[2]
+			f.sets++
+			c.WriteOK()
+		default:
+			c.WriteError("ERR unsupported CONFIG subcommand")
+		}
+	}))
+}
+
+func (f *fakeConfig) get() (string, int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.events, f.sets
+}
+
+func (f *fakeConfig) set(events string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.events = events
+}
+
+func TestRedisNotifier_requiredEventFlags(t *testing.T) {
+	tests := []struct {
+		name      string
+		keyEvents []string
+		want      string
+	}{
+		{name: "keyspace channels", want: "Kg$x"},
+		{name: "set and expired", keyEvents: []string{"set", "expired"}, want: "E$x"},
+		{name: "duplicate classes", keyEvents: []string{"set", "append", "del"}, want: "E$g"},
+		{name: "unknown operation", keyEvents: []string{"set", "custom"}, want: "E" + allEventClasses},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rn := &RedisNotifier{keyEvents: tt.keyEvents}
+			assert.Equal(t, tt.want, rn.requiredEventFlags())
+		})
+	}
+}
+
+func TestMissingEventFlags(t *testing.T) {
+	tests := []struct {
+		current  string
+		required string
+		want     string
+	}{
+		{current: "", required: "Kg$x", want: "Kg$x"},
+		{current: "KEA", required: "Kg$x", want: ""},
+		{current: "Ex", required: "E$x", want: "$"},
+		{current: "AK", required: "E$x", want: "E"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.current+"/"+tt.required, func(t *testing.T) {
+			assert.Equal(t, tt.want, missingEventFlags(tt.current, tt.required))
+		})
+	}
+}
+
+func TestRedisNotifier_EnsureNotifications(t *testing.T) {
+	tests := []struct {
+		name      string
+		current   string
+		configure bool
+		denySet   bool
+		wantErr   string
+		wantFlags string
+		disabled  bool
+	}{
+		{
+			name:      "already enabled",
+			current:   "KEA",
+			wantFlags: "KEA",
+		},
+		{
+			name:     "disabled",
+			current:  "",
+			wantErr:  `keyspace notifications are not enabled: notify-keyspace-events is "", missing "Kg$x"`,
+			disabled: true,
+		},
+		{
+			name:      "disabled and configured",
+			current:   "Ex",
+			configure: true,
+			wantFlags: "ExKg$",
+		},
+		{
+			name:      "configure refused",
+			current:   "",
+			configure: true,
+			denySet:   true,
+			wantErr:   "failed to enable keyspace notifications",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mr, err := miniredis.Run()
+			require.NoError(t, err)
+			defer mr.Close()
+
+			cfg := &fakeConfig{events: tt.current, denySet: tt.denySet}
+			cfg.register(t, mr)
+
+			notifier, err := NewRedisNotifier(mr.Addr())
+			require.NoError(t, err)
+			defer func() {
+				_ = notifier.Close()
+			}()
+			notifier.configureEvents = tt.configure
+
+			err = notifier.EnsureNotifications(context.Background())
+
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				assert.Equal(t, tt.disabled, errors.Is(err, ErrNotificationsDisabled))
+				return
+			}
+			require.NoError(t, err)
+			flags, _ := cfg.get()
+			assert.Equal(t, tt.wantFlags, flags)
+		})
+	}
+}
+
+func TestRedisNotifier_EnsureNotifications_ConfigUnavailable(t *testing.T) {
+	mr, err := miniredis.Run()
+	require.NoError(t, err)
+	defer mr.Close()
+
+	notifier, err := NewRedisNotifier(mr.Addr())
+	require.NoError(t, err)
+	defer func() {
+		_ = notifier.Close()
+	}()
+
+	// miniredis has no CONFIG command, like managed Redis services that disable it
+	err = notifier.EnsureNotifications(context.Background())
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to read notify-keyspace-events")
+	assert.False(t, errors.Is(err, ErrNotificationsDisabled))
+}
+
+func TestRedisNotifier_WatchNotifications(t *testing.T) {
+	mr, err := miniredis.Run()
+	require.NoError(t, err)
+	defer mr.Close()
+
+	cfg := &fakeConfig{events: "KEA"}
+	cfg.register(t, mr)
+
+	notifier, err := NewRedisNotifier(mr.Addr())
+	require.NoError(t, err)
+	defer func() {
+		_ = notifier.Close()
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	errs := make(chan error, 10)
+	go notifier.WatchNotifications(ctx, 10*time.Millisecond, func(err error) {
+		errs <- err
+	})
+
+	// Simulate a Redis restart with the default configuration
+	cfg.set("")
+
+	select {
+	case err := <-errs:
+		assert.True(t, errors.Is(err, ErrNotificationsDisabled))
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the periodic check to fail")
+	}
+}
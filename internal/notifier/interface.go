@@ -12,6 +12,10 @@ type Notifier interface {
 	Close() error
 }
 
+// OperationGap is the Operation of a synthetic event emitted after the
+// notifier reconnected; events may have been missed while it was down
+const OperationGap = "gap"
+
 type StorageEvent struct {
 	Key       string
 	Operation string
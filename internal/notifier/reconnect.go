@@ -0,0 +1,181 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// receiveResult is a message or error read from a pub/sub connection
+type receiveResult struct {
+	msg interface{}
+	err error
+}
+
+// run delivers the notifications received on pubsubs to eventChan until ctx
+// is done or the notifier is closed. When a connection is lost it
+// resubscribes to the stored patterns and emits an OperationGap event.
+func (rn *RedisNotifier) run(ctx context.Context, pubsubs []*redis.PubSub, eventChan chan<- StorageEvent) {
+	defer close(eventChan)
+
+	for {
+		err := rn.receive(ctx, pubsubs, eventChan)
+		if err == nil || errors.Is(err, redis.ErrClosed) {
+			return
+		}
+
+		// Resubscribe every node, in a cluster the set of primaries may have changed
+		rn.setLost(err)
+		closePubSubs(pubsubs)
+
+		if pubsubs = rn.resubscribe(ctx); pubsubs == nil {
+			return
+		}
+
+		gap := StorageEvent{Operation: OperationGap, Timestamp: time.Now()}
+		select {
+		case eventChan <- gap:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// receive forwards the messages of pubsubs to eventChan. It returns nil when
+// ctx is done and the first read error otherwise.
+func (rn *RedisNotifier) receive(ctx context.Context, pubsubs []*redis.PubSub, eventChan chan<- StorageEvent) error {
+	results := make(chan receiveResult)
+	stop := make(chan struct{})
+	defer close(stop)
+
+	for _, ps := range pubsubs {
+		go rn.read(ps, results, stop)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case result := <-results:
+			if result.err != nil {
+				return result.err
+			}
+
+			msg, ok := result.msg.(*redis.Message)
+			if !ok {
+				continue // Subscription confirmations and pongs
+			}
+
+			event := rn.parseMessage(msg)
+			if event != nil {
+				select {
+				case eventChan <- *event:
+				case <-ctx.Done():
+					return nil
+				}
+			}
+		}
+	}
+}
+
+// read reads from ps until an error occurs or stop is closed. An idle
+// connection is pinged; if the ping gets no reply before the next read
+// times out the connection is considered lost, which catches half-open
+// TCP connections that would otherwise block forever.
+func (rn *RedisNotifier) read(ps *redis.PubSub, results chan<- receiveResult, stop <-chan struct{}) {
+	ctx := context.Background()
+	pinged := false
+
+	for {
+		var result receiveResult
+		if rn.pingInterval > 0 {
+			result.msg, result.err = ps.ReceiveTimeout(ctx, rn.pingInterval)
+		} else {
+			result.msg, result.err = ps.Receive(ctx)
+		}
+
+		if isTimeout(result.err) {
+			if !pinged {
+				if result.err = ps.Ping(ctx); result.err == nil {
+					pinged = true
+					continue
+				}
+			} else {
+				result.err = fmt.Errorf("no reply to ping: %w", result.err)
+			}
+		} else if result.err == nil {
+			pinged = false
+		}
+
+		select {
+		case results <- result:
+		case <-stop:
+			return
+		}
+
+		if result.err != nil {
+			return
+		}
+	}
+}
+
+// resubscribe opens new subscriptions to the stored patterns, retrying with
+// exponential backoff. It returns nil when ctx is done or the notifier closed.
+func (rn *RedisNotifier) resubscribe(ctx context.Context) []*redis.PubSub {
+	backoff := rn.minBackoff
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(backoff):
+		}
+
+		rn.mu.RLock()
+		closed, patterns := rn.closed, rn.patterns
+		rn.mu.RUnlock()
+		if closed {
+			return nil
+		}
+
+		pubsubs, err := rn.subscribeChannels(ctx, patterns)
+		if err != nil {
+			rn.setLost(err)
+			backoff = min(backoff*2, rn.maxBackoff)
+			continue
+		}
+
+		rn.mu.Lock()
+		if rn.closed {
+			rn.mu.Unlock()
+			closePubSubs(pubsubs)
+			return nil
+		}
+		rn.pubsubs = pubsubs
+		rn.lostSince, rn.lostErr = time.Time{}, nil
+		rn.mu.Unlock()
+
+		return pubsubs
+	}
+}
+
+// setLost records that the subscription connection is down, keeping the
+// time of the first failure
+func (rn *RedisNotifier) setLost(err error) {
+	rn.mu.Lock()
+	defer rn.mu.Unlock()
+
+	if rn.lostSince.IsZero() {
+		rn.lostSince = time.Now()
+	}
+	rn.lostErr = err
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,113 @@
+package notifier
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedisNotifier_Reconnect(t *testing.T) {
+	mr, err := miniredis.Run()
+	require.NoError(t, err)
+	defer mr.Close()
+
+	notifier, err := NewRedisNotifier(mr.Addr())
+	require.NoError(t, err)
+	defer func() {
+		_ = notifier.Close()
+	}()
+	notifier.minBackoff = 10 * time.Millisecond
+	notifier.maxBackoff = 50 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, err := notifier.Subscribe(ctx, []string{"radius:acct:*"})
+	require.NoError(t, err)
+	assert.NoError(t, notifier.HealthCheck(ctx))
+
+	// Drop the connection
+	mr.Close()
+
+	// A ping to the stopped server only fails after go-redis gives up dialing
+	require.Eventually(t, func() bool {
+		return notifier.HealthCheck(ctx) != nil
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.ErrorContains(t, notifier.HealthCheck(ctx), "subscription connection lost since")
+
+	// Redis comes back on the same address
+	require.NoError(t, mr.Restart())
+
+	select {
+	case event, ok := <-events:
+		require.True(t, ok, "event channel closed instead of reconnecting")
+		assert.Equal(t, OperationGap, event.Operation)
+		assert.Empty(t, event.Key)
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for gap event")
+	}
+	assert.NoError(t, notifier.HealthCheck(ctx))
+
+	// The stored pattern was resubscribed
+	require.Eventually(t, func() bool {
+		return mr.PubSubNumPat() == 1
+	}, time.Second, 10*time.Millisecond)
+	mr.Publish("__keyspace@0__:radius:acct:user", "set")
+
+	select {
+	case event := <-events:
+		assert.Equal(t, "radius:acct:user", event.Key)
+		assert.Equal(t, "set", event.Operation)
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for event after reconnect")
+	}
+}
+
+func TestRedisNotifier_ReconnectStopsOnClose(t *testing.T) {
+	mr, err := miniredis.Run()
+	require.NoError(t, err)
+
+	notifier, err := NewRedisNotifier(mr.Addr())
+	require.NoError(t, err)
+	notifier.minBackoff = 10 * time.Millisecond
+	notifier.maxBackoff = 10 * time.Millisecond
+
+	events, err := notifier.Subscribe(context.Background(), []string{"radius:acct:*"})
+	require.NoError(t, err)
+
+	// While Redis is down the notifier keeps retrying until it is closed
+	mr.Close()
+	require.Eventually(t, func() bool {
+		return notifier.HealthCheck(context.Background()) != nil
+	}, 5*time.Second, 10*time.Millisecond)
+	_ = notifier.Close()
+
+	select {
+	case _, ok := <-events:
+		assert.False(t, ok, "channel should be closed")
+	case <-time.After(time.Second):
+		t.Fatal("event channel not closed after Close")
+	}
+}
+
+func TestRedisNotifier_UnsubscribeForgetsPatterns(t *testing.T) {
+	mr, err := miniredis.Run()
+	require.NoError(t, err)
+	defer mr.Close()
+
+	notifier, err := NewRedisNotifier(mr.Addr())
+	require.NoError(t, err)
+	defer func() {
+		_ = notifier.Close()
+	}()
+
+	_, err = notifier.Subscribe(context.Background(), []string{"radius:acct:*", "radius:auth:*"})
+	require.NoError(t, err)
+	require.NoError(t, notifier.Unsubscribe([]string{"radius:auth:*"}))
+
+	assert.Equal(t, []string{"__keyspace@0__:radius:acct:*"}, notifier.patterns)
+}
@@ -3,98 +3,209 @@ package notifier
 import (
 	"context"
 	"fmt"
+	"regexp"
+	"slices"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/kal997/radius-accounting-server/internal/config"
+	"github.com/kal997/radius-accounting-server/internal/redisconn"
 	"github.com/redis/go-redis/v9"
 )
 
 // RedisNotifier implements Notifier interface using Redis pub/sub
 type RedisNotifier struct {
-	client   *redis.Client
-	pubsub   *redis.PubSub
-	patterns []string
-	mu       sync.RWMutex // Protects pubsub and patterns fields
+	client    redis.UniversalClient
+	db        int      // Database whose notifications are received
+	keyEvents []string // Operations to receive on __keyevent@N__ channels, empty for keyspace channels
+
+	configureEvents bool // Enable missing notify-keyspace-events flags instead of failing
+
+	// Reconnection tuning, set by the constructor
+	minBackoff   time.Duration // First delay before resubscribing
+	maxBackoff   time.Duration // Upper bound of the exponential backoff
+	pingInterval time.Duration // Idle time before the subscription connection is pinged
+
+	pubsubs    []*redis.PubSub           // One per primary; keyspace notifications are node-local
+	patterns   []string                  // Subscribed channels or channel patterns
+	keyFilters map[string]*regexp.Regexp // Key patterns matched locally for keyevent messages
+	lostSince  time.Time                 // When the subscription connection was lost, zero while connected
+	lostErr    error                     // Why the subscription connection was lost
+	closed     bool
+	mu         sync.RWMutex // Protects pubsubs, patterns, keyFilters, connection state and closed fields
 }
 
-// NewRedisNotifier creates a new Redis notifier
+// NewRedisNotifier creates a new Redis notifier for keyspace events of database 0
 func NewRedisNotifier(addr string) (*RedisNotifier, error) {
-	client := redis.NewClient(&redis.Options{
+	return newRedisNotifier(redis.NewClient(&redis.Options{
 		Addr: addr,
 		DB:   0,
-	})
+	}), nil)
+}
+
+// NewRedisNotifierFromConfig creates a new Redis notifier using the shared
+// Redis settings (mode, credentials, database index and TLS). Notifications
+// are received for the configured database, on __keyevent@N__ channels when
+// key events are configured and on __keyspace@N__ channels otherwise. In
+// Cluster mode every primary is subscribed, since each node only publishes
+// notifications for its own keys.
+func NewRedisNotifierFromConfig(redisCfg *config.RedisConfig, notifierCfg *config.NotifierConfig) (*RedisNotifier, error) {
+	client, err := redisconn.NewClient(redisCfg)
+	if err != nil {
+		return nil, err
+	}
+	rn, err := newRedisNotifier(client, notifierCfg.GetKeyEvents())
+	if err != nil {
+		return nil, err
+	}
+	rn.configureEvents = notifierCfg.ConfigureEvents()
+	return rn, nil
+}
 
+func newRedisNotifier(client redis.UniversalClient, keyEvents []string) (*RedisNotifier, error) {
 	// Test connection
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	if err := client.Ping(ctx).Err(); err != nil {
+		_ = client.Close()
 		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
 	}
 
 	return &RedisNotifier{
-		client: client,
+		client:       client,
+		db:           clientDB(client),
+		keyEvents:    keyEvents,
+		minBackoff:   100 * time.Millisecond,
+		maxBackoff:   30 * time.Second,
+		pingInterval: 30 * time.Second,
 	}, nil
 }
 
+// keyspacePrefix returns the channel prefix of keyspace notifications,
+// which carry the key in the channel name and the operation as payload
+func (rn *RedisNotifier) keyspacePrefix() string {
+	return fmt.Sprintf("__keyspace@%d__:", rn.db)
+}
+
+// keyeventPrefix returns the channel prefix of keyevent notifications,
+// which carry the operation in the channel name and the key as payload
+func (rn *RedisNotifier) keyeventPrefix() string {
+	return fmt.Sprintf("__keyevent@%d__:", rn.db)
+}
+
 // Subscribe to Redis keyspace notifications
 func (rn *RedisNotifier) Subscribe(ctx context.Context, patterns []string) (<-chan StorageEvent, error) {
 	if len(patterns) == 0 {
 		return nil, fmt.Errorf("no patterns provided")
 	}
 
-	// Convert patterns to keyspace notification patterns
-	keyspacePatterns := make([]string, len(patterns))
-	for i, pattern := range patterns {
-		keyspacePatterns[i] = fmt.Sprintf("__keyspace@0__:%s", pattern)
-	}
-
-	// Lock for write access to pubsub and patterns
+	// Lock for write access to pubsubs and patterns
 	rn.mu.Lock()
-	// Subscribe to patterns
-	rn.pubsub = rn.client.PSubscribe(ctx, keyspacePatterns...)
-	rn.patterns = keyspacePatterns
+	if len(rn.keyEvents) > 0 {
+		// Keyevent channels cannot be filtered by key on the server, so
+		// subscribe to each operation and match the keys locally
+		filters := make(map[string]*regexp.Regexp, len(patterns))
+		for _, pattern := range patterns {
+			filters[pattern] = globToRegexp(pattern)
+		}
+		channels := make([]string, len(rn.keyEvents))
+		for i, event := range rn.keyEvents {
+			channels[i] = rn.keyeventPrefix() + event
+		}
+		rn.patterns = channels
+		rn.keyFilters = filters
+	} else {
+		// Convert patterns to keyspace notification patterns
+		keyspacePatterns := make([]string, len(patterns))
+		for i, pattern := range patterns {
+			keyspacePatterns[i] = rn.keyspacePrefix() + pattern
+		}
+		rn.patterns = keyspacePatterns
+	}
+	pubsubs, err := rn.subscribeChannels(ctx, rn.patterns)
+	if err != nil {
+		rn.mu.Unlock()
+		return nil, fmt.Errorf("failed to subscribe: %w", err)
+	}
+	rn.pubsubs = pubsubs
 	rn.mu.Unlock()
 
 	// Create event buffered channel
 	eventChan := make(chan StorageEvent, 100)
 
-	// Start goroutine to process messages
-	go func() {
-		defer close(eventChan)
+	// Start goroutine to process messages, reconnecting when the connection is lost
+	go rn.run(ctx, pubsubs, eventChan)
 
-		// Get pubsub reference safely
-		rn.mu.RLock()
-		ps := rn.pubsub
-		rn.mu.RUnlock()
+	return eventChan, nil
+}
 
-		if ps == nil {
-			return
-		}
+// subscribeChannels opens a pub/sub connection to every node subscribed to
+// channels, which are keyevent channels or keyspace channel patterns
+func (rn *RedisNotifier) subscribeChannels(ctx context.Context, channels []string) ([]*redis.PubSub, error) {
+	nodes, err := rn.nodes(ctx)
+	if err != nil {
+		return nil, err
+	}
 
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			case msg, ok := <-ps.Channel():
-				if !ok {
-					return
-				}
-
-				event := rn.parseMessage(msg)
-				if event != nil {
-					select {
-					case eventChan <- *event:
-					case <-ctx.Done():
-						return
-					}
-				}
-			}
+	pubsubs := make([]*redis.PubSub, 0, len(nodes))
+	for _, node := range nodes {
+		var ps *redis.PubSub
+		if len(rn.keyEvents) > 0 {
+			ps = node.Subscribe(ctx)
+			err = ps.Subscribe(ctx, channels...)
+		} else {
+			ps = node.PSubscribe(ctx)
+			err = ps.PSubscribe(ctx, channels...)
 		}
-	}()
+		if err != nil {
+			_ = ps.Close()
+			closePubSubs(pubsubs)
+			return nil, err
+		}
+		pubsubs = append(pubsubs, ps)
+	}
+	return pubsubs, nil
+}
 
-	return eventChan, nil
+// nodes returns the clients that publish notifications: every primary of a
+// cluster, or the single (possibly Sentinel-managed) client otherwise
+func (rn *RedisNotifier) nodes(ctx context.Context) ([]redis.UniversalClient, error) {
+	cluster, ok := rn.client.(*redis.ClusterClient)
+	if !ok {
+		return []redis.UniversalClient{rn.client}, nil
+	}
+
+	// Pick up failovers and resharding before listing the primaries
+	cluster.ReloadState(ctx)
+
+	var mu sync.Mutex
+	var nodes []redis.UniversalClient
+	err := cluster.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+		mu.Lock()
+		defer mu.Unlock()
+		nodes = append(nodes, node)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list cluster primaries: %w", err)
+	}
+	return nodes, nil
+}
+
+// clientDB returns the database index selected by client; clusters only have database 0
+func clientDB(client redis.UniversalClient) int {
+	if c, ok := client.(*redis.Client); ok {
+		return c.Options().DB
+	}
+	return 0
+}
+
+func closePubSubs(pubsubs []*redis.PubSub) {
+	for _, ps := range pubsubs {
+		_ = ps.Close()
+	}
 }
 
 // parseMessage converts Redis message to StorageEvent
@@ -103,17 +214,26 @@ func (rn *RedisNotifier) parseMessage(msg *redis.Message) *StorageEvent {
 		return nil
 	}
 
-	// Extract key from keyspace notification
-	// Channel format: __keyspace@0__:radius:acct:user:session:timestamp:AccRecordType
+	// Keyspace channel format: __keyspace@N__:radius:acct:user:session:timestamp:AccRecordType
 	// Payload: operation (set, expire, del, etc.)
-
-	if !strings.HasPrefix(msg.Channel, "__keyspace@0__:") {
+	// Keyevent channel format: __keyevent@N__:operation
+	// Payload: key
+
+	var key, operation string
+	switch {
+	case strings.HasPrefix(msg.Channel, rn.keyspacePrefix()):
+		key = strings.TrimPrefix(msg.Channel, rn.keyspacePrefix())
+		operation = msg.Payload
+	case strings.HasPrefix(msg.Channel, rn.keyeventPrefix()):
+		key = msg.Payload
+		operation = strings.TrimPrefix(msg.Channel, rn.keyeventPrefix())
+		if !rn.matchesKey(key) {
+			return nil
+		}
+	default:
 		return nil
 	}
 
-	key := strings.TrimPrefix(msg.Channel, "__keyspace@0__:")
-	operation := msg.Payload
-
 	return &StorageEvent{
 		Key:       key,
 		Operation: operation,
@@ -124,23 +244,117 @@ func (rn *RedisNotifier) parseMessage(msg *redis.Message) *StorageEvent {
 // Unsubscribe from patterns
 func (rn *RedisNotifier) Unsubscribe(patterns []string) error {
 	rn.mu.RLock()
-	ps := rn.pubsub
+	pubsubs := rn.pubsubs
 	rn.mu.RUnlock()
 
-	if ps == nil {
+	if len(pubsubs) == 0 {
 		return fmt.Errorf("not subscribed")
 	}
 
+	if len(rn.keyEvents) > 0 {
+		// Keyevent channels stay subscribed; keys no longer match locally
+		rn.mu.Lock()
+		for _, pattern := range patterns {
+			delete(rn.keyFilters, pattern)
+		}
+		rn.mu.Unlock()
+		return nil
+	}
+
 	keyspacePatterns := make([]string, len(patterns))
 	for i, pattern := range patterns {
-		keyspacePatterns[i] = fmt.Sprintf("__keyspace@0__:%s", pattern)
+		keyspacePatterns[i] = rn.keyspacePrefix() + pattern
+	}
+
+	// Forget the patterns so they are not resubscribed after a reconnect
+	rn.mu.Lock()
+	remaining := rn.patterns[:0:0]
+	for _, pattern := range rn.patterns {
+		if !slices.Contains(keyspacePatterns, pattern) {
+			remaining = append(remaining, pattern)
+		}
+	}
+	rn.patterns = remaining
+	rn.mu.Unlock()
+
+	for _, ps := range pubsubs {
+		if err := ps.PUnsubscribe(context.Background(), keyspacePatterns...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// matchesKey reports whether key matches one of the subscribed key patterns
+func (rn *RedisNotifier) matchesKey(key string) bool {
+	rn.mu.RLock()
+	defer rn.mu.RUnlock()
+
+	for _, filter := range rn.keyFilters {
+		if filter.MatchString(key) {
+			return true
+		}
 	}
+	return false
+}
 
-	return ps.PUnsubscribe(context.Background(), keyspacePatterns...)
+// CompileGlob compiles a Redis glob pattern into a regular expression that
+// matches whole keys, for notifiers that filter keys themselves
+func CompileGlob(pattern string) *regexp.Regexp {
+	return globToRegexp(pattern)
 }
 
-// HealthCheck verifies Redis connectivity
+// globToRegexp compiles a Redis glob pattern (*, ?, [...] and \ escapes)
+// into an anchored regular expression
+func globToRegexp(pattern string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("(?s)^")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		case '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end <= 0 || pattern[i+1:i+1+end] == "^" {
+				// Not a character class, match the rest literally
+				b.WriteString(regexp.QuoteMeta(pattern[i:]))
+				i = len(pattern)
+				break
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "^") {
+				class = "^" + regexp.QuoteMeta(class[1:])
+			} else {
+				class = regexp.QuoteMeta(class)
+			}
+			b.WriteString("[" + class + "]")
+			i += end + 1
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+			}
+			b.WriteString(regexp.QuoteMeta(string(pattern[i])))
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
+
+// HealthCheck verifies Redis connectivity and reports a lost subscription
+// connection that has not been re-established yet
 func (rn *RedisNotifier) HealthCheck(ctx context.Context) error {
+	rn.mu.RLock()
+	lostSince, lostErr := rn.lostSince, rn.lostErr
+	rn.mu.RUnlock()
+
+	if !lostSince.IsZero() {
+		return fmt.Errorf("subscription connection lost since %s: %w", lostSince.Format(time.RFC3339), lostErr)
+	}
+
 	return rn.client.Ping(ctx).Err()
 }
 
@@ -149,12 +363,15 @@ func (rn *RedisNotifier) Close() error {
 	var err error
 
 	rn.mu.Lock()
-	ps := rn.pubsub
-	rn.pubsub = nil
+	pubsubs := rn.pubsubs
+	rn.pubsubs = nil
+	rn.closed = true
 	rn.mu.Unlock()
 
-	if ps != nil {
-		err = ps.Close()
+	for _, ps := range pubsubs {
+		if closeErr := ps.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
 	}
 
 	if rn.client != nil {
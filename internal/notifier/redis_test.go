@@ -2,7 +2,11 @@ package notifier
 
 import (
 	"context"
+	"fmt"
 	"net"
+	"os"
+	"path/filepath"
+	"regexp"
 	"testing"
 	"time"
 
@@ -10,6 +14,8 @@ import (
 	"github.com/redis/go-redis/v9"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/kal997/radius-accounting-server/internal/config"
 )
 
 func TestNewRedisNotifier(t *testing.T) {
@@ -69,6 +75,34 @@ func TestNewRedisNotifier(t *testing.T) {
 	}
 }
 
+func TestNewRedisNotifierFromConfig(t *testing.T) {
+	mr, err := miniredis.Run()
+	require.NoError(t, err)
+	defer mr.Close()
+	mr.RequireAuth("notifierpass")
+
+	host, port, err := net.SplitHostPort(mr.Addr())
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	content := fmt.Sprintf("logging:\n  file: /tmp/test.log\nredis:\n  host: %s\n  port: %s\n  password: notifierpass\n", host, port)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+
+	cfg, err := config.LoadLogger(path, nil)
+	require.NoError(t, err)
+
+	notifier, err := NewRedisNotifierFromConfig(cfg.GetRedis(), cfg.GetNotifier())
+	require.NoError(t, err)
+	defer func() {
+		_ = notifier.Close()
+	}()
+	assert.NoError(t, notifier.HealthCheck(context.Background()))
+
+	// Without the password the connection is refused
+	_, err = NewRedisNotifier(mr.Addr())
+	assert.ErrorContains(t, err, "failed to connect to Redis")
+}
+
 func TestRedisNotifier_Subscribe(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -165,7 +199,7 @@ func TestRedisNotifier_Subscribe(t *testing.T) {
 			} else {
 				require.NoError(t, err)
 				require.NotNil(t, eventChan)
-				assert.NotNil(t, notifier.pubsub)
+				assert.Len(t, notifier.pubsubs, 1)
 				assert.Equal(t, len(tt.patterns), len(notifier.patterns))
 
 				// Verify pattern format
@@ -312,6 +346,126 @@ func TestRedisNotifier_parseMessage(t *testing.T) {
 	}
 }
 
+func TestRedisNotifier_parseMessage_Database(t *testing.T) {
+	tests := []struct {
+		name     string
+		notifier *RedisNotifier
+		msg      *redis.Message
+		expected *StorageEvent
+	}{
+		{
+			name:     "keyspace channel of configured database",
+			notifier: &RedisNotifier{db: 3},
+			msg:      &redis.Message{Channel: "__keyspace@3__:radius:acct:user", Payload: "set"},
+			expected: &StorageEvent{Key: "radius:acct:user", Operation: "set"},
+		},
+		{
+			name:     "keyspace channel of another database",
+			notifier: &RedisNotifier{db: 3},
+			msg:      &redis.Message{Channel: "__keyspace@0__:radius:acct:user", Payload: "set"},
+			expected: nil,
+		},
+		{
+			name: "keyevent channel with matching key",
+			notifier: &RedisNotifier{db: 1, keyFilters: map[string]*regexp.Regexp{
+				"radius:acct:*": globToRegexp("radius:acct:*"),
+			}},
+			msg:      &redis.Message{Channel: "__keyevent@1__:expired", Payload: "radius:acct:user"},
+			expected: &StorageEvent{Key: "radius:acct:user", Operation: "expired"},
+		},
+		{
+			name: "keyevent channel with other key",
+			notifier: &RedisNotifier{db: 1, keyFilters: map[string]*regexp.Regexp{
+				"radius:acct:*": globToRegexp("radius:acct:*"),
+			}},
+			msg:      &redis.Message{Channel: "__keyevent@1__:set", Payload: "other:key"},
+			expected: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := tt.notifier.parseMessage(tt.msg)
+
+			if tt.expected == nil {
+				assert.Nil(t, result)
+				return
+			}
+
+			require.NotNil(t, result)
+			assert.Equal(t, tt.expected.Key, result.Key)
+			assert.Equal(t, tt.expected.Operation, result.Operation)
+		})
+	}
+}
+
+func TestRedisNotifier_KeyEvents(t *testing.T) {
+	mr, err := miniredis.Run()
+	require.NoError(t, err)
+	defer mr.Close()
+
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr(), DB: 2})
+	notifier, err := newRedisNotifier(client, []string{"set", "expired"})
+	require.NoError(t, err)
+	defer func() {
+		_ = notifier.Close()
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, err := notifier.Subscribe(ctx, []string{"radius:acct:*"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"__keyevent@2__:set", "__keyevent@2__:expired"}, notifier.patterns)
+
+	// miniredis does not emit keyspace notifications, publish them by hand
+	require.Eventually(t, func() bool {
+		return mr.PubSubNumSub("__keyevent@2__:expired")["__keyevent@2__:expired"] == 1
+	}, time.Second, 10*time.Millisecond)
+	mr.Publish("__keyevent@2__:set", "other:key")
+	mr.Publish("__keyevent@0__:set", "radius:acct:wrongdb")
+	mr.Publish("__keyevent@2__:expired", "radius:acct:user:session")
+
+	select {
+	case event := <-events:
+		assert.Equal(t, "radius:acct:user:session", event.Key)
+		assert.Equal(t, "expired", event.Operation)
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for keyevent notification")
+	}
+
+	// After unsubscribing the key pattern nothing matches any more
+	require.NoError(t, notifier.Unsubscribe([]string{"radius:acct:*"}))
+	assert.Nil(t, notifier.parseMessage(&redis.Message{Channel: "__keyevent@2__:set", Payload: "radius:acct:user"}))
+}
+
+func TestGlobToRegexp(t *testing.T) {
+	tests := []struct {
+		pattern string
+		key     string
+		want    bool
+	}{
+		{"radius:acct:*", "radius:acct:user:session", true},
+		{"radius:acct:*", "radius:auth:user", false},
+		{"radius:acct:?", "radius:acct:a", true},
+		{"radius:acct:?", "radius:acct:ab", false},
+		{"user[12]", "user1", true},
+		{"user[12]", "user3", false},
+		{"user[^12]", "user3", true},
+		{"user[a-c]", "userb", true},
+		{`literal\*`, "literal*", true},
+		{`literal\*`, "literalx", false},
+		{"dots.are.literal", "dotsXareXliteral", false},
+		{"open[bracket", "open[bracket", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+"/"+tt.key, func(t *testing.T) {
+			assert.Equal(t, tt.want, globToRegexp(tt.pattern).MatchString(tt.key))
+		})
+	}
+}
+
 func TestRedisNotifier_Unsubscribe(t *testing.T) {
 	tests := []struct {
 		name          string
@@ -581,7 +735,7 @@ func TestRedisNotifier_Close(t *testing.T) {
 				require.NoError(t, err)
 
 				// Close pubsub first to simulate error scenario
-				_ = notifier.pubsub.Close()
+				_ = notifier.pubsubs[0].Close()
 
 				return notifier, func() { mr.Close() }
 			},
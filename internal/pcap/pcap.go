@@ -0,0 +1,315 @@
+// Package pcap reads packet captures in the libpcap and pcapng formats, e.g.
+// written by tcpdump or Wireshark, and decodes the UDP datagrams they hold.
+// It also writes pcapng captures of datagrams read from a socket.
+package pcap
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// LinkType is the link-layer header type of captured packets, as assigned in
+// https://www.tcpdump.org/linktypes.html
+type LinkType uint16
+
+// Link types of the captures this package decodes
+const (
+	LinkTypeNull      LinkType = 0   // BSD loopback, host byte order address family
+	LinkTypeEthernet  LinkType = 1   // Ethernet II, optionally 802.1Q tagged
+	LinkTypeRaw       LinkType = 101 // Raw IPv4 or IPv6
+	LinkTypeLinuxSLL  LinkType = 113 // Linux "any" device
+	LinkTypeIPv4      LinkType = 228
+	LinkTypeIPv6      LinkType = 229
+	LinkTypeLinuxSLL2 LinkType = 276
+)
+
+// Magic numbers of the file formats
+const (
+	magicMicroseconds = 0xa1b2c3d4
+	magicNanoseconds  = 0xa1b23c4d
+	magicSection      = 0x0a0d0d0a // pcapng section header block type
+	magicByteOrder    = 0x1a2b3c4d // pcapng byte-order magic
+)
+
+// pcapng block types
+const (
+	blockInterface      = 0x00000001
+	blockEnhancedPacket = 0x00000006
+)
+
+// maxBlockLength bounds the packets and blocks read, to fail on corrupt
+// files instead of allocating their length
+const maxBlockLength = 16 << 20
+
+// ErrFormat is wrapped by the errors returned for files that are not valid
+// captures
+var ErrFormat = errors.New("invalid capture file")
+
+// Packet is one captured packet
+type Packet struct {
+	Time     time.Time
+	LinkType LinkType
+	Data     []byte // Captured bytes, possibly truncated to the snapshot length
+}
+
+// interfaceInfo describes a pcapng interface
+type interfaceInfo struct {
+	linkType   LinkType
+	resolution time.Duration // Duration of one timestamp unit, zero for sub-nanosecond units
+	divisor    uint64        // Units per second when resolution is zero
+}
+
+// Reader reads the packets of a libpcap or pcapng capture
+type Reader struct {
+	r     *bufio.Reader
+	order binary.ByteOrder
+	ng    bool
+
+	// libpcap
+	linkType   LinkType
+	resolution time.Duration
+
+	// pcapng
+	interfaces []interfaceInfo
+}
+
+// NewReader reads the file header of a capture in either format
+func NewReader(r io.Reader) (*Reader, error) {
+	reader := &Reader{r: bufio.NewReader(r)}
+
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(reader.r, header); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrFormat, err)
+	}
+
+	if binary.LittleEndian.Uint32(header) == magicSection {
+		reader.ng = true
+		if err := reader.readSection(); err != nil {
+			return nil, err
+		}
+		return reader, nil
+	}
+
+	switch {
+	case binary.LittleEndian.Uint32(header) == magicMicroseconds || binary.LittleEndian.Uint32(header) == magicNanoseconds:
+		reader.order = binary.LittleEndian
+	case binary.BigEndian.Uint32(header) == magicMicroseconds || binary.BigEndian.Uint32(header) == magicNanoseconds:
+		reader.order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("%w: unknown magic number %x", ErrFormat, header)
+	}
+	reader.resolution = time.Microsecond
+	if reader.order.Uint32(header) == magicNanoseconds {
+		reader.resolution = time.Nanosecond
+	}
+
+	// Version, time zone, accuracy, snapshot length and link type
+	rest := make([]byte, 20)
+	if _, err := io.ReadFull(reader.r, rest); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrFormat, err)
+	}
+	reader.linkType = LinkType(reader.order.Uint32(rest[16:]) & 0xffff)
+	return reader, nil
+}
+
+// Next returns the next packet, or io.EOF after the last one
+func (r *Reader) Next() (Packet, error) {
+	if r.ng {
+		return r.nextBlock()
+	}
+
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(r.r, header); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return Packet{}, fmt.Errorf("%w: truncated packet header", ErrFormat)
+		}
+		return Packet{}, err
+	}
+	length := r.order.Uint32(header[8:])
+	data, err := r.read(length)
+	if err != nil {
+		return Packet{}, err
+	}
+
+	sec := int64(r.order.Uint32(header))
+	frac := time.Duration(r.order.Uint32(header[4:])) * r.resolution
+	return Packet{
+		Time:     time.Unix(sec, int64(frac)).UTC(),
+		LinkType: r.linkType,
+		Data:     data,
+	}, nil
+}
+
+// read reads n bytes of a packet or block
+func (r *Reader) read(n uint32) ([]byte, error) {
+	if n > maxBlockLength {
+		return nil, fmt.Errorf("%w: length %d too large", ErrFormat, n)
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(r.r, data); err != nil {
+		return nil, fmt.Errorf("%w: truncated packet", ErrFormat)
+	}
+	return data, nil
+}
+
+// nextBlock reads pcapng blocks until the next packet. Blocks other than
+// section headers, interface descriptions and enhanced packets are skipped.
+func (r *Reader) nextBlock() (Packet, error) {
+	for {
+		header := make([]byte, 8)
+		if _, err := io.ReadFull(r.r, header); err != nil {
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				return Packet{}, fmt.Errorf("%w: truncated block header", ErrFormat)
+			}
+			return Packet{}, err
+		}
+
+		// A new section may change the byte order
+		if binary.LittleEndian.Uint32(header) == magicSection {
+			if err := r.readSection(header[4:]...); err != nil {
+				return Packet{}, err
+			}
+			continue
+		}
+
+		blockType := r.order.Uint32(header)
+		length := r.order.Uint32(header[4:])
+		if length < 12 || length%4 != 0 {
+			return Packet{}, fmt.Errorf("%w: invalid block length %d", ErrFormat, length)
+		}
+		body, err := r.read(length - 8)
+		if err != nil {
+			return Packet{}, err
+		}
+		body = body[:len(body)-4] // Trailing block length
+
+		switch blockType {
+		case blockInterface:
+			if err := r.addInterface(body); err != nil {
+				return Packet{}, err
+			}
+		case blockEnhancedPacket:
+			return r.enhancedPacket(body)
+		}
+	}
+}
+
+// readSection reads a section header block after its type. Part of the
+// block may already have been read.
+func (r *Reader) readSection(read ...byte) error {
+	head := make([]byte, 8)
+	n := copy(head, read)
+	if _, err := io.ReadFull(r.r, head[n:]); err != nil {
+		return fmt.Errorf("%w: truncated section header", ErrFormat)
+	}
+
+	switch binary.LittleEndian.Uint32(head[4:]) {
+	case magicByteOrder:
+		r.order = binary.LittleEndian
+	default:
+		if binary.BigEndian.Uint32(head[4:]) != magicByteOrder {
+			return fmt.Errorf("%w: invalid byte-order magic", ErrFormat)
+		}
+		r.order = binary.BigEndian
+	}
+
+	length := r.order.Uint32(head)
+	if length < 28 || length%4 != 0 {
+		return fmt.Errorf("%w: invalid section header length %d", ErrFormat, length)
+	}
+	if _, err := r.read(length - 12); err != nil {
+		return err
+	}
+	r.interfaces = nil
+	return nil
+}
+
+// addInterface records an interface description block
+func (r *Reader) addInterface(body []byte) error {
+	if len(body) < 8 {
+		return fmt.Errorf("%w: truncated interface description", ErrFormat)
+	}
+	info := interfaceInfo{
+		linkType:   LinkType(r.order.Uint16(body)),
+		resolution: time.Microsecond,
+	}
+
+	// Options are code, length and a value padded to 32 bits
+	options := body[8:]
+	for len(options) >= 4 {
+		code := r.order.Uint16(options)
+		length := int(r.order.Uint16(options[2:]))
+		if code == 0 || 4+length > len(options) {
+			break
+		}
+		if code == 9 && length >= 1 { // if_tsresol
+			info.resolution, info.divisor = resolution(options[4])
+		}
+		next := 4 + (length+3)&^3
+		if next > len(options) {
+			break
+		}
+		options = options[next:]
+	}
+
+	r.interfaces = append(r.interfaces, info)
+	return nil
+}
+
+// resolution converts if_tsresol, a negative power of 10, or of 2 when the
+// high bit is set, to the duration of a unit or, for units smaller than a
+// nanosecond, to units per second
+func resolution(tsresol byte) (time.Duration, uint64) {
+	exp := int(tsresol & 0x7f)
+	if tsresol&0x80 != 0 {
+		if exp > 63 {
+			exp = 63
+		}
+		return 0, 1 << exp
+	}
+	if exp <= 9 {
+		return time.Duration(math.Pow10(9 - exp)), 0
+	}
+	if exp > 19 {
+		exp = 19
+	}
+	return 0, uint64(math.Pow10(exp))
+}
+
+// enhancedPacket decodes an enhanced packet block
+func (r *Reader) enhancedPacket(body []byte) (Packet, error) {
+	if len(body) < 20 {
+		return Packet{}, fmt.Errorf("%w: truncated packet block", ErrFormat)
+	}
+	id := r.order.Uint32(body)
+	if int(id) >= len(r.interfaces) {
+		return Packet{}, fmt.Errorf("%w: packet of undescribed interface %d", ErrFormat, id)
+	}
+	info := r.interfaces[id]
+
+	length := r.order.Uint32(body[12:])
+	if int(length) > len(body)-20 {
+		return Packet{}, fmt.Errorf("%w: truncated packet block", ErrFormat)
+	}
+
+	units := uint64(r.order.Uint32(body[4:]))<<32 | uint64(r.order.Uint32(body[8:]))
+	var t time.Time
+	if info.resolution > 0 {
+		perSecond := uint64(time.Second / info.resolution)
+		t = time.Unix(int64(units/perSecond), int64(units%perSecond)*int64(info.resolution))
+	} else {
+		nsec := float64(units%info.divisor) * 1e9 / float64(info.divisor)
+		t = time.Unix(int64(units/info.divisor), int64(nsec))
+	}
+
+	return Packet{
+		Time:     t.UTC(),
+		LinkType: info.linkType,
+		Data:     body[20 : 20+length],
+	}, nil
+}
@@ -0,0 +1,204 @@
+package pcap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ipv4UDP builds an IPv4 packet carrying a UDP datagram
+func ipv4UDP(src, dst string, srcPort, dstPort int, payload []byte) []byte {
+	packet := make([]byte, 28, 28+len(payload))
+	packet[0] = 0x45
+	binary.BigEndian.PutUint16(packet[2:], uint16(28+len(payload)))
+	packet[8] = 64
+	packet[9] = protocolUDP
+	copy(packet[12:], net.ParseIP(src).To4())
+	copy(packet[16:], net.ParseIP(dst).To4())
+	binary.BigEndian.PutUint16(packet[20:], uint16(srcPort))
+	binary.BigEndian.PutUint16(packet[22:], uint16(dstPort))
+	binary.BigEndian.PutUint16(packet[24:], uint16(8+len(payload)))
+	return append(packet, payload...)
+}
+
+// ethernet frames an IP packet, with a VLAN tag and minimum frame padding
+func ethernet(ip []byte) []byte {
+	frame := make([]byte, 12, 18+len(ip)+20)
+	frame = binary.BigEndian.AppendUint16(frame, etherTypeVLAN)
+	frame = binary.BigEndian.AppendUint16(frame, 42)
+	frame = binary.BigEndian.AppendUint16(frame, etherTypeIPv4)
+	frame = append(frame, ip...)
+	return append(frame, make([]byte, 20)...)
+}
+
+func TestReader_Libpcap(t *testing.T) {
+	payload := []byte("accounting")
+	frame := ethernet(ipv4UDP("192.168.1.1", "10.0.0.1", 40000, 1813, payload))
+
+	// Big-endian with nanosecond timestamps
+	var file bytes.Buffer
+	header := []any{uint32(magicNanoseconds), uint16(2), uint16(4), int32(0), uint32(0), uint32(65535), uint32(LinkTypeEthernet)}
+	for _, v := range header {
+		require.NoError(t, binary.Write(&file, binary.BigEndian, v))
+	}
+	for _, v := range []uint32{1705314645, 123456789, uint32(len(frame)), uint32(len(frame))} {
+		require.NoError(t, binary.Write(&file, binary.BigEndian, v))
+	}
+	file.Write(frame)
+
+	reader, err := NewReader(&file)
+	require.NoError(t, err)
+
+	packet, err := reader.Next()
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 1, 15, 10, 30, 45, 123456789, time.UTC), packet.Time)
+	assert.Equal(t, LinkTypeEthernet, packet.LinkType)
+
+	datagram, ok := DecodeUDP(packet)
+	require.True(t, ok)
+	assert.Equal(t, "192.168.1.1:40000", datagram.Src.String())
+	assert.Equal(t, "10.0.0.1:1813", datagram.Dst.String())
+	assert.Equal(t, payload, datagram.Payload)
+
+	_, err = reader.Next()
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+// block builds a little-endian pcapng block
+func block(blockType uint32, body []byte) []byte {
+	for len(body)%4 != 0 {
+		body = append(body, 0)
+	}
+	b := binary.LittleEndian.AppendUint32(nil, blockType)
+	b = binary.LittleEndian.AppendUint32(b, uint32(12+len(body)))
+	b = append(b, body...)
+	return binary.LittleEndian.AppendUint32(b, uint32(12+len(body)))
+}
+
+func TestReader_Pcapng(t *testing.T) {
+	ip := ipv4UDP("192.168.1.2", "10.0.0.1", 1814, 1813, []byte("x"))
+
+	section := binary.LittleEndian.AppendUint32(nil, magicByteOrder)
+	section = append(section, 1, 0, 0, 0) // Version 1.0
+	section = binary.LittleEndian.AppendUint64(section, ^uint64(0))
+
+	// Raw IP with millisecond timestamps
+	iface := binary.LittleEndian.AppendUint16(nil, uint16(LinkTypeRaw))
+	iface = append(iface, 0, 0, 0, 0, 0, 0)
+	iface = append(iface, 9, 0, 1, 0, 3, 0, 0, 0) // if_tsresol = 10^-3
+	iface = append(iface, 0, 0, 0, 0)             // opt_endofopt
+
+	ms := uint64(1705314645123)
+	packet := binary.LittleEndian.AppendUint32(nil, 0)
+	packet = binary.LittleEndian.AppendUint32(packet, uint32(ms>>32))
+	packet = binary.LittleEndian.AppendUint32(packet, uint32(ms))
+	packet = binary.LittleEndian.AppendUint32(packet, uint32(len(ip)))
+	packet = binary.LittleEndian.AppendUint32(packet, uint32(len(ip)))
+	packet = append(packet, ip...)
+
+	var file []byte
+	file = append(file, block(magicSection, section)...)
+	file = append(file, block(blockInterface, iface)...)
+	file = append(file, block(0x00000005, []byte("statistics"))...) // Skipped
+	file = append(file, block(blockEnhancedPacket, packet)...)
+
+	reader, err := NewReader(bytes.NewReader(file))
+	require.NoError(t, err)
+
+	got, err := reader.Next()
+	require.NoError(t, err)
+	assert.Equal(t, time.UnixMilli(int64(ms)).UTC(), got.Time)
+	assert.Equal(t, LinkTypeRaw, got.LinkType)
+	assert.Equal(t, ip, got.Data)
+
+	_, err = reader.Next()
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestNewReader_Invalid(t *testing.T) {
+	_, err := NewReader(bytes.NewReader([]byte("Fri Jan  5 10:30:45 2024\n")))
+	assert.ErrorIs(t, err, ErrFormat)
+
+	_, err = NewReader(bytes.NewReader(nil))
+	assert.ErrorIs(t, err, ErrFormat)
+}
+
+func TestDecodeUDP(t *testing.T) {
+	ipv6 := make([]byte, 48)
+	ipv6[0] = 0x60
+	binary.BigEndian.PutUint16(ipv6[4:], 8)
+	ipv6[6] = protocolUDP
+	copy(ipv6[8:], net.ParseIP("2001:db8::1"))
+	copy(ipv6[24:], net.ParseIP("2001:db8::2"))
+	binary.BigEndian.PutUint16(ipv6[40:], 1814)
+	binary.BigEndian.PutUint16(ipv6[42:], 1813)
+	binary.BigEndian.PutUint16(ipv6[44:], 8)
+
+	sll := make([]byte, 16)
+	binary.BigEndian.PutUint16(sll[14:], etherTypeIPv6)
+
+	datagram, ok := DecodeUDP(Packet{LinkType: LinkTypeLinuxSLL, Data: append(sll, ipv6...)})
+	require.True(t, ok)
+	assert.Equal(t, "[2001:db8::1]:1814", datagram.Src.String())
+	assert.Empty(t, datagram.Payload)
+
+	fragment := ipv4UDP("192.168.1.1", "10.0.0.1", 1814, 1813, nil)
+	fragment[6] = 0x20 // More fragments
+	_, ok = DecodeUDP(Packet{LinkType: LinkTypeRaw, Data: fragment})
+	assert.False(t, ok)
+
+	tcp := ipv4UDP("192.168.1.1", "10.0.0.1", 1814, 1813, nil)
+	tcp[9] = 6
+	_, ok = DecodeUDP(Packet{LinkType: LinkTypeRaw, Data: tcp})
+	assert.False(t, ok)
+
+	truncated := ipv4UDP("192.168.1.1", "10.0.0.1", 1814, 1813, []byte("payload"))
+	_, ok = DecodeUDP(Packet{LinkType: LinkTypeRaw, Data: truncated[:30]})
+	assert.False(t, ok)
+}
+
+func TestWriter(t *testing.T) {
+	client := &net.UDPAddr{IP: net.ParseIP("192.168.1.1"), Port: 40000}
+	server := &net.UDPAddr{IP: net.ParseIP("10.0.0.1"), Port: 1813}
+	client6 := &net.UDPAddr{IP: net.ParseIP("2001:db8::1"), Port: 40000}
+	server6 := &net.UDPAddr{IP: net.ParseIP("2001:db8::2"), Port: 1813}
+	at := time.Date(2024, 1, 15, 10, 30, 45, 123456789, time.UTC)
+
+	var file bytes.Buffer
+	writer, err := NewWriter(&file)
+	require.NoError(t, err)
+	require.NoError(t, writer.WritePacket(at, EncodeUDP(client, server, []byte("request"))))
+	require.NoError(t, writer.WritePacket(at.Add(time.Millisecond), EncodeUDP(server6, client6, []byte("odd"))))
+
+	reader, err := NewReader(&file)
+	require.NoError(t, err)
+
+	packet, err := reader.Next()
+	require.NoError(t, err)
+	assert.Equal(t, at, packet.Time)
+	assert.Zero(t, checksum(packet.Data[:20]), "IPv4 header checksum")
+	datagram, ok := DecodeUDP(packet)
+	require.True(t, ok)
+	assert.Equal(t, client.String(), datagram.Src.String())
+	assert.Equal(t, server.String(), datagram.Dst.String())
+	assert.Equal(t, []byte("request"), datagram.Payload)
+
+	packet, err = reader.Next()
+	require.NoError(t, err)
+	datagram, ok = DecodeUDP(packet)
+	require.True(t, ok)
+	assert.Equal(t, server6.String(), datagram.Src.String())
+	assert.Equal(t, []byte("odd"), datagram.Payload)
+	udp := packet.Data[40:]
+	pseudo := append(append([]byte(nil), packet.Data[8:40]...), 0, 0, 0, byte(len(udp)), 0, 0, 0, protocolUDP)
+	assert.Zero(t, checksum(pseudo, udp), "UDP checksum")
+
+	_, err = reader.Next()
+	assert.ErrorIs(t, err, io.EOF)
+}
@@ -0,0 +1,123 @@
+package pcap
+
+import (
+	"encoding/binary"
+	"net"
+)
+
+// Ether types and IP protocol numbers
+const (
+	etherTypeIPv4 = 0x0800
+	etherTypeIPv6 = 0x86dd
+	etherTypeVLAN = 0x8100
+	etherTypeQinQ = 0x88a8
+	protocolUDP   = 17
+)
+
+// Datagram is a UDP datagram
+type Datagram struct {
+	Src     *net.UDPAddr
+	Dst     *net.UDPAddr
+	Payload []byte
+}
+
+// DecodeUDP returns the UDP datagram carried by a captured packet. It
+// reports false for other packets, for IP fragments, which are not
+// reassembled, and for IPv6 packets with extension headers before UDP.
+func DecodeUDP(packet Packet) (Datagram, bool) {
+	ip, ok := network(packet.LinkType, packet.Data)
+	if !ok || len(ip) < 1 {
+		return Datagram{}, false
+	}
+
+	var src, dst net.IP
+	var udp []byte
+	switch ip[0] >> 4 {
+	case 4:
+		headerLength := int(ip[0]&0x0f) * 4
+		if headerLength < 20 || len(ip) < headerLength {
+			return Datagram{}, false
+		}
+		fragment := binary.BigEndian.Uint16(ip[6:])
+		if ip[9] != protocolUDP || fragment&0x3fff != 0 { // More fragments or an offset
+			return Datagram{}, false
+		}
+		if total := int(binary.BigEndian.Uint16(ip[2:])); total >= headerLength && total < len(ip) {
+			ip = ip[:total] // Ethernet padding
+		}
+		src, dst, udp = net.IP(ip[12:16]), net.IP(ip[16:20]), ip[headerLength:]
+
+	case 6:
+		if len(ip) < 40 || ip[6] != protocolUDP {
+			return Datagram{}, false
+		}
+		if payload := int(binary.BigEndian.Uint16(ip[4:])); 40+payload < len(ip) {
+			ip = ip[:40+payload]
+		}
+		src, dst, udp = net.IP(ip[8:24]), net.IP(ip[24:40]), ip[40:]
+
+	default:
+		return Datagram{}, false
+	}
+
+	if len(udp) < 8 {
+		return Datagram{}, false
+	}
+	length := int(binary.BigEndian.Uint16(udp[4:]))
+	if length < 8 || length > len(udp) {
+		return Datagram{}, false // Truncated by the snapshot length
+	}
+	return Datagram{
+		Src:     &net.UDPAddr{IP: append(net.IP(nil), src...), Port: int(binary.BigEndian.Uint16(udp))},
+		Dst:     &net.UDPAddr{IP: append(net.IP(nil), dst...), Port: int(binary.BigEndian.Uint16(udp[2:]))},
+		Payload: udp[8:length],
+	}, true
+}
+
+// network strips the link-layer header of a packet and returns its IP packet
+func network(linkType LinkType, data []byte) ([]byte, bool) {
+	switch linkType {
+	case LinkTypeRaw, LinkTypeIPv4, LinkTypeIPv6:
+		return data, true
+
+	case LinkTypeNull:
+		// The address family is in the byte order of the capturing host, so
+		// the IP version is checked instead
+		if len(data) < 4 {
+			return nil, false
+		}
+		return data[4:], true
+
+	case LinkTypeEthernet:
+		if len(data) < 14 {
+			return nil, false
+		}
+		etherType := binary.BigEndian.Uint16(data[12:])
+		data = data[14:]
+		for etherType == etherTypeVLAN || etherType == etherTypeQinQ {
+			if len(data) < 4 {
+				return nil, false
+			}
+			etherType = binary.BigEndian.Uint16(data[2:])
+			data = data[4:]
+		}
+		return data, etherType == etherTypeIPv4 || etherType == etherTypeIPv6
+
+	case LinkTypeLinuxSLL:
+		if len(data) < 16 {
+			return nil, false
+		}
+		etherType := binary.BigEndian.Uint16(data[14:])
+		return data[16:], etherType == etherTypeIPv4 || etherType == etherTypeIPv6
+
+	case LinkTypeLinuxSLL2:
+		if len(data) < 20 {
+			return nil, false
+		}
+		etherType := binary.BigEndian.Uint16(data)
+		return data[20:], etherType == etherTypeIPv4 || etherType == etherTypeIPv6
+
+	default:
+		return nil, false
+	}
+}
@@ -0,0 +1,120 @@
+package pcap
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"time"
+)
+
+// Writer writes a pcapng capture of raw IP packets with nanosecond
+// timestamps, readable by Wireshark, tcpdump and Reader
+type Writer struct {
+	w io.Writer
+}
+
+// NewWriter writes the section header and the interface description of a
+// capture to w
+func NewWriter(w io.Writer) (*Writer, error) {
+	section := binary.LittleEndian.AppendUint32(nil, magicByteOrder)
+	section = binary.LittleEndian.AppendUint16(section, 1) // Version 1.0
+	section = binary.LittleEndian.AppendUint16(section, 0)
+	section = binary.LittleEndian.AppendUint64(section, ^uint64(0)) // Unknown section length
+
+	iface := binary.LittleEndian.AppendUint16(nil, uint16(LinkTypeRaw))
+	iface = binary.LittleEndian.AppendUint16(iface, 0)
+	iface = binary.LittleEndian.AppendUint32(iface, 0) // No snapshot length
+	iface = append(iface, 9, 0, 1, 0, 9, 0, 0, 0)      // if_tsresol: nanoseconds
+	iface = append(iface, 0, 0, 0, 0)                  // opt_endofopt
+
+	data := appendBlock(nil, magicSection, section)
+	data = appendBlock(data, blockInterface, iface)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	return &Writer{w: w}, nil
+}
+
+// WritePacket writes a raw IPv4 or IPv6 packet captured at t
+func (w *Writer) WritePacket(t time.Time, packet []byte) error {
+	ns := uint64(t.UnixNano())
+	body := binary.LittleEndian.AppendUint32(make([]byte, 0, 20+len(packet)+3), 0) // Interface 0
+	body = binary.LittleEndian.AppendUint32(body, uint32(ns>>32))
+	body = binary.LittleEndian.AppendUint32(body, uint32(ns))
+	body = binary.LittleEndian.AppendUint32(body, uint32(len(packet)))
+	body = binary.LittleEndian.AppendUint32(body, uint32(len(packet)))
+	body = append(body, packet...)
+
+	_, err := w.w.Write(appendBlock(nil, blockEnhancedPacket, body))
+	return err
+}
+
+// appendBlock appends a pcapng block, padding its body to 32 bits
+func appendBlock(b []byte, blockType uint32, body []byte) []byte {
+	padding := (4 - len(body)%4) % 4
+	length := uint32(12 + len(body) + padding)
+	b = binary.LittleEndian.AppendUint32(b, blockType)
+	b = binary.LittleEndian.AppendUint32(b, length)
+	b = append(b, body...)
+	b = append(b, make([]byte, padding)...)
+	return binary.LittleEndian.AppendUint32(b, length)
+}
+
+// EncodeUDP synthesises the IPv4 or IPv6 packet carrying a UDP datagram, for
+// captures of datagrams whose headers were not seen, e.g. those read from a
+// socket. IPv4 is used when both addresses are IPv4 addresses.
+func EncodeUDP(src, dst *net.UDPAddr, payload []byte) []byte {
+	udp := make([]byte, 8, 8+len(payload))
+	binary.BigEndian.PutUint16(udp, uint16(src.Port))
+	binary.BigEndian.PutUint16(udp[2:], uint16(dst.Port))
+	binary.BigEndian.PutUint16(udp[4:], uint16(8+len(payload)))
+	udp = append(udp, payload...)
+
+	if src4, dst4 := src.IP.To4(), dst.IP.To4(); src4 != nil && dst4 != nil {
+		ip := make([]byte, 20, 20+len(udp))
+		ip[0] = 0x45
+		binary.BigEndian.PutUint16(ip[2:], uint16(20+len(udp)))
+		binary.BigEndian.PutUint16(ip[6:], 0x4000) // Don't fragment
+		ip[8] = 64
+		ip[9] = protocolUDP
+		copy(ip[12:], src4)
+		copy(ip[16:], dst4)
+		binary.BigEndian.PutUint16(ip[10:], checksum(ip))
+		return append(ip, udp...) // UDP checksum is optional over IPv4
+	}
+
+	ip := make([]byte, 40, 40+len(udp))
+	ip[0] = 0x60
+	binary.BigEndian.PutUint16(ip[4:], uint16(len(udp)))
+	ip[6] = protocolUDP
+	ip[7] = 64
+	copy(ip[8:], src.IP.To16())
+	copy(ip[24:], dst.IP.To16())
+
+	// The UDP checksum is mandatory over IPv6 and covers a pseudo-header
+	pseudo := append(append([]byte(nil), ip[8:40]...), 0, 0, byte(len(udp)>>8), byte(len(udp)), 0, 0, 0, protocolUDP)
+	sum := checksum(pseudo, udp)
+	if sum == 0 {
+		sum = 0xffff
+	}
+	binary.BigEndian.PutUint16(udp[6:], sum)
+	return append(ip, udp...)
+}
+
+// checksum returns the Internet checksum (RFC 1071) of the concatenated
+// parts; every part but the last must have an even length
+func checksum(parts ...[]byte) uint16 {
+	var sum uint32
+	for _, data := range parts {
+		for i := 0; i+1 < len(data); i += 2 {
+			sum += uint32(binary.BigEndian.Uint16(data[i:]))
+		}
+		if len(data)%2 == 1 {
+			sum += uint32(data[len(data)-1]) << 8
+		}
+	}
+	for sum > 0xffff {
+		sum = sum>>16 + sum&0xffff
+	}
+	return ^uint16(sum)
+}
@@ -0,0 +1,101 @@
+package radiustest
+
+import (
+	"context"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"layeh.com/radius"
+	"layeh.com/radius/rfc2866"
+
+	"github.com/kal997/radius-accounting-server/internal/nas"
+)
+
+// NASOptions configure a fake NAS
+type NASOptions struct {
+	Secret  string        // Secret of the requests, Secret by default
+	Timeout time.Duration // Wait for a response, 2 seconds by default
+	TCP     bool          // Send over TCP instead of UDP
+}
+
+// NAS is a fake NAS sending accounting requests to the server. Requests are
+// not retransmitted, so that every record is stored once.
+type NAS struct {
+	t      testing.TB
+	client *nas.Client
+	secret []byte
+	rng    *rand.Rand
+	prefix string
+}
+
+// NAS creates a fake NAS sending to the server from its own socket or TCP
+// connection
+func (s *Server) NAS(t testing.TB, opts NASOptions) *NAS {
+	t.Helper()
+
+	if opts.Secret == "" {
+		opts.Secret = Secret
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = 2 * time.Second
+	}
+	var client *nas.Client
+	var err error
+	if opts.TCP {
+		client, err = nas.DialTCP(s.TCPAddr, []byte(opts.Secret), opts.Timeout)
+	} else {
+		client, err = nas.Dial(s.Addr, []byte(opts.Secret), opts.Timeout, 0)
+	}
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = client.Close() })
+
+	return &NAS{
+		t:      t,
+		client: client,
+		secret: []byte(opts.Secret),
+		rng:    rand.New(rand.NewSource(1)),
+		prefix: strings.ReplaceAll(t.Name(), "/", "-"),
+	}
+}
+
+// Session creates simulated session n, with a session ID unique to the test
+func (n *NAS) Session(i int) *nas.Session {
+	return nas.NewSession(n.rng, n.prefix, i, 1)
+}
+
+// Start sends the Accounting-Start of session and requires a response
+func (n *NAS) Start(session *nas.Session) {
+	n.t.Helper()
+	n.Send(session.Start(time.Now(), n.secret))
+}
+
+// Interim sends an Interim-Update of session and requires a response
+func (n *NAS) Interim(session *nas.Session) {
+	n.t.Helper()
+	n.Send(session.Interim(time.Now(), n.secret))
+}
+
+// Stop sends the Accounting-Stop of session and requires a response
+func (n *NAS) Stop(session *nas.Session) {
+	n.t.Helper()
+	n.Send(session.Stop(time.Now(), rfc2866.AcctTerminateCause_Value_UserRequest, n.secret))
+}
+
+// Send sends a request and requires an Accounting-Response
+func (n *NAS) Send(packet *radius.Packet) *radius.Packet {
+	n.t.Helper()
+
+	exchange, err := n.Exchange(packet)
+	require.NoError(n.t, err)
+	require.Equal(n.t, radius.CodeAccountingResponse, exchange.Response.Code)
+	return exchange.Response
+}
+
+// Exchange sends a request and returns the outcome, nas.ErrTimeout when it
+// is not answered
+func (n *NAS) Exchange(packet *radius.Packet) (nas.Exchange, error) {
+	return n.client.Send(context.Background(), packet)
+}
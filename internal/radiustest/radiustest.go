@@ -0,0 +1,238 @@
+// Package radiustest runs radius-controlplane and radius-controlplane-logger
+// inside a test: the accounting handler on ephemeral UDP and TCP ports, a
+// storage backend, the keyspace notifier on miniredis and the file logger.
+// A fake NAS sends accounting requests, and assertions check the stored
+// records and the log, without docker-compose or an external Redis.
+//
+//	srv := radiustest.Start(t, radiustest.Options{})
+//	nas := srv.NAS(t, radiustest.NASOptions{})
+//	session := nas.Session(1)
+//	nas.Start(session)
+//	nas.Stop(session)
+//	records := srv.RequireRecords(t, session, "start", "stop")
+//	srv.RequireLogged(t, records...)
+package radiustest
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/require"
+	"layeh.com/radius"
+
+	"github.com/kal997/radius-accounting-server/internal/accounting"
+	"github.com/kal997/radius-accounting-server/internal/config"
+	"github.com/kal997/radius-accounting-server/internal/logger"
+	"github.com/kal997/radius-accounting-server/internal/models"
+	"github.com/kal997/radius-accounting-server/internal/nas"
+	"github.com/kal997/radius-accounting-server/internal/notifier"
+	"github.com/kal997/radius-accounting-server/internal/storage"
+	"github.com/kal997/radius-accounting-server/internal/stream"
+)
+
+// Secret is the shared secret of the server and of fake NAS by default
+const Secret = "testing123"
+
+// logTimeout bounds the wait for an event to reach the log
+const logTimeout = 5 * time.Second
+
+// Options configure the server
+type Options struct {
+	// Backend stores the records: config.StorageBackendRedis, the default,
+	// on miniredis, or config.StorageBackendMemory
+	Backend config.StorageBackend
+}
+
+// Server is a controlplane and logger running in the test process. It is
+// stopped when the test ends.
+type Server struct {
+	Addr    string // UDP address of the accounting handler
+	TCPAddr string // TCP address of the accounting handler (RFC 6613)
+	Config  *config.ControlplaneConfig
+	Store   storage.Storage
+	Stats   *accounting.RequestStats
+	Redis   *miniredis.Miniredis // Also carries the notifications of the memory backend
+	LogFile string               // Written by the logger
+}
+
+// Start starts a server for the test
+func Start(t testing.TB, opts Options) *Server {
+	t.Helper()
+
+	backend := opts.Backend
+	if backend == "" {
+		backend = config.StorageBackendRedis
+	}
+	mr := miniredis.RunT(t)
+	dir := t.TempDir()
+
+	host, port, err := net.SplitHostPort(mr.Addr())
+	require.NoError(t, err)
+	path := filepath.Join(dir, "config.yaml")
+	content := fmt.Sprintf("radius:\n  shared_secret: %s\nredis:\n  host: %s\n  port: %s\nstorage:\n  backend: %s\n", Secret, host, port, backend)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+	cfg, err := config.LoadControlplane(path, nil)
+	require.NoError(t, err)
+	require.NoError(t, cfg.Validate())
+
+	store, err := storage.New(cfg)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = store.Close() })
+
+	s := &Server{
+		Config:  cfg,
+		Store:   store,
+		Stats:   accounting.NewRequestStats(),
+		Redis:   mr,
+		LogFile: filepath.Join(dir, "radius_accounting.log"),
+	}
+	s.startLogger(t)
+	s.startHandler(t)
+	return s
+}
+
+// startHandler serves the accounting handler on loopback UDP and TCP ports
+func (s *Server) startHandler(t testing.TB) {
+	t.Helper()
+
+	handler := accounting.NewHandler(&notifyingStorage{Storage: s.Store, redis: s.Redis}, s.Stats)
+	secrets := accounting.SecretSource(func() *config.ControlplaneConfig { return s.Config })
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s.Addr = conn.LocalAddr().String()
+	server := &radius.PacketServer{Handler: handler, SecretSource: secrets}
+	go func() { _ = server.Serve(conn) }()
+	t.Cleanup(func() { _ = server.Shutdown(context.Background()) })
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s.TCPAddr = listener.Addr().String()
+	tcpServer := &stream.Server{Handler: handler, SecretSource: secrets}
+	go func() { _ = tcpServer.Serve(listener) }()
+	t.Cleanup(func() { _ = tcpServer.Shutdown(context.Background()) })
+}
+
+// startLogger subscribes the logger to the notifications of miniredis
+func (s *Server) startLogger(t testing.TB) {
+	t.Helper()
+
+	redis, err := notifier.NewRedisNotifier(s.Redis.Addr())
+	require.NoError(t, err)
+	fileLogger, err := logger.NewFileLogger(s.LogFile)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events, err := redis.Subscribe(ctx, []string{"radius:acct:*"})
+	require.NoError(t, err)
+	// PSUBSCRIBE is not acknowledged before Subscribe returns, and events
+	// published before miniredis handles it are lost
+	require.Eventually(t, func() bool { return s.Redis.PubSubNumPat() > 0 },
+		logTimeout, time.Millisecond, "logger did not subscribe")
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		logger.Forward(ctx, events, fileLogger, nil, nil)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		wg.Wait()
+		_ = redis.Close()
+		_ = fileLogger.Close()
+	})
+}
+
+// notifyingStorage publishes the keyspace notification Redis would send
+// for every stored record, as miniredis publishes none
+type notifyingStorage struct {
+	storage.Storage
+	redis *miniredis.Miniredis
+}
+
+func (n *notifyingStorage) Store(ctx context.Context, record models.AccountingEvent) error {
+	if err := n.Storage.Store(ctx, record); err != nil {
+		return err
+	}
+	n.redis.Publish("__keyspace@0__:"+record.GenerateRedisKey(), "set")
+	return nil
+}
+
+// Records returns the stored records of a session, oldest first
+func (s *Server) Records(t testing.TB, session *nas.Session) []models.AccountingEvent {
+	t.Helper()
+
+	querier, ok := s.Store.(storage.Querier)
+	require.True(t, ok, "storage does not support queries")
+	q := storage.Query{Username: session.Username, AcctSessionID: session.ID}
+
+	var records []models.AccountingEvent
+	for {
+		result, err := querier.Query(context.Background(), q)
+		require.NoError(t, err)
+		records = append(records, result.Records...)
+		if result.NextCursor == "" {
+			return records
+		}
+		q.Cursor = result.NextCursor
+	}
+}
+
+// RequireRecords checks that the records of a session have the given types
+// (start, interim or stop), oldest first, and returns them
+func (s *Server) RequireRecords(t testing.TB, session *nas.Session, types ...string) []models.AccountingEvent {
+	t.Helper()
+
+	records := s.Records(t, session)
+	got := []string{}
+	for _, record := range records {
+		got = append(got, storage.RecordType(record))
+	}
+	if types == nil {
+		types = []string{}
+	}
+	require.Equal(t, types, got, "records of session %s", session.ID)
+	return records
+}
+
+// LogLines returns the lines written by the logger so far
+func (s *Server) LogLines(t testing.TB) []string {
+	t.Helper()
+
+	data, err := os.ReadFile(s.LogFile)
+	require.NoError(t, err)
+	return strings.FieldsFunc(string(data), func(r rune) bool { return r == '\n' })
+}
+
+// WaitForLog waits until a line of the log contains text
+func (s *Server) WaitForLog(t testing.TB, text string) {
+	t.Helper()
+
+	require.Eventually(t, func() bool {
+		for _, line := range s.LogLines(t) {
+			if strings.Contains(line, text) {
+				return true
+			}
+		}
+		return false
+	}, logTimeout, 10*time.Millisecond, "log does not contain %q", text)
+}
+
+// RequireLogged waits until the logger has logged every record
+func (s *Server) RequireLogged(t testing.TB, records ...models.AccountingEvent) {
+	t.Helper()
+
+	for _, record := range records {
+		s.WaitForLog(t, "Received update for key: "+record.GenerateRedisKey()+",")
+	}
+}
@@ -0,0 +1,65 @@
+package radiustest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kal997/radius-accounting-server/internal/config"
+	"github.com/kal997/radius-accounting-server/internal/models"
+	"github.com/kal997/radius-accounting-server/internal/nas"
+)
+
+func TestServer(t *testing.T) {
+	backends := []config.StorageBackend{config.StorageBackendRedis, config.StorageBackendMemory}
+	for _, backend := range backends {
+		t.Run(string(backend), func(t *testing.T) {
+			srv := Start(t, Options{Backend: backend})
+			client := srv.NAS(t, NASOptions{})
+
+			session := client.Session(1)
+			client.Start(session)
+			client.Interim(session)
+			client.Stop(session)
+
+			records := srv.RequireRecords(t, session, "start", "interim", "stop")
+			start, ok := records[0].(*models.StartRecord)
+			require.True(t, ok)
+			assert.Equal(t, session.Username, start.Username)
+			assert.Equal(t, session.NASIPAddress.String(), start.NASIPAddress)
+			srv.RequireLogged(t, records...)
+
+			counts := srv.Stats.Counts()
+			assert.Equal(t, uint64(3), counts.Received)
+			assert.Equal(t, uint64(3), counts.Stored)
+		})
+	}
+}
+
+func TestServer_TCP(t *testing.T) {
+	srv := Start(t, Options{})
+	client := srv.NAS(t, NASOptions{TCP: true})
+
+	session := client.Session(1)
+	client.Start(session)
+	client.Interim(session)
+	client.Stop(session)
+
+	records := srv.RequireRecords(t, session, "start", "interim", "stop")
+	srv.RequireLogged(t, records...)
+	assert.Equal(t, uint64(3), srv.Stats.Counts().Stored)
+}
+
+func TestServer_WrongSecret(t *testing.T) {
+	srv := Start(t, Options{})
+	client := srv.NAS(t, NASOptions{Secret: "wrong", Timeout: 200 * time.Millisecond})
+
+	session := client.Session(1)
+	_, err := client.Exchange(session.Start(time.Now(), []byte("wrong")))
+	require.ErrorIs(t, err, nas.ErrTimeout)
+
+	srv.RequireRecords(t, session)
+	assert.Zero(t, srv.Stats.Counts().Stored)
+}
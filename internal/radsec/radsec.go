@@ -0,0 +1,106 @@
+// Package radsec serves RADIUS over TLS (RFC 6614) for radius-controlplane.
+// NAS authenticate with certificates signed by the configured CA, and each
+// certificate is mapped to a NAS identity which may restrict the
+// NAS-IP-Address of its requests. The RADIUS packets inside the TLS session
+// use the fixed RadSec secret and reach the same handler as UDP requests.
+package radsec
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+
+	"layeh.com/radius"
+	"layeh.com/radius/rfc2865"
+
+	"github.com/kal997/radius-accounting-server/internal/config"
+	"github.com/kal997/radius-accounting-server/internal/stream"
+)
+
+type contextKey struct{}
+
+// Listen opens the TLS listener of cfg, which requires a client certificate
+func Listen(cfg *config.RadSecConfig) (net.Listener, error) {
+	tlsConfig, err := cfg.ServerConfig()
+	if err != nil {
+		return nil, err
+	}
+	return tls.Listen("tcp", cfg.GetAddress(), tlsConfig)
+}
+
+// NewServer returns the server of RadSec connections passing the requests
+// of authorised NAS to handler. current is called for every connection so
+// that a reloaded client mapping applies to new connections.
+func NewServer(handler radius.Handler, current func() *config.ControlplaneConfig) *stream.Server {
+	return &stream.Server{
+		Handler: authorize(handler),
+		SecretSource: secretSourceFunc(func(net.Addr) []byte {
+			return []byte(current().GetRadSec().GetSecret())
+		}),
+		ConnContext: func(ctx context.Context, conn net.Conn) (context.Context, error) {
+			client, err := identify(current().GetRadSec(), conn)
+			if err != nil {
+				return nil, err
+			}
+			log.Printf("RadSec connection from %s authenticated as %s", conn.RemoteAddr(), client.Name)
+			return context.WithValue(ctx, contextKey{}, client), nil
+		},
+	}
+}
+
+// ClientFromContext returns the NAS identity of the connection a request
+// was received on
+func ClientFromContext(ctx context.Context) (config.RadSecClient, bool) {
+	client, ok := ctx.Value(contextKey{}).(config.RadSecClient)
+	return client, ok
+}
+
+// identify maps the certificate of a connection to a NAS. Without a client
+// mapping, every certificate the CA verified is accepted under its common
+// name.
+func identify(cfg *config.RadSecConfig, conn net.Conn) (config.RadSecClient, error) {
+	tlsConn, ok := conn.(*tls.Conn)
+	if !ok {
+		return config.RadSecClient{}, fmt.Errorf("not a TLS connection")
+	}
+	certs := tlsConn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return config.RadSecClient{}, fmt.Errorf("no client certificate")
+	}
+
+	if len(cfg.GetClients()) == 0 {
+		return config.RadSecClient{Name: certs[0].Subject.CommonName}, nil
+	}
+	client, ok := cfg.LookupClient(certs[0])
+	if !ok {
+		return config.RadSecClient{}, fmt.Errorf("certificate %q is not mapped to a NAS", certs[0].Subject.CommonName)
+	}
+	return client, nil
+}
+
+// authorize drops the requests whose NAS-IP-Address is not allowed for the
+// NAS of their connection, so that a NAS cannot account for another
+func authorize(next radius.Handler) radius.Handler {
+	return radius.HandlerFunc(func(w radius.ResponseWriter, r *radius.Request) {
+		client, ok := ClientFromContext(r.Context())
+		if !ok {
+			return
+		}
+		if client.NASNetwork != nil {
+			ip := rfc2865.NASIPAddress_Get(r.Packet)
+			if ip == nil || !client.NASNetwork.Contains(ip) {
+				log.Printf("Dropped request from %s: NAS-IP-Address %v not allowed for %s", r.RemoteAddr, ip, client.Name)
+				return
+			}
+		}
+		next.ServeRADIUS(w, r)
+	})
+}
+
+type secretSourceFunc func(remoteAddr net.Addr) []byte
+
+func (f secretSourceFunc) RADIUSSecret(ctx context.Context, remoteAddr net.Addr) ([]byte, error) {
+	return f(remoteAddr), nil
+}
@@ -0,0 +1,271 @@
+package radsec
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"layeh.com/radius"
+	"layeh.com/radius/rfc2865"
+	"layeh.com/radius/rfc2866"
+
+	"github.com/kal997/radius-accounting-server/internal/accounting"
+	"github.com/kal997/radius-accounting-server/internal/config"
+	"github.com/kal997/radius-accounting-server/internal/storage"
+)
+
+// authority is a CA issuing certificates for the tests
+type authority struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	dir  string
+}
+
+func newAuthority(t *testing.T, name string) *authority {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	ca := &authority{cert: cert, key: key, dir: t.TempDir()}
+	writePEM(t, ca.path("ca.pem"), "CERTIFICATE", der)
+	return ca
+}
+
+func (ca *authority) path(name string) string {
+	return filepath.Join(ca.dir, name)
+}
+
+// issue writes a certificate and key for name, returning their paths
+func (ca *authority) issue(t *testing.T, name string, usage x509.ExtKeyUsage, ips ...net.IP) (certFile, keyFile string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		IPAddresses:  ips,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certFile, keyFile = ca.path(name+".pem"), ca.path(name+"-key.pem")
+	writePEM(t, certFile, "CERTIFICATE", der)
+	writePEM(t, keyFile, "EC PRIVATE KEY", keyDER)
+	return certFile, keyFile
+}
+
+func writePEM(t *testing.T, path, blockType string, der []byte) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600))
+}
+
+// serve starts a RadSec listener storing records in memory
+func serve(t *testing.T, ca *authority, clients string) (addr string, store storage.Storage) {
+	t.Helper()
+
+	certFile, keyFile := ca.issue(t, "radius.test", x509.ExtKeyUsageServerAuth, net.IPv4(127, 0, 0, 1))
+	path := ca.path("config.yaml")
+	content := fmt.Sprintf(`
+radius:
+  shared_secret: testsecret123
+storage:
+  backend: memory
+radsec:
+  address: 127.0.0.1:2083
+  cert_file: %s
+  key_file: %s
+  ca_file: %s
+%s`, certFile, keyFile, ca.path("ca.pem"), clients)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	cfg, err := config.LoadControlplane(path, nil)
+	require.NoError(t, err)
+
+	store = storage.NewInMemoryStorage(cfg)
+	t.Cleanup(func() { _ = store.Close() })
+
+	// Listen as Listen does, on an ephemeral port
+	tlsConfig, err := cfg.GetRadSec().ServerConfig()
+	require.NoError(t, err)
+	l, err := tls.Listen("tcp", "127.0.0.1:0", tlsConfig)
+	require.NoError(t, err)
+	server := NewServer(accounting.NewHandler(store, accounting.NewRequestStats()), func() *config.ControlplaneConfig { return cfg })
+	go func() { _ = server.Serve(l) }()
+	t.Cleanup(func() { _ = server.Shutdown(context.Background()) })
+	return l.Addr().String(), store
+}
+
+// dial connects as the NAS holding the certificate of name
+func dial(t *testing.T, addr string, ca, issuer *authority, name string) (*tls.Conn, error) {
+	t.Helper()
+
+	tlsConfig := &tls.Config{RootCAs: x509.NewCertPool(), ServerName: "radius.test"}
+	tlsConfig.RootCAs.AddCert(ca.cert)
+	if issuer != nil {
+		certFile, keyFile := issuer.issue(t, name, x509.ExtKeyUsageClientAuth)
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		require.NoError(t, err)
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	conn, err := tls.Dial("tcp", addr, tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	require.NoError(t, conn.SetDeadline(time.Now().Add(2*time.Second)))
+	// The server verifies the certificate during the handshake, and reports
+	// a rejection on the first read
+	return conn, conn.Handshake()
+}
+
+func startRequest(t *testing.T, sessionID string, nasIP net.IP) *radius.Packet {
+	t.Helper()
+
+	packet := radius.New(radius.CodeAccountingRequest, []byte(config.DefaultRadSecSecret))
+	require.NoError(t, rfc2865.UserName_SetString(packet, "alice"))
+	require.NoError(t, rfc2865.NASIPAddress_Set(packet, nasIP))
+	require.NoError(t, rfc2866.AcctSessionID_SetString(packet, sessionID))
+	require.NoError(t, rfc2866.AcctStatusType_Set(packet, rfc2866.AcctStatusType_Value_Start))
+	return packet
+}
+
+// exchange sends a request and reads its response
+func exchange(t *testing.T, conn net.Conn, request *radius.Packet) (*radius.Packet, error) {
+	t.Helper()
+
+	encoded, err := request.Encode()
+	require.NoError(t, err)
+	if _, err := conn.Write(encoded); err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, binary.BigEndian.Uint16(header[2:]))
+	copy(buf, header)
+	if _, err := io.ReadFull(conn, buf[4:]); err != nil {
+		return nil, err
+	}
+	if !radius.IsAuthenticResponse(buf, encoded, request.Secret) {
+		return nil, fmt.Errorf("response authenticator mismatch")
+	}
+	return radius.Parse(buf, request.Secret)
+}
+
+func records(t *testing.T, store storage.Storage, sessionID string) int {
+	t.Helper()
+
+	result, err := store.(storage.Querier).Query(context.Background(), storage.Query{AcctSessionID: sessionID})
+	require.NoError(t, err)
+	return len(result.Records)
+}
+
+func TestRadSec(t *testing.T) {
+	ca := newAuthority(t, "Test CA")
+	addr, store := serve(t, ca, `
+  clients:
+    - name: pop-1
+      subject: nas-1.test
+      nas_address: 10.1.0.0/16
+`)
+
+	conn, err := dial(t, addr, ca, ca, "nas-1.test")
+	require.NoError(t, err)
+
+	response, err := exchange(t, conn, startRequest(t, "session-1", net.IPv4(10, 1, 0, 1)))
+	require.NoError(t, err)
+	assert.Equal(t, radius.CodeAccountingResponse, response.Code)
+	assert.Equal(t, 1, records(t, store, "session-1"))
+
+	// A NAS-IP-Address outside the mapping is dropped without a response
+	_, err = exchange(t, conn, startRequest(t, "session-2", net.IPv4(10, 2, 0, 1)))
+	var netErr net.Error
+	require.ErrorAs(t, err, &netErr)
+	assert.True(t, netErr.Timeout())
+	assert.Zero(t, records(t, store, "session-2"))
+}
+
+func TestRadSec_RejectsCertificates(t *testing.T) {
+	ca := newAuthority(t, "Test CA")
+	addr, store := serve(t, ca, `
+  clients:
+    - name: pop-1
+      subject: nas-1.test
+`)
+
+	tests := []struct {
+		name   string
+		issuer *authority
+		cn     string
+	}{
+		{name: "no certificate"},
+		{name: "other CA", issuer: newAuthority(t, "Other CA"), cn: "nas-1.test"},
+		{name: "unmapped certificate", issuer: ca, cn: "nas-2.test"},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sessionID := fmt.Sprintf("rejected-%d", i)
+			conn, err := dial(t, addr, ca, tt.issuer, tt.cn)
+			if err == nil {
+				_, err = exchange(t, conn, startRequest(t, sessionID, net.IPv4(10, 1, 0, 1)))
+			}
+			assert.Error(t, err)
+			assert.Zero(t, records(t, store, sessionID))
+		})
+	}
+}
+
+func TestRadSec_AnyCertificateWithoutMapping(t *testing.T) {
+	ca := newAuthority(t, "Test CA")
+	addr, store := serve(t, ca, "")
+
+	conn, err := dial(t, addr, ca, ca, "nas-9.test")
+	require.NoError(t, err)
+
+	_, err = exchange(t, conn, startRequest(t, "session-1", net.IPv4(192, 0, 2, 1)))
+	require.NoError(t, err)
+	assert.Equal(t, 1, records(t, store, "session-1"))
+}
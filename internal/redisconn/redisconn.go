@@ -0,0 +1,68 @@
+// Package redisconn builds go-redis clients from the shared Redis configuration
+// so that storage and notifier connect with the same address, credentials,
+// database index and TLS settings, in standalone, Sentinel or Cluster mode.
+package redisconn
+
+import (
+	"fmt"
+
+	"github.com/kal997/radius-accounting-server/internal/config"
+	"github.com/redis/go-redis/v9"
+)
+
+// Options converts the Redis configuration into go-redis client options
+// for a standalone server
+func Options(cfg *config.RedisConfig) (*redis.Options, error) {
+	tlsConfig, err := cfg.GetTLS().ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("invalid Redis TLS configuration: %w", err)
+	}
+
+	return &redis.Options{
+		Addr:      cfg.GetAddr(),
+		Username:  cfg.GetUsername(),
+		Password:  cfg.GetPassword(),
+		DB:        cfg.GetDB(),
+		TLSConfig: tlsConfig,
+	}, nil
+}
+
+// NewClient creates a Redis client for the configuration: a *redis.Client
+// for standalone and Sentinel mode (following the current master) or a
+// *redis.ClusterClient for Cluster mode.
+// The connection is established lazily; callers should Ping to verify it.
+func NewClient(cfg *config.RedisConfig) (redis.UniversalClient, error) {
+	tlsConfig, err := cfg.GetTLS().ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("invalid Redis TLS configuration: %w", err)
+	}
+
+	switch cfg.GetMode() {
+	case config.RedisModeSentinel:
+		return redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:       cfg.GetSentinelMasterName(),
+			SentinelAddrs:    cfg.GetSentinelAddrs(),
+			SentinelUsername: cfg.GetSentinelUsername(),
+			SentinelPassword: cfg.GetSentinelPassword(),
+			Username:         cfg.GetUsername(),
+			Password:         cfg.GetPassword(),
+			DB:               cfg.GetDB(),
+			TLSConfig:        tlsConfig,
+		}), nil
+
+	case config.RedisModeCluster:
+		return redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:     cfg.GetClusterAddrs(),
+			Username:  cfg.GetUsername(),
+			Password:  cfg.GetPassword(),
+			TLSConfig: tlsConfig,
+		}), nil
+
+	default:
+		opts, err := Options(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return redis.NewClient(opts), nil
+	}
+}
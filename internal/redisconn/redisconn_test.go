@@ -0,0 +1,319 @@
+package redisconn
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/alicebob/miniredis/v2/server"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kal997/radius-accounting-server/internal/config"
+)
+
+// Helper to load a RedisConfig from a YAML redis section
+func loadRedisConfig(t *testing.T, redisSection string) *config.RedisConfig {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	content := "logging:\n  file: /tmp/test.log\nredis:\n" + redisSection
+	require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+
+	cfg, err := config.LoadLogger(path, nil)
+	require.NoError(t, err)
+	return cfg.GetRedis()
+}
+
+func TestNewClient_Plain(t *testing.T) {
+	mr, err := miniredis.Run()
+	require.NoError(t, err)
+	defer mr.Close()
+
+	host, port, err := net.SplitHostPort(mr.Addr())
+	require.NoError(t, err)
+
+	client, err := NewClient(loadRedisConfig(t, fmt.Sprintf("  host: %s\n  port: %s\n  db: 3\n", host, port)))
+	require.NoError(t, err)
+	defer func() {
+		_ = client.Close()
+	}()
+
+	ctx := context.Background()
+	require.NoError(t, client.Set(ctx, "key", "value", 0).Err())
+
+	// The key must land in the configured database
+	got, err := mr.DB(3).Get("key")
+	require.NoError(t, err)
+	assert.Equal(t, "value", got)
+	assert.False(t, mr.Exists("key"))
+}
+
+func TestNewClient_Auth(t *testing.T) {
+	mr, err := miniredis.Run()
+	require.NoError(t, err)
+	defer mr.Close()
+	mr.RequireUserAuth("radius", "redispass123")
+
+	host, port, err := net.SplitHostPort(mr.Addr())
+	require.NoError(t, err)
+
+	passwordFile := filepath.Join(t.TempDir(), "redis_password")
+	require.NoError(t, os.WriteFile(passwordFile, []byte("redispass123\n"), 0600))
+
+	tests := []struct {
+		name    string
+		section string
+		wantErr bool
+	}{
+		{
+			name:    "password from file",
+			section: fmt.Sprintf("  host: %s\n  port: %s\n  username: radius\n  password_file: %s\n", host, port, passwordFile),
+		},
+		{
+			name:    "wrong password",
+			section: fmt.Sprintf("  host: %s\n  port: %s\n  username: radius\n  password: wrongpass\n", host, port),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := NewClient(loadRedisConfig(t, tt.section))
+			require.NoError(t, err)
+			defer func() {
+				_ = client.Close()
+			}()
+
+			err = client.Ping(context.Background()).Err()
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestNewClient_TLS(t *testing.T) {
+	dir := t.TempDir()
+	caFile, certFile, keyFile := writeTestCertificates(t, dir)
+
+	serverCert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	require.NoError(t, err)
+
+	mr, err := miniredis.RunTLS(&tls.Config{Certificates: []tls.Certificate{serverCert}})
+	require.NoError(t, err)
+	defer mr.Close()
+
+	host, port, err := net.SplitHostPort(mr.Addr())
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		section string
+		wantErr bool
+	}{
+		{
+			name: "trusted CA",
+			section: fmt.Sprintf("  host: %s\n  port: %s\n  tls:\n    enabled: true\n    ca_file: %s\n    server_name: localhost\n",
+				host, port, caFile),
+		},
+		{
+			name:    "unknown CA",
+			section: fmt.Sprintf("  host: %s\n  port: %s\n  tls:\n    enabled: true\n    server_name: localhost\n", host, port),
+			wantErr: true,
+		},
+		{
+			name: "client certificate",
+			section: fmt.Sprintf("  host: %s\n  port: %s\n  tls:\n    enabled: true\n    ca_file: %s\n    cert_file: %s\n    key_file: %s\n    server_name: localhost\n",
+				host, port, caFile, certFile, keyFile),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := NewClient(loadRedisConfig(t, tt.section))
+			require.NoError(t, err)
+			defer func() {
+				_ = client.Close()
+			}()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+
+			err = client.Ping(ctx).Err()
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestOptions(t *testing.T) {
+	opts, err := Options(loadRedisConfig(t, "  host: redis\n  port: 6380\n  username: radius\n  password: pass\n  db: 2\n"))
+
+	require.NoError(t, err)
+	assert.Equal(t, "redis:6380", opts.Addr)
+	assert.Equal(t, "radius", opts.Username)
+	assert.Equal(t, "pass", opts.Password)
+	assert.Equal(t, 2, opts.DB)
+	assert.Nil(t, opts.TLSConfig)
+}
+
+// writeTestCertificates generates a CA and a certificate for localhost and
+// 127.0.0.1 signed by it, returning the PEM file paths
+func writeTestCertificates(t *testing.T, dir string) (caFile, certFile, keyFile string) {
+	t.Helper()
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+	caCert, err := x509.ParseCertificate(caDER)
+	require.NoError(t, err)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	caFile = filepath.Join(dir, "ca.pem")
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}), 0600))
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+
+	return caFile, certFile, keyFile
+}
+
+// runSentinel starts a miniredis stand-in for Redis Sentinel that reports
+// master as the address of the monitored master "mymaster"
+func runSentinel(t *testing.T, master *miniredis.Miniredis) *miniredis.Miniredis {
+	t.Helper()
+	sentinel, err := miniredis.Run()
+	require.NoError(t, err)
+	t.Cleanup(sentinel.Close)
+
+	host, port, err := net.SplitHostPort(master.Addr())
+	require.NoError(t, err)
+
+	require.NoError(t, sentinel.Server().Register("SENTINEL", func(c *server.Peer, cmd string, args []string) {
+		switch {
+		case len(args) == 2 && strings.EqualFold(args[0], "get-master-addr-by-name") && args[1] == "mymaster":
+			c.WriteStrings([]string{host, port})
+		case len(args) == 2 && strings.EqualFold(args[0], "get-master-addr-by-name"):
+			c.WriteNull()
+		case len(args) == 2 && (strings.EqualFold(args[0], "sentinels") || strings.EqualFold(args[0], "replicas")):
+			c.WriteLen(0)
+		default:
+			c.WriteError("ERR unsupported SENTINEL subcommand")
+		}
+	}))
+
+	return sentinel
+}
+
+func TestNewClient_Sentinel(t *testing.T) {
+	master, err := miniredis.Run()
+	require.NoError(t, err)
+	defer master.Close()
+	sentinel := runSentinel(t, master)
+
+	tests := []struct {
+		name       string
+		masterName string
+		wantErr    bool
+	}{
+		{name: "known master", masterName: "mymaster"},
+		{name: "unknown master", masterName: "othermaster", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := NewClient(loadRedisConfig(t, fmt.Sprintf(
+				"  mode: sentinel\n  db: 1\n  sentinel:\n    master_name: %s\n    addresses: [%s]\n", tt.masterName, sentinel.Addr())))
+			require.NoError(t, err)
+			defer func() {
+				_ = client.Close()
+			}()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+
+			err = client.Set(ctx, "key", "value", 0).Err()
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			// The write went to the master reported by Sentinel
+			got, err := master.DB(1).Get("key")
+			require.NoError(t, err)
+			assert.Equal(t, "value", got)
+		})
+	}
+}
+
+func TestNewClient_Cluster(t *testing.T) {
+	// miniredis answers CLUSTER SLOTS as a single node owning every slot
+	mr, err := miniredis.Run()
+	require.NoError(t, err)
+	defer mr.Close()
+
+	client, err := NewClient(loadRedisConfig(t, fmt.Sprintf("  mode: cluster\n  cluster:\n    addresses: [%s]\n", mr.Addr())))
+	require.NoError(t, err)
+	defer func() {
+		_ = client.Close()
+	}()
+
+	_, ok := client.(*redis.ClusterClient)
+	require.True(t, ok, "expected a cluster client, got %T", client)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	require.NoError(t, client.Set(ctx, "key", "value", 0).Err())
+	got, err := mr.Get("key")
+	require.NoError(t, err)
+	assert.Equal(t, "value", got)
+}
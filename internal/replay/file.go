@@ -0,0 +1,157 @@
+package replay
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/kal997/radius-accounting-server/internal/detail"
+	"github.com/kal997/radius-accounting-server/internal/models"
+	"github.com/kal997/radius-accounting-server/internal/pcap"
+	"github.com/kal997/radius-accounting-server/internal/storage"
+)
+
+// Format is the format of a file to replay
+type Format string
+
+// Supported formats
+const (
+	FormatAuto   Format = ""       // Detected from the contents
+	FormatJSONL  Format = "jsonl"  // Archive files and JSON lines exports, optionally gzip compressed
+	FormatDetail Format = "detail" // FreeRADIUS detail files
+	FormatPcap   Format = "pcap"   // libpcap or pcapng captures of RADIUS traffic
+)
+
+// ParseFormat validates a format name; "auto" and "" detect the format
+func ParseFormat(name string) (Format, error) {
+	switch Format(name) {
+	case FormatJSONL, FormatDetail, FormatPcap:
+		return Format(name), nil
+	case FormatAuto, "auto":
+		return FormatAuto, nil
+	default:
+		return "", fmt.Errorf("unknown replay format %q, expected auto, jsonl, detail or pcap", name)
+	}
+}
+
+// File is an open file to replay
+type File struct {
+	Source
+	Format Format
+
+	file    *os.File
+	closers []io.Closer
+}
+
+// Open opens a file in the given format, or in the format detected from its
+// first bytes. packets configures the decoding of captures.
+func Open(path string, format Format, packets PacketOptions) (*File, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	f := &File{file: file, Format: format}
+
+	r := bufio.NewReader(file)
+	head, _ := r.Peek(4)
+	if f.Format == FormatAuto {
+		f.Format = detect(head)
+	}
+
+	switch f.Format {
+	case FormatJSONL:
+		var in io.Reader = r
+		if bytes.HasPrefix(head, []byte{0x1f, 0x8b}) {
+			gz, err := gzip.NewReader(r)
+			if err != nil {
+				_ = file.Close()
+				return nil, fmt.Errorf("failed to read %s: %w", path, err)
+			}
+			f.closers = append(f.closers, gz)
+			in = gz
+		}
+		f.Source = &jsonlSource{dec: json.NewDecoder(in)}
+
+	case FormatDetail:
+		f.Source = detail.NewReader(r)
+
+	case FormatPcap:
+		reader, err := pcap.NewReader(r)
+		if err != nil {
+			_ = file.Close()
+			return nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		f.Source = NewPacketSource(reader, packets)
+
+	default:
+		_ = file.Close()
+		return nil, fmt.Errorf("unknown replay format %q", f.Format)
+	}
+	return f, nil
+}
+
+// detect returns the format of a file starting with head: captures by their
+// magic number, gzip compressed or JSON files as JSON lines, and anything else
+// as a detail file
+func detect(head []byte) Format {
+	if len(head) == 4 {
+		for _, magic := range []uint32{0xa1b2c3d4, 0xa1b23c4d, 0x0a0d0d0a} {
+			if binary.LittleEndian.Uint32(head) == magic || binary.BigEndian.Uint32(head) == magic {
+				return FormatPcap
+			}
+		}
+	}
+	if bytes.HasPrefix(head, []byte{0x1f, 0x8b}) || bytes.HasPrefix(bytes.TrimLeft(head, " \t\r\n"), []byte("{")) {
+		return FormatJSONL
+	}
+	return FormatDetail
+}
+
+// Skipped returns the number of entries that were not replayed because they
+// are not accounting records: detail entries such as Accounting-On, and
+// captured packets other than authentic Accounting-Requests, including
+// retransmissions
+func (f *File) Skipped() int {
+	switch s := f.Source.(type) {
+	case *detail.Reader:
+		return s.Skipped
+	case *PacketSource:
+		return s.Skipped
+	default:
+		return 0
+	}
+}
+
+// Close closes the file
+func (f *File) Close() error {
+	for _, closer := range f.closers {
+		_ = closer.Close()
+	}
+	return f.file.Close()
+}
+
+// jsonlSource reads records in the format of archive files and JSON lines
+// exports: one {"key": ..., "record": ...} object per line
+type jsonlSource struct {
+	dec  *json.Decoder
+	line int
+}
+
+func (s *jsonlSource) Next() (models.AccountingEvent, error) {
+	var line storage.KeyedRecord
+	err := s.dec.Decode(&line)
+	if errors.Is(err, io.EOF) {
+		return nil, io.EOF
+	}
+	s.line++
+	if err != nil {
+		return nil, fmt.Errorf("record %d: %w", s.line, err)
+	}
+	return line.Record, nil
+}
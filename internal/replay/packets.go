@@ -0,0 +1,130 @@
+package replay
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"time"
+
+	"layeh.com/radius"
+
+	"github.com/kal997/radius-accounting-server/internal/models"
+	"github.com/kal997/radius-accounting-server/internal/pcap"
+)
+
+// DefaultPort is the accounting port decoded when PacketOptions.Port is zero
+const DefaultPort = 1813
+
+// ErrNotAuthentic is reported for Accounting-Requests whose authenticator
+// does not match the shared secret of their client
+var ErrNotAuthentic = errors.New("authenticator does not match the shared secret")
+
+// PacketOptions configure the decoding of captured RADIUS traffic
+type PacketOptions struct {
+	// Port is the accounting port of the server; only datagrams sent to it
+	// are decoded. DefaultPort when zero.
+	Port int
+
+	// Secret returns the shared secret of the client at ip
+	Secret func(ip net.IP) string
+
+	// Rejected is called, if set, for each datagram sent to the port that
+	// is not a valid RADIUS packet or not authentic
+	Rejected func(datagram pcap.Datagram, err error)
+}
+
+// requestID identifies the requests of a client that are retransmissions of
+// each other
+type requestID struct {
+	client     string
+	identifier byte
+}
+
+// PacketSource decodes the Accounting-Requests of a capture like the server
+// does on receipt: the record's timestamp is the capture time and its client
+// IP the source address of the datagram.
+type PacketSource struct {
+	reader *pcap.Reader
+	opts   PacketOptions
+
+	// Authenticator of the last request per client address and identifier
+	last map[requestID][16]byte
+
+	// Skipped counts the packets sent to the port that are not
+	// Accounting-Requests, and retransmitted requests
+	Skipped int
+}
+
+// NewPacketSource creates a source of the requests captured by reader
+func NewPacketSource(reader *pcap.Reader, opts PacketOptions) *PacketSource {
+	if opts.Port == 0 {
+		opts.Port = DefaultPort
+	}
+	return &PacketSource{
+		reader: reader,
+		opts:   opts,
+		last:   make(map[requestID][16]byte),
+	}
+}
+
+// Next returns the record of the next Accounting-Request
+func (s *PacketSource) Next() (models.AccountingEvent, error) {
+	for {
+		captured, err := s.reader.Next()
+		if err != nil {
+			return nil, err
+		}
+		datagram, ok := pcap.DecodeUDP(captured)
+		if !ok || datagram.Dst.Port != s.opts.Port {
+			continue
+		}
+
+		record, err := s.decode(datagram, captured.Time)
+		if err != nil {
+			if s.opts.Rejected != nil {
+				s.opts.Rejected(datagram, err)
+			}
+			continue
+		}
+		if record == nil {
+			s.Skipped++
+			continue
+		}
+		return record, nil
+	}
+}
+
+// decode returns the record of a request, or nil for other packets and
+// retransmissions
+func (s *PacketSource) decode(datagram pcap.Datagram, received time.Time) (models.AccountingEvent, error) {
+	var secret []byte
+	if s.opts.Secret != nil {
+		secret = []byte(s.opts.Secret(datagram.Src.IP))
+	}
+	packet, err := radius.Parse(datagram.Payload, secret)
+	if err != nil {
+		return nil, err
+	}
+	if packet.Code != radius.CodeAccountingRequest {
+		return nil, nil
+	}
+	length := binary.BigEndian.Uint16(datagram.Payload[2:]) // Checked by Parse
+	if !radius.IsAuthenticRequest(datagram.Payload[:length], secret) {
+		return nil, ErrNotAuthentic
+	}
+
+	// A NAS retransmits a request unchanged, with the same identifier and
+	// authenticator
+	id := requestID{client: datagram.Src.String(), identifier: packet.Identifier}
+	if last, ok := s.last[id]; ok && last == packet.Authenticator {
+		return nil, nil
+	}
+	s.last[id] = packet.Authenticator
+
+	record, err := models.ParseRADIUSPacket(packet, datagram.Src.IP.String())
+	if err != nil {
+		return nil, err
+	}
+	record.Base().Timestamp = received.UTC().Format(time.RFC3339Nano)
+	return record, nil
+}
@@ -0,0 +1,249 @@
+// Package replay stores accounting records again from JSON lines files,
+// FreeRADIUS detail files or packet captures, to recover data lost to an
+// outage or a bug.
+//
+// Records go through the same validation as received packets. A record is
+// skipped as a duplicate when a record of the same NAS, session and type
+// with an event time within DuplicateWindow of its own was already replayed
+// or, with a storage that supports queries, is already stored. Keys cannot
+// be compared: they include the receipt time, which a capture holds as the
+// capture time and a detail file to the second. Replaying overlapping
+// sources, or the same source twice, therefore stores each record once.
+package replay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/kal997/radius-accounting-server/internal/models"
+	"github.com/kal997/radius-accounting-server/internal/storage"
+)
+
+// DuplicateWindow is how far apart the event times of two records of the same
+// NAS, session and type may be for them to be the same record. It covers the
+// second precision of detail files and the delay between the capture and the
+// processing of a packet, and is far below any Acct-Interim-Interval.
+const DuplicateWindow = 2 * time.Second
+
+// Source yields the records to replay
+type Source interface {
+	// Next returns the next record, or io.EOF after the last one
+	Next() (models.AccountingEvent, error)
+}
+
+// Options configure a Replayer
+type Options struct {
+	// DryRun validates and deduplicates records without storing them
+	DryRun bool
+
+	// Rate limits the records stored per second, zero for no limit
+	Rate float64
+
+	// From and To restrict the replay to records with event times in
+	// [From, To); zero for no bound
+	From time.Time
+	To   time.Time
+
+	// Invalid is called for each record that fails validation, if set
+	Invalid func(record models.AccountingEvent, err error)
+}
+
+// Result counts the records replayed so far
+type Result struct {
+	Stored     int // Stored, or would be stored in a dry run
+	Duplicates int // Already stored or replayed
+	Invalid    int // Failed validation
+	Outside    int // Outside of the time range
+}
+
+// Replayer stores the records of one or more sources
+type Replayer struct {
+	store   storage.Storage
+	querier storage.Querier // Nil when the storage cannot be checked for duplicates
+	opts    Options
+
+	seen   map[recordIdentity][]time.Time // Event times replayed so far
+	next   time.Time                      // Earliest time of the next store under the rate limit
+	result Result
+}
+
+// recordIdentity identifies the records that may be the same record, stored
+// at slightly different times
+type recordIdentity struct {
+	nasIPAddress  string
+	acctSessionID string
+	recordType    string
+}
+
+func identityOf(record models.AccountingEvent) recordIdentity {
+	base := record.Base()
+	return recordIdentity{
+		nasIPAddress:  base.NASIPAddress,
+		acctSessionID: base.AcctSessionID,
+		recordType:    storage.RecordType(record),
+	}
+}
+
+// within reports whether two event times are within DuplicateWindow
+func within(a, b time.Time) bool {
+	d := a.Sub(b)
+	return d > -DuplicateWindow && d < DuplicateWindow
+}
+
+// New creates a replayer that stores records in store, which may be nil for a
+// dry run
+func New(store storage.Storage, opts Options) *Replayer {
+	querier, _ := store.(storage.Querier)
+	return &Replayer{
+		store:   store,
+		querier: querier,
+		opts:    opts,
+		seen:    make(map[recordIdentity][]time.Time),
+	}
+}
+
+// Result returns the counts of the records replayed so far
+func (r *Replayer) Result() Result {
+	return r.result
+}
+
+// Replay stores the records of src until it is exhausted. Errors reading the
+// source or storing a record stop the replay; records stored before remain.
+func (r *Replayer) Replay(ctx context.Context, src Source) error {
+	for {
+		record, err := src.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := r.replay(ctx, record); err != nil {
+			return err
+		}
+	}
+}
+
+// replay stores one record unless it is invalid or a duplicate
+func (r *Replayer) replay(ctx context.Context, record models.AccountingEvent) error {
+	t := storage.RecordTime(record, time.Time{})
+	if (!r.opts.From.IsZero() && t.Before(r.opts.From)) || (!r.opts.To.IsZero() && !t.Before(r.opts.To)) {
+		r.result.Outside++
+		return nil
+	}
+
+	if err := record.Validate(); err != nil {
+		r.result.Invalid++
+		if r.opts.Invalid != nil {
+			r.opts.Invalid(record, err)
+		}
+		return nil
+	}
+
+	duplicate, err := r.duplicate(ctx, record, t)
+	if err != nil {
+		return err
+	}
+	if duplicate {
+		r.result.Duplicates++
+		return nil
+	}
+	id := identityOf(record)
+	r.seen[id] = append(r.seen[id], t)
+
+	key := record.GenerateRedisKey()
+	if !r.opts.DryRun {
+		if err := r.wait(ctx); err != nil {
+			return err
+		}
+		if err := r.store.Store(ctx, record); err != nil {
+			return fmt.Errorf("failed to store %s: %w", key, err)
+		}
+	}
+	r.result.Stored++
+	return nil
+}
+
+// duplicate reports whether a record with event time t was replayed or is
+// already stored
+func (r *Replayer) duplicate(ctx context.Context, record models.AccountingEvent, t time.Time) (bool, error) {
+	id := identityOf(record)
+	for _, seen := range r.seen[id] {
+		if within(seen, t) {
+			return true, nil
+		}
+	}
+	if r.querier == nil {
+		return false, nil
+	}
+
+	// Records without an event time can only match their own key
+	key := record.GenerateRedisKey()
+	if t.IsZero() {
+		_, err := r.querier.Record(ctx, key)
+		switch {
+		case err == nil:
+			return true, nil
+		case errors.Is(err, storage.ErrNotFound):
+			return false, nil
+		}
+		return r.queryFailed(key, err)
+	}
+
+	q := storage.Query{
+		AcctSessionID: id.acctSessionID,
+		NASIPAddress:  id.nasIPAddress,
+		From:          t.Add(-DuplicateWindow + time.Microsecond),
+		To:            t.Add(DuplicateWindow),
+		Limit:         storage.MaxQueryLimit,
+	}
+	for {
+		result, err := r.querier.Query(ctx, q)
+		if err != nil {
+			return r.queryFailed(key, err)
+		}
+		for _, stored := range result.Records {
+			if storage.RecordType(stored) == id.recordType {
+				return true, nil
+			}
+		}
+		if result.NextCursor == "" {
+			return false, nil
+		}
+		q.Cursor = result.NextCursor
+	}
+}
+
+// queryFailed stops checking the storage when it cannot be queried, and
+// reports other errors
+func (r *Replayer) queryFailed(key string, err error) (bool, error) {
+	if errors.Is(err, storage.ErrQueryNotSupported) {
+		r.querier = nil
+		return false, nil
+	}
+	return false, fmt.Errorf("failed to check for %s: %w", key, err)
+}
+
+// wait blocks until the rate limit allows the next store
+func (r *Replayer) wait(ctx context.Context) error {
+	if r.opts.Rate <= 0 {
+		return nil
+	}
+
+	now := time.Now()
+	if delay := r.next.Sub(now); delay > 0 {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+		now = r.next
+	}
+	r.next = now.Add(time.Duration(float64(time.Second) / r.opts.Rate))
+	return nil
+}
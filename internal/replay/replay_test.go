@@ -0,0 +1,289 @@
+package replay
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"layeh.com/radius"
+	"layeh.com/radius/rfc2865"
+	"layeh.com/radius/rfc2866"
+
+	"github.com/kal997/radius-accounting-server/internal/config"
+	"github.com/kal997/radius-accounting-server/internal/detail"
+	"github.com/kal997/radius-accounting-server/internal/models"
+	"github.com/kal997/radius-accounting-server/internal/pcap"
+	"github.com/kal997/radius-accounting-server/internal/storage"
+)
+
+var testStart = &models.StartRecord{
+	BaseAccountingRecord: models.BaseAccountingRecord{
+		Username:      "alice",
+		NASIPAddress:  "192.168.1.1",
+		AcctSessionID: "a1",
+		ClientIP:      "192.168.1.1",
+		Timestamp:     "2024-01-15T10:00:00Z",
+	},
+	FramedIPAddress: "10.0.0.1",
+}
+
+// sliceSource replays a fixed list of records
+type sliceSource []models.AccountingEvent
+
+func (s *sliceSource) Next() (models.AccountingEvent, error) {
+	if len(*s) == 0 {
+		return nil, io.EOF
+	}
+	record := (*s)[0]
+	*s = (*s)[1:]
+	return record, nil
+}
+
+func newMemoryStorage(t *testing.T) *storage.InMemoryStorage {
+	t.Helper()
+	_ = os.Setenv("RADIUS_SHARED_SECRET", "testing123")
+	_ = os.Setenv("STORAGE_BACKEND", "memory")
+	defer func() {
+		_ = os.Unsetenv("RADIUS_SHARED_SECRET")
+		_ = os.Unsetenv("STORAGE_BACKEND")
+	}()
+
+	cfg, err := config.LoadControlplane("", nil)
+	require.NoError(t, err)
+	store := storage.NewInMemoryStorage(cfg)
+	t.Cleanup(func() { _ = store.Close() })
+	return store
+}
+
+func TestReplayer(t *testing.T) {
+	store := newMemoryStorage(t)
+	ctx := context.Background()
+
+	invalid := &models.StartRecord{BaseAccountingRecord: testStart.BaseAccountingRecord}
+	early := &models.StartRecord{BaseAccountingRecord: testStart.BaseAccountingRecord, FramedIPAddress: "10.0.0.2"}
+	early.Timestamp = "2024-01-14T23:59:59Z"
+
+	var rejected []error
+	replayer := New(store, Options{
+		From:    time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC),
+		Invalid: func(record models.AccountingEvent, err error) { rejected = append(rejected, err) },
+	})
+	require.NoError(t, replayer.Replay(ctx, &sliceSource{testStart, invalid, testStart, early}))
+	assert.Equal(t, Result{Stored: 1, Duplicates: 1, Invalid: 1, Outside: 1}, replayer.Result())
+	assert.Len(t, rejected, 1)
+
+	record, err := store.Record(ctx, testStart.GenerateRedisKey())
+	require.NoError(t, err)
+	assert.Equal(t, testStart, record)
+
+	// A second replay finds the record already stored
+	replayer = New(store, Options{})
+	require.NoError(t, replayer.Replay(ctx, &sliceSource{testStart}))
+	assert.Equal(t, Result{Duplicates: 1}, replayer.Result())
+}
+
+func TestReplayer_DryRunAndRate(t *testing.T) {
+	store := newMemoryStorage(t)
+	ctx := context.Background()
+
+	second := &models.StartRecord{BaseAccountingRecord: testStart.BaseAccountingRecord, FramedIPAddress: "10.0.0.1"}
+	second.AcctSessionID = "a2"
+
+	replayer := New(store, Options{DryRun: true})
+	require.NoError(t, replayer.Replay(ctx, &sliceSource{testStart, second}))
+	assert.Equal(t, Result{Stored: 2}, replayer.Result())
+	_, err := store.Record(ctx, testStart.GenerateRedisKey())
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+
+	replayer = New(store, Options{Rate: 20})
+	begin := time.Now()
+	require.NoError(t, replayer.Replay(ctx, &sliceSource{testStart, second}))
+	assert.GreaterOrEqual(t, time.Since(begin), 50*time.Millisecond)
+	assert.Equal(t, Result{Stored: 2}, replayer.Result())
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	third := &models.StartRecord{BaseAccountingRecord: second.BaseAccountingRecord, FramedIPAddress: "10.0.0.1"}
+	third.AcctSessionID = "a3"
+	fourth := &models.StartRecord{BaseAccountingRecord: third.BaseAccountingRecord, FramedIPAddress: "10.0.0.1"}
+	fourth.AcctSessionID = "a4"
+	assert.ErrorIs(t, New(store, Options{Rate: 1}).Replay(cancelled, &sliceSource{third, fourth}), context.Canceled)
+}
+
+func TestOpen_JSONL(t *testing.T) {
+	dir := t.TempDir()
+
+	var lines bytes.Buffer
+	require.NoError(t, json.NewEncoder(&lines).Encode(map[string]any{"key": testStart.GenerateRedisKey(), "record": testStart}))
+
+	plain := filepath.Join(dir, "export.jsonl")
+	require.NoError(t, os.WriteFile(plain, lines.Bytes(), 0o600))
+
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	_, _ = gz.Write(lines.Bytes())
+	require.NoError(t, gz.Close())
+	archived := filepath.Join(dir, "radius-accounting-20240115T10Z.jsonl.gz")
+	require.NoError(t, os.WriteFile(archived, compressed.Bytes(), 0o600))
+
+	for _, path := range []string{plain, archived} {
+		f, err := Open(path, FormatAuto, PacketOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, FormatJSONL, f.Format)
+
+		record, err := f.Next()
+		require.NoError(t, err)
+		assert.Equal(t, testStart, record)
+		_, err = f.Next()
+		assert.ErrorIs(t, err, io.EOF)
+		require.NoError(t, f.Close())
+	}
+}
+
+func TestOpen_Detail(t *testing.T) {
+	var entry bytes.Buffer
+	require.NoError(t, detail.Encode(&entry, testStart))
+	path := filepath.Join(t.TempDir(), "detail-20240115")
+	require.NoError(t, os.WriteFile(path, entry.Bytes(), 0o600))
+
+	f, err := Open(path, FormatAuto, PacketOptions{})
+	require.NoError(t, err)
+	defer f.Close()
+	assert.Equal(t, FormatDetail, f.Format)
+
+	record, err := f.Next()
+	require.NoError(t, err)
+	assert.Equal(t, testStart, record)
+}
+
+// accountingRequest encodes a Start request as a NAS would send it
+func accountingRequest(t *testing.T, identifier byte, secret string) []byte {
+	t.Helper()
+	packet := radius.New(radius.CodeAccountingRequest, []byte(secret))
+	packet.Identifier = identifier
+	require.NoError(t, rfc2866.AcctStatusType_Set(packet, rfc2866.AcctStatusType_Value_Start))
+	require.NoError(t, rfc2865.UserName_SetString(packet, "alice"))
+	require.NoError(t, rfc2866.AcctSessionID_SetString(packet, "a1"))
+	require.NoError(t, rfc2865.NASIPAddress_Set(packet, net.ParseIP("192.168.1.1")))
+	require.NoError(t, rfc2865.FramedIPAddress_Set(packet, net.ParseIP("10.0.0.1")))
+	data, err := packet.Encode()
+	require.NoError(t, err)
+	return data
+}
+
+// capture writes a libpcap file of raw IPv4 packets, one second apart
+func capture(t *testing.T, src string, srcPort, dstPort int, payloads ...[]byte) string {
+	t.Helper()
+
+	var file bytes.Buffer
+	for _, v := range []uint32{0xa1b2c3d4, 0x00040002, 0, 0, 65535, uint32(pcap.LinkTypeRaw)} {
+		_ = binary.Write(&file, binary.LittleEndian, v)
+	}
+	for i, payload := range payloads {
+		ip := make([]byte, 28, 28+len(payload))
+		ip[0] = 0x45
+		binary.BigEndian.PutUint16(ip[2:], uint16(28+len(payload)))
+		ip[9] = 17
+		copy(ip[12:], net.ParseIP(src).To4())
+		copy(ip[16:], net.ParseIP("10.255.0.1").To4())
+		binary.BigEndian.PutUint16(ip[20:], uint16(srcPort))
+		binary.BigEndian.PutUint16(ip[22:], uint16(dstPort))
+		binary.BigEndian.PutUint16(ip[24:], uint16(8+len(payload)))
+		ip = append(ip, payload...)
+
+		for _, v := range []uint32{1705312800 + uint32(i), 250000, uint32(len(ip)), uint32(len(ip))} {
+			_ = binary.Write(&file, binary.LittleEndian, v)
+		}
+		file.Write(ip)
+	}
+
+	path := filepath.Join(t.TempDir(), "radius.pcap")
+	require.NoError(t, os.WriteFile(path, file.Bytes(), 0o600))
+	return path
+}
+
+func TestOpen_Pcap(t *testing.T) {
+	request := accountingRequest(t, 1, "testing123")
+	forged := accountingRequest(t, 2, "wrongsecret")
+	path := capture(t, "192.168.1.1", 40000, 1813, request, request, forged, []byte("short"))
+
+	var rejected []error
+	f, err := Open(path, FormatAuto, PacketOptions{
+		Secret:   func(net.IP) string { return "testing123" },
+		Rejected: func(datagram pcap.Datagram, err error) { rejected = append(rejected, err) },
+	})
+	require.NoError(t, err)
+	defer f.Close()
+	assert.Equal(t, FormatPcap, f.Format)
+
+	record, err := f.Next()
+	require.NoError(t, err)
+	start, ok := record.(*models.StartRecord)
+	require.True(t, ok)
+	assert.Equal(t, "alice", start.Username)
+	assert.Equal(t, "10.0.0.1", start.FramedIPAddress)
+	assert.Equal(t, "192.168.1.1", start.ClientIP)
+	assert.Equal(t, "2024-01-15T10:00:00.25Z", start.Timestamp)
+
+	// The retransmission is skipped, the forged and malformed packets rejected
+	_, err = f.Next()
+	assert.ErrorIs(t, err, io.EOF)
+	assert.Equal(t, 1, f.Skipped())
+	require.Len(t, rejected, 2)
+	assert.ErrorIs(t, rejected[0], ErrNotAuthentic)
+
+	// Traffic to other ports is ignored
+	other, err := Open(capture(t, "192.168.1.1", 40000, 1812, request), FormatPcap, PacketOptions{})
+	require.NoError(t, err)
+	defer other.Close()
+	_, err = other.Next()
+	assert.ErrorIs(t, err, io.EOF)
+	assert.Equal(t, 0, other.Skipped())
+}
+
+func TestParseFormat(t *testing.T) {
+	format, err := ParseFormat("auto")
+	require.NoError(t, err)
+	assert.Equal(t, FormatAuto, format)
+
+	format, err = ParseFormat("pcap")
+	require.NoError(t, err)
+	assert.Equal(t, FormatPcap, format)
+
+	_, err = ParseFormat("csv")
+	assert.Error(t, err)
+}
+
+func TestReplayer_PcapOfStoredTraffic(t *testing.T) {
+	store := newMemoryStorage(t)
+	ctx := context.Background()
+
+	// The server stored the request when it was received, slightly before
+	// the capture timestamped it
+	received := &models.StartRecord{BaseAccountingRecord: testStart.BaseAccountingRecord, FramedIPAddress: "10.0.0.1"}
+	received.Timestamp = "2024-01-15T10:00:00.1Z"
+	require.NoError(t, store.Store(ctx, received))
+
+	path := capture(t, "192.168.1.1", 40000, 1813, accountingRequest(t, 1, "testing123"))
+	f, err := Open(path, FormatPcap, PacketOptions{Secret: func(net.IP) string { return "testing123" }})
+	require.NoError(t, err)
+	defer f.Close()
+
+	replayer := New(store, Options{})
+	require.NoError(t, replayer.Replay(ctx, f))
+	assert.Equal(t, Result{Duplicates: 1}, replayer.Result())
+
+	records, err := store.Query(ctx, storage.Query{AcctSessionID: "a1", Limit: storage.MaxQueryLimit})
+	require.NoError(t, err)
+	assert.Len(t, records.Records, 1)
+}
@@ -0,0 +1,28 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/kal997/radius-accounting-server/internal/models"
+)
+
+// ErrArchiveNotSupported is returned by MultiStorage when none of its
+// backends tracks archived records
+var ErrArchiveNotSupported = errors.New("no storage backend tracks archived records")
+
+// ArchiveTracker is implemented by backends whose records expire, so that an
+// archiver can save every record before it does. Records are marked archived
+// once they are safely on disk; the marks expire shortly after the records.
+type ArchiveTracker interface {
+	// Unarchived calls fn for every stored record that expires before
+	// deadline and is not marked archived
+	Unarchived(ctx context.Context, deadline time.Time, fn func(key string, record models.AccountingEvent) error) error
+
+	// Archived reports whether a record is marked archived
+	Archived(ctx context.Context, key string) (bool, error)
+
+	// MarkArchived marks records as archived
+	MarkArchived(ctx context.Context, keys []string) error
+}
@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kal997/radius-accounting-server/internal/models"
+)
+
+func TestRedisStorage_ArchiveTracking(t *testing.T) {
+	store, mr, cleanup := newTestStorage(t, 2*time.Hour)
+	defer cleanup()
+	ctx := context.Background()
+
+	queryFixture(t, store)
+	keys, err := mr.ZMembers(redisIndexAll)
+	require.NoError(t, err)
+	require.Greater(t, len(keys), 2)
+	expiring, marked := keys[0], keys[1]
+	mr.SetTTL(expiring, 10*time.Minute)
+	mr.SetTTL(marked, 10*time.Minute)
+
+	require.NoError(t, store.MarkArchived(ctx, []string{marked}))
+	archived, err := store.Archived(ctx, marked)
+	require.NoError(t, err)
+	assert.True(t, archived)
+	archived, err = store.Archived(ctx, expiring)
+	require.NoError(t, err)
+	assert.False(t, archived)
+
+	// Only the record expiring within the window and not marked is returned
+	keys = nil
+	err = store.Unarchived(ctx, time.Now().Add(30*time.Minute), func(key string, record models.AccountingEvent) error {
+		assert.Equal(t, key, record.GenerateRedisKey())
+		keys = append(keys, key)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{expiring}, keys)
+
+	// Marks outlive their record by the grace period
+	score, err := mr.ZScore(redisArchived, marked)
+	require.NoError(t, err)
+	assert.InDelta(t, float64(time.Now().Add(3*time.Hour).UnixMilli()), score, float64(time.Minute.Milliseconds()))
+
+	// Without a TTL records never expire, so neither do their marks
+	store.SetTTL(0)
+	require.NoError(t, store.MarkArchived(ctx, []string{expiring}))
+	score, err = mr.ZScore(redisArchived, expiring)
+	require.NoError(t, err)
+	assert.True(t, score > 1e300)
+}
+
+func TestMultiStorage_ArchiveTracking(t *testing.T) {
+	ms := newMultiStorage(1, []multiBackend{{name: "postgres", store: &fakeStorage{}}})
+
+	_, err := ms.Archived(context.Background(), "radius:acct:alice:a1:x:start")
+	assert.ErrorIs(t, err, ErrArchiveNotSupported)
+	assert.ErrorIs(t, ms.MarkArchived(context.Background(), []string{"k"}), ErrArchiveNotSupported)
+}
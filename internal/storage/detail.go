@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/kal997/radius-accounting-server/internal/config"
+	"github.com/kal997/radius-accounting-server/internal/detail"
+	"github.com/kal997/radius-accounting-server/internal/models"
+)
+
+// DetailStorage implements the Storage interface by appending records to
+// FreeRADIUS detail files, for tools that consume them. It is write-only;
+// combine it with another backend in a multi storage to query records.
+type DetailStorage struct {
+	writer *detail.Writer
+}
+
+// NewDetailStorage creates the detail file directory if needed
+func NewDetailStorage(cfg *config.ControlplaneConfig) (*DetailStorage, error) {
+	writer, err := detail.NewWriter(cfg.GetStorage().GetDetail().GetDirectory())
+	if err != nil {
+		return nil, err
+	}
+	return &DetailStorage{writer: writer}, nil
+}
+
+// Store appends the record to the detail file of its NAS and day
+func (ds *DetailStorage) Store(ctx context.Context, record models.AccountingEvent) error {
+	if record == nil {
+		return fmt.Errorf("record cannot be nil")
+	}
+	return ds.writer.Write(record)
+}
+
+// HealthCheck verifies that the detail directory still exists
+func (ds *DetailStorage) HealthCheck(ctx context.Context) error {
+	info, err := os.Stat(ds.writer.Dir())
+	if err != nil {
+		return fmt.Errorf("detail directory unavailable: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("detail directory unavailable: %s is not a directory", ds.writer.Dir())
+	}
+	return nil
+}
+
+// Close does nothing; files are closed after every write
+func (ds *DetailStorage) Close() error {
+	return nil
+}
@@ -0,0 +1,37 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kal997/radius-accounting-server/internal/detail"
+	"github.com/kal997/radius-accounting-server/internal/models"
+)
+
+func TestDetailStorage(t *testing.T) {
+	dir := t.TempDir()
+	writer, err := detail.NewWriter(dir)
+	require.NoError(t, err)
+	store := &DetailStorage{writer: writer}
+	defer store.Close()
+
+	ctx := context.Background()
+	record := &models.StartRecord{BaseAccountingRecord: models.BaseAccountingRecord{
+		Username:      "alice",
+		NASIPAddress:  "192.168.1.1",
+		AcctSessionID: "a1",
+		Timestamp:     "2024-01-15T10:00:00Z",
+	}}
+	require.NoError(t, store.Store(ctx, record))
+	assert.Error(t, store.Store(ctx, nil))
+	assert.FileExists(t, filepath.Join(dir, "192.168.1.1", "detail-20240115"))
+
+	assert.NoError(t, store.HealthCheck(ctx))
+	require.NoError(t, os.RemoveAll(dir))
+	assert.ErrorContains(t, store.HealthCheck(ctx), "detail directory unavailable")
+}
@@ -2,7 +2,9 @@ package storage
 
 import (
 	"context"
+	"fmt"
 
+	"github.com/kal997/radius-accounting-server/internal/config"
 	"github.com/kal997/radius-accounting-server/internal/models"
 )
 
@@ -17,3 +19,55 @@ type Storage interface {
 	// Close closes the storage connection
 	Close() error
 }
+
+// New creates the storage backend selected by the configuration
+func New(cfg *config.ControlplaneConfig) (Storage, error) {
+	if cfg.GetStorage().GetBackend() == config.StorageBackendMulti {
+		store, err := NewMultiStorage(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return store, nil
+	}
+	return newBackend(cfg, cfg.GetStorage().GetBackend())
+}
+
+// newBackend creates a single storage backend. Errors are returned with a
+// nil Storage rather than a typed nil pointer.
+func newBackend(cfg *config.ControlplaneConfig, backend config.StorageBackend) (Storage, error) {
+	switch backend {
+	case config.StorageBackendRedis:
+		store, err := NewRedisStorage(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return store, nil
+
+	case config.StorageBackendSQLite:
+		store, err := NewSQLiteStorage(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return store, nil
+
+	case config.StorageBackendPostgres:
+		store, err := NewPostgresStorage(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return store, nil
+
+	case config.StorageBackendMemory:
+		return NewInMemoryStorage(cfg), nil
+
+	case config.StorageBackendDetail:
+		store, err := NewDetailStorage(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return store, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported storage backend: %s", backend)
+	}
+}
@@ -0,0 +1,143 @@
+package storage
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/netip"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kal997/radius-accounting-server/internal/models"
+)
+
+// maxIPLookupAddresses bounds how many assigned addresses a prefix lookup
+// may cover, so that a short prefix cannot scan the whole timeline
+const maxIPLookupAddresses = 4096
+
+// ErrIPLookupNotSupported is returned by MultiStorage.LookupIP when none of
+// its backends keeps an IP assignment timeline
+var ErrIPLookupNotSupported = errors.New("no storage backend supports IP lookups")
+
+// IPAssignment is a Framed-IP-Address held by a session, from its Start
+// record until its Stop record
+type IPAssignment struct {
+	IP            netip.Addr `json:"ip"`
+	Username      string     `json:"username"`
+	AcctSessionID string     `json:"acct_session_id"`
+	NASIPAddress  string     `json:"nas_ip_address"`
+	Start         time.Time  `json:"start"`
+	Stop          *time.Time `json:"stop,omitempty"` // Nil while the session is open
+}
+
+// IPAttributor is implemented by storage backends that keep a timeline of
+// Framed-IP-Address assignments
+type IPAttributor interface {
+	// LookupIP returns the assignments of the addresses in prefix that were
+	// held at the given time, ordered by address
+	LookupIP(ctx context.Context, prefix netip.Prefix, at time.Time) ([]IPAssignment, error)
+}
+
+// ParseIPPrefix parses an IPv4 or IPv6 address or CIDR prefix. A single
+// address is treated as a full-length prefix.
+func ParseIPPrefix(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("invalid IP prefix %q: %w", s, err)
+		}
+		return prefix.Masked(), nil
+	}
+
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid IP address %q: %w", s, err)
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// newIPAssignment returns the assignment opened by a Start record, or false
+// when the record carries no usable Framed-IP-Address
+func newIPAssignment(start *models.StartRecord, at time.Time) (*IPAssignment, bool) {
+	addr, err := netip.ParseAddr(start.FramedIPAddress)
+	if err != nil || addr.IsUnspecified() {
+		return nil, false
+	}
+
+	return &IPAssignment{
+		IP:            addr.Unmap(),
+		Username:      start.Username,
+		AcctSessionID: start.AcctSessionID,
+		NASIPAddress:  start.NASIPAddress,
+		Start:         at,
+	}, true
+}
+
+// activeAt reports whether the address was held at the given time
+func (a *IPAssignment) activeAt(at time.Time) bool {
+	return !a.Start.After(at) && (a.Stop == nil || a.Stop.After(at))
+}
+
+// currentAssignments picks the holders of one address at the given time from
+// the assignments that started before it, newest first. A NAS hands an
+// address to one session at a time, so for each NAS only the newest
+// assignment is considered; an older one missing its Stop record was
+// superseded. Different NASes may assign the same private address.
+func currentAssignments(candidates []IPAssignment, at time.Time) []IPAssignment {
+	var current []IPAssignment
+	seen := make(map[string]bool)
+	for _, candidate := range candidates {
+		if seen[candidate.NASIPAddress] {
+			continue
+		}
+		seen[candidate.NASIPAddress] = true
+		if candidate.activeAt(at) {
+			current = append(current, candidate)
+		}
+	}
+	return current
+}
+
+// sortAssignments orders assignments by address, then start time
+func sortAssignments(assignments []IPAssignment) {
+	sort.Slice(assignments, func(i, j int) bool {
+		if c := assignments[i].IP.Compare(assignments[j].IP); c != 0 {
+			return c < 0
+		}
+		return assignments[i].Start.Before(assignments[j].Start)
+	})
+}
+
+// ipSortKey encodes an address as 32 hex digits, IPv4 as IPv4-mapped IPv6,
+// so that addresses sort lexically in numeric order
+func ipSortKey(addr netip.Addr) string {
+	bytes := addr.As16()
+	return hex.EncodeToString(bytes[:])
+}
+
+// parseIPSortKey decodes an address encoded by ipSortKey
+func parseIPSortKey(key string) (netip.Addr, error) {
+	raw, err := hex.DecodeString(key)
+	if err != nil || len(raw) != 16 {
+		return netip.Addr{}, fmt.Errorf("invalid address key %q", key)
+	}
+	return netip.AddrFrom16([16]byte(raw)).Unmap(), nil
+}
+
+// prefixSortKeys returns the sort keys of the first and last address of prefix
+func prefixSortKeys(prefix netip.Prefix) (string, string) {
+	bits := prefix.Bits()
+	if prefix.Addr().Is4() {
+		bits += 96
+	}
+
+	first := prefix.Masked().Addr().As16()
+	last := first
+	for i := bits; i < 128; i++ {
+		last[i/8] |= 1 << (7 - i%8)
+	}
+	return hex.EncodeToString(first[:]), hex.EncodeToString(last[:])
+}
@@ -0,0 +1,245 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kal997/radius-accounting-server/internal/models"
+)
+
+func TestParseIPPrefix(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string
+		wantErr string
+	}{
+		{input: "10.0.0.100", want: "10.0.0.100/32"},
+		{input: "10.0.0.100/24", want: "10.0.0.0/24"},
+		{input: "2001:db8::1", want: "2001:db8::1/128"},
+		{input: "2001:db8::/48", want: "2001:db8::/48"},
+		{input: "::ffff:10.0.0.1", want: "10.0.0.1/32"},
+		{input: "10.0.0.300", wantErr: `invalid IP address "10.0.0.300"`},
+		{input: "10.0.0.0/33", wantErr: `invalid IP prefix "10.0.0.0/33"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			prefix, err := ParseIPPrefix(tt.input)
+
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, prefix.String())
+		})
+	}
+}
+
+func TestPrefixSortKeys(t *testing.T) {
+	first, last := prefixSortKeys(netip.MustParsePrefix("10.0.0.0/24"))
+	assert.Equal(t, ipSortKey(netip.MustParseAddr("10.0.0.0")), first)
+	assert.Equal(t, ipSortKey(netip.MustParseAddr("10.0.0.255")), last)
+
+	first, last = prefixSortKeys(netip.MustParsePrefix("2001:db8::/32"))
+	assert.Equal(t, ipSortKey(netip.MustParseAddr("2001:db8::")), first)
+	assert.Equal(t, ipSortKey(netip.MustParseAddr("2001:db8:ffff:ffff:ffff:ffff:ffff:ffff")), last)
+
+	addr, err := parseIPSortKey(ipSortKey(netip.MustParseAddr("10.0.0.7")))
+	require.NoError(t, err)
+	assert.Equal(t, netip.MustParseAddr("10.0.0.7"), addr)
+}
+
+// testIPLookups runs the same lookups against any backend
+func testIPLookups(t *testing.T, store interface {
+	Storage
+	IPAttributor
+}) {
+	ctx := context.Background()
+	start := time.Now().Add(-time.Hour).Truncate(time.Second).UTC()
+	at := func(minute int) time.Time { return start.Add(time.Duration(minute) * time.Minute) }
+	base := func(user, session, nas string, minute int) models.BaseAccountingRecord {
+		return models.BaseAccountingRecord{
+			Username:      user,
+			AcctSessionID: session,
+			NASIPAddress:  nas,
+			ClientIP:      nas,
+			Timestamp:     at(minute).Format(time.RFC3339Nano),
+		}
+	}
+
+	records := []models.AccountingEvent{
+		// alice holds 10.0.0.100 from minute 0 to 10, then bob from minute 20
+		&models.StartRecord{BaseAccountingRecord: base("alice", "a1", "192.168.1.1", 0), FramedIPAddress: "10.0.0.100"},
+		&models.InterimRecord{BaseAccountingRecord: base("alice", "a1", "192.168.1.1", 5), SessionTime: 300},
+		&models.StopRecord{BaseAccountingRecord: base("alice", "a1", "192.168.1.1", 10), SessionTime: 600, TerminateCause: "1"},
+		&models.StartRecord{BaseAccountingRecord: base("bob", "b1", "192.168.1.1", 20), FramedIPAddress: "10.0.0.100"},
+		// carol holds the same private address on another NAS
+		&models.StartRecord{BaseAccountingRecord: base("carol", "c1", "192.168.1.2", 2), FramedIPAddress: "10.0.0.100"},
+		// dave's stale session never stopped but its address was reassigned
+		&models.StartRecord{BaseAccountingRecord: base("dave", "d1", "192.168.1.1", 1), FramedIPAddress: "10.0.0.101"},
+		&models.StartRecord{BaseAccountingRecord: base("erin", "e1", "192.168.1.1", 15), FramedIPAddress: "10.0.0.101"},
+		&models.StartRecord{BaseAccountingRecord: base("frank", "f1", "192.168.1.1", 3), FramedIPAddress: "2001:db8::1"},
+		// Start records without a usable address are not tracked
+		&models.StartRecord{BaseAccountingRecord: base("gina", "g1", "192.168.1.1", 3), FramedIPAddress: "0.0.0.0"},
+		&models.StartRecord{BaseAccountingRecord: base("hank", "h1", "192.168.1.1", 3), FramedIPAddress: "<nil>"},
+	}
+	for _, record := range records {
+		require.NoError(t, store.Store(ctx, record))
+	}
+
+	tests := []struct {
+		name   string
+		prefix string
+		at     time.Time
+		want   []string
+	}{
+		{name: "before any session", prefix: "10.0.0.100", at: at(-1)},
+		{name: "during a session", prefix: "10.0.0.100", at: at(5), want: []string{"10.0.0.100 a1 open=false", "10.0.0.100 c1 open=true"}},
+		{name: "at the stop time", prefix: "10.0.0.100", at: at(10), want: []string{"10.0.0.100 c1 open=true"}},
+		{name: "open session", prefix: "10.0.0.100", at: at(30), want: []string{"10.0.0.100 c1 open=true", "10.0.0.100 b1 open=true"}},
+		{name: "superseded session", prefix: "10.0.0.101", at: at(20), want: []string{"10.0.0.101 e1 open=true"}},
+		{name: "IPv4 prefix", prefix: "10.0.0.0/24", at: at(12), want: []string{"10.0.0.100 c1 open=true", "10.0.0.101 d1 open=true"}},
+		{name: "IPv6 prefix", prefix: "2001:db8::/32", at: at(4), want: []string{"2001:db8::1 f1 open=true"}},
+		{name: "unassigned prefix", prefix: "172.16.0.0/12", at: at(4)},
+		{name: "unspecified addresses", prefix: "0.0.0.0/8", at: at(4)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prefix, err := ParseIPPrefix(tt.prefix)
+			require.NoError(t, err)
+
+			assignments, err := store.LookupIP(ctx, prefix, tt.at)
+			require.NoError(t, err)
+
+			var got []string
+			for _, a := range assignments {
+				got = append(got, fmt.Sprintf("%s %s open=%t", a.IP, a.AcctSessionID, a.Stop == nil))
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	assignments, err := store.LookupIP(ctx, netip.MustParsePrefix("10.0.0.100/32"), at(5))
+	require.NoError(t, err)
+	require.NotEmpty(t, assignments)
+	assert.Equal(t, IPAssignment{
+		IP:            netip.MustParseAddr("10.0.0.100"),
+		Username:      "alice",
+		AcctSessionID: "a1",
+		NASIPAddress:  "192.168.1.1",
+		Start:         at(0),
+		Stop:          &[]time.Time{at(10)}[0],
+	}, withUTC(assignments[0]))
+}
+
+// withUTC normalizes the times of an assignment decoded from JSON
+func withUTC(a IPAssignment) IPAssignment {
+	a.Start = a.Start.UTC()
+	if a.Stop != nil {
+		stop := a.Stop.UTC()
+		a.Stop = &stop
+	}
+	return a
+}
+
+func TestRedisStorage_LookupIP(t *testing.T) {
+	store, mr, cleanup := newTestStorage(t, 2*time.Hour)
+	defer cleanup()
+
+	testIPLookups(t, store)
+
+	assert.True(t, mr.Exists("radius:ip:session:192.168.1.1:a1"))
+	assert.True(t, mr.Exists("radius:ip:addr:10.0.0.100"))
+	assert.Greater(t, mr.TTL("radius:ip:addr:10.0.0.100"), time.Hour)
+
+	// Addresses whose timeline expired are removed from the prefix index
+	mr.Del("radius:ip:addr:2001:db8::1")
+	assignments, err := store.LookupIP(context.Background(), netip.MustParsePrefix("2001:db8::/32"), time.Now())
+	require.NoError(t, err)
+	assert.Empty(t, assignments)
+
+	members, err := mr.ZMembers("radius:ip:addrs")
+	require.NoError(t, err)
+	assert.Len(t, members, 2)
+}
+
+func TestRedisStorage_LookupIP_ExpiredAddresses(t *testing.T) {
+	store, mr, cleanup := newTestStorage(t, 2*time.Hour)
+	defer cleanup()
+
+	// More expired addresses than a lookup may cover, whose timelines are gone
+	for i := 0; i < maxIPLookupAddresses+100; i++ {
+		addr := netip.AddrFrom4([4]byte{10, 1, byte(i >> 8), byte(i)})
+		_, err := mr.ZAdd("radius:ip:addrs", 0, ipSortKey(addr))
+		require.NoError(t, err)
+	}
+
+	now := time.Now().UTC()
+	require.NoError(t, store.Store(context.Background(), &models.StartRecord{
+		BaseAccountingRecord: models.BaseAccountingRecord{
+			Username:      "alice",
+			AcctSessionID: "a1",
+			NASIPAddress:  "192.168.1.1",
+			Timestamp:     now.Format(time.RFC3339Nano),
+		},
+		FramedIPAddress: "10.1.255.1",
+	}))
+
+	assignments, err := store.LookupIP(context.Background(), netip.MustParsePrefix("10.1.0.0/16"), now)
+	require.NoError(t, err)
+	require.Len(t, assignments, 1)
+	assert.Equal(t, "a1", assignments[0].AcctSessionID)
+
+	members, err := mr.ZMembers("radius:ip:addrs")
+	require.NoError(t, err)
+	assert.Equal(t, []string{ipSortKey(netip.MustParseAddr("10.1.255.1"))}, members)
+}
+
+func TestInMemoryStorage_LookupIP(t *testing.T) {
+	store := newInMemoryStorage(0, 0, time.Hour)
+	defer store.Close()
+
+	testIPLookups(t, store)
+}
+
+func TestInMemoryStorage_LookupIP_Expiry(t *testing.T) {
+	store := newInMemoryStorage(50*time.Millisecond, 0, 10*time.Millisecond)
+	defer store.Close()
+
+	now := time.Now().UTC()
+	require.NoError(t, store.Store(context.Background(), &models.StartRecord{
+		BaseAccountingRecord: models.BaseAccountingRecord{
+			Username:      "alice",
+			AcctSessionID: "a1",
+			NASIPAddress:  "192.168.1.1",
+			Timestamp:     now.Format(time.RFC3339Nano),
+		},
+		FramedIPAddress: "10.0.0.100",
+	}))
+
+	prefix := netip.MustParsePrefix("10.0.0.100/32")
+	assignments, err := store.LookupIP(context.Background(), prefix, now)
+	require.NoError(t, err)
+	assert.Len(t, assignments, 1)
+
+	assert.Eventually(t, func() bool {
+		store.mu.Lock()
+		defer store.mu.Unlock()
+		return len(store.assignments) == 0
+	}, 2*time.Second, 10*time.Millisecond)
+}
+
+func TestMultiStorage_LookupIP(t *testing.T) {
+	ms := newMultiStorage(1, []multiBackend{{name: "postgres", store: &fakeStorage{}}})
+
+	_, err := ms.LookupIP(context.Background(), netip.MustParsePrefix("10.0.0.0/8"), time.Now())
+	assert.ErrorIs(t, err, ErrIPLookupNotSupported)
+}
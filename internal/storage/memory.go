@@ -0,0 +1,651 @@
+package storage
+
+import (
+	"container/heap"
+	"container/list"
+	"context"
+	"fmt"
+	"log"
+	"net/netip"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kal997/radius-accounting-server/internal/config"
+	"github.com/kal997/radius-accounting-server/internal/models"
+	"github.com/kal997/radius-accounting-server/internal/notifier"
+)
+
+// memoryEntry is a record held by InMemoryStorage
+type memoryEntry struct {
+	key       string
+	record    models.AccountingEvent
+	position  queryPosition // Event time and key, the order of query results
+	expiresAt time.Time     // Zero when the record never expires
+	elem      *list.Element // Position in insertion order
+	heapIndex int           // Position in the expiry heap, -1 when not in it
+}
+
+// expiryHeap orders entries with a TTL by expiry time
+type expiryHeap []*memoryEntry
+
+func (h expiryHeap) Len() int           { return len(h) }
+func (h expiryHeap) Less(i, j int) bool { return h[i].expiresAt.Before(h[j].expiresAt) }
+func (h expiryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].heapIndex = i
+	h[j].heapIndex = j
+}
+func (h *expiryHeap) Push(x any) {
+	entry := x.(*memoryEntry)
+	entry.heapIndex = len(*h)
+	*h = append(*h, entry)
+}
+func (h *expiryHeap) Pop() any {
+	old := *h
+	entry := old[len(old)-1]
+	old[len(old)-1] = nil
+	entry.heapIndex = -1
+	*h = old[:len(old)-1]
+	return entry
+}
+
+// InMemoryStorage implements the Storage, Querier, IPAttributor and
+// SessionTracker interfaces in process memory, for local development and
+// tests that should not need Redis. Like Redis it expires records after a TTL
+// and publishes "set", "expired" and "evicted" events, which are received
+// through Notifier. When max records is set the oldest record is evicted to
+// make room for a new one.
+type InMemoryStorage struct {
+	maxRecords    int
+	sweepInterval time.Duration // How often expired records are removed
+
+	mu      sync.Mutex // Protects every field below
+	ttl     time.Duration
+	entries map[string]*memoryEntry
+	order   *list.List // Entries, oldest first
+	expiry  expiryHeap
+	subs    map[*memorySubscription]struct{}
+	closed  bool
+
+	// IP assignment timeline by sessionID, expiring like records from
+	// the last record of each session
+	assignments map[string]*memoryAssignment
+
+	// Sessions by sessionID, expiring like records from the last record of
+	// each session, and the counters of every NAS seen
+	sessions map[string]*memorySession
+	nas      map[string]*NASSummary
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewInMemoryStorage creates an empty in-memory storage
+func NewInMemoryStorage(cfg *config.ControlplaneConfig) *InMemoryStorage {
+	memoryCfg := cfg.GetStorage().GetMemory()
+	return newInMemoryStorage(memoryCfg.GetTTL(), memoryCfg.GetMaxRecords(), time.Second)
+}
+
+func newInMemoryStorage(ttl time.Duration, maxRecords int, sweepInterval time.Duration) *InMemoryStorage {
+	ms := &InMemoryStorage{
+		maxRecords:    maxRecords,
+		sweepInterval: sweepInterval,
+		ttl:           ttl,
+		entries:       make(map[string]*memoryEntry),
+		order:         list.New(),
+		subs:          make(map[*memorySubscription]struct{}),
+		assignments:   make(map[string]*memoryAssignment),
+		sessions:      make(map[string]*memorySession),
+		nas:           make(map[string]*NASSummary),
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+
+	go ms.sweepLoop()
+
+	return ms
+}
+
+// Store saves an accounting record, replacing a record with the same key
+func (ms *InMemoryStorage) Store(ctx context.Context, record models.AccountingEvent) error {
+	if record == nil {
+		return fmt.Errorf("record cannot be nil")
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	key := record.GenerateRedisKey()
+	now := time.Now()
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if ms.closed {
+		return errStorageClosed
+	}
+
+	if old, ok := ms.entries[key]; ok {
+		ms.remove(old)
+	}
+
+	eventTime := RecordTime(record, now)
+	entry := &memoryEntry{
+		key:       key,
+		record:    record,
+		position:  queryPosition{micros: eventTime.UnixMicro(), key: key},
+		heapIndex: -1,
+	}
+	if ms.ttl > 0 {
+		entry.expiresAt = now.Add(ms.ttl)
+		heap.Push(&ms.expiry, entry)
+	}
+	entry.elem = ms.order.PushBack(entry)
+	ms.entries[key] = entry
+	ms.publish(key, "set", now)
+	ms.trackIPAssignment(record, eventTime, now)
+	ms.trackSession(record, eventTime, now)
+
+	for ms.maxRecords > 0 && len(ms.entries) > ms.maxRecords {
+		oldest := ms.order.Front().Value.(*memoryEntry)
+		ms.remove(oldest)
+		ms.publish(oldest.key, "evicted", now)
+	}
+
+	return nil
+}
+
+// Get returns the record stored under key, as generated by GenerateRedisKey
+func (ms *InMemoryStorage) Get(key string) (models.AccountingEvent, bool) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	entry, ok := ms.entries[key]
+	if !ok || entry.expired(time.Now()) {
+		return nil, false
+	}
+	return entry.record, true
+}
+
+// Record returns the record stored under key, or ErrNotFound
+func (ms *InMemoryStorage) Record(ctx context.Context, key string) (models.AccountingEvent, error) {
+	record, ok := ms.Get(key)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return record, nil
+}
+
+// Query returns the records matching q. Records are scanned rather than
+// indexed, which is fine for the sizes this backend is meant for.
+func (ms *InMemoryStorage) Query(ctx context.Context, q Query) (*QueryResult, error) {
+	limit, after, err := q.prepare()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var matched []*memoryEntry
+
+	ms.mu.Lock()
+	for _, entry := range ms.entries {
+		if entry.expired(now) || !q.inRange(entry.position.micros) || !q.matches(entry.record) {
+			continue
+		}
+		if after != nil && !entry.position.after(*after) {
+			continue
+		}
+		matched = append(matched, entry)
+	}
+	ms.mu.Unlock()
+
+	sort.Slice(matched, func(i, j int) bool {
+		return matched[j].position.after(matched[i].position)
+	})
+
+	result := &QueryResult{}
+	if len(matched) > limit {
+		matched = matched[:limit]
+		result.NextCursor = matched[limit-1].position.cursor()
+	}
+	for _, entry := range matched {
+		result.Records = append(result.Records, entry.record)
+	}
+	return result, nil
+}
+
+// memoryAssignment is an IP assignment held by InMemoryStorage
+type memoryAssignment struct {
+	IPAssignment
+	expiresAt time.Time // Zero when the assignment never expires
+}
+
+// trackIPAssignment opens, refreshes or closes the IP assignment of the
+// record's session; ms.mu must be held
+func (ms *InMemoryStorage) trackIPAssignment(record models.AccountingEvent, eventTime, now time.Time) {
+	var expiresAt time.Time
+	if ms.ttl > 0 {
+		expiresAt = now.Add(ms.ttl)
+	}
+
+	switch r := record.(type) {
+	case *models.StartRecord:
+		if assignment, ok := newIPAssignment(r, eventTime); ok {
+			id := sessionID(r.NASIPAddress, r.AcctSessionID)
+			ms.assignments[id] = &memoryAssignment{IPAssignment: *assignment, expiresAt: expiresAt}
+		}
+
+	case *models.InterimRecord:
+		if assignment, ok := ms.assignments[sessionID(r.NASIPAddress, r.AcctSessionID)]; ok {
+			assignment.expiresAt = expiresAt
+		}
+
+	case *models.StopRecord:
+		if assignment, ok := ms.assignments[sessionID(r.NASIPAddress, r.AcctSessionID)]; ok {
+			stop := eventTime
+			assignment.Stop = &stop
+			assignment.expiresAt = expiresAt
+		}
+	}
+}
+
+// LookupIP returns the sessions that held the addresses of prefix at the
+// given time
+func (ms *InMemoryStorage) LookupIP(ctx context.Context, prefix netip.Prefix, at time.Time) ([]IPAssignment, error) {
+	now := time.Now()
+	byAddr := make(map[netip.Addr][]IPAssignment)
+
+	ms.mu.Lock()
+	for _, assignment := range ms.assignments {
+		if !assignment.expiresAt.IsZero() && !now.Before(assignment.expiresAt) {
+			continue
+		}
+		if prefix.Contains(assignment.IP) && !assignment.Start.After(at) {
+			byAddr[assignment.IP] = append(byAddr[assignment.IP], assignment.IPAssignment)
+		}
+	}
+	ms.mu.Unlock()
+
+	if len(byAddr) > maxIPLookupAddresses {
+		return nil, invalidQuery("prefix %s covers more than %d assigned addresses", prefix, maxIPLookupAddresses)
+	}
+
+	var result []IPAssignment
+	for _, candidates := range byAddr {
+		sort.Slice(candidates, func(i, j int) bool {
+			return candidates[i].Start.After(candidates[j].Start)
+		})
+		result = append(result, currentAssignments(candidates, at)...)
+	}
+
+	sortAssignments(result)
+	return result, nil
+}
+
+// memorySession is a session held by InMemoryStorage
+type memorySession struct {
+	Session
+	expiresAt time.Time // Zero when the session never expires
+}
+
+func (s *memorySession) expired(now time.Time) bool {
+	return !s.expiresAt.IsZero() && !now.Before(s.expiresAt)
+}
+
+// trackSession merges the record into its session and counts it for its
+// NAS; ms.mu must be held
+func (ms *InMemoryStorage) trackSession(record models.AccountingEvent, eventTime, now time.Time) {
+	base := record.Base()
+
+	id := sessionID(base.NASIPAddress, base.AcctSessionID)
+	session, ok := ms.sessions[id]
+	if !ok || session.expired(now) {
+		session = &memorySession{}
+		ms.sessions[id] = session
+	}
+	session.apply(record, eventTime)
+	if ms.ttl > 0 {
+		session.expiresAt = now.Add(ms.ttl)
+	}
+
+	summary, ok := ms.nas[base.NASIPAddress]
+	if !ok {
+		summary = &NASSummary{NASIPAddress: base.NASIPAddress}
+		ms.nas[base.NASIPAddress] = summary
+	}
+	switch record.(type) {
+	case *models.StartRecord:
+		summary.Starts++
+	case *models.InterimRecord:
+		summary.InterimUpdates++
+	case *models.StopRecord:
+		summary.Stops++
+	}
+	summary.LastSeen = now
+}
+
+// Sessions returns the sessions matching q, scanning every session
+func (ms *InMemoryStorage) Sessions(ctx context.Context, q SessionQuery) (*SessionResult, error) {
+	limit, after, err := q.prepare()
+	if err != nil {
+		return nil, err
+	}
+
+	type match struct {
+		session  Session
+		position queryPosition
+	}
+
+	now := time.Now()
+	var matched []match
+
+	ms.mu.Lock()
+	for id, session := range ms.sessions {
+		if session.expired(now) || !q.matches(&session.Session) {
+			continue
+		}
+		pos := queryPosition{micros: session.LastUpdate.UnixMicro(), key: id}
+		if after != nil && !pos.after(*after) {
+			continue
+		}
+		matched = append(matched, match{session: session.Session, position: pos})
+	}
+	ms.mu.Unlock()
+
+	sort.Slice(matched, func(i, j int) bool {
+		return matched[j].position.after(matched[i].position)
+	})
+
+	result := &SessionResult{}
+	if len(matched) > limit {
+		matched = matched[:limit]
+		result.NextCursor = matched[limit-1].position.cursor()
+	}
+	for _, m := range matched {
+		result.Sessions = append(result.Sessions, m.session)
+	}
+	return result, nil
+}
+
+// Session returns one session, or ErrNotFound
+func (ms *InMemoryStorage) Session(ctx context.Context, nasIPAddress, acctSessionID string) (*Session, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	session, ok := ms.sessions[sessionID(nasIPAddress, acctSessionID)]
+	if !ok || session.expired(time.Now()) {
+		return nil, ErrNotFound
+	}
+	result := session.Session
+	return &result, nil
+}
+
+// NASSummaries returns the counters of every NAS seen
+func (ms *InMemoryStorage) NASSummaries(ctx context.Context) ([]NASSummary, error) {
+	now := time.Now()
+
+	ms.mu.Lock()
+	summaries := make([]NASSummary, 0, len(ms.nas))
+	active := make(map[string]int)
+	for _, session := range ms.sessions {
+		if !session.expired(now) && session.Active() {
+			active[session.NASIPAddress]++
+		}
+	}
+	for addr, summary := range ms.nas {
+		s := *summary
+		s.ActiveSessions = active[addr]
+		summaries = append(summaries, s)
+	}
+	ms.mu.Unlock()
+
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].NASIPAddress < summaries[j].NASIPAddress
+	})
+	return summaries, nil
+}
+
+// Len returns the number of records held, including expired records not
+// yet removed
+func (ms *InMemoryStorage) Len() int {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	return len(ms.entries)
+}
+
+// TTL returns the expiry applied to newly stored records
+func (ms *InMemoryStorage) TTL() time.Duration {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	return ms.ttl
+}
+
+// SetTTL changes the expiry applied to records stored from now on
+func (ms *InMemoryStorage) SetTTL(ttl time.Duration) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.ttl = ttl
+}
+
+func (e *memoryEntry) expired(now time.Time) bool {
+	return !e.expiresAt.IsZero() && !now.Before(e.expiresAt)
+}
+
+// remove deletes entry from every index; ms.mu must be held
+func (ms *InMemoryStorage) remove(entry *memoryEntry) {
+	delete(ms.entries, entry.key)
+	ms.order.Remove(entry.elem)
+	if entry.heapIndex >= 0 {
+		heap.Remove(&ms.expiry, entry.heapIndex)
+	}
+}
+
+// sweepLoop removes expired records every sweep interval until Close
+func (ms *InMemoryStorage) sweepLoop() {
+	defer close(ms.done)
+
+	ticker := time.NewTicker(ms.sweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ms.stop:
+			return
+		case now := <-ticker.C:
+			ms.sweep(now)
+		}
+	}
+}
+
+// sweep removes the records expired at now and publishes "expired" for each,
+// then removes the expired IP assignments and sessions
+func (ms *InMemoryStorage) sweep(now time.Time) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	for len(ms.expiry) > 0 && ms.expiry[0].expired(now) {
+		entry := ms.expiry[0]
+		ms.remove(entry)
+		ms.publish(entry.key, "expired", now)
+	}
+
+	for id, assignment := range ms.assignments {
+		if !assignment.expiresAt.IsZero() && !now.Before(assignment.expiresAt) {
+			delete(ms.assignments, id)
+		}
+	}
+
+	for id, session := range ms.sessions {
+		if session.expired(now) {
+			delete(ms.sessions, id)
+		}
+	}
+}
+
+// HealthCheck reports whether the storage is open
+func (ms *InMemoryStorage) HealthCheck(ctx context.Context) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if ms.closed {
+		return errStorageClosed
+	}
+	return nil
+}
+
+// Close stops expiry and closes every event subscription
+func (ms *InMemoryStorage) Close() error {
+	ms.mu.Lock()
+	if ms.closed {
+		ms.mu.Unlock()
+		return nil
+	}
+	ms.closed = true
+	for sub := range ms.subs {
+		ms.unsubscribe(sub)
+	}
+	ms.mu.Unlock()
+
+	close(ms.stop)
+	<-ms.done
+	return nil
+}
+
+// ======================= NOTIFIER =========================
+
+// memorySubscription receives the events of keys matching its patterns
+type memorySubscription struct {
+	filters  map[string]*regexp.Regexp
+	events   chan notifier.StorageEvent
+	closed   bool
+	dropped  int
+	stopWait chan struct{}
+}
+
+// publish delivers an event to every matching subscription; ms.mu must be
+// held. Like Redis pub/sub, events are dropped for subscribers that do not
+// keep up rather than blocking writers.
+func (ms *InMemoryStorage) publish(key, operation string, now time.Time) {
+	for sub := range ms.subs {
+		if !sub.matches(key) {
+			continue
+		}
+		select {
+		case sub.events <- notifier.StorageEvent{Key: key, Operation: operation, Timestamp: now}:
+		default:
+			sub.dropped++
+			if sub.dropped == 1 || sub.dropped%1000 == 0 {
+				log.Printf("In-memory notifier subscriber is not keeping up, %d events dropped", sub.dropped)
+			}
+		}
+	}
+}
+
+func (sub *memorySubscription) matches(key string) bool {
+	for _, filter := range sub.filters {
+		if filter.MatchString(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// unsubscribe closes sub's channel; ms.mu must be held
+func (ms *InMemoryStorage) unsubscribe(sub *memorySubscription) {
+	if sub.closed {
+		return
+	}
+	sub.closed = true
+	delete(ms.subs, sub)
+	close(sub.events)
+	close(sub.stopWait)
+}
+
+// memoryNotifier implements notifier.Notifier for an InMemoryStorage
+type memoryNotifier struct {
+	storage *InMemoryStorage
+	subs    []*memorySubscription // Protected by storage.mu
+}
+
+// Notifier returns a notifier.Notifier delivering the events of this storage.
+// Closing the notifier ends its subscriptions but leaves the storage open.
+func (ms *InMemoryStorage) Notifier() notifier.Notifier {
+	return &memoryNotifier{storage: ms}
+}
+
+// Subscribe receives the events of keys matching any of the Redis glob
+// patterns until ctx is done or the notifier is closed
+func (mn *memoryNotifier) Subscribe(ctx context.Context, patterns []string) (<-chan notifier.StorageEvent, error) {
+	if len(patterns) == 0 {
+		return nil, fmt.Errorf("no patterns provided")
+	}
+
+	sub := &memorySubscription{
+		filters:  make(map[string]*regexp.Regexp, len(patterns)),
+		events:   make(chan notifier.StorageEvent, 100),
+		stopWait: make(chan struct{}),
+	}
+	for _, pattern := range patterns {
+		sub.filters[pattern] = notifier.CompileGlob(pattern)
+	}
+
+	ms := mn.storage
+	ms.mu.Lock()
+	if ms.closed {
+		ms.mu.Unlock()
+		return nil, errStorageClosed
+	}
+	ms.subs[sub] = struct{}{}
+	mn.subs = append(mn.subs, sub)
+	ms.mu.Unlock()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			ms.mu.Lock()
+			ms.unsubscribe(sub)
+			ms.mu.Unlock()
+		case <-sub.stopWait:
+		}
+	}()
+
+	return sub.events, nil
+}
+
+// Unsubscribe stops matching the given patterns; subscriptions left without
+// patterns keep their channel open until Close, as with RedisNotifier
+func (mn *memoryNotifier) Unsubscribe(patterns []string) error {
+	ms := mn.storage
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if len(mn.subs) == 0 {
+		return fmt.Errorf("not subscribed")
+	}
+	for _, sub := range mn.subs {
+		for _, pattern := range patterns {
+			delete(sub.filters, pattern)
+		}
+	}
+	return nil
+}
+
+// HealthCheck reports whether the underlying storage is open
+func (mn *memoryNotifier) HealthCheck(ctx context.Context) error {
+	return mn.storage.HealthCheck(ctx)
+}
+
+// Close ends every subscription made through this notifier
+func (mn *memoryNotifier) Close() error {
+	ms := mn.storage
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	for _, sub := range mn.subs {
+		ms.unsubscribe(sub)
+	}
+	mn.subs = nil
+	return nil
+}
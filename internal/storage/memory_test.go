@@ -0,0 +1,198 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kal997/radius-accounting-server/internal/config"
+	"github.com/kal997/radius-accounting-server/internal/models"
+	"github.com/kal997/radius-accounting-server/internal/notifier"
+)
+
+// nextEvent waits for an event on events
+func nextEvent(t *testing.T, events <-chan notifier.StorageEvent) notifier.StorageEvent {
+	t.Helper()
+
+	select {
+	case event, ok := <-events:
+		require.True(t, ok, "events channel closed")
+		return event
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for event")
+		return notifier.StorageEvent{}
+	}
+}
+
+func TestInMemoryStorage_Store(t *testing.T) {
+	store := newInMemoryStorage(0, 0, time.Hour)
+	defer store.Close()
+
+	ctx := context.Background()
+	record := &models.StartRecord{BaseAccountingRecord: testBase(time.Now()), FramedIPAddress: "10.0.0.5"}
+
+	require.NoError(t, store.Store(ctx, record))
+	require.NoError(t, store.Store(ctx, record))
+
+	got, ok := store.Get(record.GenerateRedisKey())
+	require.True(t, ok)
+	assert.Equal(t, record, got)
+	assert.Equal(t, 1, store.Len())
+
+	_, ok = store.Get("radius:acct:missing")
+	assert.False(t, ok)
+
+	assert.EqualError(t, store.Store(ctx, nil), "record cannot be nil")
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.ErrorIs(t, store.Store(cancelled, record), context.Canceled)
+}
+
+func TestInMemoryStorage_Expiry(t *testing.T) {
+	store := newInMemoryStorage(50*time.Millisecond, 0, 10*time.Millisecond)
+	defer store.Close()
+
+	events, err := store.Notifier().Subscribe(context.Background(), []string{"radius:acct:*"})
+	require.NoError(t, err)
+
+	record := &models.StartRecord{BaseAccountingRecord: testBase(time.Now())}
+	require.NoError(t, store.Store(context.Background(), record))
+
+	event := nextEvent(t, events)
+	assert.Equal(t, record.GenerateRedisKey(), event.Key)
+	assert.Equal(t, "set", event.Operation)
+
+	event = nextEvent(t, events)
+	assert.Equal(t, record.GenerateRedisKey(), event.Key)
+	assert.Equal(t, "expired", event.Operation)
+
+	_, ok := store.Get(record.GenerateRedisKey())
+	assert.False(t, ok)
+	assert.Equal(t, 0, store.Len())
+
+	// Records stored after the TTL is cleared never expire
+	store.SetTTL(0)
+	assert.Equal(t, time.Duration(0), store.TTL())
+	require.NoError(t, store.Store(context.Background(), record))
+	assert.Equal(t, "set", nextEvent(t, events).Operation)
+
+	time.Sleep(100 * time.Millisecond)
+	_, ok = store.Get(record.GenerateRedisKey())
+	assert.True(t, ok)
+}
+
+func TestInMemoryStorage_Eviction(t *testing.T) {
+	store := newInMemoryStorage(0, 2, time.Hour)
+	defer store.Close()
+
+	events, err := store.Notifier().Subscribe(context.Background(), []string{"*:stop"})
+	require.NoError(t, err)
+
+	now := time.Now()
+	var keys []string
+	for i := 0; i < 3; i++ {
+		record := &models.StopRecord{BaseAccountingRecord: testBase(now.Add(time.Duration(i) * time.Second))}
+		require.NoError(t, store.Store(context.Background(), record))
+		keys = append(keys, record.GenerateRedisKey())
+	}
+
+	assert.Equal(t, 2, store.Len())
+	_, ok := store.Get(keys[0])
+	assert.False(t, ok)
+
+	for _, want := range []notifier.StorageEvent{
+		{Key: keys[0], Operation: "set"},
+		{Key: keys[1], Operation: "set"},
+		{Key: keys[2], Operation: "set"},
+		{Key: keys[0], Operation: "evicted"},
+	} {
+		event := nextEvent(t, events)
+		assert.Equal(t, want.Key, event.Key)
+		assert.Equal(t, want.Operation, event.Operation)
+	}
+}
+
+func TestInMemoryStorage_Notifier(t *testing.T) {
+	store := newInMemoryStorage(0, 0, time.Hour)
+	defer store.Close()
+
+	n := store.Notifier()
+	require.NoError(t, n.HealthCheck(context.Background()))
+
+	_, err := n.Subscribe(context.Background(), nil)
+	assert.EqualError(t, err, "no patterns provided")
+	assert.EqualError(t, n.Unsubscribe([]string{"*"}), "not subscribed")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	byContext, err := n.Subscribe(ctx, []string{"*"})
+	require.NoError(t, err)
+	byClose, err := n.Subscribe(context.Background(), []string{"*:start", "*:stop"})
+	require.NoError(t, err)
+
+	// Unsubscribed patterns no longer match
+	require.NoError(t, n.Unsubscribe([]string{"*:start"}))
+	require.NoError(t, store.Store(context.Background(), &models.StartRecord{BaseAccountingRecord: testBase(time.Now())}))
+	assert.Equal(t, "set", nextEvent(t, byContext).Operation)
+	assert.Empty(t, byClose)
+
+	cancel()
+	assert.Eventually(t, func() bool {
+		_, ok := <-byContext
+		return !ok
+	}, 2*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, n.Close())
+	_, ok := <-byClose
+	assert.False(t, ok)
+
+	// The storage stays open after its notifier is closed
+	assert.NoError(t, store.HealthCheck(context.Background()))
+}
+
+func TestInMemoryStorage_Close(t *testing.T) {
+	store := newInMemoryStorage(time.Minute, 0, time.Hour)
+
+	events, err := store.Notifier().Subscribe(context.Background(), []string{"*"})
+	require.NoError(t, err)
+
+	require.NoError(t, store.Close())
+	require.NoError(t, store.Close())
+
+	_, ok := <-events
+	assert.False(t, ok)
+	assert.ErrorIs(t, store.HealthCheck(context.Background()), errStorageClosed)
+	assert.ErrorIs(t, store.Store(context.Background(), &models.StartRecord{BaseAccountingRecord: testBase(time.Now())}), errStorageClosed)
+
+	_, err = store.Notifier().Subscribe(context.Background(), []string{"*"})
+	assert.ErrorIs(t, err, errStorageClosed)
+}
+
+func TestNewInMemoryStorage(t *testing.T) {
+	_ = os.Setenv("RADIUS_SHARED_SECRET", "testsecret123")
+	_ = os.Setenv("STORAGE_BACKEND", "memory")
+	_ = os.Setenv("MEMORY_TTL_SECONDS", "30")
+	_ = os.Setenv("MEMORY_MAX_RECORDS", "10")
+	defer func() {
+		_ = os.Unsetenv("RADIUS_SHARED_SECRET")
+		_ = os.Unsetenv("STORAGE_BACKEND")
+		_ = os.Unsetenv("MEMORY_TTL_SECONDS")
+		_ = os.Unsetenv("MEMORY_MAX_RECORDS")
+	}()
+
+	cfg, err := config.LoadControlplane("", nil)
+	require.NoError(t, err)
+
+	store, err := New(cfg)
+	require.NoError(t, err)
+	defer store.Close()
+
+	require.IsType(t, &InMemoryStorage{}, store)
+	memory := store.(*InMemoryStorage)
+	assert.Equal(t, 30*time.Second, memory.TTL())
+	assert.Equal(t, 10, memory.maxRecords)
+}
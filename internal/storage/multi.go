@@ -0,0 +1,338 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/kal997/radius-accounting-server/internal/config"
+	"github.com/kal997/radius-accounting-server/internal/models"
+)
+
+// ErrQuorumNotMet is returned by MultiStorage.Store when a required backend
+// failed or too few backends stored the record. The record must not be
+// acknowledged so that the NAS retransmits it.
+var ErrQuorumNotMet = errors.New("storage quorum not met")
+
+// Records whose quorum was not met are remembered for partialWriteTTL, up to
+// maxPartialWrites of them, so that their retransmission skips the backends
+// that already stored them
+const (
+	partialWriteTTL  = 10 * time.Minute
+	maxPartialWrites = 10000
+)
+
+// partialWrite records which backends stored a record whose quorum was not met
+type partialWrite struct {
+	stored    []bool
+	expiresAt time.Time
+}
+
+// multiBackend is a backend written to by a MultiStorage
+type multiBackend struct {
+	name     string
+	store    Storage
+	required bool
+}
+
+// MultiStorage implements the Storage interface by writing every record to
+// several backends concurrently, e.g. Redis for hot data and PostgreSQL for
+// history. A record is stored when every required backend succeeded and at
+// least quorum backends succeeded in total; best-effort failures are logged.
+//
+// When the quorum is not met, storing the same record again (the handler
+// keeps its key across retransmissions) only writes it to the backends that
+// did not store it, so that it is not duplicated in the others.
+type MultiStorage struct {
+	backends []multiBackend
+	quorum   int
+
+	mu      sync.Mutex // Protects partial
+	partial map[string]*partialWrite
+}
+
+// NewMultiStorage creates every backend listed in the multi storage settings
+func NewMultiStorage(cfg *config.ControlplaneConfig) (*MultiStorage, error) {
+	multiCfg := cfg.GetStorage().GetMulti()
+
+	var backends []multiBackend
+	for _, target := range multiCfg.GetTargets() {
+		store, err := newBackend(cfg, target.Backend)
+		if err != nil {
+			for _, backend := range backends {
+				_ = backend.store.Close()
+			}
+			return nil, fmt.Errorf("failed to initialize %s storage: %w", target.Backend, err)
+		}
+		backends = append(backends, multiBackend{
+			name:     string(target.Backend),
+			store:    store,
+			required: target.Policy == config.StoragePolicyRequired,
+		})
+	}
+
+	return newMultiStorage(multiCfg.GetQuorum(), backends), nil
+}
+
+func newMultiStorage(quorum int, backends []multiBackend) *MultiStorage {
+	return &MultiStorage{backends: backends, quorum: quorum, partial: make(map[string]*partialWrite)}
+}
+
+// Backends returns the underlying backends in configuration order
+func (ms *MultiStorage) Backends() []Storage {
+	stores := make([]Storage, len(ms.backends))
+	for i, backend := range ms.backends {
+		stores[i] = backend.store
+	}
+	return stores
+}
+
+// Store writes the record to every backend that has not stored it yet and
+// waits for all of them
+func (ms *MultiStorage) Store(ctx context.Context, record models.AccountingEvent) error {
+	if record == nil {
+		return fmt.Errorf("record cannot be nil")
+	}
+
+	key := record.GenerateRedisKey()
+	stored := ms.partialStored(key)
+	errs := ms.each(func(i int, store Storage) error {
+		if stored[i] {
+			return nil
+		}
+		return store.Store(ctx, record)
+	})
+
+	err := ms.check("store record", errs)
+	ms.rememberPartial(key, stored, errs, err)
+	return err
+}
+
+// partialStored returns which backends already stored the record of key
+func (ms *MultiStorage) partialStored(key string) []bool {
+	stored := make([]bool, len(ms.backends))
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if partial, ok := ms.partial[key]; ok && time.Now().Before(partial.expiresAt) {
+		copy(stored, partial.stored)
+	}
+	return stored
+}
+
+// rememberPartial records the backends that stored the record of key when
+// the quorum was not met, and forgets the record once it is stored
+func (ms *MultiStorage) rememberPartial(key string, stored []bool, errs []error, err error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if err == nil {
+		delete(ms.partial, key)
+		return
+	}
+
+	now := time.Now()
+	if _, ok := ms.partial[key]; !ok && len(ms.partial) >= maxPartialWrites {
+		for k, partial := range ms.partial {
+			if !now.Before(partial.expiresAt) {
+				delete(ms.partial, k)
+			}
+		}
+		if len(ms.partial) >= maxPartialWrites {
+			log.Printf("Too many records pending a retransmission, %s may be stored twice", key)
+			return
+		}
+	}
+
+	for i, backendErr := range errs {
+		stored[i] = stored[i] || backendErr == nil
+	}
+	ms.partial[key] = &partialWrite{stored: stored, expiresAt: now.Add(partialWriteTTL)}
+}
+
+// Query reads from the first backend, in configuration order, that supports
+// queries
+func (ms *MultiStorage) Query(ctx context.Context, q Query) (*QueryResult, error) {
+	for _, backend := range ms.backends {
+		if querier, ok := backend.store.(Querier); ok {
+			return querier.Query(ctx, q)
+		}
+	}
+	return nil, ErrQueryNotSupported
+}
+
+// Record reads from the first backend, in configuration order, that supports
+// queries
+func (ms *MultiStorage) Record(ctx context.Context, key string) (models.AccountingEvent, error) {
+	for _, backend := range ms.backends {
+		if querier, ok := backend.store.(Querier); ok {
+			return querier.Record(ctx, key)
+		}
+	}
+	return nil, ErrQueryNotSupported
+}
+
+// LookupIP reads from the first backend, in configuration order, that keeps
+// an IP assignment timeline
+func (ms *MultiStorage) LookupIP(ctx context.Context, prefix netip.Prefix, at time.Time) ([]IPAssignment, error) {
+	for _, backend := range ms.backends {
+		if attributor, ok := backend.store.(IPAttributor); ok {
+			return attributor.LookupIP(ctx, prefix, at)
+		}
+	}
+	return nil, ErrIPLookupNotSupported
+}
+
+// sessionTracker returns the first backend, in configuration order, that
+// tracks sessions
+func (ms *MultiStorage) sessionTracker() (SessionTracker, error) {
+	for _, backend := range ms.backends {
+		if tracker, ok := backend.store.(SessionTracker); ok {
+			return tracker, nil
+		}
+	}
+	return nil, ErrSessionsNotSupported
+}
+
+// Sessions reads from the first backend that tracks sessions
+func (ms *MultiStorage) Sessions(ctx context.Context, q SessionQuery) (*SessionResult, error) {
+	tracker, err := ms.sessionTracker()
+	if err != nil {
+		return nil, err
+	}
+	return tracker.Sessions(ctx, q)
+}
+
+// Session reads from the first backend that tracks sessions
+func (ms *MultiStorage) Session(ctx context.Context, nasIPAddress, acctSessionID string) (*Session, error) {
+	tracker, err := ms.sessionTracker()
+	if err != nil {
+		return nil, err
+	}
+	return tracker.Session(ctx, nasIPAddress, acctSessionID)
+}
+
+// NASSummaries reads from the first backend that tracks sessions
+func (ms *MultiStorage) NASSummaries(ctx context.Context) ([]NASSummary, error) {
+	tracker, err := ms.sessionTracker()
+	if err != nil {
+		return nil, err
+	}
+	return tracker.NASSummaries(ctx)
+}
+
+// archiveTracker returns the first backend, in configuration order, that
+// tracks archived records
+func (ms *MultiStorage) archiveTracker() (ArchiveTracker, error) {
+	for _, backend := range ms.backends {
+		if tracker, ok := backend.store.(ArchiveTracker); ok {
+			return tracker, nil
+		}
+	}
+	return nil, ErrArchiveNotSupported
+}
+
+// Unarchived reads from the first backend that tracks archived records
+func (ms *MultiStorage) Unarchived(ctx context.Context, deadline time.Time, fn func(key string, record models.AccountingEvent) error) error {
+	tracker, err := ms.archiveTracker()
+	if err != nil {
+		return err
+	}
+	return tracker.Unarchived(ctx, deadline, fn)
+}
+
+// Archived reads from the first backend that tracks archived records
+func (ms *MultiStorage) Archived(ctx context.Context, key string) (bool, error) {
+	tracker, err := ms.archiveTracker()
+	if err != nil {
+		return false, err
+	}
+	return tracker.Archived(ctx, key)
+}
+
+// MarkArchived marks the records in the first backend that tracks archived
+// records
+func (ms *MultiStorage) MarkArchived(ctx context.Context, keys []string) error {
+	tracker, err := ms.archiveTracker()
+	if err != nil {
+		return err
+	}
+	return tracker.MarkArchived(ctx, keys)
+}
+
+// HealthCheck reports the backends that are unhealthy. It fails only when
+// the backends that remain could not meet the quorum.
+func (ms *MultiStorage) HealthCheck(ctx context.Context) error {
+	errs := ms.each(func(_ int, store Storage) error {
+		return store.HealthCheck(ctx)
+	})
+	return ms.check("health check", errs)
+}
+
+// Close closes every backend and returns all the errors encountered
+func (ms *MultiStorage) Close() error {
+	errs := ms.each(func(_ int, store Storage) error {
+		return store.Close()
+	})
+
+	var joined []error
+	for i, err := range errs {
+		if err != nil {
+			joined = append(joined, fmt.Errorf("%s: %w", ms.backends[i].name, err))
+		}
+	}
+	return errors.Join(joined...)
+}
+
+// each runs fn on every backend concurrently, with its index, and returns
+// the errors in backend order
+func (ms *MultiStorage) each(fn func(i int, store Storage) error) []error {
+	errs := make([]error, len(ms.backends))
+
+	var wg sync.WaitGroup
+	for i, backend := range ms.backends {
+		wg.Add(1)
+		go func(i int, store Storage) {
+			defer wg.Done()
+			errs[i] = fn(i, store)
+		}(i, backend.store)
+	}
+	wg.Wait()
+
+	return errs
+}
+
+// check applies the backend policies and the quorum to the per-backend errors
+func (ms *MultiStorage) check(operation string, errs []error) error {
+	var (
+		succeeded      int
+		failed         []error
+		requiredFailed bool
+	)
+
+	for i, err := range errs {
+		backend := ms.backends[i]
+		if err == nil {
+			succeeded++
+			continue
+		}
+
+		failed = append(failed, fmt.Errorf("%s: %w", backend.name, err))
+		if backend.required {
+			requiredFailed = true
+		} else {
+			log.Printf("Best-effort %s storage failed to %s: %v", backend.name, operation, err)
+		}
+	}
+
+	if requiredFailed || succeeded < ms.quorum {
+		return fmt.Errorf("%w (%d of %d backends succeeded, quorum %d): %w",
+			ErrQuorumNotMet, succeeded, len(ms.backends), ms.quorum, errors.Join(failed...))
+	}
+
+	return nil
+}
@@ -0,0 +1,207 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kal997/radius-accounting-server/internal/config"
+	"github.com/kal997/radius-accounting-server/internal/models"
+)
+
+// fakeStorage is a Storage whose operations fail with err
+type fakeStorage struct {
+	err    error
+	stored atomic.Int32
+	closed atomic.Bool
+}
+
+func (f *fakeStorage) Store(ctx context.Context, record models.AccountingEvent) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.stored.Add(1)
+	return nil
+}
+
+func (f *fakeStorage) HealthCheck(ctx context.Context) error {
+	return f.err
+}
+
+func (f *fakeStorage) Close() error {
+	f.closed.Store(true)
+	return f.err
+}
+
+func TestMultiStorage_Store(t *testing.T) {
+	failure := errors.New("connection refused")
+
+	tests := []struct {
+		name     string
+		quorum   int
+		backends []multiBackend
+		wantErr  string
+	}{
+		{
+			name:   "all succeed",
+			quorum: 2,
+			backends: []multiBackend{
+				{name: "redis", store: &fakeStorage{}, required: true},
+				{name: "postgres", store: &fakeStorage{}, required: true},
+			},
+		},
+		{
+			name:   "best-effort failure is tolerated",
+			quorum: 1,
+			backends: []multiBackend{
+				{name: "redis", store: &fakeStorage{}, required: true},
+				{name: "postgres", store: &fakeStorage{err: failure}},
+			},
+		},
+		{
+			name:   "required failure",
+			quorum: 1,
+			backends: []multiBackend{
+				{name: "redis", store: &fakeStorage{err: failure}, required: true},
+				{name: "postgres", store: &fakeStorage{}},
+			},
+			wantErr: "storage quorum not met (1 of 2 backends succeeded, quorum 1): redis: connection refused",
+		},
+		{
+			name:   "quorum not met by best-effort backends",
+			quorum: 2,
+			backends: []multiBackend{
+				{name: "sqlite", store: &fakeStorage{}},
+				{name: "postgres", store: &fakeStorage{err: failure}},
+			},
+			wantErr: "storage quorum not met (1 of 2 backends succeeded, quorum 2): postgres: connection refused",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ms := newMultiStorage(tt.quorum, tt.backends)
+
+			err := ms.Store(context.Background(), &models.StartRecord{BaseAccountingRecord: testBase(time.Now())})
+
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, tt.wantErr)
+			assert.ErrorIs(t, err, ErrQuorumNotMet)
+			assert.ErrorIs(t, err, failure)
+
+			// Healthy backends were still written to
+			for _, backend := range tt.backends {
+				if fake := backend.store.(*fakeStorage); fake.err == nil {
+					assert.Equal(t, int32(1), fake.stored.Load())
+				}
+			}
+		})
+	}
+}
+
+func TestMultiStorage_StoreRetransmission(t *testing.T) {
+	redis := &fakeStorage{}
+	postgres := &fakeStorage{err: errors.New("connection refused")}
+	ms := newMultiStorage(2, []multiBackend{
+		{name: "redis", store: redis, required: true},
+		{name: "postgres", store: postgres, required: true},
+	})
+	record := &models.StartRecord{BaseAccountingRecord: testBase(time.Now())}
+
+	err := ms.Store(context.Background(), record)
+	require.ErrorIs(t, err, ErrQuorumNotMet)
+	assert.Equal(t, int32(1), redis.stored.Load())
+
+	// The retransmission only goes to the backend that failed
+	postgres.err = nil
+	require.NoError(t, ms.Store(context.Background(), record))
+	assert.Equal(t, int32(1), redis.stored.Load())
+	assert.Equal(t, int32(1), postgres.stored.Load())
+
+	// and a stored record is forgotten
+	require.NoError(t, ms.Store(context.Background(), record))
+	assert.Equal(t, int32(2), redis.stored.Load())
+	assert.Empty(t, ms.partial)
+}
+
+func TestMultiStorage_HealthCheck(t *testing.T) {
+	healthy := &fakeStorage{}
+	unhealthy := &fakeStorage{err: errors.New("down")}
+
+	ms := newMultiStorage(1, []multiBackend{
+		{name: "redis", store: healthy, required: true},
+		{name: "postgres", store: unhealthy},
+	})
+	assert.NoError(t, ms.HealthCheck(context.Background()))
+
+	ms = newMultiStorage(1, []multiBackend{
+		{name: "redis", store: healthy},
+		{name: "postgres", store: unhealthy, required: true},
+	})
+	assert.ErrorContains(t, ms.HealthCheck(context.Background()), "postgres: down")
+}
+
+func TestMultiStorage_Close(t *testing.T) {
+	first := &fakeStorage{err: errors.New("close failed")}
+	second := &fakeStorage{}
+
+	ms := newMultiStorage(1, []multiBackend{
+		{name: "redis", store: first, required: true},
+		{name: "sqlite", store: second},
+	})
+
+	err := ms.Close()
+
+	assert.EqualError(t, err, "redis: close failed")
+	assert.True(t, first.closed.Load())
+	assert.True(t, second.closed.Load())
+	assert.Equal(t, []Storage{first, second}, ms.Backends())
+}
+
+func TestNewMultiStorage(t *testing.T) {
+	_ = os.Setenv("RADIUS_SHARED_SECRET", "testsecret123")
+	_ = os.Setenv("STORAGE_BACKEND", "multi")
+	_ = os.Setenv("STORAGE_MULTI_BACKENDS", "sqlite:required,postgres:best_effort")
+	_ = os.Setenv("SQLITE_PATH", filepath.Join(t.TempDir(), "accounting.db"))
+	_ = os.Setenv("POSTGRES_DSN", "postgres://radius@127.0.0.1:1/radius?connect_timeout=1")
+	defer func() {
+		_ = os.Unsetenv("RADIUS_SHARED_SECRET")
+		_ = os.Unsetenv("STORAGE_BACKEND")
+		_ = os.Unsetenv("STORAGE_MULTI_BACKENDS")
+		_ = os.Unsetenv("SQLITE_PATH")
+		_ = os.Unsetenv("POSTGRES_DSN")
+	}()
+
+	cfg, err := config.LoadControlplane("", nil)
+	require.NoError(t, err)
+
+	// A backend that cannot be created fails the whole storage
+	store, err := New(cfg)
+
+	assert.Nil(t, store)
+	assert.ErrorContains(t, err, "failed to initialize postgres storage")
+
+	_ = os.Setenv("STORAGE_MULTI_BACKENDS", "sqlite")
+	cfg, err = config.LoadControlplane("", nil)
+	require.NoError(t, err)
+
+	store, err = New(cfg)
+	require.NoError(t, err)
+	defer func() {
+		_ = store.Close()
+	}()
+
+	require.IsType(t, &MultiStorage{}, store)
+	assert.IsType(t, &SQLiteStorage{}, store.(*MultiStorage).Backends()[0])
+	assert.NoError(t, store.HealthCheck(context.Background()))
+}
@@ -0,0 +1,400 @@
+package storage
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/kal997/radius-accounting-server/internal/config"
+	"github.com/kal997/radius-accounting-server/internal/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// postgresMigrations are applied in order and recorded in schema_migrations
+// by their 1-based index. Never edit a migration that has been released,
+// append a new one instead.
+var postgresMigrations = []string{
+	// 1: partitioned accounting records and per-session aggregates
+	`CREATE TABLE accounting_records (
+		record_key         text        NOT NULL,
+		record_type        text        NOT NULL,
+		username           text        NOT NULL,
+		acct_session_id    text        NOT NULL,
+		nas_ip_address     text        NOT NULL,
+		nas_port           bigint      NOT NULL, -- NAS-Port is unsigned 32-bit
+		calling_station_id text        NOT NULL,
+		called_station_id  text        NOT NULL,
+		client_ip          text        NOT NULL,
+		framed_ip_address  text,
+		session_time       bigint,
+		input_octets       bigint,
+		output_octets      bigint,
+		terminate_cause    text,
+		event_time         timestamptz NOT NULL,
+		data               jsonb       NOT NULL, -- Record as stored in Redis
+		PRIMARY KEY (record_key, event_time)
+	) PARTITION BY RANGE (event_time);
+	CREATE INDEX accounting_records_username_idx ON accounting_records (username, event_time);
+	CREATE INDEX accounting_records_session_idx ON accounting_records (acct_session_id, event_time);
+	CREATE INDEX accounting_records_nas_idx ON accounting_records (nas_ip_address, event_time);
+
+	CREATE TABLE accounting_sessions (
+		acct_session_id    text        NOT NULL,
+		nas_ip_address     text        NOT NULL,
+		username           text        NOT NULL,
+		nas_port           bigint      NOT NULL,
+		calling_station_id text        NOT NULL,
+		called_station_id  text        NOT NULL,
+		framed_ip_address  text,
+		session_time       bigint      NOT NULL DEFAULT 0,
+		input_octets       bigint      NOT NULL DEFAULT 0,
+		output_octets      bigint      NOT NULL DEFAULT 0,
+		terminate_cause    text,
+		record_count       bigint      NOT NULL DEFAULT 0,
+		started_at         timestamptz,
+		updated_at         timestamptz NOT NULL,
+		stopped_at         timestamptz,
+		PRIMARY KEY (acct_session_id, nas_ip_address)
+	);
+	CREATE INDEX accounting_sessions_username_idx ON accounting_sessions (username, updated_at);
+	CREATE INDEX accounting_sessions_nas_idx ON accounting_sessions (nas_ip_address, updated_at);
+	CREATE INDEX accounting_sessions_updated_at_idx ON accounting_sessions (updated_at);`,
+}
+
+// postgresMigrationLock is the advisory lock key that serialises migrations
+// when several controlplanes start at the same time
+const postgresMigrationLock = 0x72616463 // "radc"
+
+// postgresRecordColumns lists the accounting_records columns in table order
+var postgresRecordColumns = []string{
+	"record_key", "record_type", "username", "acct_session_id", "nas_ip_address", "nas_port",
+	"calling_station_id", "called_station_id", "client_ip", "framed_ip_address",
+	"session_time", "input_octets", "output_octets", "terminate_cause", "event_time", "data",
+}
+
+// postgresFlushSQL moves a staged batch into accounting_records, skipping
+// records already stored, and folds the new records into their sessions.
+// Counters only ever grow so out-of-order interim updates are harmless.
+const postgresFlushSQL = `
+	WITH inserted AS (
+		INSERT INTO accounting_records SELECT * FROM accounting_records_staging
+		ON CONFLICT DO NOTHING
+		RETURNING *
+	)
+	INSERT INTO accounting_sessions AS s (
+		acct_session_id, nas_ip_address, username, nas_port, calling_station_id, called_station_id,
+		framed_ip_address, session_time, input_octets, output_octets, terminate_cause,
+		record_count, started_at, updated_at, stopped_at
+	)
+	SELECT
+		acct_session_id,
+		nas_ip_address,
+		(array_agg(username ORDER BY event_time DESC))[1],
+		(array_agg(nas_port ORDER BY event_time DESC))[1],
+		(array_agg(calling_station_id ORDER BY event_time DESC))[1],
+		(array_agg(called_station_id ORDER BY event_time DESC))[1],
+		(array_agg(framed_ip_address ORDER BY event_time DESC) FILTER (WHERE framed_ip_address IS NOT NULL))[1],
+		COALESCE(MAX(session_time), 0),
+		COALESCE(MAX(input_octets), 0),
+		COALESCE(MAX(output_octets), 0),
+		(array_agg(terminate_cause ORDER BY event_time DESC) FILTER (WHERE terminate_cause IS NOT NULL))[1],
+		COUNT(*),
+		MIN(event_time) FILTER (WHERE record_type = 'start'),
+		MAX(event_time),
+		MAX(event_time) FILTER (WHERE record_type = 'stop')
+	FROM inserted
+	GROUP BY acct_session_id, nas_ip_address
+	ON CONFLICT (acct_session_id, nas_ip_address) DO UPDATE SET
+		framed_ip_address = COALESCE(excluded.framed_ip_address, s.framed_ip_address),
+		session_time      = GREATEST(s.session_time, excluded.session_time),
+		input_octets      = GREATEST(s.input_octets, excluded.input_octets),
+		output_octets     = GREATEST(s.output_octets, excluded.output_octets),
+		terminate_cause   = COALESCE(excluded.terminate_cause, s.terminate_cause),
+		record_count      = s.record_count + excluded.record_count,
+		started_at        = LEAST(s.started_at, excluded.started_at),
+		updated_at        = GREATEST(s.updated_at, excluded.updated_at),
+		stopped_at        = GREATEST(s.stopped_at, excluded.stopped_at)`
+
+// errStorageClosed is returned by Store after Close
+var errStorageClosed = errors.New("storage is closed")
+
+// postgresWrite is a record waiting to be written by the next batch
+type postgresWrite struct {
+	row  *recordRow
+	done chan error // Buffered so the writer never blocks on a caller
+}
+
+// PostgresStorage implements the Storage interface using PostgreSQL.
+// Records go to accounting_records, range-partitioned by event time, and
+// each session is aggregated in accounting_sessions.
+//
+// Concurrent Store calls are grouped and written with a single COPY; each
+// call returns once the batch containing its record is committed.
+type PostgresStorage struct {
+	pool      *pgxpool.Pool
+	batchSize int
+	interval  config.PartitionInterval
+
+	writes     chan postgresWrite
+	partitions map[string]bool // Partitions known to exist; only used by the writer
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewPostgresStorage connects to PostgreSQL, applies pending migrations and
+// starts the batch writer
+func NewPostgresStorage(cfg *config.ControlplaneConfig) (*PostgresStorage, error) {
+	pgCfg := cfg.GetStorage().GetPostgres()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	pool, err := pgxpool.New(ctx, pgCfg.GetDSN())
+	if err != nil {
+		return nil, fmt.Errorf("invalid PostgreSQL connection string: %w", err)
+	}
+
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("failed to connect to PostgreSQL: %w", err)
+	}
+
+	if err := migratePostgres(ctx, pool); err != nil {
+		pool.Close()
+		return nil, err
+	}
+
+	ps := &PostgresStorage{
+		pool:       pool,
+		batchSize:  pgCfg.GetBatchSize(),
+		interval:   pgCfg.GetPartitionInterval(),
+		writes:     make(chan postgresWrite),
+		partitions: make(map[string]bool),
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+
+	go ps.writeLoop()
+
+	return ps, nil
+}
+
+// migratePostgres applies every migration not yet recorded in schema_migrations
+func migratePostgres(ctx context.Context, pool *pgxpool.Pool) error {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin PostgreSQL migrations: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", postgresMigrationLock); err != nil {
+		return fmt.Errorf("failed to lock PostgreSQL migrations: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    integer     PRIMARY KEY,
+		applied_at timestamptz NOT NULL DEFAULT now()
+	)`); err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	var version int
+	if err := tx.QueryRow(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version); err != nil {
+		return fmt.Errorf("failed to read PostgreSQL schema version: %w", err)
+	}
+
+	if version > len(postgresMigrations) {
+		return fmt.Errorf("PostgreSQL schema version %d is newer than supported version %d", version, len(postgresMigrations))
+	}
+
+	for i := version; i < len(postgresMigrations); i++ {
+		if _, err := tx.Exec(ctx, postgresMigrations[i]); err != nil {
+			return fmt.Errorf("failed to apply PostgreSQL migration %d: %w", i+1, err)
+		}
+		if _, err := tx.Exec(ctx, "INSERT INTO schema_migrations (version) VALUES ($1)", i+1); err != nil {
+			return fmt.Errorf("failed to record PostgreSQL migration %d: %w", i+1, err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit PostgreSQL migrations: %w", err)
+	}
+
+	return nil
+}
+
+// partitionRange returns the name and [from, to) bounds of the
+// accounting_records partition holding t
+func partitionRange(interval config.PartitionInterval, t time.Time) (string, time.Time, time.Time) {
+	t = t.UTC()
+	if interval == config.PartitionDaily {
+		from := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		return "accounting_records_" + from.Format("20060102"), from, from.AddDate(0, 0, 1)
+	}
+	from := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return "accounting_records_" + from.Format("200601"), from, from.AddDate(0, 1, 0)
+}
+
+// Store queues a record for the next batch and waits until it is committed.
+// Storing the same record twice is a no-op.
+func (ps *PostgresStorage) Store(ctx context.Context, record models.AccountingEvent) error {
+	row, err := newRecordRow(record)
+	if err != nil {
+		return err
+	}
+
+	write := postgresWrite{row: row, done: make(chan error, 1)}
+
+	select {
+	case ps.writes <- write:
+	case <-ps.stop:
+		return errStorageClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case err := <-write.done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// writeLoop collects the writes that are waiting and flushes them as one
+// batch, so batches grow with load without delaying a lone record
+func (ps *PostgresStorage) writeLoop() {
+	defer close(ps.done)
+
+	for {
+		var batch []postgresWrite
+
+		select {
+		case <-ps.stop:
+			return
+		case write := <-ps.writes:
+			batch = append(batch, write)
+		}
+
+	collect:
+		for len(batch) < ps.batchSize {
+			select {
+			case write := <-ps.writes:
+				batch = append(batch, write)
+			default:
+				break collect
+			}
+		}
+
+		err := ps.flush(batch)
+		for _, write := range batch {
+			write.done <- err
+		}
+	}
+}
+
+// flush writes a batch with COPY in a single transaction
+func (ps *PostgresStorage) flush(batch []postgresWrite) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	for _, write := range batch {
+		if err := ps.ensurePartition(ctx, write.row.eventTime); err != nil {
+			return err
+		}
+	}
+
+	tx, err := ps.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to store records in PostgreSQL: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	// COPY cannot skip duplicates, so the batch is staged first
+	if _, err := tx.Exec(ctx, "CREATE TEMP TABLE accounting_records_staging (LIKE accounting_records) ON COMMIT DROP"); err != nil {
+		return fmt.Errorf("failed to create PostgreSQL staging table: %w", err)
+	}
+
+	rows := pgx.CopyFromSlice(len(batch), func(i int) ([]any, error) {
+		return postgresRecordValues(batch[i].row), nil
+	})
+	if _, err := tx.CopyFrom(ctx, pgx.Identifier{"accounting_records_staging"}, postgresRecordColumns, rows); err != nil {
+		return fmt.Errorf("failed to copy records to PostgreSQL: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, postgresFlushSQL); err != nil {
+		return fmt.Errorf("failed to store records in PostgreSQL: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to store records in PostgreSQL: %w", err)
+	}
+
+	return nil
+}
+
+// ensurePartition creates the partition for t unless it is known to exist.
+// It runs outside the batch transaction so the lock on the parent table is
+// held only briefly.
+func (ps *PostgresStorage) ensurePartition(ctx context.Context, t time.Time) error {
+	name, from, to := partitionRange(ps.interval, t)
+	if ps.partitions[name] {
+		return nil
+	}
+
+	_, err := ps.pool.Exec(ctx, fmt.Sprintf(
+		"CREATE TABLE IF NOT EXISTS %s PARTITION OF accounting_records FOR VALUES FROM ('%s') TO ('%s')",
+		pgx.Identifier{name}.Sanitize(), from.Format(time.RFC3339), to.Format(time.RFC3339),
+	))
+
+	// Another controlplane may have created it concurrently
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "42P07" { // duplicate_table
+		err = nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create PostgreSQL partition %s: %w", name, err)
+	}
+
+	ps.partitions[name] = true
+	return nil
+}
+
+// postgresRecordValues returns the values of a row in postgresRecordColumns order
+func postgresRecordValues(row *recordRow) []any {
+	return []any{
+		row.key, row.recordType, row.base.Username, row.base.AcctSessionID, row.base.NASIPAddress,
+		int64(row.base.NASPort), row.base.CallingStationID, row.base.CalledStationID, row.base.ClientIP,
+		nullValue(row.framedIPAddress), nullValue(row.sessionTime), nullValue(row.inputOctets),
+		nullValue(row.outputOctets), nullValue(row.terminateCause), row.eventTime, row.data,
+	}
+}
+
+// nullValue unwraps a sql.Null* value into nil or its underlying value
+func nullValue(v driver.Valuer) any {
+	value, _ := v.Value()
+	return value
+}
+
+// HealthCheck verifies PostgreSQL connectivity
+func (ps *PostgresStorage) HealthCheck(ctx context.Context) error {
+	return ps.pool.Ping(ctx)
+}
+
+// Close waits for the batch in progress, then closes the connection pool
+func (ps *PostgresStorage) Close() error {
+	ps.closeOnce.Do(func() {
+		close(ps.stop)
+		<-ps.done
+		ps.pool.Close()
+	})
+	return nil
+}
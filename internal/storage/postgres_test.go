@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kal997/radius-accounting-server/internal/config"
+	"github.com/kal997/radius-accounting-server/internal/models"
+)
+
+func TestPartitionRange(t *testing.T) {
+	tests := []struct {
+		name     string
+		interval config.PartitionInterval
+		time     time.Time
+		wantName string
+		wantFrom time.Time
+		wantTo   time.Time
+	}{
+		{
+			name:     "monthly",
+			interval: config.PartitionMonthly,
+			time:     time.Date(2026, 10, 18, 13, 45, 0, 0, time.UTC),
+			wantName: "accounting_records_202610",
+			wantFrom: time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC),
+			wantTo:   time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "monthly across year end",
+			interval: config.PartitionMonthly,
+			time:     time.Date(2026, 12, 31, 23, 59, 59, 0, time.UTC),
+			wantName: "accounting_records_202612",
+			wantFrom: time.Date(2026, 12, 1, 0, 0, 0, 0, time.UTC),
+			wantTo:   time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "daily",
+			interval: config.PartitionDaily,
+			time:     time.Date(2026, 2, 28, 8, 0, 0, 0, time.UTC),
+			wantName: "accounting_records_20260228",
+			wantFrom: time.Date(2026, 2, 28, 0, 0, 0, 0, time.UTC),
+			wantTo:   time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "converted to UTC",
+			interval: config.PartitionDaily,
+			time:     time.Date(2026, 3, 1, 1, 0, 0, 0, time.FixedZone("CET", 3600)),
+			wantName: "accounting_records_20260301",
+			wantFrom: time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC),
+			wantTo:   time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, from, to := partitionRange(tt.interval, tt.time)
+
+			assert.Equal(t, tt.wantName, name)
+			assert.Equal(t, tt.wantFrom, from)
+			assert.Equal(t, tt.wantTo, to)
+		})
+	}
+}
+
+func TestPostgresRecordValues(t *testing.T) {
+	now := time.Now()
+	base := testBase(now)
+	base.NASPort = 4294967295 // Largest NAS-Port, beyond int32
+	row, err := newRecordRow(&models.StopRecord{
+		BaseAccountingRecord: base,
+		SessionTime:          120,
+		TerminateCause:       "1",
+		InputOctets:          300,
+		OutputOctets:         400,
+	})
+	require.NoError(t, err)
+
+	values := postgresRecordValues(row)
+
+	require.Len(t, values, len(postgresRecordColumns))
+	assert.Equal(t, "stop", values[1])
+	assert.Equal(t, int64(4294967295), values[5])
+	assert.Nil(t, values[9]) // framed_ip_address is only set on Start records
+	assert.Equal(t, int64(120), values[10])
+	assert.Equal(t, "1", values[13])
+	assert.True(t, now.Equal(values[14].(time.Time)))
+}
+
+func TestNewPostgresStorage_ConnectionFailure(t *testing.T) {
+	_ = os.Setenv("RADIUS_SHARED_SECRET", "testsecret123")
+	_ = os.Setenv("STORAGE_BACKEND", "postgres")
+	_ = os.Setenv("POSTGRES_DSN", "postgres://radius@127.0.0.1:1/radius?connect_timeout=1")
+	defer func() {
+		_ = os.Unsetenv("RADIUS_SHARED_SECRET")
+		_ = os.Unsetenv("STORAGE_BACKEND")
+		_ = os.Unsetenv("POSTGRES_DSN")
+	}()
+
+	cfg, err := config.LoadControlplane("", nil)
+	require.NoError(t, err)
+
+	store, err := NewPostgresStorage(cfg)
+
+	assert.Nil(t, store)
+	assert.ErrorContains(t, err, "failed to connect to PostgreSQL")
+}
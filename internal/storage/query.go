@@ -0,0 +1,257 @@
+package storage
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kal997/radius-accounting-server/internal/models"
+)
+
+const (
+	// DefaultQueryLimit is the page size used when Query.Limit is zero
+	DefaultQueryLimit = 100
+
+	// MaxQueryLimit is the largest page size a query may request
+	MaxQueryLimit = 1000
+)
+
+// ErrInvalidQuery is wrapped by the errors returned for queries that cannot
+// be run as given
+var ErrInvalidQuery = errors.New("invalid query")
+
+// ErrInvalidCursor is returned when Query.Cursor was not produced by a
+// previous page of the same backend
+var ErrInvalidCursor = fmt.Errorf("%w: unknown cursor", ErrInvalidQuery)
+
+// ErrQueryNotSupported is returned by MultiStorage.Query when none of its
+// backends supports queries
+var ErrQueryNotSupported = errors.New("no storage backend supports queries")
+
+// Querier is implemented by storage backends that can read records back
+type Querier interface {
+	// Query returns one page of the records matching q, oldest first
+	Query(ctx context.Context, q Query) (*QueryResult, error)
+
+	// Record returns the record stored under key, or ErrNotFound
+	Record(ctx context.Context, key string) (models.AccountingEvent, error)
+}
+
+// Query selects accounting records. Every non-empty field must match; a
+// query without filters returns all records in the time range.
+type Query struct {
+	Username      string
+	AcctSessionID string
+	NASIPAddress  string
+
+	// Only Start records carry a Framed-IP-Address; use AcctSessionID to
+	// follow the rest of a session once it is found
+	FramedIPAddress string
+
+	// Calling-Station-Id, usually the client MAC address. MAC addresses
+	// match in any notation, e.g. AA-BB-CC-DD-EE-FF and aa:bb:cc:dd:ee:ff.
+	CallingStationID string
+
+	From time.Time // Inclusive, zero for no lower bound
+	To   time.Time // Exclusive, zero for no upper bound
+
+	Limit  int    // Page size, DefaultQueryLimit when zero
+	Cursor string // NextCursor of the previous page, empty for the first
+}
+
+// QueryResult is one page of query results
+type QueryResult struct {
+	Records []models.AccountingEvent
+
+	// NextCursor continues the query after this page. It is empty on the
+	// last page; a full page may be followed by an empty one.
+	NextCursor string
+}
+
+// queryPosition orders records by event time, then by key
+type queryPosition struct {
+	micros int64 // Event time in microseconds since the epoch
+	key    string
+}
+
+func (p queryPosition) after(other queryPosition) bool {
+	if p.micros != other.micros {
+		return p.micros > other.micros
+	}
+	return p.key > other.key
+}
+
+func (p queryPosition) cursor() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(p.micros, 10) + ":" + p.key))
+}
+
+func parseCursor(cursor string) (*queryPosition, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	micros, key, ok := strings.Cut(string(raw), ":")
+	if !ok || key == "" {
+		return nil, ErrInvalidCursor
+	}
+	pos := queryPosition{key: key}
+	if pos.micros, err = strconv.ParseInt(micros, 10, 64); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &pos, nil
+}
+
+// prepare validates the query and returns its page size and the position of
+// the last record of the previous page, nil for the first page
+func (q *Query) prepare() (int, *queryPosition, error) {
+	limit := q.Limit
+	if limit == 0 {
+		limit = DefaultQueryLimit
+	}
+	if limit < 0 || limit > MaxQueryLimit {
+		return 0, nil, invalidQuery("limit must be between 1 and %d", MaxQueryLimit)
+	}
+	if !q.From.IsZero() && !q.To.IsZero() && !q.From.Before(q.To) {
+		return 0, nil, invalidQuery("from must be before to")
+	}
+	if q.Cursor == "" {
+		return limit, nil, nil
+	}
+	after, err := parseCursor(q.Cursor)
+	if err != nil {
+		return 0, nil, err
+	}
+	return limit, after, nil
+}
+
+func invalidQuery(format string, args ...any) error {
+	return fmt.Errorf("%w: "+format, append([]any{ErrInvalidQuery}, args...)...)
+}
+
+// inRange reports whether an event time in microseconds is within the range
+func (q *Query) inRange(micros int64) bool {
+	if !q.From.IsZero() && micros < q.From.UnixMicro() {
+		return false
+	}
+	if !q.To.IsZero() && micros >= q.To.UnixMicro() {
+		return false
+	}
+	return true
+}
+
+// matches reports whether record satisfies every filter of the query
+func (q *Query) matches(record models.AccountingEvent) bool {
+	base := record.Base()
+	if q.Username != "" && base.Username != q.Username {
+		return false
+	}
+	if q.AcctSessionID != "" && base.AcctSessionID != q.AcctSessionID {
+		return false
+	}
+	if q.NASIPAddress != "" && base.NASIPAddress != q.NASIPAddress {
+		return false
+	}
+	if q.CallingStationID != "" && NormalizeStationID(base.CallingStationID) != NormalizeStationID(q.CallingStationID) {
+		return false
+	}
+	if q.FramedIPAddress != "" {
+		start, ok := record.(*models.StartRecord)
+		if !ok || start.FramedIPAddress != q.FramedIPAddress {
+			return false
+		}
+	}
+	return true
+}
+
+// NormalizeStationID returns a Calling-Station-Id holding a MAC address in
+// lowercase colon notation; other identifiers are returned unchanged
+func NormalizeStationID(id string) string {
+	if mac, err := net.ParseMAC(id); err == nil {
+		return mac.String()
+	}
+	return id
+}
+
+// RecordType returns the name of a record's type: start, interim or stop
+func RecordType(record models.AccountingEvent) string {
+	switch record.(type) {
+	case *models.StartRecord:
+		return "start"
+	case *models.InterimRecord:
+		return "interim"
+	case *models.StopRecord:
+		return "stop"
+	default:
+		return "unknown"
+	}
+}
+
+// RecordTime returns the event time of a record, or fallback when its
+// timestamp cannot be parsed
+func RecordTime(record models.AccountingEvent, fallback time.Time) time.Time {
+	if t, err := time.Parse(time.RFC3339Nano, record.Base().Timestamp); err == nil {
+		return t
+	}
+	return fallback
+}
+
+// DecodeRecord decodes a record stored as JSON under key, using the record
+// type suffix of the key to pick the concrete type
+func DecodeRecord(key string, data []byte) (models.AccountingEvent, error) {
+	var record models.AccountingEvent
+
+	switch {
+	case strings.HasSuffix(key, ":start"):
+		record = &models.StartRecord{}
+	case strings.HasSuffix(key, ":interim"):
+		record = &models.InterimRecord{}
+	case strings.HasSuffix(key, ":stop"):
+		record = &models.StopRecord{}
+	default:
+		return nil, fmt.Errorf("unknown record type for key %q", key)
+	}
+
+	if err := json.Unmarshal(data, record); err != nil {
+		return nil, fmt.Errorf("failed to decode record %q: %w", key, err)
+	}
+	return record, nil
+}
+
+// KeyedRecord is the JSON form of a record with its key and type, as served by
+// the admin API and written to JSON lines exports and archives
+type KeyedRecord struct {
+	Key    string                 `json:"key"`
+	Type   string                 `json:"type"`
+	Record models.AccountingEvent `json:"record"`
+}
+
+// NewKeyedRecord returns the JSON form of record
+func NewKeyedRecord(record models.AccountingEvent) KeyedRecord {
+	return KeyedRecord{Key: record.GenerateRedisKey(), Type: RecordType(record), Record: record}
+}
+
+// UnmarshalJSON decodes the record with DecodeRecord, as its concrete type
+// depends on the key
+func (r *KeyedRecord) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Key    string          `json:"key"`
+		Type   string          `json:"type"`
+		Record json.RawMessage `json:"record"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	record, err := DecodeRecord(raw.Key, raw.Record)
+	if err != nil {
+		return err
+	}
+	*r = KeyedRecord{Key: raw.Key, Type: raw.Type, Record: record}
+	return nil
+}
@@ -0,0 +1,273 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kal997/radius-accounting-server/internal/models"
+)
+
+// queryFixture stores two sessions of alice on one NAS and one session of bob
+// on another, one minute apart, and returns the first event time. Each user
+// has a MAC address as Calling-Station-Id, in a different notation.
+func queryFixture(t *testing.T, store Storage) time.Time {
+	t.Helper()
+
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+	stations := map[string]string{"alice": "aa:bb:cc:dd:ee:01", "bob": "AA-BB-CC-DD-EE-02"}
+	base := func(user, session, nas string, minute int) models.BaseAccountingRecord {
+		return models.BaseAccountingRecord{
+			Username:         user,
+			AcctSessionID:    session,
+			NASIPAddress:     nas,
+			CallingStationID: stations[user],
+			ClientIP:         nas,
+			Timestamp:        start.Add(time.Duration(minute) * time.Minute).UTC().Format(time.RFC3339Nano),
+		}
+	}
+
+	records := []models.AccountingEvent{
+		&models.StartRecord{BaseAccountingRecord: base("alice", "a1", "192.168.1.1", 0), FramedIPAddress: "10.0.0.1"},
+		&models.StartRecord{BaseAccountingRecord: base("bob", "b1", "192.168.1.2", 1), FramedIPAddress: "10.0.0.2"},
+		&models.InterimRecord{BaseAccountingRecord: base("alice", "a1", "192.168.1.1", 2), SessionTime: 120},
+		&models.StopRecord{BaseAccountingRecord: base("alice", "a1", "192.168.1.1", 3), SessionTime: 180, TerminateCause: "1"},
+		&models.StartRecord{BaseAccountingRecord: base("alice", "a2", "192.168.1.1", 4), FramedIPAddress: "10.0.0.1"},
+		&models.StopRecord{BaseAccountingRecord: base("bob", "b1", "192.168.1.2", 5), SessionTime: 240, TerminateCause: "1"},
+	}
+	for _, record := range records {
+		require.NoError(t, store.Store(context.Background(), record))
+	}
+
+	return start
+}
+
+var recordTypeNames = map[models.AccRecordType]string{
+	models.Start:   "start",
+	models.Interim: "interim",
+	models.Stop:    "stop",
+}
+
+// sessionsOf returns the session ID and type of each record
+func sessionsOf(records []models.AccountingEvent) []string {
+	var got []string
+	for _, record := range records {
+		got = append(got, record.Base().AcctSessionID+":"+recordTypeNames[record.GetType()])
+	}
+	return got
+}
+
+// testQueries runs the same queries against any backend
+func testQueries(t *testing.T, store interface {
+	Storage
+	Querier
+}) {
+	start := queryFixture(t, store)
+	ctx := context.Background()
+
+	tests := []struct {
+		name  string
+		query Query
+		want  []string
+	}{
+		{
+			name:  "all records",
+			query: Query{},
+			want:  []string{"a1:start", "b1:start", "a1:interim", "a1:stop", "a2:start", "b1:stop"},
+		},
+		{
+			name:  "by username",
+			query: Query{Username: "bob"},
+			want:  []string{"b1:start", "b1:stop"},
+		},
+		{
+			name:  "by session",
+			query: Query{AcctSessionID: "a1"},
+			want:  []string{"a1:start", "a1:interim", "a1:stop"},
+		},
+		{
+			name:  "by NAS",
+			query: Query{NASIPAddress: "192.168.1.1"},
+			want:  []string{"a1:start", "a1:interim", "a1:stop", "a2:start"},
+		},
+		{
+			name:  "by framed IP",
+			query: Query{FramedIPAddress: "10.0.0.1"},
+			want:  []string{"a1:start", "a2:start"},
+		},
+		{
+			name:  "by calling station in another notation",
+			query: Query{CallingStationID: "aabb.ccdd.ee02"},
+			want:  []string{"b1:start", "b1:stop"},
+		},
+		{
+			name:  "by time range",
+			query: Query{From: start.Add(2 * time.Minute), To: start.Add(5 * time.Minute)},
+			want:  []string{"a1:interim", "a1:stop", "a2:start"},
+		},
+		{
+			name:  "combined filters",
+			query: Query{Username: "alice", NASIPAddress: "192.168.1.1", From: start.Add(time.Minute)},
+			want:  []string{"a1:interim", "a1:stop", "a2:start"},
+		},
+		{
+			name:  "no match",
+			query: Query{Username: "alice", NASIPAddress: "192.168.1.2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := store.Query(ctx, tt.query)
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, sessionsOf(result.Records))
+			assert.Empty(t, result.NextCursor)
+		})
+	}
+
+	t.Run("pagination", func(t *testing.T) {
+		query := Query{Username: "alice", Limit: 2}
+		var pages [][]string
+		for {
+			result, err := store.Query(ctx, query)
+			require.NoError(t, err)
+			if len(result.Records) > 0 {
+				pages = append(pages, sessionsOf(result.Records))
+			}
+			if result.NextCursor == "" {
+				break
+			}
+			query.Cursor = result.NextCursor
+		}
+
+		assert.Equal(t, [][]string{{"a1:start", "a1:interim"}, {"a1:stop", "a2:start"}}, pages)
+	})
+
+	t.Run("record by key", func(t *testing.T) {
+		result, err := store.Query(ctx, Query{AcctSessionID: "b1"})
+		require.NoError(t, err)
+		require.NotEmpty(t, result.Records)
+
+		record, err := store.Record(ctx, result.Records[0].GenerateRedisKey())
+		require.NoError(t, err)
+		assert.Equal(t, result.Records[0], record)
+
+		_, err = store.Record(ctx, "radius:acct:nobody:x:2025-01-01T00:00:00Z:start")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("invalid queries", func(t *testing.T) {
+		_, err := store.Query(ctx, Query{Limit: MaxQueryLimit + 1})
+		assert.EqualError(t, err, "invalid query: limit must be between 1 and 1000")
+
+		_, err = store.Query(ctx, Query{From: start, To: start})
+		assert.EqualError(t, err, "invalid query: from must be before to")
+
+		_, err = store.Query(ctx, Query{Cursor: "not a cursor"})
+		assert.ErrorIs(t, err, ErrInvalidCursor)
+	})
+}
+
+func TestRedisStorage_Query(t *testing.T) {
+	store, _, cleanup := newTestStorage(t, 2*time.Hour)
+	defer cleanup()
+
+	testQueries(t, store)
+}
+
+func TestRedisStorage_Query_Indexes(t *testing.T) {
+	store, mr, cleanup := newTestStorage(t, 2*time.Hour)
+	defer cleanup()
+
+	queryFixture(t, store)
+
+	members, err := mr.ZMembers("radius:idx:user:alice")
+	require.NoError(t, err)
+	assert.Len(t, members, 4)
+	assert.True(t, mr.Exists("radius:idx:all"))
+	assert.True(t, mr.Exists("radius:idx:session:b1"))
+	assert.True(t, mr.Exists("radius:idx:nas:192.168.1.2"))
+	assert.True(t, mr.Exists("radius:idx:framed_ip:10.0.0.2"))
+	assert.True(t, mr.Exists("radius:idx:calling_station:aa:bb:cc:dd:ee:02"))
+	assert.Greater(t, mr.TTL("radius:idx:all"), time.Hour)
+
+	// Index entries of expired records are skipped and removed
+	mr.Del(members[0])
+	result, err := store.Query(context.Background(), Query{Username: "alice"})
+	require.NoError(t, err)
+	assert.Len(t, result.Records, 3)
+
+	members, err = mr.ZMembers("radius:idx:user:alice")
+	require.NoError(t, err)
+	assert.Len(t, members, 3)
+
+	// Entries older than the TTL are trimmed on the next write to the index
+	store.SetTTL(30 * time.Minute)
+	require.NoError(t, store.Store(context.Background(), &models.StartRecord{BaseAccountingRecord: models.BaseAccountingRecord{
+		Username:      "alice",
+		AcctSessionID: "a3",
+		NASIPAddress:  "192.168.1.1",
+		Timestamp:     time.Now().UTC().Format(time.RFC3339Nano),
+	}}))
+
+	members, err = mr.ZMembers("radius:idx:user:alice")
+	require.NoError(t, err)
+	assert.Len(t, members, 1)
+}
+
+func TestInMemoryStorage_Query(t *testing.T) {
+	store := newInMemoryStorage(0, 0, time.Hour)
+	defer store.Close()
+
+	testQueries(t, store)
+}
+
+func TestMultiStorage_Query(t *testing.T) {
+	memory := newInMemoryStorage(0, 0, time.Hour)
+	defer memory.Close()
+
+	ms := newMultiStorage(1, []multiBackend{
+		{name: "postgres", store: &fakeStorage{}},
+		{name: "memory", store: memory, required: true},
+	})
+	queryFixture(t, ms)
+
+	result, err := ms.Query(context.Background(), Query{AcctSessionID: "b1"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"b1:start", "b1:stop"}, sessionsOf(result.Records))
+
+	ms = newMultiStorage(1, []multiBackend{{name: "postgres", store: &fakeStorage{}}})
+	_, err = ms.Query(context.Background(), Query{})
+	assert.ErrorIs(t, err, ErrQueryNotSupported)
+}
+
+func TestKeyedRecord_JSON(t *testing.T) {
+	stop := &models.StopRecord{
+		BaseAccountingRecord: models.BaseAccountingRecord{
+			Username:      "alice",
+			AcctSessionID: "a1",
+			NASIPAddress:  "192.168.1.1",
+			ClientIP:      "192.168.1.1",
+			Timestamp:     "2024-01-15T10:00:00Z",
+		},
+		SessionTime:    180,
+		TerminateCause: "1",
+	}
+
+	data, err := json.Marshal(NewKeyedRecord(stop))
+	require.NoError(t, err)
+
+	var decoded KeyedRecord
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, stop.GenerateRedisKey(), decoded.Key)
+	assert.Equal(t, "stop", decoded.Type)
+	assert.Equal(t, stop, decoded.Record)
+
+	err = json.Unmarshal([]byte(`{"key": "radius:acct:alice:a1:x", "record": {}}`), &decoded)
+	assert.ErrorContains(t, err, "unknown record type")
+}
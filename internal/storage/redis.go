@@ -3,33 +3,42 @@ package storage
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/kal997/radius-accounting-server/internal/config"
 	"github.com/kal997/radius-accounting-server/internal/models"
+	"github.com/kal997/radius-accounting-server/internal/redisconn"
 
 	"github.com/redis/go-redis/v9"
 )
 
-// RedisStorage implements the Storage interface using Redis
+// RedisStorage implements the Storage, Querier, IPAttributor, SessionTracker
+// and ArchiveTracker interfaces using Redis
 type RedisStorage struct {
-	client *redis.Client
+	client redis.UniversalClient
 	ttl    time.Duration
+	mu     sync.RWMutex // Protects ttl, which can change on config reload
 }
 
 // NewRedisStorage creates a new Redis storage instance
-func NewRedisStorage(cfg *config.Config) (*RedisStorage, error) {
-	client := redis.NewClient(&redis.Options{
-		Addr: cfg.GetRedisAddr(),
-		DB:   0,
-	})
+func NewRedisStorage(cfg *config.ControlplaneConfig) (*RedisStorage, error) {
+	client, err := redisconn.NewClient(cfg.GetRedis())
+	if err != nil {
+		return nil, err
+	}
 
 	// Test connection
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	if err := client.Ping(ctx).Err(); err != nil {
+		_ = client.Close()
 		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
 	}
 
@@ -39,21 +48,486 @@ func NewRedisStorage(cfg *config.Config) (*RedisStorage, error) {
 	}, nil
 }
 
-// Store saves an accounting record
+// redisRecordPrefix starts the key of every accounting record
+const redisRecordPrefix = "radius:acct:"
+
+// Redis key prefixes of the secondary indexes. Each index is a sorted set of
+// record keys scored by event time in microseconds.
+const (
+	redisIndexAll      = "radius:idx:all"
+	redisIndexUser     = "radius:idx:user:"
+	redisIndexSession  = "radius:idx:session:"
+	redisIndexNAS      = "radius:idx:nas:"
+	redisIndexFramedIP = "radius:idx:framed_ip:"
+	redisIndexStation  = "radius:idx:calling_station:"
+)
+
+// Store saves an accounting record, adds it to the secondary indexes and
+// merges it into its session in the same transaction. Index entries for
+// events older than the TTL are trimmed, and each index expires with its most
+// recent record. In cluster mode the record and its indexes hash to
+// different slots, which cannot be updated in one transaction, so they are
+// written in one pipeline instead.
 func (rs *RedisStorage) Store(ctx context.Context, record models.AccountingEvent) error {
+	if record == nil {
+		return fmt.Errorf("record cannot be nil")
+	}
+
 	data, err := json.Marshal(record)
 	if err != nil {
 		return fmt.Errorf("failed to marshal record: %w", err)
 	}
 
+	now := time.Now()
 	key := record.GenerateRedisKey()
-	if err := rs.client.Set(ctx, key, data, rs.ttl).Err(); err != nil {
+	ttl := rs.TTL()
+	eventTime := RecordTime(record, now)
+	entry := redis.Z{Score: float64(eventTime.UnixMicro()), Member: key}
+
+	var assignment *IPAssignment
+	if start, ok := record.(*models.StartRecord); ok {
+		assignment, _ = newIPAssignment(start, eventTime)
+	}
+
+	_, err = rs.write(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, key, data, ttl)
+		for _, index := range redisIndexKeys(record) {
+			pipe.ZAdd(ctx, index, entry)
+			if ttl > 0 {
+				pipe.ZRemRangeByScore(ctx, index, "-inf", fmt.Sprintf("(%d", now.Add(-ttl).UnixMicro()))
+				pipe.Expire(ctx, index, ttl)
+			}
+		}
+		addSession(ctx, pipe, record, eventTime, now, ttl)
+		if assignment != nil {
+			return addIPAssignment(ctx, pipe, assignment, ttl)
+		}
+		return nil
+	})
+	if err != nil {
 		return fmt.Errorf("failed to store record in Redis: %w", err)
 	}
 
+	switch r := record.(type) {
+	case *models.InterimRecord:
+		return rs.updateIPAssignment(ctx, &r.BaseAccountingRecord, nil, ttl)
+	case *models.StopRecord:
+		return rs.updateIPAssignment(ctx, &r.BaseAccountingRecord, &eventTime, ttl)
+	}
+
 	return nil
 }
 
+// write runs fn in a MULTI transaction, or in a plain pipeline in cluster
+// mode where the keys of one write hash to different slots
+func (rs *RedisStorage) write(ctx context.Context, fn func(redis.Pipeliner) error) ([]redis.Cmder, error) {
+	if _, ok := rs.client.(*redis.ClusterClient); ok {
+		return rs.client.Pipelined(ctx, fn)
+	}
+	return rs.client.TxPipelined(ctx, fn)
+}
+
+// redisIndexKeys returns the indexes a record is added to
+func redisIndexKeys(record models.AccountingEvent) []string {
+	base := record.Base()
+
+	indexes := []string{
+		redisIndexAll,
+		redisIndexUser + base.Username,
+		redisIndexSession + base.AcctSessionID,
+		redisIndexNAS + base.NASIPAddress,
+	}
+	if base.CallingStationID != "" {
+		indexes = append(indexes, redisIndexStation+NormalizeStationID(base.CallingStationID))
+	}
+	if start, ok := record.(*models.StartRecord); ok && start.FramedIPAddress != "" {
+		indexes = append(indexes, redisIndexFramedIP+start.FramedIPAddress)
+	}
+	return indexes
+}
+
+// redisIndex returns the most selective index covering the query; records
+// read from it are still checked against every filter
+func (q *Query) redisIndex() string {
+	switch {
+	case q.AcctSessionID != "":
+		return redisIndexSession + q.AcctSessionID
+	case q.FramedIPAddress != "":
+		return redisIndexFramedIP + q.FramedIPAddress
+	case q.CallingStationID != "":
+		return redisIndexStation + NormalizeStationID(q.CallingStationID)
+	case q.Username != "":
+		return redisIndexUser + q.Username
+	case q.NASIPAddress != "":
+		return redisIndexNAS + q.NASIPAddress
+	default:
+		return redisIndexAll
+	}
+}
+
+// Query reads the records matching q from the most selective index. Index
+// entries whose record has expired are removed as they are found.
+func (rs *RedisStorage) Query(ctx context.Context, q Query) (*QueryResult, error) {
+	limit, after, err := q.prepare()
+	if err != nil {
+		return nil, err
+	}
+
+	index := q.redisIndex()
+	scoreRange := &redis.ZRangeBy{Min: "-inf", Max: "+inf", Count: int64(limit)}
+	if !q.From.IsZero() {
+		scoreRange.Min = strconv.FormatInt(q.From.UnixMicro(), 10)
+	}
+	if after != nil && (q.From.IsZero() || after.micros >= q.From.UnixMicro()) {
+		scoreRange.Min = strconv.FormatInt(after.micros, 10)
+	}
+	if !q.To.IsZero() {
+		scoreRange.Max = "(" + strconv.FormatInt(q.To.UnixMicro(), 10)
+	}
+
+	result := &QueryResult{}
+	var stale []any
+
+	for len(result.Records) < limit {
+		entries, err := rs.client.ZRangeByScoreWithScores(ctx, index, scoreRange).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read index %s: %w", index, err)
+		}
+		if len(entries) == 0 {
+			break
+		}
+		scoreRange.Offset += int64(len(entries))
+
+		records, err := rs.getRecords(ctx, entries)
+		if err != nil {
+			return nil, err
+		}
+
+		for i, entry := range entries {
+			pos := queryPosition{micros: int64(entry.Score), key: entry.Member.(string)}
+			if after != nil && !pos.after(*after) {
+				continue
+			}
+			if records[i] == nil {
+				stale = append(stale, pos.key)
+				continue
+			}
+			if !q.matches(records[i]) {
+				continue
+			}
+
+			result.Records = append(result.Records, records[i])
+			if len(result.Records) == limit {
+				result.NextCursor = pos.cursor()
+				break
+			}
+		}
+	}
+
+	if len(stale) > 0 {
+		if err := rs.client.ZRem(ctx, index, stale...).Err(); err != nil {
+			return nil, fmt.Errorf("failed to remove expired records from index %s: %w", index, err)
+		}
+	}
+
+	return result, nil
+}
+
+// Record reads one accounting record. Only record keys are accepted, so that
+// callers passing keys from untrusted input cannot read other data.
+func (rs *RedisStorage) Record(ctx context.Context, key string) (models.AccountingEvent, error) {
+	if !strings.HasPrefix(key, redisRecordPrefix) {
+		return nil, ErrNotFound
+	}
+
+	data, err := rs.client.Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read record from Redis: %w", err)
+	}
+	return DecodeRecord(key, data)
+}
+
+// getRecords reads the records of the index entries, nil for records that
+// have expired. GETs are pipelined rather than sent as one MGET so that keys
+// may live in different cluster slots.
+func (rs *RedisStorage) getRecords(ctx context.Context, entries []redis.Z) ([]models.AccountingEvent, error) {
+	cmds := make([]*redis.StringCmd, len(entries))
+	_, err := rs.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, entry := range entries {
+			cmds[i] = pipe.Get(ctx, entry.Member.(string))
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("failed to read records from Redis: %w", err)
+	}
+
+	records := make([]models.AccountingEvent, len(entries))
+	for i, cmd := range cmds {
+		data, err := cmd.Bytes()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read records from Redis: %w", err)
+		}
+		if records[i], err = DecodeRecord(entries[i].Member.(string), data); err != nil {
+			return nil, err
+		}
+	}
+	return records, nil
+}
+
+// Redis keys of the IP assignment timeline. Each session with a
+// Framed-IP-Address has its assignment stored as JSON under
+// radius:ip:session:<nas>:<session>. The assignments of each address are a
+// sorted set scored by start time, and radius:ip:addrs holds every address
+// as a hex sort key, all with score 0, for prefix scans with ZRANGEBYLEX.
+const (
+	redisIPSession = "radius:ip:session:"
+	redisIPAddr    = "radius:ip:addr:"
+	redisIPAddrs   = "radius:ip:addrs"
+
+	// Assignments kept per address; older ones are dropped on write
+	redisIPAddrHistory = 100
+
+	// Addresses of radius:ip:addrs checked per round trip by a lookup
+	redisIPAddrsBatch = 1024
+)
+
+// addIPAssignment queues the writes of a new assignment on pipe
+func addIPAssignment(ctx context.Context, pipe redis.Pipeliner, assignment *IPAssignment, ttl time.Duration) error {
+	data, err := json.Marshal(assignment)
+	if err != nil {
+		return fmt.Errorf("failed to marshal IP assignment: %w", err)
+	}
+
+	id := redisIPSession + sessionID(assignment.NASIPAddress, assignment.AcctSessionID)
+	addrKey := redisIPAddr + assignment.IP.String()
+
+	pipe.Set(ctx, id, data, ttl)
+	pipe.ZAdd(ctx, addrKey, redis.Z{Score: float64(assignment.Start.UnixMicro()), Member: id})
+	pipe.ZRemRangeByRank(ctx, addrKey, 0, -redisIPAddrHistory-1)
+	if ttl > 0 {
+		pipe.Expire(ctx, addrKey, ttl)
+	}
+	pipe.ZAdd(ctx, redisIPAddrs, redis.Z{Score: 0, Member: ipSortKey(assignment.IP)})
+	return nil
+}
+
+// updateIPAssignment keeps the assignment of an open session from expiring
+// and, when stop is set, records the end of the session
+func (rs *RedisStorage) updateIPAssignment(ctx context.Context, base *models.BaseAccountingRecord, stop *time.Time, ttl time.Duration) error {
+	id := redisIPSession + sessionID(base.NASIPAddress, base.AcctSessionID)
+
+	data, err := rs.client.Get(ctx, id).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil // The session has no Framed-IP-Address or its Start record was lost
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read IP assignment: %w", err)
+	}
+
+	var assignment IPAssignment
+	if err := json.Unmarshal(data, &assignment); err != nil {
+		return fmt.Errorf("failed to decode IP assignment %q: %w", id, err)
+	}
+	if stop != nil {
+		assignment.Stop = stop
+		if data, err = json.Marshal(assignment); err != nil {
+			return fmt.Errorf("failed to marshal IP assignment: %w", err)
+		}
+	}
+
+	_, err = rs.write(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, id, data, ttl)
+		if ttl > 0 {
+			pipe.Expire(ctx, redisIPAddr+assignment.IP.String(), ttl)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update IP assignment: %w", err)
+	}
+	return nil
+}
+
+// LookupIP scans the assigned addresses of prefix and returns the sessions
+// that held them at the given time. Addresses and timeline entries whose
+// assignment has expired are removed as they are found.
+func (rs *RedisStorage) LookupIP(ctx context.Context, prefix netip.Prefix, at time.Time) ([]IPAssignment, error) {
+	addrs, err := rs.assignedAddrs(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		result []IPAssignment
+		gone   []any
+	)
+	for _, sortKey := range addrs {
+		addr, err := parseIPSortKey(sortKey)
+		if err != nil {
+			return nil, err
+		}
+
+		candidates, exists, err := rs.ipCandidates(ctx, addr, at)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			gone = append(gone, sortKey)
+			continue
+		}
+		result = append(result, currentAssignments(candidates, at)...)
+	}
+
+	if len(gone) > 0 {
+		if err := rs.client.ZRem(ctx, redisIPAddrs, gone...).Err(); err != nil {
+			return nil, fmt.Errorf("failed to remove expired addresses from IP timeline: %w", err)
+		}
+	}
+
+	sortAssignments(result)
+	return result, nil
+}
+
+// assignedAddrs returns the sort keys of the addresses of prefix that still
+// have a timeline. The addresses whose timeline expired are removed from
+// radius:ip:addrs before the lookup limit is applied, so that they cannot
+// make every lookup of the prefix fail.
+func (rs *RedisStorage) assignedAddrs(ctx context.Context, prefix netip.Prefix) ([]string, error) {
+	first, last := prefixSortKeys(prefix)
+	from := "[" + first
+
+	var live []string
+	for {
+		page, err := rs.client.ZRangeByLex(ctx, redisIPAddrs, &redis.ZRangeBy{
+			Min:   from,
+			Max:   "[" + last,
+			Count: redisIPAddrsBatch,
+		}).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read IP timeline: %w", err)
+		}
+
+		cmds := make([]*redis.IntCmd, len(page))
+		_, err = rs.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for i, sortKey := range page {
+				addr, err := parseIPSortKey(sortKey)
+				if err != nil {
+					return err
+				}
+				cmds[i] = pipe.Exists(ctx, redisIPAddr+addr.String())
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read IP timeline: %w", err)
+		}
+
+		var gone []any
+		for i, cmd := range cmds {
+			if cmd.Val() > 0 {
+				live = append(live, page[i])
+			} else {
+				gone = append(gone, page[i])
+			}
+		}
+		if len(gone) > 0 {
+			if err := rs.client.ZRem(ctx, redisIPAddrs, gone...).Err(); err != nil {
+				return nil, fmt.Errorf("failed to remove expired addresses from IP timeline: %w", err)
+			}
+		}
+
+		if len(live) > maxIPLookupAddresses {
+			return nil, invalidQuery("prefix %s covers more than %d assigned addresses", prefix, maxIPLookupAddresses)
+		}
+		if len(page) < redisIPAddrsBatch {
+			return live, nil
+		}
+		from = "(" + page[len(page)-1]
+	}
+}
+
+// ipCandidates returns the assignments of addr that started at or before the
+// given time, newest first, and whether the address has a timeline at all
+func (rs *RedisStorage) ipCandidates(ctx context.Context, addr netip.Addr, at time.Time) ([]IPAssignment, bool, error) {
+	addrKey := redisIPAddr + addr.String()
+
+	ids, err := rs.client.ZRevRangeByScore(ctx, addrKey, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(at.UnixMicro(), 10),
+	}).Result()
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read IP timeline of %s: %w", addr, err)
+	}
+	if len(ids) == 0 {
+		exists, err := rs.client.Exists(ctx, addrKey).Result()
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to read IP timeline of %s: %w", addr, err)
+		}
+		return nil, exists > 0, nil
+	}
+
+	cmds := make([]*redis.StringCmd, len(ids))
+	_, err = rs.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, id := range ids {
+			cmds[i] = pipe.Get(ctx, id)
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, false, fmt.Errorf("failed to read IP assignments of %s: %w", addr, err)
+	}
+
+	var (
+		candidates []IPAssignment
+		expired    []any
+	)
+	for i, cmd := range cmds {
+		data, err := cmd.Bytes()
+		if errors.Is(err, redis.Nil) {
+			expired = append(expired, ids[i])
+			continue
+		}
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to read IP assignments of %s: %w", addr, err)
+		}
+
+		var assignment IPAssignment
+		if err := json.Unmarshal(data, &assignment); err != nil {
+			return nil, false, fmt.Errorf("failed to decode IP assignment %q: %w", ids[i], err)
+		}
+		candidates = append(candidates, assignment)
+	}
+
+	if len(expired) > 0 {
+		if err := rs.client.ZRem(ctx, addrKey, expired...).Err(); err != nil {
+			return nil, false, fmt.Errorf("failed to remove expired IP assignments of %s: %w", addr, err)
+		}
+	}
+
+	return candidates, true, nil
+}
+
+// TTL returns the expiry applied to newly stored records
+func (rs *RedisStorage) TTL() time.Duration {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+	return rs.ttl
+}
+
+// SetTTL changes the expiry applied to records stored from now on
+func (rs *RedisStorage) SetTTL(ttl time.Duration) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.ttl = ttl
+}
+
 // HealthCheck verifies Redis connectivity
 func (rs *RedisStorage) HealthCheck(ctx context.Context) error {
 	return rs.client.Ping(ctx).Err()
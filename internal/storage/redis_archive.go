@@ -0,0 +1,169 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/kal997/radius-accounting-server/internal/models"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisArchived is a sorted set of the archived record keys, scored by the
+// time in milliseconds after which the mark is no longer needed
+const redisArchived = "radius:archived"
+
+// redisArchiveMarkGrace keeps archive marks past the expiry of their record,
+// so that expired notifications can still be checked against them
+const redisArchiveMarkGrace = time.Hour
+
+// redisScanCount is the COUNT hint of the SCAN calls of the pre-expiry sweep
+const redisScanCount = 1000
+
+// Unarchived scans the record keys, on every primary in cluster mode, and
+// calls fn for the records expiring before deadline that are not marked
+// archived. Calls to fn are serialized.
+func (rs *RedisStorage) Unarchived(ctx context.Context, deadline time.Time, fn func(key string, record models.AccountingEvent) error) error {
+	var mu sync.Mutex
+	return rs.scanRecordKeys(ctx, func(keys []string) error {
+		keys, err := rs.expiringUnarchived(ctx, keys, deadline)
+		if err != nil || len(keys) == 0 {
+			return err
+		}
+
+		entries := make([]redis.Z, len(keys))
+		for i, key := range keys {
+			entries[i] = redis.Z{Member: key}
+		}
+		records, err := rs.getRecords(ctx, entries)
+		if err != nil {
+			return err
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		for i, record := range records {
+			if record == nil {
+				continue
+			}
+			if err := fn(keys[i], record); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// scanRecordKeys calls fn with each batch of record keys returned by SCAN
+func (rs *RedisStorage) scanRecordKeys(ctx context.Context, fn func(keys []string) error) error {
+	scan := func(ctx context.Context, client redis.UniversalClient) error {
+		var cursor uint64
+		for {
+			keys, next, err := client.Scan(ctx, cursor, redisRecordPrefix+"*", redisScanCount).Result()
+			if err != nil {
+				return fmt.Errorf("failed to scan records: %w", err)
+			}
+			if len(keys) > 0 {
+				if err := fn(keys); err != nil {
+					return err
+				}
+			}
+			if next == 0 {
+				return nil
+			}
+			cursor = next
+		}
+	}
+
+	cluster, ok := rs.client.(*redis.ClusterClient)
+	if !ok {
+		return scan(ctx, rs.client)
+	}
+	return cluster.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+		return scan(ctx, node)
+	})
+}
+
+// expiringUnarchived returns the keys that expire before deadline and are
+// not marked archived. Keys without an expiry never qualify.
+func (rs *RedisStorage) expiringUnarchived(ctx context.Context, keys []string, deadline time.Time) ([]string, error) {
+	ttls := make([]*redis.DurationCmd, len(keys))
+	marks := make([]*redis.FloatCmd, len(keys))
+	_, err := rs.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, key := range keys {
+			ttls[i] = pipe.PTTL(ctx, key)
+			marks[i] = pipe.ZScore(ctx, redisArchived, key)
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("failed to read record expiry: %w", err)
+	}
+
+	now := time.Now()
+	var expiring []string
+	for i, key := range keys {
+		ttl, err := ttls[i].Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read record expiry: %w", err)
+		}
+		// Negative TTLs mean no expiry or an already expired key
+		if ttl <= 0 || !now.Add(ttl).Before(deadline) {
+			continue
+		}
+		if err := marks[i].Err(); !errors.Is(err, redis.Nil) {
+			if err != nil {
+				return nil, fmt.Errorf("failed to read archive marks: %w", err)
+			}
+			continue
+		}
+		expiring = append(expiring, key)
+	}
+	return expiring, nil
+}
+
+// Archived reports whether key is in the archived set
+func (rs *RedisStorage) Archived(ctx context.Context, key string) (bool, error) {
+	err := rs.client.ZScore(ctx, redisArchived, key).Err()
+	if errors.Is(err, redis.Nil) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read archive marks: %w", err)
+	}
+	return true, nil
+}
+
+// MarkArchived adds keys to the archived set until an hour after the record
+// TTL, and trims the marks that are no longer needed. Without a TTL records
+// never expire and neither do their marks.
+func (rs *RedisStorage) MarkArchived(ctx context.Context, keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	score := math.Inf(1)
+	if ttl := rs.TTL(); ttl > 0 {
+		score = float64(now.Add(ttl + redisArchiveMarkGrace).UnixMilli())
+	}
+
+	members := make([]redis.Z, len(keys))
+	for i, key := range keys {
+		members[i] = redis.Z{Score: score, Member: key}
+	}
+	_, err := rs.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZAdd(ctx, redisArchived, members...)
+		pipe.ZRemRangeByScore(ctx, redisArchived, "-inf", "("+strconv.FormatInt(now.UnixMilli(), 10))
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to mark records archived: %w", err)
+	}
+	return nil
+}
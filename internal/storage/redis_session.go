@@ -0,0 +1,325 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/kal997/radius-accounting-server/internal/models"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Redis keys of the session aggregates. Each session is a hash under
+// radius:session:<nas>:<session>, merged from its records by
+// redisSessionScript. The session indexes are sorted sets of session IDs
+// scored by the event time of their latest record; the active indexes drop
+// a session when its Stop record arrives. Each NAS has a hash of counters
+// under radius:nas:<ip>, and radius:nas is the set of every NAS seen.
+const (
+	redisSession           = "radius:session:"
+	redisSessionsUser      = "radius:sessions:user:"
+	redisSessionsNAS       = "radius:sessions:nas:"
+	redisSessionsActive    = "radius:sessions:active"
+	redisSessionsActiveNAS = "radius:sessions:active:nas:"
+	redisNAS               = "radius:nas:"
+	redisNASAll            = "radius:nas"
+)
+
+// redisSessionScript merges one record into a session hash. Times are event
+// times in microseconds; counters and the last update only grow, so records
+// received out of order do not move them back.
+//
+// KEYS[1] is the session hash. ARGV holds the record type, username, NAS,
+// session ID, event time, Framed-IP-Address, session time, input and output
+// octets, terminate cause and the TTL in milliseconds.
+const redisSessionScript = `
+local key = KEYS[1]
+redis.call('HSET', key, 'username', ARGV[2], 'nas_ip_address', ARGV[3], 'acct_session_id', ARGV[4])
+
+local function raise(field, value)
+	local current = redis.call('HGET', key, field)
+	if not current or tonumber(value) > tonumber(current) then
+		redis.call('HSET', key, field, value)
+	end
+end
+
+raise('last_update', ARGV[5])
+if ARGV[1] == 'start' then
+	redis.call('HSET', key, 'start', ARGV[5], 'framed_ip_address', ARGV[6])
+else
+	raise('session_time', ARGV[7])
+	raise('input_octets', ARGV[8])
+	raise('output_octets', ARGV[9])
+	if ARGV[1] == 'stop' then
+		redis.call('HSET', key, 'stop', ARGV[5], 'terminate_cause', ARGV[10])
+	end
+end
+
+local ttl = tonumber(ARGV[11])
+if ttl > 0 then
+	redis.call('PEXPIRE', key, ttl)
+end
+return 1
+`
+
+// addSession queues the writes merging a record into its session, the
+// session indexes and the counters of its NAS on pipe
+func addSession(ctx context.Context, pipe redis.Pipeliner, record models.AccountingEvent, eventTime, now time.Time, ttl time.Duration) {
+	base := record.Base()
+
+	var (
+		kind, framedIP, terminateCause string
+		sessionTime                    int
+		inputOctets, outputOctets      uint64
+		counter                        string
+	)
+	switch r := record.(type) {
+	case *models.StartRecord:
+		kind, counter = "start", "starts"
+		framedIP = r.FramedIPAddress
+	case *models.InterimRecord:
+		kind, counter = "interim", "interim_updates"
+		sessionTime, inputOctets, outputOctets = r.SessionTime, r.InputOctets, r.OutputOctets
+	case *models.StopRecord:
+		kind, counter = "stop", "stops"
+		sessionTime, inputOctets, outputOctets = r.SessionTime, r.InputOctets, r.OutputOctets
+		terminateCause = r.TerminateCause
+	}
+
+	id := sessionID(base.NASIPAddress, base.AcctSessionID)
+	micros := eventTime.UnixMicro()
+	pipe.Eval(ctx, redisSessionScript, []string{redisSession + id},
+		kind, base.Username, base.NASIPAddress, base.AcctSessionID, micros, framedIP,
+		sessionTime, inputOctets, outputOctets, terminateCause, ttl.Milliseconds())
+
+	entry := redis.Z{Score: float64(micros), Member: id}
+	indexes := []string{redisSessionsUser + base.Username, redisSessionsNAS + base.NASIPAddress}
+	active := []string{redisSessionsActive, redisSessionsActiveNAS + base.NASIPAddress}
+	if kind == "stop" {
+		for _, index := range active {
+			pipe.ZRem(ctx, index, id)
+		}
+	} else {
+		indexes = append(indexes, active...)
+	}
+	for _, index := range indexes {
+		pipe.ZAddGT(ctx, index, entry)
+		if ttl > 0 {
+			pipe.ZRemRangeByScore(ctx, index, "-inf", fmt.Sprintf("(%d", now.Add(-ttl).UnixMicro()))
+			pipe.Expire(ctx, index, ttl)
+		}
+	}
+
+	nasKey := redisNAS + base.NASIPAddress
+	pipe.SAdd(ctx, redisNASAll, base.NASIPAddress)
+	pipe.HIncrBy(ctx, nasKey, counter, 1)
+	pipe.HSet(ctx, nasKey, "last_seen", now.UnixMicro())
+}
+
+// redisIndex returns the most selective session index covering the query;
+// sessions read from it are still checked against every filter
+func (q *SessionQuery) redisIndex() string {
+	switch {
+	case q.Username != "":
+		return redisSessionsUser + q.Username
+	case q.NASIPAddress != "" && q.ActiveOnly:
+		return redisSessionsActiveNAS + q.NASIPAddress
+	case q.NASIPAddress != "":
+		return redisSessionsNAS + q.NASIPAddress
+	default:
+		return redisSessionsActive
+	}
+}
+
+// Sessions reads the sessions matching q from the most selective index.
+// Index entries whose session has expired are removed as they are found.
+func (rs *RedisStorage) Sessions(ctx context.Context, q SessionQuery) (*SessionResult, error) {
+	limit, after, err := q.prepare()
+	if err != nil {
+		return nil, err
+	}
+
+	index := q.redisIndex()
+	scoreRange := &redis.ZRangeBy{Min: "-inf", Max: "+inf", Count: int64(limit)}
+	if after != nil {
+		scoreRange.Min = strconv.FormatInt(after.micros, 10)
+	}
+
+	result := &SessionResult{}
+	var stale []any
+
+	for len(result.Sessions) < limit {
+		entries, err := rs.client.ZRangeByScoreWithScores(ctx, index, scoreRange).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read index %s: %w", index, err)
+		}
+		if len(entries) == 0 {
+			break
+		}
+		scoreRange.Offset += int64(len(entries))
+
+		ids := make([]string, len(entries))
+		for i, entry := range entries {
+			ids[i] = entry.Member.(string)
+		}
+		sessions, err := rs.getSessions(ctx, ids)
+		if err != nil {
+			return nil, err
+		}
+
+		for i, entry := range entries {
+			pos := queryPosition{micros: int64(entry.Score), key: ids[i]}
+			if after != nil && !pos.after(*after) {
+				continue
+			}
+			if sessions[i] == nil {
+				stale = append(stale, pos.key)
+				continue
+			}
+			if !q.matches(sessions[i]) {
+				continue
+			}
+
+			result.Sessions = append(result.Sessions, *sessions[i])
+			if len(result.Sessions) == limit {
+				result.NextCursor = pos.cursor()
+				break
+			}
+		}
+	}
+
+	if len(stale) > 0 {
+		if err := rs.client.ZRem(ctx, index, stale...).Err(); err != nil {
+			return nil, fmt.Errorf("failed to remove expired sessions from index %s: %w", index, err)
+		}
+	}
+
+	return result, nil
+}
+
+// Session reads one session
+func (rs *RedisStorage) Session(ctx context.Context, nasIPAddress, acctSessionID string) (*Session, error) {
+	sessions, err := rs.getSessions(ctx, []string{sessionID(nasIPAddress, acctSessionID)})
+	if err != nil {
+		return nil, err
+	}
+	if sessions[0] == nil {
+		return nil, ErrNotFound
+	}
+	return sessions[0], nil
+}
+
+// getSessions reads sessions by ID, nil for sessions that have expired
+func (rs *RedisStorage) getSessions(ctx context.Context, ids []string) ([]*Session, error) {
+	cmds := make([]*redis.MapStringStringCmd, len(ids))
+	_, err := rs.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, id := range ids {
+			cmds[i] = pipe.HGetAll(ctx, redisSession+id)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sessions from Redis: %w", err)
+	}
+
+	sessions := make([]*Session, len(ids))
+	for i, cmd := range cmds {
+		fields := cmd.Val()
+		if len(fields) == 0 {
+			continue
+		}
+		if sessions[i], err = decodeSession(fields); err != nil {
+			return nil, fmt.Errorf("failed to decode session %q: %w", ids[i], err)
+		}
+	}
+	return sessions, nil
+}
+
+// decodeSession converts a session hash written by redisSessionScript
+func decodeSession(fields map[string]string) (*Session, error) {
+	session := &Session{
+		AcctSessionID:   fields["acct_session_id"],
+		NASIPAddress:    fields["nas_ip_address"],
+		Username:        fields["username"],
+		FramedIPAddress: fields["framed_ip_address"],
+		TerminateCause:  fields["terminate_cause"],
+	}
+
+	var err error
+	parseTime := func(field string) *time.Time {
+		value, ok := fields[field]
+		if !ok || err != nil {
+			return nil
+		}
+		var micros int64
+		if micros, err = strconv.ParseInt(value, 10, 64); err != nil {
+			return nil
+		}
+		t := time.UnixMicro(micros).UTC()
+		return &t
+	}
+	parseUint := func(field string) uint64 {
+		value, ok := fields[field]
+		if !ok || err != nil {
+			return 0
+		}
+		var n uint64
+		n, err = strconv.ParseUint(value, 10, 64)
+		return n
+	}
+
+	session.Start = parseTime("start")
+	session.Stop = parseTime("stop")
+	if lastUpdate := parseTime("last_update"); lastUpdate != nil {
+		session.LastUpdate = *lastUpdate
+	}
+	session.SessionTime = int(parseUint("session_time"))
+	session.InputOctets = parseUint("input_octets")
+	session.OutputOctets = parseUint("output_octets")
+	return session, err
+}
+
+// NASSummaries reads the counters of every NAS seen. Active sessions are
+// counted from the active index, ignoring entries older than the TTL.
+func (rs *RedisStorage) NASSummaries(ctx context.Context) ([]NASSummary, error) {
+	addrs, err := rs.client.SMembers(ctx, redisNASAll).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read NAS list: %w", err)
+	}
+	sort.Strings(addrs)
+
+	minScore := "-inf"
+	if ttl := rs.TTL(); ttl > 0 {
+		minScore = strconv.FormatInt(time.Now().Add(-ttl).UnixMicro(), 10)
+	}
+
+	counters := make([]*redis.MapStringStringCmd, len(addrs))
+	active := make([]*redis.IntCmd, len(addrs))
+	_, err = rs.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, addr := range addrs {
+			counters[i] = pipe.HGetAll(ctx, redisNAS+addr)
+			active[i] = pipe.ZCount(ctx, redisSessionsActiveNAS+addr, minScore, "+inf")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read NAS summaries: %w", err)
+	}
+
+	summaries := make([]NASSummary, len(addrs))
+	for i, addr := range addrs {
+		fields := counters[i].Val()
+		summary := NASSummary{NASIPAddress: addr, ActiveSessions: int(active[i].Val())}
+		summary.Starts, _ = strconv.ParseUint(fields["starts"], 10, 64)
+		summary.InterimUpdates, _ = strconv.ParseUint(fields["interim_updates"], 10, 64)
+		summary.Stops, _ = strconv.ParseUint(fields["stops"], 10, 64)
+		if micros, err := strconv.ParseInt(fields["last_seen"], 10, 64); err == nil {
+			summary.LastSeen = time.UnixMicro(micros).UTC()
+		}
+		summaries[i] = summary
+	}
+	return summaries, nil
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"net"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -31,16 +32,12 @@ func TestNewRedisStorage_Success(t *testing.T) {
 	_ = os.Setenv("REDIS_HOST", host)
 	_ = os.Setenv("REDIS_PORT", port)
 	_ = os.Setenv("RECORD_TTL_HOURS", "24")
-	_ = os.Setenv("LOG_LEVEL", "info")
-	_ = os.Setenv("LOG_FILE", "/tmp/test.log")
 	defer func() {
 		_ = os.Unsetenv("RADIUS_SHARED_SECRET")
 		_ = os.Unsetenv("REDIS_HOST")
 		_ = os.Unsetenv("RECORD_TTL_HOURS")
-		_ = os.Unsetenv("LOG_LEVEL")
-		_ = os.Unsetenv("LOG_FILE")
 	}()
-	cfg, err := config.LoadFromEnv()
+	cfg, err := config.LoadControlplane("", nil)
 	require.NoError(t, err)
 
 	storage, err := NewRedisStorage(cfg)
@@ -57,23 +54,55 @@ func TestNewRedisStorage_Success(t *testing.T) {
 	assert.Equal(t, 24*time.Hour, storage.ttl)
 }
 
+// Test NewRedisStorage in cluster mode against a single-node miniredis cluster
+func TestNewRedisStorage_Cluster(t *testing.T) {
+	mr, err := miniredis.Run()
+	require.NoError(t, err)
+	defer mr.Close()
+
+	_ = os.Setenv("RADIUS_SHARED_SECRET", "testsecret123")
+	_ = os.Setenv("REDIS_MODE", "cluster")
+	_ = os.Setenv("REDIS_CLUSTER_ADDRESSES", mr.Addr())
+	defer func() {
+		_ = os.Unsetenv("RADIUS_SHARED_SECRET")
+		_ = os.Unsetenv("REDIS_MODE")
+		_ = os.Unsetenv("REDIS_CLUSTER_ADDRESSES")
+	}()
+
+	cfg, err := config.LoadControlplane("", nil)
+	require.NoError(t, err)
+
+	storage, err := NewRedisStorage(cfg)
+	require.NoError(t, err)
+	defer func() {
+		_ = storage.Close()
+	}()
+
+	record := &models.StartRecord{
+		BaseAccountingRecord: models.BaseAccountingRecord{
+			Username:      "testuser",
+			AcctSessionID: "session123",
+			NASIPAddress:  "127.0.0.1",
+			Timestamp:     time.Now().Format(time.RFC3339Nano),
+		},
+	}
+	require.NoError(t, storage.Store(context.Background(), record))
+	assert.True(t, mr.Exists(record.GenerateRedisKey()))
+}
+
 // Test NewRedisStorage with connection failure
 func TestNewRedisStorage_ConnectionFailure(t *testing.T) {
 	// Set environment variables with invalid Redis host
 	_ = os.Setenv("RADIUS_SHARED_SECRET", "testsecret123")
 	_ = os.Setenv("REDIS_HOST", "invalid-host-that-does-not-exist")
 	_ = os.Setenv("RECORD_TTL_HOURS", "24")
-	_ = os.Setenv("LOG_LEVEL", "info")
-	_ = os.Setenv("LOG_FILE", "/tmp/test.log")
 	defer func() {
 		_ = os.Unsetenv("RADIUS_SHARED_SECRET")
 		_ = os.Unsetenv("REDIS_HOST")
 		_ = os.Unsetenv("RECORD_TTL_HOURS")
-		_ = os.Unsetenv("LOG_LEVEL")
-		_ = os.Unsetenv("LOG_FILE")
 	}()
 
-	cfg, err := config.LoadFromEnv()
+	cfg, err := config.LoadControlplane("", nil)
 	require.NoError(t, err)
 
 	storage, err := NewRedisStorage(cfg)
@@ -187,6 +216,32 @@ func TestRedisStorage_Close(t *testing.T) {
 	assert.Error(t, storage.Close())
 }
 
+// Test SetTTL applies to records stored afterwards
+func TestRedisStorage_SetTTL(t *testing.T) {
+	storage, mr, cleanup := newTestStorage(t, 5*time.Minute)
+	defer cleanup()
+
+	assert.Equal(t, 5*time.Minute, storage.TTL())
+	storage.SetTTL(2 * time.Hour)
+	assert.Equal(t, 2*time.Hour, storage.TTL())
+
+	record := &models.StartRecord{
+		BaseAccountingRecord: models.BaseAccountingRecord{
+			Username:      "testuser",
+			AcctSessionID: "session123",
+			NASIPAddress:  "127.0.0.1",
+			ClientIP:      "192.168.1.10",
+			Timestamp:     time.Now().Format(time.RFC3339Nano),
+		},
+		FramedIPAddress: "10.0.0.5",
+	}
+	require.NoError(t, storage.Store(context.Background(), record))
+
+	ttl := mr.TTL(record.GenerateRedisKey())
+	assert.Greater(t, ttl, 5*time.Minute)
+	assert.LessOrEqual(t, ttl, 2*time.Hour)
+}
+
 // Test with context cancellation
 func TestRedisStorage_Store_ContextCancelled(t *testing.T) {
 	storage, _, cleanup := newTestStorage(t, 5*time.Minute)
@@ -245,18 +300,14 @@ func TestRedisStorage_FullIntegration(t *testing.T) {
 	_ = os.Setenv("REDIS_PORT", port)
 
 	_ = os.Setenv("RECORD_TTL_HOURS", "1")
-	_ = os.Setenv("LOG_LEVEL", "debug")
-	_ = os.Setenv("LOG_FILE", "/tmp/integration.log")
 	defer func() {
 		_ = os.Unsetenv("RADIUS_SHARED_SECRET")
 		_ = os.Unsetenv("REDIS_HOST")
 		_ = os.Unsetenv("RECORD_TTL_HOURS")
-		_ = os.Unsetenv("LOG_LEVEL")
-		_ = os.Unsetenv("LOG_FILE")
 	}()
 
 	// Create config and storage using actual constructor
-	cfg, err := config.LoadFromEnv()
+	cfg, err := config.LoadControlplane("", nil)
 	require.NoError(t, err)
 
 	storage, err := NewRedisStorage(cfg)
@@ -287,9 +338,18 @@ func TestRedisStorage_FullIntegration(t *testing.T) {
 		assert.NoError(t, storage.Store(ctx, record))
 	}
 
-	// Verify all records are stored
-	keys := mr.Keys()
-	assert.Len(t, keys, 3)
+	// Verify all records are stored and indexed
+	var records []string
+	for _, key := range mr.Keys() {
+		if strings.HasPrefix(key, "radius:acct:") {
+			records = append(records, key)
+		}
+	}
+	assert.Len(t, records, 3)
+
+	members, err := mr.ZMembers("radius:idx:all")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, records, members)
 }
 
 // Benchmark for Store operation
@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/kal997/radius-accounting-server/internal/models"
+)
+
+// recordRow holds the column values of a record, shared by the SQL backends
+type recordRow struct {
+	base            *models.BaseAccountingRecord
+	key             string
+	recordType      string
+	eventTime       time.Time
+	data            []byte // Record as stored in Redis
+	framedIPAddress sql.NullString
+	sessionTime     sql.NullInt64
+	inputOctets     sql.NullInt64
+	outputOctets    sql.NullInt64
+	terminateCause  sql.NullString
+}
+
+// newRecordRow extracts the columns of a record from its concrete type
+func newRecordRow(record models.AccountingEvent) (*recordRow, error) {
+	var row *recordRow
+
+	switch r := record.(type) {
+	case *models.StartRecord:
+		row = &recordRow{
+			base:            &r.BaseAccountingRecord,
+			recordType:      "start",
+			framedIPAddress: sql.NullString{String: r.FramedIPAddress, Valid: true},
+		}
+
+	case *models.InterimRecord:
+		row = &recordRow{
+			base:         &r.BaseAccountingRecord,
+			recordType:   "interim",
+			sessionTime:  sql.NullInt64{Int64: int64(r.SessionTime), Valid: true},
+			inputOctets:  sql.NullInt64{Int64: int64(r.InputOctets), Valid: true},
+			outputOctets: sql.NullInt64{Int64: int64(r.OutputOctets), Valid: true},
+		}
+
+	case *models.StopRecord:
+		row = &recordRow{
+			base:           &r.BaseAccountingRecord,
+			recordType:     "stop",
+			sessionTime:    sql.NullInt64{Int64: int64(r.SessionTime), Valid: true},
+			inputOctets:    sql.NullInt64{Int64: int64(r.InputOctets), Valid: true},
+			outputOctets:   sql.NullInt64{Int64: int64(r.OutputOctets), Valid: true},
+			terminateCause: sql.NullString{String: r.TerminateCause, Valid: true},
+		}
+
+	default:
+		return nil, fmt.Errorf("unsupported record type %T", record)
+	}
+
+	eventTime, err := time.Parse(time.RFC3339Nano, row.base.Timestamp)
+	if err != nil {
+		return nil, fmt.Errorf("invalid record timestamp %q: %w", row.base.Timestamp, err)
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal record: %w", err)
+	}
+
+	row.key = record.GenerateRedisKey()
+	row.eventTime = eventTime
+	row.data = data
+	return row, nil
+}
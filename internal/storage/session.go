@@ -0,0 +1,139 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/kal997/radius-accounting-server/internal/models"
+)
+
+// ErrNotFound is returned when a record or session does not exist or has
+// expired
+var ErrNotFound = errors.New("not found")
+
+// ErrSessionsNotSupported is returned by MultiStorage when none of its
+// backends tracks sessions
+var ErrSessionsNotSupported = errors.New("no storage backend tracks sessions")
+
+// Session is the state of an accounting session, aggregated from its records
+type Session struct {
+	AcctSessionID   string     `json:"acct_session_id"`
+	NASIPAddress    string     `json:"nas_ip_address"`
+	Username        string     `json:"username"`
+	FramedIPAddress string     `json:"framed_ip_address,omitempty"`
+	Start           *time.Time `json:"start,omitempty"` // Nil when the Start record was not received
+	Stop            *time.Time `json:"stop,omitempty"`  // Nil while the session is active
+	LastUpdate      time.Time  `json:"last_update"`     // Event time of the latest record
+	SessionTime     int        `json:"session_time"`
+	InputOctets     uint64     `json:"input_octets"`
+	OutputOctets    uint64     `json:"output_octets"`
+	TerminateCause  string     `json:"terminate_cause,omitempty"`
+}
+
+// Active reports whether the session has not stopped
+func (s *Session) Active() bool {
+	return s.Stop == nil
+}
+
+// apply merges a record into the session. Counters only grow, so Interim
+// records received out of order do not move them back.
+func (s *Session) apply(record models.AccountingEvent, eventTime time.Time) {
+	base := record.Base()
+	s.AcctSessionID = base.AcctSessionID
+	s.NASIPAddress = base.NASIPAddress
+	s.Username = base.Username
+	if eventTime.After(s.LastUpdate) {
+		s.LastUpdate = eventTime
+	}
+
+	switch r := record.(type) {
+	case *models.StartRecord:
+		s.Start = &eventTime
+		s.FramedIPAddress = r.FramedIPAddress
+
+	case *models.InterimRecord:
+		s.updateCounters(r.SessionTime, r.InputOctets, r.OutputOctets)
+
+	case *models.StopRecord:
+		s.updateCounters(r.SessionTime, r.InputOctets, r.OutputOctets)
+		s.Stop = &eventTime
+		s.TerminateCause = r.TerminateCause
+	}
+}
+
+func (s *Session) updateCounters(sessionTime int, inputOctets, outputOctets uint64) {
+	s.SessionTime = max(s.SessionTime, sessionTime)
+	s.InputOctets = max(s.InputOctets, inputOctets)
+	s.OutputOctets = max(s.OutputOctets, outputOctets)
+}
+
+// SessionQuery selects sessions. At least one of Username, NASIPAddress or
+// ActiveOnly must be set.
+type SessionQuery struct {
+	Username     string
+	NASIPAddress string
+	ActiveOnly   bool // Only sessions without a Stop record
+
+	Limit  int    // Page size, DefaultQueryLimit when zero
+	Cursor string // NextCursor of the previous page, empty for the first
+}
+
+// SessionResult is one page of sessions
+type SessionResult struct {
+	Sessions []Session
+
+	// NextCursor continues the query after this page. It is empty on the
+	// last page; a full page may be followed by an empty one.
+	NextCursor string
+}
+
+// NASSummary describes the traffic received from one NAS
+type NASSummary struct {
+	NASIPAddress   string    `json:"nas_ip_address"`
+	ActiveSessions int       `json:"active_sessions"`
+	Starts         uint64    `json:"starts"`
+	InterimUpdates uint64    `json:"interim_updates"`
+	Stops          uint64    `json:"stops"`
+	LastSeen       time.Time `json:"last_seen"` // When its latest record was stored
+}
+
+// SessionTracker is implemented by storage backends that aggregate records
+// into sessions
+type SessionTracker interface {
+	// Sessions returns one page of the sessions matching q, least recently
+	// updated first. A session updated while paging moves to a later page
+	// and may be returned twice.
+	Sessions(ctx context.Context, q SessionQuery) (*SessionResult, error)
+
+	// Session returns one session, or ErrNotFound
+	Session(ctx context.Context, nasIPAddress, acctSessionID string) (*Session, error)
+
+	// NASSummaries returns a summary of every NAS seen, ordered by address
+	NASSummaries(ctx context.Context) ([]NASSummary, error)
+}
+
+// sessionID identifies a session; Acct-Session-Id is only unique per NAS
+func sessionID(nasIPAddress, acctSessionID string) string {
+	return nasIPAddress + ":" + acctSessionID
+}
+
+// prepare validates the query and returns its page size and the position of
+// the last session of the previous page, nil for the first page
+func (q *SessionQuery) prepare() (int, *queryPosition, error) {
+	if q.Username == "" && q.NASIPAddress == "" && !q.ActiveOnly {
+		return 0, nil, invalidQuery("a username, NAS or active filter is required")
+	}
+	return (&Query{Limit: q.Limit, Cursor: q.Cursor}).prepare()
+}
+
+// matches reports whether session satisfies every filter of the query
+func (q *SessionQuery) matches(session *Session) bool {
+	if q.Username != "" && session.Username != q.Username {
+		return false
+	}
+	if q.NASIPAddress != "" && session.NASIPAddress != q.NASIPAddress {
+		return false
+	}
+	return !q.ActiveOnly || session.Active()
+}
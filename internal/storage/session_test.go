@@ -0,0 +1,156 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sessionIDsOf returns the Acct-Session-Id of each session
+func sessionIDsOf(sessions []Session) []string {
+	var got []string
+	for _, session := range sessions {
+		got = append(got, session.AcctSessionID)
+	}
+	return got
+}
+
+// testSessions runs the same session queries against any backend, using the
+// records of queryFixture
+func testSessions(t *testing.T, store interface {
+	Storage
+	SessionTracker
+}) {
+	start := queryFixture(t, store)
+	ctx := context.Background()
+
+	t.Run("session", func(t *testing.T) {
+		session, err := store.Session(ctx, "192.168.1.1", "a1")
+		require.NoError(t, err)
+
+		assert.Equal(t, "alice", session.Username)
+		assert.Equal(t, "10.0.0.1", session.FramedIPAddress)
+		require.NotNil(t, session.Start)
+		assert.True(t, start.Equal(*session.Start))
+		require.NotNil(t, session.Stop)
+		assert.True(t, start.Add(3*time.Minute).Equal(*session.Stop))
+		assert.True(t, start.Add(3*time.Minute).Equal(session.LastUpdate))
+		assert.Equal(t, 180, session.SessionTime)
+		assert.Equal(t, "1", session.TerminateCause)
+		assert.False(t, session.Active())
+
+		session, err = store.Session(ctx, "192.168.1.1", "a2")
+		require.NoError(t, err)
+		assert.True(t, session.Active())
+
+		_, err = store.Session(ctx, "192.168.1.2", "a1")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	tests := []struct {
+		name  string
+		query SessionQuery
+		want  []string
+	}{
+		{name: "by username", query: SessionQuery{Username: "alice"}, want: []string{"a1", "a2"}},
+		{name: "by NAS", query: SessionQuery{NASIPAddress: "192.168.1.2"}, want: []string{"b1"}},
+		{name: "active", query: SessionQuery{ActiveOnly: true}, want: []string{"a2"}},
+		{name: "active by NAS", query: SessionQuery{NASIPAddress: "192.168.1.2", ActiveOnly: true}},
+		{name: "active by username", query: SessionQuery{Username: "alice", ActiveOnly: true}, want: []string{"a2"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := store.Sessions(ctx, tt.query)
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, sessionIDsOf(result.Sessions))
+			assert.Empty(t, result.NextCursor)
+		})
+	}
+
+	t.Run("pagination", func(t *testing.T) {
+		result, err := store.Sessions(ctx, SessionQuery{Username: "alice", Limit: 1})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"a1"}, sessionIDsOf(result.Sessions))
+		require.NotEmpty(t, result.NextCursor)
+
+		result, err = store.Sessions(ctx, SessionQuery{Username: "alice", Limit: 1, Cursor: result.NextCursor})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"a2"}, sessionIDsOf(result.Sessions))
+	})
+
+	t.Run("invalid queries", func(t *testing.T) {
+		_, err := store.Sessions(ctx, SessionQuery{})
+		assert.ErrorIs(t, err, ErrInvalidQuery)
+
+		_, err = store.Sessions(ctx, SessionQuery{ActiveOnly: true, Cursor: "not a cursor"})
+		assert.ErrorIs(t, err, ErrInvalidCursor)
+	})
+
+	t.Run("NAS summaries", func(t *testing.T) {
+		summaries, err := store.NASSummaries(ctx)
+		require.NoError(t, err)
+		require.Len(t, summaries, 2)
+
+		assert.Equal(t, "192.168.1.1", summaries[0].NASIPAddress)
+		assert.Equal(t, 1, summaries[0].ActiveSessions)
+		assert.Equal(t, uint64(2), summaries[0].Starts)
+		assert.Equal(t, uint64(1), summaries[0].InterimUpdates)
+		assert.Equal(t, uint64(1), summaries[0].Stops)
+		assert.WithinDuration(t, time.Now(), summaries[0].LastSeen, time.Minute)
+
+		assert.Equal(t, "192.168.1.2", summaries[1].NASIPAddress)
+		assert.Equal(t, 0, summaries[1].ActiveSessions)
+		assert.Equal(t, uint64(1), summaries[1].Stops)
+	})
+}
+
+func TestRedisStorage_Sessions(t *testing.T) {
+	store, mr, cleanup := newTestStorage(t, 2*time.Hour)
+	defer cleanup()
+
+	testSessions(t, store)
+
+	assert.Greater(t, mr.TTL("radius:session:192.168.1.1:a1"), time.Hour)
+	assert.True(t, mr.Exists("radius:sessions:active"))
+
+	// Index entries of expired sessions are skipped and removed
+	mr.Del("radius:session:192.168.1.1:a1")
+	result, err := store.Sessions(context.Background(), SessionQuery{Username: "alice"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a2"}, sessionIDsOf(result.Sessions))
+
+	members, err := mr.ZMembers("radius:sessions:user:alice")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"192.168.1.1:a2"}, members)
+}
+
+func TestInMemoryStorage_Sessions(t *testing.T) {
+	store := newInMemoryStorage(0, 0, time.Hour)
+	defer store.Close()
+
+	testSessions(t, store)
+}
+
+func TestMultiStorage_Sessions(t *testing.T) {
+	memory := newInMemoryStorage(0, 0, time.Hour)
+	defer memory.Close()
+
+	ms := newMultiStorage(1, []multiBackend{
+		{name: "postgres", store: &fakeStorage{}},
+		{name: "memory", store: memory, required: true},
+	})
+	queryFixture(t, ms)
+
+	session, err := ms.Session(context.Background(), "192.168.1.2", "b1")
+	require.NoError(t, err)
+	assert.Equal(t, "bob", session.Username)
+
+	ms = newMultiStorage(1, []multiBackend{{name: "postgres", store: &fakeStorage{}}})
+	_, err = ms.NASSummaries(context.Background())
+	assert.ErrorIs(t, err, ErrSessionsNotSupported)
+}
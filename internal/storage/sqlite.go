@@ -0,0 +1,339 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/kal997/radius-accounting-server/internal/config"
+	"github.com/kal997/radius-accounting-server/internal/models"
+
+	_ "github.com/mattn/go-sqlite3" // Registers the "sqlite3" database/sql driver
+)
+
+// sqliteMigrations are applied in order; the index of the last applied
+// migration plus one is kept in PRAGMA user_version. Never edit a migration
+// that has been released, append a new one instead.
+var sqliteMigrations = []string{
+	// 1: accounting records and per-session state
+	`CREATE TABLE records (
+		id                 INTEGER PRIMARY KEY AUTOINCREMENT,
+		record_key         TEXT    NOT NULL UNIQUE,
+		record_type        TEXT    NOT NULL,
+		username           TEXT    NOT NULL,
+		acct_session_id    TEXT    NOT NULL,
+		nas_ip_address     TEXT    NOT NULL,
+		nas_port           INTEGER NOT NULL,
+		calling_station_id TEXT    NOT NULL,
+		called_station_id  TEXT    NOT NULL,
+		client_ip          TEXT    NOT NULL,
+		framed_ip_address  TEXT,
+		session_time       INTEGER,
+		input_octets       INTEGER,
+		output_octets      INTEGER,
+		terminate_cause    TEXT,
+		timestamp          TEXT    NOT NULL,
+		event_time         INTEGER NOT NULL, -- Unix nanoseconds, for range queries
+		data               TEXT    NOT NULL  -- Record as stored in Redis
+	);
+	CREATE INDEX idx_records_username ON records (username, event_time);
+	CREATE INDEX idx_records_session ON records (acct_session_id, event_time);
+	CREATE INDEX idx_records_nas ON records (nas_ip_address, event_time);
+	CREATE INDEX idx_records_event_time ON records (event_time);
+
+	CREATE TABLE sessions (
+		acct_session_id    TEXT    NOT NULL,
+		nas_ip_address     TEXT    NOT NULL,
+		username           TEXT    NOT NULL,
+		nas_port           INTEGER NOT NULL,
+		calling_station_id TEXT    NOT NULL,
+		called_station_id  TEXT    NOT NULL,
+		framed_ip_address  TEXT,
+		session_time       INTEGER NOT NULL DEFAULT 0,
+		input_octets       INTEGER NOT NULL DEFAULT 0,
+		output_octets      INTEGER NOT NULL DEFAULT 0,
+		terminate_cause    TEXT,
+		started_at         INTEGER,
+		updated_at         INTEGER NOT NULL,
+		stopped_at         INTEGER,
+		PRIMARY KEY (acct_session_id, nas_ip_address)
+	);
+	CREATE INDEX idx_sessions_username ON sessions (username, updated_at);
+	CREATE INDEX idx_sessions_nas ON sessions (nas_ip_address, updated_at);
+	CREATE INDEX idx_sessions_updated_at ON sessions (updated_at);`,
+}
+
+// SQLiteStorage implements the Storage interface using an embedded SQLite
+// database. Unlike Redis, records are kept until the retention expires.
+type SQLiteStorage struct {
+	db *sql.DB
+
+	mu        sync.RWMutex // Protects retention, which can change on config reload
+	retention time.Duration
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewSQLiteStorage opens (or creates) the SQLite database, applies pending
+// migrations and starts pruning records older than the configured retention
+func NewSQLiteStorage(cfg *config.ControlplaneConfig) (*SQLiteStorage, error) {
+	sqliteCfg := cfg.GetStorage().GetSQLite()
+
+	db, err := openSQLite(sqliteCfg.GetPath())
+	if err != nil {
+		return nil, err
+	}
+
+	ss := &SQLiteStorage{
+		db:        db,
+		retention: sqliteCfg.GetRetention(),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+
+	go ss.pruneLoop(sqliteCfg.GetPruneInterval())
+
+	return ss, nil
+}
+
+// openSQLite opens the database in WAL mode and brings its schema up to date
+func openSQLite(path string) (*sql.DB, error) {
+	dsn := fmt.Sprintf("file:%s?_journal_mode=WAL&_synchronous=NORMAL&_busy_timeout=5000", path)
+
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open SQLite database: %w", err)
+	}
+
+	// SQLite allows a single writer; serialising writes in the pool avoids
+	// SQLITE_BUSY errors between our own connections
+	db.SetMaxOpenConns(1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := migrateSQLite(ctx, db); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// migrateSQLite applies every migration newer than the database's user_version
+func migrateSQLite(ctx context.Context, db *sql.DB) error {
+	var version int
+	if err := db.QueryRowContext(ctx, "PRAGMA user_version").Scan(&version); err != nil {
+		return fmt.Errorf("failed to read SQLite schema version: %w", err)
+	}
+
+	if version > len(sqliteMigrations) {
+		return fmt.Errorf("SQLite schema version %d is newer than supported version %d", version, len(sqliteMigrations))
+	}
+
+	for i := version; i < len(sqliteMigrations); i++ {
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("failed to begin SQLite migration %d: %w", i+1, err)
+		}
+
+		if _, err := tx.ExecContext(ctx, sqliteMigrations[i]); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("failed to apply SQLite migration %d: %w", i+1, err)
+		}
+
+		// PRAGMA does not accept bound parameters
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("PRAGMA user_version = %d", i+1)); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("failed to record SQLite migration %d: %w", i+1, err)
+		}
+
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit SQLite migration %d: %w", i+1, err)
+		}
+	}
+
+	return nil
+}
+
+// Store saves an accounting record and updates the state of its session.
+// Storing the same record twice is a no-op.
+func (ss *SQLiteStorage) Store(ctx context.Context, record models.AccountingEvent) error {
+	row, err := newRecordRow(record)
+	if err != nil {
+		return err
+	}
+	eventTime := row.eventTime.UnixNano()
+
+	tx, err := ss.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to store record in SQLite: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	result, err := tx.ExecContext(ctx, `
+		INSERT OR IGNORE INTO records (
+			record_key, record_type, username, acct_session_id, nas_ip_address, nas_port,
+			calling_station_id, called_station_id, client_ip, framed_ip_address,
+			session_time, input_octets, output_octets, terminate_cause,
+			timestamp, event_time, data
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		row.key, row.recordType, row.base.Username, row.base.AcctSessionID,
+		row.base.NASIPAddress, row.base.NASPort, row.base.CallingStationID, row.base.CalledStationID,
+		row.base.ClientIP, row.framedIPAddress, row.sessionTime, row.inputOctets, row.outputOctets,
+		row.terminateCause, row.base.Timestamp, eventTime, string(row.data),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to store record in SQLite: %w", err)
+	}
+
+	// A duplicate must not move the session state backwards
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to store record in SQLite: %w", err)
+	}
+	if inserted == 0 {
+		return nil
+	}
+
+	if err := upsertSession(ctx, tx, row, eventTime); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to store record in SQLite: %w", err)
+	}
+
+	return nil
+}
+
+// upsertSession merges a record into the session it belongs to. Counters
+// only ever grow so out-of-order interim updates are harmless.
+func upsertSession(ctx context.Context, tx *sql.Tx, row *recordRow, eventTime int64) error {
+	var startedAt, stoppedAt sql.NullInt64
+	switch row.recordType {
+	case "start":
+		startedAt = sql.NullInt64{Int64: eventTime, Valid: true}
+	case "stop":
+		stoppedAt = sql.NullInt64{Int64: eventTime, Valid: true}
+	}
+
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO sessions (
+			acct_session_id, nas_ip_address, username, nas_port, calling_station_id, called_station_id,
+			framed_ip_address, session_time, input_octets, output_octets, terminate_cause,
+			started_at, updated_at, stopped_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, COALESCE(?, 0), COALESCE(?, 0), COALESCE(?, 0), ?, ?, ?, ?)
+		ON CONFLICT (acct_session_id, nas_ip_address) DO UPDATE SET
+			framed_ip_address = COALESCE(excluded.framed_ip_address, framed_ip_address),
+			session_time      = MAX(session_time, excluded.session_time),
+			input_octets      = MAX(input_octets, excluded.input_octets),
+			output_octets     = MAX(output_octets, excluded.output_octets),
+			terminate_cause   = COALESCE(excluded.terminate_cause, terminate_cause),
+			started_at        = COALESCE(excluded.started_at, started_at),
+			updated_at        = MAX(updated_at, excluded.updated_at),
+			stopped_at        = COALESCE(excluded.stopped_at, stopped_at)`,
+		row.base.AcctSessionID, row.base.NASIPAddress, row.base.Username, row.base.NASPort,
+		row.base.CallingStationID, row.base.CalledStationID, row.framedIPAddress,
+		row.sessionTime, row.inputOctets, row.outputOctets, row.terminateCause,
+		startedAt, eventTime, stoppedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update session in SQLite: %w", err)
+	}
+	return nil
+}
+
+// Retention returns how long records are kept, zero when they are kept forever
+func (ss *SQLiteStorage) Retention() time.Duration {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+	return ss.retention
+}
+
+// SetRetention changes how long records are kept from the next prune on
+func (ss *SQLiteStorage) SetRetention(retention time.Duration) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	ss.retention = retention
+}
+
+// Prune deletes records, and sessions without activity, older than the
+// retention. It returns the number of deleted records.
+func (ss *SQLiteStorage) Prune(ctx context.Context) (int64, error) {
+	retention := ss.Retention()
+	if retention <= 0 {
+		return 0, nil
+	}
+	cutoff := time.Now().Add(-retention).UnixNano()
+
+	tx, err := ss.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune SQLite records: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	result, err := tx.ExecContext(ctx, "DELETE FROM records WHERE event_time < ?", cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune SQLite records: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM sessions WHERE updated_at < ?", cutoff); err != nil {
+		return 0, fmt.Errorf("failed to prune SQLite sessions: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to prune SQLite records: %w", err)
+	}
+
+	return result.RowsAffected()
+}
+
+// pruneLoop runs Prune every interval until Close is called
+func (ss *SQLiteStorage) pruneLoop(interval time.Duration) {
+	defer close(ss.done)
+
+	if interval <= 0 {
+		<-ss.stop
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ss.stop:
+			return
+		case <-ticker.C:
+			deleted, err := ss.Prune(context.Background())
+			if err != nil {
+				log.Printf("SQLite retention pruning failed: %v", err)
+				continue
+			}
+			if deleted > 0 {
+				log.Printf("Pruned %d SQLite records older than %s", deleted, ss.Retention())
+			}
+		}
+	}
+}
+
+// HealthCheck verifies the database can be queried
+func (ss *SQLiteStorage) HealthCheck(ctx context.Context) error {
+	_, err := ss.db.ExecContext(ctx, "SELECT 1")
+	return err
+}
+
+// Close stops pruning and closes the database
+func (ss *SQLiteStorage) Close() error {
+	ss.closeOnce.Do(func() {
+		close(ss.stop)
+		<-ss.done
+	})
+	return ss.db.Close()
+}
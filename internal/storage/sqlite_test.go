@@ -0,0 +1,224 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kal997/radius-accounting-server/internal/config"
+	"github.com/kal997/radius-accounting-server/internal/models"
+)
+
+// newTestSQLiteStorage opens a SQLite store in a temporary directory
+func newTestSQLiteStorage(t *testing.T, retentionDays string) (*SQLiteStorage, string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "accounting.db")
+
+	_ = os.Setenv("RADIUS_SHARED_SECRET", "testsecret123")
+	_ = os.Setenv("STORAGE_BACKEND", "sqlite")
+	_ = os.Setenv("SQLITE_PATH", path)
+	_ = os.Setenv("SQLITE_RETENTION_DAYS", retentionDays)
+	defer func() {
+		_ = os.Unsetenv("RADIUS_SHARED_SECRET")
+		_ = os.Unsetenv("STORAGE_BACKEND")
+		_ = os.Unsetenv("SQLITE_PATH")
+		_ = os.Unsetenv("SQLITE_RETENTION_DAYS")
+	}()
+
+	cfg, err := config.LoadControlplane("", nil)
+	require.NoError(t, err)
+
+	store, err := NewSQLiteStorage(cfg)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = store.Close()
+	})
+
+	return store, path
+}
+
+func testBase(timestamp time.Time) models.BaseAccountingRecord {
+	return models.BaseAccountingRecord{
+		Username:         "testuser",
+		NASIPAddress:     "192.168.1.1",
+		NASPort:          1,
+		AcctSessionID:    "session123",
+		CallingStationID: "00-11-22-33-44-55",
+		CalledStationID:  "66-77-88-99-AA-BB",
+		ClientIP:         "10.0.0.1",
+		Timestamp:        timestamp.UTC().Format(time.RFC3339Nano),
+	}
+}
+
+func TestNewSQLiteStorage_Success(t *testing.T) {
+	store, path := newTestSQLiteStorage(t, "0")
+
+	assert.NoError(t, store.HealthCheck(context.Background()))
+	assert.Zero(t, store.Retention())
+
+	var journalMode string
+	require.NoError(t, store.db.QueryRow("PRAGMA journal_mode").Scan(&journalMode))
+	assert.Equal(t, "wal", journalMode)
+
+	var version int
+	require.NoError(t, store.db.QueryRow("PRAGMA user_version").Scan(&version))
+	assert.Equal(t, len(sqliteMigrations), version)
+
+	// Reopening an up-to-date database applies no migration
+	db, err := openSQLite(path)
+	require.NoError(t, err)
+	assert.NoError(t, db.Close())
+}
+
+func TestNewSQLiteStorage_NewerSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "accounting.db")
+
+	db, err := sql.Open("sqlite3", path)
+	require.NoError(t, err)
+	_, err = db.Exec("PRAGMA user_version = 99")
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	db, err = openSQLite(path)
+
+	assert.Nil(t, db)
+	assert.ErrorContains(t, err, "SQLite schema version 99 is newer than supported version")
+}
+
+func TestSQLiteStorage_Store_Session(t *testing.T) {
+	store, _ := newTestSQLiteStorage(t, "0")
+	ctx := context.Background()
+	now := time.Now()
+
+	records := []models.AccountingEvent{
+		&models.StartRecord{BaseAccountingRecord: testBase(now), FramedIPAddress: "10.10.0.5"},
+		&models.InterimRecord{BaseAccountingRecord: testBase(now.Add(time.Minute)), SessionTime: 60, InputOctets: 100, OutputOctets: 200},
+		&models.StopRecord{BaseAccountingRecord: testBase(now.Add(2 * time.Minute)), SessionTime: 120, TerminateCause: "1", InputOctets: 300, OutputOctets: 400},
+	}
+	for _, record := range records {
+		require.NoError(t, store.Store(ctx, record))
+	}
+
+	// Storing a record again is ignored
+	require.NoError(t, store.Store(ctx, records[0]))
+
+	var count int
+	require.NoError(t, store.db.QueryRow("SELECT COUNT(*) FROM records WHERE username = ?", "testuser").Scan(&count))
+	assert.Equal(t, 3, count)
+
+	var recordType, data string
+	require.NoError(t, store.db.QueryRow("SELECT record_type, data FROM records WHERE record_key = ?", records[2].GenerateRedisKey()).Scan(&recordType, &data))
+	assert.Equal(t, "stop", recordType)
+	assert.Contains(t, data, `"terminate_cause":"1"`)
+
+	var (
+		framedIP                 string
+		sessionTime, inputOctets int64
+		startedAt, stoppedAt     sql.NullInt64
+		terminateCause           sql.NullString
+	)
+	require.NoError(t, store.db.QueryRow(`
+		SELECT framed_ip_address, session_time, input_octets, terminate_cause, started_at, stopped_at
+		FROM sessions WHERE acct_session_id = ? AND nas_ip_address = ?`, "session123", "192.168.1.1",
+	).Scan(&framedIP, &sessionTime, &inputOctets, &terminateCause, &startedAt, &stoppedAt))
+
+	assert.Equal(t, "10.10.0.5", framedIP)
+	assert.Equal(t, int64(120), sessionTime)
+	assert.Equal(t, int64(300), inputOctets)
+	assert.Equal(t, "1", terminateCause.String)
+	assert.True(t, startedAt.Valid)
+	assert.True(t, stoppedAt.Valid)
+}
+
+func TestSQLiteStorage_Store_OutOfOrderInterim(t *testing.T) {
+	store, _ := newTestSQLiteStorage(t, "0")
+	ctx := context.Background()
+	now := time.Now()
+
+	require.NoError(t, store.Store(ctx, &models.InterimRecord{BaseAccountingRecord: testBase(now.Add(2 * time.Minute)), SessionTime: 120, InputOctets: 500}))
+	require.NoError(t, store.Store(ctx, &models.InterimRecord{BaseAccountingRecord: testBase(now.Add(time.Minute)), SessionTime: 60, InputOctets: 100}))
+
+	var sessionTime, inputOctets int64
+	require.NoError(t, store.db.QueryRow("SELECT session_time, input_octets FROM sessions").Scan(&sessionTime, &inputOctets))
+	assert.Equal(t, int64(120), sessionTime)
+	assert.Equal(t, int64(500), inputOctets)
+}
+
+func TestSQLiteStorage_Store_InvalidRecord(t *testing.T) {
+	store, _ := newTestSQLiteStorage(t, "0")
+	ctx := context.Background()
+
+	err := store.Store(ctx, nil)
+	assert.EqualError(t, err, "unsupported record type <nil>")
+
+	base := testBase(time.Now())
+	base.Timestamp = "yesterday"
+	err = store.Store(ctx, &models.StartRecord{BaseAccountingRecord: base})
+	assert.ErrorContains(t, err, `invalid record timestamp "yesterday"`)
+}
+
+func TestSQLiteStorage_Prune(t *testing.T) {
+	store, _ := newTestSQLiteStorage(t, "7")
+	ctx := context.Background()
+	assert.Equal(t, 7*24*time.Hour, store.Retention())
+
+	old := testBase(time.Now().Add(-10 * 24 * time.Hour))
+	old.AcctSessionID = "old-session"
+	require.NoError(t, store.Store(ctx, &models.StartRecord{BaseAccountingRecord: old, FramedIPAddress: "10.10.0.5"}))
+	require.NoError(t, store.Store(ctx, &models.StartRecord{BaseAccountingRecord: testBase(time.Now()), FramedIPAddress: "10.10.0.6"}))
+
+	deleted, err := store.Prune(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+
+	var sessions int
+	require.NoError(t, store.db.QueryRow("SELECT COUNT(*) FROM sessions").Scan(&sessions))
+	assert.Equal(t, 1, sessions)
+
+	// A zero retention keeps everything
+	store.SetRetention(0)
+	require.NoError(t, store.Store(ctx, &models.StartRecord{BaseAccountingRecord: old, FramedIPAddress: "10.10.0.5"}))
+
+	deleted, err = store.Prune(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, deleted)
+}
+
+func TestSQLiteStorage_Close(t *testing.T) {
+	store, _ := newTestSQLiteStorage(t, "0")
+
+	require.NoError(t, store.Close())
+	assert.Error(t, store.HealthCheck(context.Background()))
+}
+
+func TestNew_SelectsBackend(t *testing.T) {
+	store, path := newTestSQLiteStorage(t, "0")
+	require.NoError(t, store.Close())
+
+	_ = os.Setenv("RADIUS_SHARED_SECRET", "testsecret123")
+	_ = os.Setenv("STORAGE_BACKEND", "sqlite")
+	_ = os.Setenv("SQLITE_PATH", path)
+	defer func() {
+		_ = os.Unsetenv("RADIUS_SHARED_SECRET")
+		_ = os.Unsetenv("STORAGE_BACKEND")
+		_ = os.Unsetenv("SQLITE_PATH")
+	}()
+
+	cfg, err := config.LoadControlplane("", nil)
+	require.NoError(t, err)
+
+	selected, err := New(cfg)
+	require.NoError(t, err)
+	defer func() {
+		_ = selected.Close()
+	}()
+
+	assert.IsType(t, &SQLiteStorage{}, selected)
+}
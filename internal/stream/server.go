@@ -0,0 +1,279 @@
+// Package stream serves RADIUS over stream transports: RADIUS over TCP
+// (RFC 6613) and RADIUS over TLS (RFC 6614). Packets follow each other on the
+// connection and are framed by the Length field of their header; responses
+// go back on the connection they were received on.
+package stream
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"layeh.com/radius"
+)
+
+// headerLength is the size of the RADIUS header: code, identifier, length
+// and authenticator
+const headerLength = 20
+
+// handshakeTimeout bounds the TLS handshake of a new connection
+const handshakeTimeout = 10 * time.Second
+
+// ErrServerClosed is returned by Serve after Shutdown
+var ErrServerClosed = errors.New("stream: server closed")
+
+// errTooManyConnections rejects connections beyond MaxConnections
+var errTooManyConnections = errors.New("too many connections")
+
+// Server serves RADIUS requests received on stream connections
+type Server struct {
+	// Handler processes every request
+	Handler radius.Handler
+
+	// SecretSource returns the secret of the requests of a connection
+	SecretSource radius.SecretSource
+
+	// ConnContext, when set, returns the context of the requests of a
+	// connection once any TLS handshake is complete. An error closes the
+	// connection.
+	ConnContext func(ctx context.Context, conn net.Conn) (context.Context, error)
+
+	// IdleTimeout closes connections on which no packet arrives for this
+	// long; zero keeps them open
+	IdleTimeout time.Duration
+
+	// MaxConnections limits the open connections, closing further ones as
+	// soon as they are accepted; zero is unlimited
+	MaxConnections int
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+// Serve accepts connections on l until Shutdown is called
+func (s *Server) Serve(l net.Listener) error {
+	if s.Handler == nil || s.SecretSource == nil {
+		return errors.New("stream: Handler and SecretSource are required")
+	}
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrServerClosed
+	}
+	if s.listeners == nil {
+		s.listeners = make(map[net.Listener]struct{})
+		s.conns = make(map[net.Conn]struct{})
+	}
+	s.listeners[l] = struct{}{}
+	s.mu.Unlock()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			delete(s.listeners, l)
+			s.mu.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			return err
+		}
+
+		if err := s.track(conn); err != nil {
+			_ = conn.Close()
+			if errors.Is(err, ErrServerClosed) {
+				return err
+			}
+			log.Printf("Rejected connection from %s: %v", conn.RemoteAddr(), err)
+			continue
+		}
+		go s.serveConn(conn)
+	}
+}
+
+// Shutdown stops accepting connections, closes the open ones and waits for
+// their requests to be handled or for ctx to be done
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.closed = true
+	for l := range s.listeners {
+		_ = l.Close()
+	}
+	for conn := range s.conns {
+		_ = conn.Close()
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// track registers an accepted connection, unless the server is shut down
+// or has MaxConnections open
+func (s *Server) track(conn net.Conn) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrServerClosed
+	}
+	if s.MaxConnections > 0 && len(s.conns) >= s.MaxConnections {
+		return errTooManyConnections
+	}
+	s.conns[conn] = struct{}{}
+	s.wg.Add(1)
+	return nil
+}
+
+func (s *Server) untrack(conn net.Conn) {
+	s.mu.Lock()
+	delete(s.conns, conn)
+	s.mu.Unlock()
+	s.wg.Done()
+}
+
+// serveConn reads the packets of a connection and handles each of them
+// concurrently, until the peer closes it or sends a malformed packet
+func (s *Server) serveConn(conn net.Conn) {
+	defer s.untrack(conn)
+	defer conn.Close()
+
+	ctx := context.Background()
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		handshakeCtx, cancel := context.WithTimeout(ctx, handshakeTimeout)
+		err := tlsConn.HandshakeContext(handshakeCtx)
+		cancel()
+		if err != nil {
+			log.Printf("TLS handshake with %s failed: %v", conn.RemoteAddr(), err)
+			return
+		}
+	}
+	if s.ConnContext != nil {
+		var err error
+		if ctx, err = s.ConnContext(ctx, conn); err != nil {
+			log.Printf("Rejected connection from %s: %v", conn.RemoteAddr(), err)
+			return
+		}
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	secret, err := s.SecretSource.RADIUSSecret(ctx, conn.RemoteAddr())
+	if err != nil || len(secret) == 0 {
+		log.Printf("No secret for connection from %s: %v", conn.RemoteAddr(), err)
+		return
+	}
+
+	w := &responseWriter{conn: conn}
+	var handlers sync.WaitGroup
+	defer handlers.Wait()
+
+	reader := bufio.NewReader(conn)
+	for {
+		if s.IdleTimeout > 0 {
+			if err := conn.SetReadDeadline(time.Now().Add(s.IdleTimeout)); err != nil {
+				return
+			}
+		}
+		buf, err := ReadPacket(reader)
+		switch {
+		case err == nil:
+		case errors.Is(err, os.ErrDeadlineExceeded):
+			log.Printf("Closing idle connection from %s", conn.RemoteAddr())
+			return
+		case errors.Is(err, io.EOF), errors.Is(err, net.ErrClosed):
+			return
+		default:
+			log.Printf("Closing connection from %s: %v", conn.RemoteAddr(), err)
+			return
+		}
+
+		if !radius.IsAuthenticRequest(buf, secret) {
+			log.Printf("Dropped packet from %s: bad authenticator", conn.RemoteAddr())
+			continue
+		}
+		packet, err := radius.Parse(buf, secret)
+		if err != nil {
+			log.Printf("Closing connection from %s: %v", conn.RemoteAddr(), err)
+			return
+		}
+
+		request := (&radius.Request{
+			LocalAddr:  conn.LocalAddr(),
+			RemoteAddr: conn.RemoteAddr(),
+			Packet:     packet,
+		}).WithContext(ctx)
+
+		handlers.Add(1)
+		go func() {
+			defer handlers.Done()
+			s.Handler.ServeRADIUS(w, request)
+		}()
+	}
+}
+
+// ReadPacket reads the next packet of a connection, framed by the Length
+// field of its header. A length outside the limits of RFC 2865 is an error,
+// after which the stream cannot be resynchronised.
+func ReadPacket(r io.Reader) ([]byte, error) {
+	header := make([]byte, headerLength)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+
+	length := int(binary.BigEndian.Uint16(header[2:4]))
+	if length < headerLength || length > radius.MaxPacketLength {
+		return nil, fmt.Errorf("invalid packet length %d", length)
+	}
+
+	buf := make([]byte, length)
+	copy(buf, header)
+	if _, err := io.ReadFull(r, buf[headerLength:]); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return buf, nil
+}
+
+// responseWriter writes responses to the connection of their request, one
+// at a time so that concurrent handlers do not interleave them
+type responseWriter struct {
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func (w *responseWriter) Write(packet *radius.Packet) error {
+	encoded, err := packet.Encode()
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_, err = w.conn.Write(encoded)
+	return err
+}
@@ -0,0 +1,211 @@
+package stream
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"layeh.com/radius"
+	"layeh.com/radius/rfc2866"
+)
+
+var secret = []byte("testing123")
+
+// serve answers accounting requests on a loopback listener
+func serve(t *testing.T, server *Server) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() { _ = server.Serve(l) }()
+	t.Cleanup(func() { _ = server.Shutdown(context.Background()) })
+	return l.Addr().String()
+}
+
+func echoServer() *Server {
+	return &Server{
+		SecretSource: radius.StaticSecretSource(secret),
+		Handler: radius.HandlerFunc(func(w radius.ResponseWriter, r *radius.Request) {
+			_ = w.Write(r.Response(radius.CodeAccountingResponse))
+		}),
+	}
+}
+
+func encode(t *testing.T, identifier byte, sessionID string) []byte {
+	t.Helper()
+
+	packet := radius.New(radius.CodeAccountingRequest, secret)
+	packet.Identifier = identifier
+	require.NoError(t, rfc2866.AcctSessionID_SetString(packet, sessionID))
+	encoded, err := packet.Encode()
+	require.NoError(t, err)
+	return encoded
+}
+
+func TestServer(t *testing.T) {
+	addr := serve(t, echoServer())
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, conn.SetDeadline(time.Now().Add(5*time.Second)))
+
+	// Several packets in one segment, and one split across segments
+	first, second, third := encode(t, 1, "a"), encode(t, 2, "b"), encode(t, 3, "c")
+	_, err = conn.Write(append(first, second...))
+	require.NoError(t, err)
+	_, err = conn.Write(third[:7])
+	require.NoError(t, err)
+	time.Sleep(10 * time.Millisecond)
+	_, err = conn.Write(third[7:])
+	require.NoError(t, err)
+
+	requests := map[byte][]byte{1: first, 2: second, 3: third}
+	for range requests {
+		buf, err := ReadPacket(conn)
+		require.NoError(t, err)
+		response, err := radius.Parse(buf, secret)
+		require.NoError(t, err)
+		assert.Equal(t, radius.CodeAccountingResponse, response.Code)
+
+		request, ok := requests[response.Identifier]
+		require.True(t, ok, "unexpected identifier %d", response.Identifier)
+		assert.True(t, radius.IsAuthenticResponse(buf, request, secret))
+		delete(requests, response.Identifier)
+	}
+}
+
+func TestServer_BadAuthenticator(t *testing.T) {
+	addr := serve(t, echoServer())
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, conn.SetDeadline(time.Now().Add(5*time.Second)))
+
+	forged := encode(t, 1, "a")
+	forged[4] ^= 0xff
+	_, err = conn.Write(append(forged, encode(t, 2, "b")...))
+	require.NoError(t, err)
+
+	// The forged packet is dropped and the connection kept
+	buf, err := ReadPacket(conn)
+	require.NoError(t, err)
+	assert.Equal(t, byte(2), buf[1])
+}
+
+func TestServer_InvalidLength(t *testing.T) {
+	addr := serve(t, echoServer())
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, conn.SetDeadline(time.Now().Add(5*time.Second)))
+
+	packet := encode(t, 1, "a")
+	packet[2], packet[3] = 0, 19
+	_, err = conn.Write(packet)
+	require.NoError(t, err)
+
+	// The stream cannot be resynchronised, so the connection is closed
+	_, err = ReadPacket(conn)
+	assert.Error(t, err)
+}
+
+func TestServer_ConnContext(t *testing.T) {
+	server := echoServer()
+	server.ConnContext = func(ctx context.Context, conn net.Conn) (context.Context, error) {
+		return nil, assert.AnError
+	}
+	addr := serve(t, server)
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, conn.SetDeadline(time.Now().Add(5*time.Second)))
+
+	_, _ = conn.Write(encode(t, 1, "a"))
+	_, err = ReadPacket(conn)
+	assert.Error(t, err)
+}
+
+func TestServer_IdleTimeout(t *testing.T) {
+	server := echoServer()
+	server.IdleTimeout = 100 * time.Millisecond
+	addr := serve(t, server)
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, conn.SetDeadline(time.Now().Add(5*time.Second)))
+
+	// Each request restarts the timeout
+	for i := byte(1); i <= 3; i++ {
+		time.Sleep(60 * time.Millisecond)
+		_, err = conn.Write(encode(t, i, "a"))
+		require.NoError(t, err)
+		_, err = ReadPacket(conn)
+		require.NoError(t, err)
+	}
+
+	start := time.Now()
+	_, err = ReadPacket(conn)
+	assert.ErrorIs(t, err, io.EOF)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestServer_MaxConnections(t *testing.T) {
+	server := echoServer()
+	server.MaxConnections = 1
+	addr := serve(t, server)
+
+	first, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer first.Close()
+	require.NoError(t, first.SetDeadline(time.Now().Add(5*time.Second)))
+	_, err = first.Write(encode(t, 1, "a"))
+	require.NoError(t, err)
+	_, err = ReadPacket(first)
+	require.NoError(t, err)
+
+	// A second connection is closed while the first is open
+	second, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	require.NoError(t, second.SetDeadline(time.Now().Add(5*time.Second)))
+	_, _ = second.Write(encode(t, 1, "b"))
+	_, err = ReadPacket(second)
+	assert.Error(t, err)
+	_ = second.Close()
+
+	// and accepted again once the first is closed
+	require.NoError(t, first.Close())
+	require.Eventually(t, func() bool {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			return false
+		}
+		defer conn.Close()
+		_ = conn.SetDeadline(time.Now().Add(time.Second))
+		if _, err := conn.Write(encode(t, 1, "c")); err != nil {
+			return false
+		}
+		_, err = ReadPacket(conn)
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestReadPacket(t *testing.T) {
+	packet := encode(t, 1, "a")
+
+	buf, err := ReadPacket(bytes.NewReader(packet))
+	require.NoError(t, err)
+	assert.Equal(t, packet, buf)
+
+	_, err = ReadPacket(bytes.NewReader(packet[:len(packet)-1]))
+	assert.ErrorContains(t, err, "unexpected EOF")
+
+	long := append([]byte(nil), packet...)
+	long[2], long[3] = 0x10, 0x01
+	_, err = ReadPacket(bytes.NewReader(long))
+	assert.EqualError(t, err, "invalid packet length 4097")
+}
@@ -0,0 +1,113 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kal997/radius-accounting-server/internal/config"
+	"github.com/kal997/radius-accounting-server/internal/models"
+	"github.com/kal997/radius-accounting-server/internal/storage"
+)
+
+// Runs against the postgres service of docker-compose.integration.yml
+func TestPostgresStorage_Integration(t *testing.T) {
+	dsn := os.Getenv("POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("POSTGRES_DSN not set")
+	}
+
+	_ = os.Setenv("STORAGE_BACKEND", "postgres")
+	defer func() {
+		_ = os.Unsetenv("STORAGE_BACKEND")
+	}()
+
+	cfg, err := config.LoadControlplane("", nil)
+	if err != nil {
+		t.Skipf("Config not available: %v", err)
+	}
+
+	store, err := storage.NewPostgresStorage(cfg)
+	if err != nil {
+		t.Skipf("PostgreSQL not available: %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	require.NoError(t, store.HealthCheck(ctx))
+
+	// Unique per run so repeated runs do not see each other's sessions
+	sessionID := "pg-session-" + time.Now().Format("150405.000000")
+	base := func(offset time.Duration) models.BaseAccountingRecord {
+		return models.BaseAccountingRecord{
+			Username:      "pguser",
+			AcctSessionID: sessionID,
+			NASIPAddress:  "127.0.0.1",
+			ClientIP:      "192.168.1.10",
+			Timestamp:     time.Now().Add(offset).UTC().Format(time.RFC3339Nano),
+		}
+	}
+
+	start := &models.StartRecord{BaseAccountingRecord: base(0), FramedIPAddress: "10.0.0.5"}
+	require.NoError(t, store.Store(ctx, start))
+
+	// Concurrent writes are grouped into batches
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 1; i <= 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- store.Store(ctx, &models.InterimRecord{
+				BaseAccountingRecord: base(time.Duration(i) * time.Second),
+				SessionTime:          i * 60,
+				InputOctets:          uint64(i * 1000),
+			})
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		assert.NoError(t, err)
+	}
+
+	stop := &models.StopRecord{BaseAccountingRecord: base(time.Minute), SessionTime: 1500, TerminateCause: "1", InputOctets: 25000}
+	require.NoError(t, store.Store(ctx, stop))
+
+	// Duplicates are ignored
+	require.NoError(t, store.Store(ctx, start))
+
+	conn, err := pgx.Connect(ctx, dsn)
+	require.NoError(t, err)
+	defer conn.Close(ctx)
+
+	var records int
+	require.NoError(t, conn.QueryRow(ctx, "SELECT COUNT(*) FROM accounting_records WHERE acct_session_id = $1", sessionID).Scan(&records))
+	assert.Equal(t, 22, records)
+
+	var (
+		recordCount, sessionTime, inputOctets int64
+		framedIP, terminateCause              string
+		stoppedAt                             *time.Time
+	)
+	require.NoError(t, conn.QueryRow(ctx, `
+		SELECT record_count, session_time, input_octets, framed_ip_address, terminate_cause, stopped_at
+		FROM accounting_sessions WHERE acct_session_id = $1`, sessionID,
+	).Scan(&recordCount, &sessionTime, &inputOctets, &framedIP, &terminateCause, &stoppedAt))
+
+	assert.Equal(t, int64(22), recordCount)
+	assert.Equal(t, int64(1500), sessionTime)
+	assert.Equal(t, int64(25000), inputOctets)
+	assert.Equal(t, "10.0.0.5", framedIP)
+	assert.Equal(t, "1", terminateCause)
+	assert.NotNil(t, stoppedAt)
+}
@@ -12,22 +12,23 @@ import (
 	"github.com/kal997/radius-accounting-server/internal/models"
 	"github.com/kal997/radius-accounting-server/internal/storage"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // internal/storage/integration_test.go
 func TestRedisStorage_Integration(t *testing.T) {
 	// Load real config from environment
-	cfg, err := config.LoadFromEnv()
+	cfg, err := config.LoadControlplane("", nil)
 	if err != nil {
 		t.Skipf("Config not available: %v", err)
 	}
 
 	// Create storage
-	storage, err := storage.NewRedisStorage(cfg)
+	store, err := storage.NewRedisStorage(cfg)
 	if err != nil {
 		t.Skipf("Redis not available: %v", err)
 	}
-	defer storage.Close()
+	defer store.Close()
 
 	// Create start test record
 	record := &models.StartRecord{
@@ -43,6 +44,11 @@ func TestRedisStorage_Integration(t *testing.T) {
 
 	// Test store
 	ctx := context.Background()
-	err = storage.Store(ctx, record)
+	err = store.Store(ctx, record)
 	assert.NoError(t, err)
+
+	// Test query through the secondary indexes
+	result, err := store.Query(ctx, storage.Query{FramedIPAddress: "10.0.0.5", From: time.Now().Add(-time.Minute)})
+	require.NoError(t, err)
+	assert.Contains(t, result.Records, models.AccountingEvent(record))
 }